@@ -0,0 +1,611 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/square/certstrap/pkix"
+)
+
+var dnsLabelRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+func (s *Server) handleDirectory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeProblem(w, http.StatusMethodNotAllowed, errMalformed, "directory must be requested with GET")
+		return
+	}
+	base := baseURL(r)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"newNonce":   base + "/new-nonce",
+		"newAccount": base + "/new-account",
+		"newOrder":   base + "/new-order",
+		"meta":       map[string]interface{}{},
+	})
+}
+
+func (s *Server) handleNewNonce(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", s.newNonce())
+	w.Header().Set("Cache-Control", "no-store")
+	switch r.Method {
+	case http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD")
+		writeProblem(w, http.StatusMethodNotAllowed, errMalformed, "nonces must be requested with GET or HEAD")
+	}
+}
+
+func (s *Server) handleNewAccount(w http.ResponseWriter, r *http.Request) {
+	req := s.readRequest(w, r, true)
+	if req == nil {
+		return
+	}
+	var payload struct {
+		Contact            []string `json:"contact"`
+		OnlyReturnExisting bool     `json:"onlyReturnExisting"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil {
+		writeProblem(w, http.StatusBadRequest, errMalformed, "cannot parse account")
+		return
+	}
+	jwk, err := pkix.NewPublicJWK(req.key.Public)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, errMalformed, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	base := baseURL(r)
+	if acct, ok := s.accountsByKey[jwk.Kid]; ok {
+		w.Header().Set("Location", base+"/account/"+acct.id)
+		writeJSON(w, http.StatusOK, accountJSON(base, acct))
+		return
+	}
+	if payload.OnlyReturnExisting {
+		writeProblem(w, http.StatusBadRequest, errAccountDoesNotExist, "no account for this key")
+		return
+	}
+	acct := &account{id: randomID(), thumbprint: jwk.Kid, key: req.key, contact: payload.Contact}
+	s.accounts[acct.id] = acct
+	s.accountsByKey[acct.thumbprint] = acct
+	w.Header().Set("Location", base+"/account/"+acct.id)
+	writeJSON(w, http.StatusCreated, accountJSON(base, acct))
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request, id string) {
+	req := s.readRequest(w, r, false)
+	if req == nil {
+		return
+	}
+	if req.account.id != id {
+		writeProblem(w, http.StatusForbidden, errUnauthorized, "account does not belong to the requester")
+		return
+	}
+	var payload struct {
+		Contact []string `json:"contact"`
+	}
+	if !req.postAsGet() {
+		if err := json.Unmarshal(req.payload, &payload); err != nil {
+			writeProblem(w, http.StatusBadRequest, errMalformed, "cannot parse account")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if payload.Contact != nil {
+		req.account.contact = payload.Contact
+	}
+	writeJSON(w, http.StatusOK, accountJSON(baseURL(r), req.account))
+}
+
+func (s *Server) handleAccountOrders(w http.ResponseWriter, r *http.Request, id string) {
+	req := s.readRequest(w, r, false)
+	if req == nil {
+		return
+	}
+	if req.account.id != id {
+		writeProblem(w, http.StatusForbidden, errUnauthorized, "account does not belong to the requester")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	urls := []string{}
+	for _, orderID := range req.account.orderIDs {
+		urls = append(urls, baseURL(r)+"/order/"+orderID)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"orders": urls})
+}
+
+func (s *Server) handleNewOrder(w http.ResponseWriter, r *http.Request) {
+	req := s.readRequest(w, r, false)
+	if req == nil {
+		return
+	}
+	var payload struct {
+		Identifiers []identifier `json:"identifiers"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil {
+		writeProblem(w, http.StatusBadRequest, errMalformed, "cannot parse order")
+		return
+	}
+	if len(payload.Identifiers) == 0 {
+		writeProblem(w, http.StatusBadRequest, errMalformed, "order has no identifiers")
+		return
+	}
+
+	now := pkix.Now()
+	o := &order{
+		id:        randomID(),
+		accountID: req.account.id,
+		status:    statusPending,
+		expires:   now.Add(orderLifetime),
+	}
+	var authzs []*authorization
+	var challenges []*challenge
+	seen := map[string]bool{}
+	for _, id := range payload.Identifiers {
+		value, wildcard, authorized, p := s.checkIdentifier(id)
+		if p != nil {
+			writeProblemDocument(w, p)
+			return
+		}
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		o.identifiers = append(o.identifiers, identifier{Type: "dns", Value: value})
+
+		authz := &authorization{
+			id:         randomID(),
+			accountID:  req.account.id,
+			identifier: identifier{Type: "dns", Value: strings.TrimPrefix(value, "*.")},
+			wildcard:   wildcard,
+			status:     statusPending,
+			expires:    now.Add(authzLifetime),
+		}
+		if authorized {
+			authz.status = statusValid
+		} else {
+			chal := &challenge{
+				id:      randomID(),
+				authzID: authz.id,
+				typ:     challengeHTTP01,
+				token:   randomID(),
+				status:  statusPending,
+			}
+			authz.challengeIDs = []string{chal.id}
+			challenges = append(challenges, chal)
+		}
+		o.authzIDs = append(o.authzIDs, authz.id)
+		authzs = append(authzs, authz)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, authz := range authzs {
+		s.authorizations[authz.id] = authz
+	}
+	for _, chal := range challenges {
+		s.challenges[chal.id] = chal
+	}
+	s.orders[o.id] = o
+	req.account.orderIDs = append(req.account.orderIDs, o.id)
+	s.updateOrder(o)
+
+	base := baseURL(r)
+	w.Header().Set("Location", base+"/order/"+o.id)
+	writeJSON(w, http.StatusCreated, s.orderJSON(base, o))
+}
+
+// checkIdentifier validates an order identifier against the policy. It returns the normalized
+// identifier, whether it is a wildcard, and whether it is authorized without a challenge.
+func (s *Server) checkIdentifier(id identifier) (value string, wildcard, authorized bool, p *problem) {
+	if id.Type != "dns" {
+		return "", false, false, newProblem(http.StatusBadRequest, errUnsupportedIdentifier, fmt.Sprintf("unsupported identifier type %q", id.Type))
+	}
+	value = strings.ToLower(id.Value)
+	domain := value
+	if strings.HasPrefix(value, "*.") {
+		wildcard = true
+		domain = value[2:]
+	}
+	if !validDomain(domain) {
+		return "", false, false, newProblem(http.StatusBadRequest, errRejectedIdentifier, fmt.Sprintf("invalid domain name %q", id.Value))
+	}
+	if len(s.policy.AllowedDomains) > 0 && !pkix.WithinDomains(domain, s.policy.AllowedDomains) {
+		return "", false, false, newProblem(http.StatusForbidden, errRejectedIdentifier, fmt.Sprintf("policy forbids issuing for %q", id.Value))
+	}
+
+	authorized = s.policy.Mode == ModeTrustAll ||
+		(s.policy.Mode == ModePreAuthorized && pkix.WithinDomains(domain, s.policy.PreAuthorized))
+	if wildcard && !authorized {
+		return "", false, false, newProblem(http.StatusForbidden, errRejectedIdentifier, "wildcard identifiers cannot be validated with http-01")
+	}
+	return value, wildcard, authorized, nil
+}
+
+func validDomain(domain string) bool {
+	if len(domain) == 0 || len(domain) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if !dnsLabelRegexp.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// updateOrder moves a pending order to ready or invalid according to its authorizations,
+// and invalidates expired orders. s.mu must be held.
+func (s *Server) updateOrder(o *order) {
+	if (o.status == statusPending || o.status == statusReady) && pkix.Now().After(o.expires) {
+		o.status = statusInvalid
+		o.err = newProblem(http.StatusForbidden, errMalformed, "order expired")
+		return
+	}
+	if o.status != statusPending {
+		return
+	}
+	ready := true
+	for _, id := range o.authzIDs {
+		switch s.authorizations[id].status {
+		case statusValid:
+		case statusPending:
+			ready = false
+		default:
+			o.status = statusInvalid
+			o.err = newProblem(http.StatusForbidden, errUnauthorized, "an authorization of the order is not valid")
+			return
+		}
+	}
+	if ready {
+		o.status = statusReady
+	}
+}
+
+func (s *Server) handleOrder(w http.ResponseWriter, r *http.Request, id string) {
+	req := s.readRequest(w, r, false)
+	if req == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[id]
+	if !ok {
+		writeProblem(w, http.StatusNotFound, errMalformed, "no such order")
+		return
+	}
+	if o.accountID != req.account.id {
+		writeProblem(w, http.StatusForbidden, errUnauthorized, "order does not belong to the requester")
+		return
+	}
+	s.updateOrder(o)
+	writeJSON(w, http.StatusOK, s.orderJSON(baseURL(r), o))
+}
+
+func (s *Server) handleFinalize(w http.ResponseWriter, r *http.Request, id string) {
+	req := s.readRequest(w, r, false)
+	if req == nil {
+		return
+	}
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil {
+		writeProblem(w, http.StatusBadRequest, errMalformed, "cannot parse finalize request")
+		return
+	}
+
+	s.mu.Lock()
+	o, ok := s.orders[id]
+	if !ok {
+		s.mu.Unlock()
+		writeProblem(w, http.StatusNotFound, errMalformed, "no such order")
+		return
+	}
+	if o.accountID != req.account.id {
+		s.mu.Unlock()
+		writeProblem(w, http.StatusForbidden, errUnauthorized, "order does not belong to the requester")
+		return
+	}
+	s.updateOrder(o)
+	if o.status != statusReady {
+		s.mu.Unlock()
+		writeProblem(w, http.StatusForbidden, errOrderNotReady, "order is "+o.status)
+		return
+	}
+	csr, p := checkCSR(payload.CSR, o.identifiers)
+	if p != nil {
+		s.mu.Unlock()
+		writeProblemDocument(w, p)
+		return
+	}
+	o.status = statusProcessing
+	s.mu.Unlock()
+
+	chain, err := s.issuer.Issue(csr)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		o.status = statusInvalid
+		o.err = newProblem(http.StatusInternalServerError, errServerInternal, "cannot issue certificate")
+		writeProblem(w, http.StatusInternalServerError, errServerInternal, "cannot issue certificate: "+err.Error())
+		return
+	}
+	o.certID = randomID()
+	s.certificates[o.certID] = &certificate{accountID: o.accountID, chain: chain}
+	o.status = statusValid
+
+	base := baseURL(r)
+	w.Header().Set("Location", base+"/order/"+o.id)
+	writeJSON(w, http.StatusOK, s.orderJSON(base, o))
+}
+
+// checkCSR parses a base64url-encoded CSR and checks that it requests exactly the identifiers of an order
+func checkCSR(encoded string, identifiers []identifier) (*pkix.CertificateSigningRequest, *problem) {
+	der, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, errBadCSR, "cannot decode CSR")
+	}
+	csr := pkix.NewCertificateSigningRequestFromDER(der)
+	raw, err := csr.GetRawCertificateSigningRequest()
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, errBadCSR, "cannot parse CSR")
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, newProblem(http.StatusBadRequest, errBadCSR, "invalid CSR signature")
+	}
+	if len(raw.IPAddresses) > 0 || len(raw.URIs) > 0 || len(raw.EmailAddresses) > 0 {
+		return nil, newProblem(http.StatusBadRequest, errBadCSR, "CSR may only request DNS names")
+	}
+
+	requested := map[string]bool{}
+	for _, name := range raw.DNSNames {
+		requested[strings.ToLower(name)] = true
+	}
+	if cn := strings.ToLower(raw.Subject.CommonName); cn != "" {
+		requested[cn] = true
+	}
+	ordered := map[string]bool{}
+	for _, id := range identifiers {
+		ordered[id.Value] = true
+		if !requested[id.Value] {
+			return nil, newProblem(http.StatusBadRequest, errBadCSR, fmt.Sprintf("CSR does not request %q", id.Value))
+		}
+	}
+	for name := range requested {
+		if !ordered[name] {
+			return nil, newProblem(http.StatusBadRequest, errBadCSR, fmt.Sprintf("CSR requests %q which is not in the order", name))
+		}
+	}
+	return csr, nil
+}
+
+func (s *Server) handleAuthorization(w http.ResponseWriter, r *http.Request, id string) {
+	req := s.readRequest(w, r, false)
+	if req == nil {
+		return
+	}
+	var payload struct {
+		Status string `json:"status"`
+	}
+	if !req.postAsGet() {
+		if err := json.Unmarshal(req.payload, &payload); err != nil {
+			writeProblem(w, http.StatusBadRequest, errMalformed, "cannot parse authorization")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	authz, ok := s.authorizations[id]
+	if !ok {
+		writeProblem(w, http.StatusNotFound, errMalformed, "no such authorization")
+		return
+	}
+	if authz.accountID != req.account.id {
+		writeProblem(w, http.StatusForbidden, errUnauthorized, "authorization does not belong to the requester")
+		return
+	}
+	switch payload.Status {
+	case "":
+	case "deactivated":
+		authz.status = payload.Status
+	default:
+		writeProblem(w, http.StatusBadRequest, errMalformed, "authorizations can only be deactivated")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.authorizationJSON(baseURL(r), authz))
+}
+
+func (s *Server) handleChallenge(w http.ResponseWriter, r *http.Request, id string) {
+	req := s.readRequest(w, r, false)
+	if req == nil {
+		return
+	}
+
+	s.mu.Lock()
+	chal, ok := s.challenges[id]
+	if !ok {
+		s.mu.Unlock()
+		writeProblem(w, http.StatusNotFound, errMalformed, "no such challenge")
+		return
+	}
+	authz := s.authorizations[chal.authzID]
+	if authz.accountID != req.account.id {
+		s.mu.Unlock()
+		writeProblem(w, http.StatusForbidden, errUnauthorized, "challenge does not belong to the requester")
+		return
+	}
+	// A POST with a JSON object payload asks the server to validate a pending challenge
+	validate := !req.postAsGet() && chal.status == statusPending && authz.status == statusPending
+	if validate {
+		chal.status = statusProcessing
+	}
+	s.mu.Unlock()
+
+	if validate {
+		p := s.validateHTTP01(authz.identifier.Value, chal.token, req.account.thumbprint)
+
+		s.mu.Lock()
+		if p == nil {
+			chal.status = statusValid
+			chal.validated = pkix.Now()
+			authz.status = statusValid
+		} else {
+			chal.status = statusInvalid
+			chal.err = p
+			authz.status = statusInvalid
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	base := baseURL(r)
+	w.Header().Add("Link", fmt.Sprintf("<%s/authz/%s>;rel=\"up\"", base, authz.id))
+	writeJSON(w, http.StatusOK, challengeJSON(base, chal))
+}
+
+// validateHTTP01 fetches the key authorization for token from domain
+func (s *Server) validateHTTP01(domain, token, thumbprint string) *problem {
+	port := s.HTTPPort
+	if port == 0 {
+		port = 80
+	}
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	url := "http://" + net.JoinHostPort(domain, strconv.Itoa(port)) + HTTPChallengePath + token
+	res, err := client.Get(url)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, errConnection, fmt.Sprintf("fetching %s: %v", url, err))
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return newProblem(http.StatusForbidden, errIncorrectResponse, fmt.Sprintf("fetching %s: unexpected status %s", url, res.Status))
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1024))
+	if err != nil {
+		return newProblem(http.StatusBadRequest, errConnection, fmt.Sprintf("fetching %s: %v", url, err))
+	}
+	if string(bytes.TrimSpace(body)) != token+"."+thumbprint {
+		return newProblem(http.StatusForbidden, errIncorrectResponse, fmt.Sprintf("fetching %s: key authorization does not match", url))
+	}
+	return nil
+}
+
+func (s *Server) handleCertificate(w http.ResponseWriter, r *http.Request, id string) {
+	req := s.readRequest(w, r, false)
+	if req == nil {
+		return
+	}
+
+	s.mu.Lock()
+	crt, ok := s.certificates[id]
+	s.mu.Unlock()
+	if !ok {
+		writeProblem(w, http.StatusNotFound, errMalformed, "no such certificate")
+		return
+	}
+	if crt.accountID != req.account.id {
+		writeProblem(w, http.StatusForbidden, errUnauthorized, "certificate does not belong to the requester")
+		return
+	}
+
+	var buf bytes.Buffer
+	for _, c := range crt.chain {
+		b, err := c.Export()
+		if err != nil {
+			writeProblem(w, http.StatusInternalServerError, errServerInternal, "cannot encode certificate")
+			return
+		}
+		buf.Write(b)
+	}
+	w.Header().Set("Content-Type", pemCertificateChainMIMEType)
+	w.WriteHeader(http.StatusOK)
+	//nolint:errcheck
+	w.Write(buf.Bytes())
+}
+
+func accountJSON(base string, acct *account) interface{} {
+	return map[string]interface{}{
+		"status":  statusValid,
+		"contact": acct.contact,
+		"orders":  base + "/account/" + acct.id + "/orders",
+	}
+}
+
+func (s *Server) orderJSON(base string, o *order) interface{} {
+	authzs := []string{}
+	for _, id := range o.authzIDs {
+		authzs = append(authzs, base+"/authz/"+id)
+	}
+	v := map[string]interface{}{
+		"status":         o.status,
+		"expires":        o.expires.UTC().Format(time.RFC3339),
+		"identifiers":    o.identifiers,
+		"authorizations": authzs,
+		"finalize":       base + "/order/" + o.id + "/finalize",
+	}
+	if o.certID != "" {
+		v["certificate"] = base + "/certificate/" + o.certID
+	}
+	if o.err != nil {
+		v["error"] = o.err
+	}
+	return v
+}
+
+func (s *Server) authorizationJSON(base string, authz *authorization) interface{} {
+	challenges := []interface{}{}
+	for _, id := range authz.challengeIDs {
+		challenges = append(challenges, challengeJSON(base, s.challenges[id]))
+	}
+	v := map[string]interface{}{
+		"identifier": authz.identifier,
+		"status":     authz.status,
+		"expires":    authz.expires.UTC().Format(time.RFC3339),
+		"challenges": challenges,
+	}
+	if authz.wildcard {
+		v["wildcard"] = true
+	}
+	return v
+}
+
+func challengeJSON(base string, chal *challenge) interface{} {
+	v := map[string]interface{}{
+		"type":   chal.typ,
+		"url":    base + "/challenge/" + chal.id,
+		"token":  chal.token,
+		"status": chal.status,
+	}
+	if !chal.validated.IsZero() {
+		v["validated"] = chal.validated.UTC().Format(time.RFC3339)
+	}
+	if chal.err != nil {
+		v["error"] = chal.err
+	}
+	return v
+}
@@ -0,0 +1,176 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"mime"
+	"net/http"
+
+	"github.com/square/certstrap/pkix"
+)
+
+// jwsMessage is a JWS in flattened JSON serialization
+type jwsMessage struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+type jwsHeader struct {
+	Alg   string          `json:"alg"`
+	Nonce string          `json:"nonce"`
+	URL   string          `json:"url"`
+	JWK   json.RawMessage `json:"jwk"`
+	KID   string          `json:"kid"`
+}
+
+// request is an authenticated ACME request
+type request struct {
+	header  jwsHeader
+	payload []byte
+	// key signed the request, and is the account key for requests by an account
+	key *pkix.Key
+	// account made the request, nil for requests signed with a jwk
+	account *account
+}
+
+// postAsGet reports whether the request is a POST-as-GET, which has an empty payload
+func (r *request) postAsGet() bool {
+	return len(r.payload) == 0
+}
+
+// readRequest verifies the JWS body of an ACME request. Requests to create an account must
+// be signed with the key in the jwk header, and all others by an account identified by kid.
+// It writes a problem and returns nil if the request is not valid.
+func (s *Server) readRequest(w http.ResponseWriter, r *http.Request, newAccount bool) *request {
+	w.Header().Set("Replay-Nonce", s.newNonce())
+	w.Header().Set("Cache-Control", "no-store")
+
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != joseContentType {
+		writeProblem(w, http.StatusUnsupportedMediaType, errMalformed, "requests must have content type "+joseContentType)
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, errMalformed, "cannot read request body")
+		return nil
+	}
+	var msg jwsMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		writeProblem(w, http.StatusBadRequest, errMalformed, "request body is not a flattened JWS")
+		return nil
+	}
+	protected, err := base64.RawURLEncoding.DecodeString(msg.Protected)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, errMalformed, "cannot decode protected header")
+		return nil
+	}
+	req := &request{}
+	if err := json.Unmarshal(protected, &req.header); err != nil {
+		writeProblem(w, http.StatusBadRequest, errMalformed, "cannot parse protected header")
+		return nil
+	}
+	if req.payload, err = base64.RawURLEncoding.DecodeString(msg.Payload); err != nil {
+		writeProblem(w, http.StatusBadRequest, errMalformed, "cannot decode payload")
+		return nil
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, errMalformed, "cannot decode signature")
+		return nil
+	}
+
+	if !s.useNonce(req.header.Nonce) {
+		writeProblem(w, http.StatusBadRequest, errBadNonce, "invalid or reused nonce")
+		return nil
+	}
+	if req.header.URL != baseURL(r)+r.URL.Path {
+		writeProblem(w, http.StatusUnauthorized, errUnauthorized, "url header does not match the request")
+		return nil
+	}
+
+	switch {
+	case newAccount && len(req.header.JWK) > 0 && req.header.KID == "":
+		if req.key, err = pkix.NewKeyFromJWK(req.header.JWK); err != nil {
+			writeProblem(w, http.StatusBadRequest, errMalformed, "invalid jwk: "+err.Error())
+			return nil
+		}
+	case !newAccount && len(req.header.JWK) == 0 && req.header.KID != "":
+		prefix := baseURL(r) + "/account/"
+		s.mu.Lock()
+		if len(req.header.KID) > len(prefix) && req.header.KID[:len(prefix)] == prefix {
+			req.account = s.accounts[req.header.KID[len(prefix):]]
+		}
+		s.mu.Unlock()
+		if req.account == nil {
+			writeProblem(w, http.StatusBadRequest, errAccountDoesNotExist, "no account for kid")
+			return nil
+		}
+		req.key = req.account.key
+	case newAccount:
+		writeProblem(w, http.StatusBadRequest, errMalformed, "request must be signed with a jwk")
+		return nil
+	default:
+		writeProblem(w, http.StatusBadRequest, errMalformed, "request must be signed with the kid of an account")
+		return nil
+	}
+
+	if ok, supported := verifySignature(req.header.Alg, req.key.Public, []byte(msg.Protected+"."+msg.Payload), sig); !supported {
+		writeProblem(w, http.StatusBadRequest, errBadSignatureAlgorithm, "unsupported algorithm "+req.header.Alg)
+		return nil
+	} else if !ok {
+		writeProblem(w, http.StatusBadRequest, errMalformed, "invalid signature")
+		return nil
+	}
+	return req
+}
+
+// verifySignature checks a JWS signature, reporting whether the algorithm is supported for the key
+func verifySignature(alg string, pub crypto.PublicKey, input, sig []byte) (ok, supported bool) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			return false, false
+		}
+		digest := sha256.Sum256(input)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil, true
+	case *ecdsa.PublicKey:
+		var digest []byte
+		switch {
+		case alg == "ES256" && pub.Curve == elliptic.P256():
+			d := sha256.Sum256(input)
+			digest = d[:]
+		case alg == "ES384" && pub.Curve == elliptic.P384():
+			d := sha512.Sum384(input)
+			digest = d[:]
+		case alg == "ES512" && pub.Curve == elliptic.P521():
+			d := sha512.Sum512(input)
+			digest = d[:]
+		default:
+			return false, false
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false, true
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(pub, digest, r, s), true
+	case ed25519.PublicKey:
+		if alg != "EdDSA" {
+			return false, false
+		}
+		return ed25519.Verify(pub, input, sig), true
+	default:
+		return false, false
+	}
+}
@@ -0,0 +1,290 @@
+// Package acme implements a small ACME (RFC 8555) server that issues
+// certificates through a caller-provided Issuer.
+//
+// The server supports the http-01 challenge, and can also be configured to
+// authorize every identifier, or a list of pre-authorized domains, without a
+// challenge. All state is kept in memory, so accounts and orders are lost
+// when the server stops.
+package acme
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/square/certstrap/pkix"
+)
+
+// Mode selects how the server authorizes identifiers
+type Mode string
+
+const (
+	// ModeHTTP01 requires every identifier to be validated with the http-01 challenge
+	ModeHTTP01 Mode = "http-01"
+	// ModeTrustAll authorizes every allowed identifier without a challenge
+	ModeTrustAll Mode = "trust-all"
+	// ModePreAuthorized authorizes identifiers within Policy.PreAuthorized without a challenge,
+	// and validates the others with http-01
+	ModePreAuthorized Mode = "pre-authorized"
+)
+
+// Policy restricts the identifiers the server issues certificates for
+type Policy struct {
+	Mode Mode
+	// AllowedDomains limits identifiers to these domains and their subdomains.
+	// Every domain is allowed if empty.
+	AllowedDomains []string
+	// PreAuthorized lists the domains, including their subdomains, authorized
+	// without a challenge in ModePreAuthorized
+	PreAuthorized []string
+}
+
+// Issuer signs certificate requests whose identifiers the server has authorized
+type Issuer interface {
+	// Issue returns the certificate for csr followed by the chain of intermediates to serve with it
+	Issue(csr *pkix.CertificateSigningRequest) ([]*pkix.Certificate, error)
+}
+
+const (
+	// HTTPChallengePath is the path under which http-01 key authorizations are served
+	HTTPChallengePath = "/.well-known/acme-challenge/"
+
+	challengeHTTP01 = "http-01"
+
+	statusPending    = "pending"
+	statusProcessing = "processing"
+	statusReady      = "ready"
+	statusValid      = "valid"
+	statusInvalid    = "invalid"
+
+	orderLifetime = 24 * time.Hour
+	authzLifetime = 7 * 24 * time.Hour
+
+	maxNonces      = 10000
+	maxRequestSize = 64 << 10
+)
+
+type account struct {
+	id         string
+	thumbprint string
+	key        *pkix.Key
+	contact    []string
+	orderIDs   []string
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type order struct {
+	id          string
+	accountID   string
+	status      string
+	expires     time.Time
+	identifiers []identifier
+	authzIDs    []string
+	certID      string
+	err         *problem
+}
+
+type authorization struct {
+	id           string
+	accountID    string
+	identifier   identifier
+	wildcard     bool
+	status       string
+	expires      time.Time
+	challengeIDs []string
+}
+
+type challenge struct {
+	id        string
+	authzID   string
+	typ       string
+	token     string
+	status    string
+	validated time.Time
+	err       *problem
+}
+
+type certificate struct {
+	accountID string
+	chain     []*pkix.Certificate
+}
+
+// Server is an ACME server. It implements http.Handler and serves its directory at /directory.
+type Server struct {
+	issuer Issuer
+	policy Policy
+
+	// HTTPPort is the port http-01 challenges are validated on, 80 if zero
+	HTTPPort int
+	// HTTPClient fetches http-01 key authorizations, http.DefaultClient if nil
+	HTTPClient *http.Client
+
+	mu             sync.Mutex
+	nonces         map[string]bool
+	accounts       map[string]*account
+	accountsByKey  map[string]*account
+	orders         map[string]*order
+	authorizations map[string]*authorization
+	challenges     map[string]*challenge
+	certificates   map[string]*certificate
+}
+
+// NewServer creates an ACME server issuing certificates with issuer, subject to policy
+func NewServer(issuer Issuer, policy Policy) (*Server, error) {
+	switch policy.Mode {
+	case ModeHTTP01, ModeTrustAll, ModePreAuthorized:
+	default:
+		return nil, fmt.Errorf("unknown mode %q", policy.Mode)
+	}
+	return &Server{
+		issuer:         issuer,
+		policy:         policy,
+		nonces:         map[string]bool{},
+		accounts:       map[string]*account{},
+		accountsByKey:  map[string]*account{},
+		orders:         map[string]*order{},
+		authorizations: map[string]*authorization{},
+		challenges:     map[string]*challenge{},
+		certificates:   map[string]*certificate{},
+	}, nil
+}
+
+// ServeHTTP routes ACME requests
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Link", fmt.Sprintf("<%s/directory>;rel=\"index\"", baseURL(r)))
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "directory":
+		s.handleDirectory(w, r)
+	case len(parts) == 1 && parts[0] == "new-nonce":
+		s.handleNewNonce(w, r)
+	case r.Method != http.MethodPost:
+		w.Header().Set("Allow", http.MethodPost)
+		writeProblem(w, http.StatusMethodNotAllowed, errMalformed, "resources must be requested with POST")
+	case len(parts) == 1 && parts[0] == "new-account":
+		s.handleNewAccount(w, r)
+	case len(parts) == 1 && parts[0] == "new-order":
+		s.handleNewOrder(w, r)
+	case len(parts) == 2 && parts[0] == "account":
+		s.handleAccount(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "account" && parts[2] == "orders":
+		s.handleAccountOrders(w, r, parts[1])
+	case len(parts) == 2 && parts[0] == "order":
+		s.handleOrder(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "order" && parts[2] == "finalize":
+		s.handleFinalize(w, r, parts[1])
+	case len(parts) == 2 && parts[0] == "authz":
+		s.handleAuthorization(w, r, parts[1])
+	case len(parts) == 2 && parts[0] == "challenge":
+		s.handleChallenge(w, r, parts[1])
+	case len(parts) == 2 && parts[0] == "certificate":
+		s.handleCertificate(w, r, parts[1])
+	default:
+		writeProblem(w, http.StatusNotFound, errMalformed, "no such resource")
+	}
+}
+
+// baseURL returns the URL the server was reached at
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// newNonce creates a nonce for the Replay-Nonce header. The nonces are forgotten
+// in bulk once too many are outstanding, which makes clients retry with a new one.
+func (s *Server) newNonce() string {
+	nonce := randomID()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.nonces) >= maxNonces {
+		s.nonces = map[string]bool{}
+	}
+	s.nonces[nonce] = true
+	return nonce
+}
+
+// useNonce consumes a nonce, reporting whether it was valid
+func (s *Server) useNonce(nonce string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.nonces[nonce] {
+		return false
+	}
+	delete(s.nonces, nonce)
+	return true
+}
+
+// randomID returns a random URL-safe identifier
+func randomID() string {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(pkix.Random(), b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+const errNamespace = "urn:ietf:params:acme:error:"
+
+// ACME error types, relative to errNamespace
+const (
+	errAccountDoesNotExist   = "accountDoesNotExist"
+	errBadCSR                = "badCSR"
+	errBadNonce              = "badNonce"
+	errBadSignatureAlgorithm = "badSignatureAlgorithm"
+	errConnection            = "connection"
+	errIncorrectResponse     = "incorrectResponse"
+	errMalformed             = "malformed"
+	errOrderNotReady         = "orderNotReady"
+	errRejectedIdentifier    = "rejectedIdentifier"
+	errServerInternal        = "serverInternal"
+	errUnauthorized          = "unauthorized"
+	errUnsupportedIdentifier = "unsupportedIdentifier"
+)
+
+const (
+	problemContentType          = "application/problem+json"
+	joseContentType             = "application/jose+json"
+	pemCertificateChainMIMEType = "application/pem-certificate-chain"
+)
+
+// problem is an RFC 7807 problem document
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+func newProblem(status int, typ, detail string) *problem {
+	return &problem{Type: errNamespace + typ, Detail: detail, Status: status}
+}
+
+func writeProblem(w http.ResponseWriter, status int, typ, detail string) {
+	writeProblemDocument(w, newProblem(status, typ, detail))
+}
+
+func writeProblemDocument(w http.ResponseWriter, p *problem) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	//nolint:errcheck
+	json.NewEncoder(w).Encode(p)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	//nolint:errcheck
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,270 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	certpkix "github.com/square/certstrap/pkix"
+)
+
+// testIssuer signs certificate requests with a CA created for the test
+type testIssuer struct {
+	crt *certpkix.Certificate
+	key *certpkix.Key
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := certpkix.CreateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := certpkix.CreateCertificateAuthority(key, "", time.Now().Add(time.Hour), "", "", "", "", "ACME Test CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIssuer{crt: crt, key: key}
+}
+
+func (i *testIssuer) Issue(csr *certpkix.CertificateSigningRequest) ([]*certpkix.Certificate, error) {
+	crt, err := certpkix.CreateCertificateHost(i.crt, i.key, csr, time.Now().Add(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	return []*certpkix.Certificate{crt}, nil
+}
+
+func newTestClient(t *testing.T, policy Policy) (*acme.Client, *Server, *testIssuer) {
+	issuer := newTestIssuer(t)
+	server, err := NewServer(issuer, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &acme.Client{Key: key, DirectoryURL: srv.URL + "/directory"}
+	if _, err := client.Register(context.Background(), &acme.Account{}, acme.AcceptTOS); err != nil {
+		t.Fatalf("registering account: %v", err)
+	}
+	return client, server, issuer
+}
+
+func createCSR(t *testing.T, names ...string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: names[0]},
+		DNSNames: names,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// finishOrder finalizes a ready order and checks the issued certificate
+func finishOrder(t *testing.T, client *acme.Client, issuer *testIssuer, o *acme.Order, names ...string) {
+	ctx := context.Background()
+	o, err := client.WaitOrder(ctx, o.URI)
+	if err != nil {
+		t.Fatalf("waiting for order: %v", err)
+	}
+	ders, _, err := client.CreateOrderCert(ctx, o.FinalizeURL, createCSR(t, names...), true)
+	if err != nil {
+		t.Fatalf("finalizing order: %v", err)
+	}
+	if len(ders) != 1 {
+		t.Fatalf("got %d certificates, want 1", len(ders))
+	}
+	crt, err := x509.ParseCertificate(ders[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(crt.DNSNames, ",") != strings.Join(names, ",") {
+		t.Fatalf("certificate is for %v, want %v", crt.DNSNames, names)
+	}
+	ca, err := issuer.crt.GetRawCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crt.CheckSignatureFrom(ca); err != nil {
+		t.Fatalf("certificate is not signed by the CA: %v", err)
+	}
+}
+
+func TestHTTP01(t *testing.T) {
+	client, server, issuer := newTestClient(t, Policy{Mode: ModeHTTP01})
+	ctx := context.Background()
+
+	tokens := map[string]string{}
+	challengeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyAuth, ok := tokens[strings.TrimPrefix(r.URL.Path, HTTPChallengePath)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(keyAuth))
+	}))
+	defer challengeSrv.Close()
+	u, err := url.Parse(challengeSrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.HTTPPort, err = strconv.Atoi(u.Port()); err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := client.AuthorizeOrder(ctx, acme.DomainIDs("localhost"))
+	if err != nil {
+		t.Fatalf("creating order: %v", err)
+	}
+	if o.Status != acme.StatusPending {
+		t.Fatalf("order is %s, want pending", o.Status)
+	}
+	authz, err := client.GetAuthorization(ctx, o.AuthzURLs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "http-01" {
+			chal = c
+		}
+	}
+	if chal == nil {
+		t.Fatal("no http-01 challenge")
+	}
+
+	// Finalizing before the challenge is validated must fail
+	if _, _, err := client.CreateOrderCert(ctx, o.FinalizeURL, createCSR(t, "localhost"), true); !isProblem(err, errOrderNotReady) {
+		t.Fatalf("finalizing a pending order: got %v, want %s", err, errOrderNotReady)
+	}
+
+	if tokens[chal.Token], err = client.HTTP01ChallengeResponse(chal.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Accept(ctx, chal); err != nil {
+		t.Fatalf("accepting challenge: %v", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		t.Fatalf("waiting for authorization: %v", err)
+	}
+	finishOrder(t, client, issuer, o, "localhost")
+}
+
+func TestHTTP01IncorrectResponse(t *testing.T) {
+	client, server, _ := newTestClient(t, Policy{Mode: ModeHTTP01})
+	ctx := context.Background()
+
+	challengeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("wrong"))
+	}))
+	defer challengeSrv.Close()
+	u, _ := url.Parse(challengeSrv.URL)
+	server.HTTPPort, _ = strconv.Atoi(u.Port())
+
+	o, err := client.AuthorizeOrder(ctx, acme.DomainIDs("localhost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authz, err := client.GetAuthorization(ctx, o.AuthzURLs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Accept(ctx, authz.Challenges[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err == nil {
+		t.Fatal("authorization with an incorrect key authorization succeeded")
+	}
+	if _, err := client.WaitOrder(ctx, o.URI); err == nil {
+		t.Fatal("order with an invalid authorization succeeded")
+	}
+}
+
+func TestTrustAll(t *testing.T) {
+	client, _, issuer := newTestClient(t, Policy{Mode: ModeTrustAll, AllowedDomains: []string{"example.com"}})
+	ctx := context.Background()
+
+	o, err := client.AuthorizeOrder(ctx, acme.DomainIDs("www.example.com", "example.com"))
+	if err != nil {
+		t.Fatalf("creating order: %v", err)
+	}
+	if o.Status != acme.StatusReady {
+		t.Fatalf("order is %s, want ready", o.Status)
+	}
+	finishOrder(t, client, issuer, o, "www.example.com", "example.com")
+
+	if _, err := client.AuthorizeOrder(ctx, acme.DomainIDs("example.org")); !isProblem(err, errRejectedIdentifier) {
+		t.Fatalf("ordering a domain outside the policy: got %v, want %s", err, errRejectedIdentifier)
+	}
+}
+
+func TestPreAuthorized(t *testing.T) {
+	client, _, issuer := newTestClient(t, Policy{Mode: ModePreAuthorized, PreAuthorized: []string{"internal.test"}})
+	ctx := context.Background()
+
+	o, err := client.AuthorizeOrder(ctx, acme.DomainIDs("*.internal.test"))
+	if err != nil {
+		t.Fatalf("creating order: %v", err)
+	}
+	if o.Status != acme.StatusReady {
+		t.Fatalf("order is %s, want ready", o.Status)
+	}
+	finishOrder(t, client, issuer, o, "*.internal.test")
+
+	o, err = client.AuthorizeOrder(ctx, acme.DomainIDs("other.test"))
+	if err != nil {
+		t.Fatalf("creating order: %v", err)
+	}
+	if o.Status != acme.StatusPending {
+		t.Fatalf("order for a domain that is not pre-authorized is %s, want pending", o.Status)
+	}
+	if _, err := client.AuthorizeOrder(ctx, acme.DomainIDs("*.other.test")); !isProblem(err, errRejectedIdentifier) {
+		t.Fatalf("ordering a wildcard that needs a challenge: got %v, want %s", err, errRejectedIdentifier)
+	}
+}
+
+func TestFinalizeCSRMismatch(t *testing.T) {
+	client, _, _ := newTestClient(t, Policy{Mode: ModeTrustAll})
+	ctx := context.Background()
+
+	o, err := client.AuthorizeOrder(ctx, acme.DomainIDs("a.test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.CreateOrderCert(ctx, o.FinalizeURL, createCSR(t, "a.test", "b.test"), true); !isProblem(err, errBadCSR) {
+		t.Fatalf("finalizing with a CSR for other names: got %v, want %s", err, errBadCSR)
+	}
+}
+
+func TestNewServerUnknownMode(t *testing.T) {
+	if _, err := NewServer(newTestIssuer(t), Policy{Mode: "dns-01"}); err == nil {
+		t.Fatal("created a server with an unknown mode")
+	}
+}
+
+func isProblem(err error, typ string) bool {
+	var e *acme.Error
+	return errors.As(err, &e) && e.ProblemType == errNamespace+typ
+}
@@ -0,0 +1,201 @@
+// Package agent keeps short-lived certificates in a depot valid by renewing them once a
+// fraction of their lifetime has passed.
+//
+// Each certificate is renewed by signing the certificate request stored for it in the depot,
+// or a request made from its private key and current certificate if there is none. The new
+// certificate replaces the old one atomically under the depot lock, and a hook is run once per
+// renewal round so that servers can reload it.
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/pkix"
+)
+
+// DefaultFraction is the fraction of their lifetime after which certificates are renewed by default
+const DefaultFraction = 0.67
+
+// DefaultRetryInterval is how long to wait after a failed renewal by default
+const DefaultRetryInterval = time.Minute
+
+// Issuer issues certificates for certificate requests
+type Issuer interface {
+	// Issue returns the certificate signed for csr followed by the chain of its issuers
+	Issue(csr *pkix.CertificateSigningRequest) ([]*pkix.Certificate, error)
+}
+
+// Agent renews the certificates of a set of names in a depot
+type Agent struct {
+	d      *depot.FileDepot
+	names  []string
+	issuer Issuer
+
+	// Fraction of the lifetime of a certificate after which it is renewed
+	Fraction float64
+	// RetryInterval is how long Run waits after a failed renewal
+	RetryInterval time.Duration
+	// Chain also writes the certificate followed by the chain of its issuers to name.chain.pem
+	Chain bool
+	// Hook, if set, is called with the names whose certificates were renewed
+	Hook func(names []string) error
+	// Logf, if set, logs renewals and errors
+	Logf func(format string, args ...interface{})
+
+	now func() time.Time
+}
+
+// New creates an agent renewing the certificates of names in d with issuer
+func New(d *depot.FileDepot, names []string, issuer Issuer) *Agent {
+	return &Agent{
+		d:             d,
+		names:         names,
+		issuer:        issuer,
+		Fraction:      DefaultFraction,
+		RetryInterval: DefaultRetryInterval,
+		now:           pkix.Now,
+	}
+}
+
+// RenewAt returns when the certificate of name is due for renewal. It is the zero time
+// if the depot has no valid certificate for name.
+func (a *Agent) RenewAt(name string) time.Time {
+	crt, err := depot.GetCertificate(a.d, name)
+	if err != nil {
+		return time.Time{}
+	}
+	raw, err := crt.GetRawCertificate()
+	if err != nil {
+		return time.Time{}
+	}
+	lifetime := raw.NotAfter.Sub(raw.NotBefore)
+	return raw.NotBefore.Add(time.Duration(float64(lifetime) * a.Fraction))
+}
+
+// Renew issues a new certificate for name and replaces the one in the depot
+func (a *Agent) Renew(name string) (*pkix.Certificate, error) {
+	var csr *pkix.CertificateSigningRequest
+	var err error
+	if depot.CheckCertificateSigningRequest(a.d, name) {
+		csr, err = depot.GetCertificateSigningRequest(a.d, name)
+	} else {
+		csr, err = a.requestFromCertificate(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	crts, err := a.issuer.Issue(csr)
+	if err != nil {
+		return nil, err
+	}
+	if len(crts) == 0 {
+		return nil, errors.New("no certificate issued")
+	}
+
+	// The depot is only locked while files are replaced, since the issuer may lock it as well
+	unlock, err := a.d.Lock()
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer unlock()
+	if err := depot.ReplaceCertificate(a.d, name, crts[0]); err != nil {
+		return nil, err
+	}
+	if a.Chain {
+		if err := depot.ReplaceCertificateChain(a.d, name, crts); err != nil {
+			return nil, err
+		}
+	}
+	return crts[0], nil
+}
+
+// requestFromCertificate makes a request for the subject and names of the current certificate
+// of name with its private key, which must not be encrypted
+func (a *Agent) requestFromCertificate(name string) (*pkix.CertificateSigningRequest, error) {
+	crt, err := depot.GetCertificate(a.d, name)
+	if err != nil {
+		return nil, fmt.Errorf("no certificate request or certificate: %v", err)
+	}
+	key, err := depot.GetPrivateKey(a.d, name)
+	if err != nil {
+		return nil, fmt.Errorf("get private key: %v", err)
+	}
+	return pkix.CreateCertificateSigningRequestFromCertificate(key, crt)
+}
+
+// RenewDue renews the certificates which are due, then calls Hook if any was renewed. It
+// returns when the next certificate is due. Renewal continues with the other names when
+// one fails, and the last error is returned.
+func (a *Agent) RenewDue() (time.Time, error) {
+	var renewed []string
+	var next time.Time
+	var lastErr error
+	for _, name := range a.names {
+		renewAt := a.RenewAt(name)
+		if renewAt.After(a.now()) {
+			if next.IsZero() || renewAt.Before(next) {
+				next = renewAt
+			}
+			continue
+		}
+
+		crt, err := a.Renew(name)
+		if err != nil {
+			lastErr = fmt.Errorf("renew %s: %w", name, err)
+			a.logf("Renew %s error: %v", name, err)
+			continue
+		}
+		renewed = append(renewed, name)
+		raw, err := crt.GetRawCertificate()
+		if err != nil {
+			lastErr = fmt.Errorf("renew %s: %w", name, err)
+			continue
+		}
+		renewAt = a.RenewAt(name)
+		a.logf("Renewed %s, expires %s, next renewal at %s", name, raw.NotAfter.Format(time.RFC3339), renewAt.Format(time.RFC3339))
+		if next.IsZero() || renewAt.Before(next) {
+			next = renewAt
+		}
+	}
+
+	if len(renewed) > 0 && a.Hook != nil {
+		if err := a.Hook(renewed); err != nil {
+			lastErr = fmt.Errorf("hook: %w", err)
+			a.logf("Hook error: %v", err)
+		}
+	}
+	return next, lastErr
+}
+
+// Run renews certificates as they become due until ctx is done. Failed renewals are
+// retried after RetryInterval, as are certificates still due right after being renewed,
+// so that a lifetime too short for the clock skew of the issuer does not flood it.
+func (a *Agent) Run(ctx context.Context) error {
+	for {
+		next, err := a.RenewDue()
+		wait := a.RetryInterval
+		if untilNext := next.Sub(a.now()); !next.IsZero() && untilNext > 0 && (err == nil || untilNext < wait) {
+			wait = untilNext
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (a *Agent) logf(format string, args ...interface{}) {
+	if a.Logf != nil {
+		a.Logf(format, args...)
+	}
+}
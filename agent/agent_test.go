@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"context"
+	"crypto/elliptic"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/pkix"
+)
+
+type testIssuer struct {
+	crt    *pkix.Certificate
+	key    *pkix.Key
+	issued int
+	err    error
+}
+
+func (i *testIssuer) Issue(csr *pkix.CertificateSigningRequest) ([]*pkix.Certificate, error) {
+	if i.err != nil {
+		return nil, i.err
+	}
+	i.issued++
+	crt, err := pkix.CreateCertificateHost(i.crt, i.key, csr, time.Now().Add(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	return []*pkix.Certificate{crt, i.crt}, nil
+}
+
+func newTestAgent(t *testing.T) (*Agent, *testIssuer) {
+	dir, err := os.MkdirTemp("", "certstrap-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	d, err := depot.NewFileDepot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caKey, err := pkix.CreateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCrt, err := pkix.CreateCertificateAuthority(caKey, "", time.Now().Add(24*time.Hour), "", "", "", "", "Agent CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{crt: caCrt, key: caKey}
+
+	// web has a certificate request, db only a key and certificate
+	for _, name := range []string{"web", "db"} {
+		key, err := pkix.CreateECDSAKey(elliptic.P256())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := depot.PutPrivateKey(d, name, key); err != nil {
+			t.Fatal(err)
+		}
+		csr, err := pkix.CreateCertificateSigningRequest(key, "", nil, []string{name}, nil, "", "", "", "", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "web" {
+			if err := depot.PutCertificateSigningRequest(d, name, csr); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		crt, err := pkix.CreateCertificateHost(caCrt, caKey, csr, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := depot.PutCertificate(d, name, crt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return New(d, []string{"web", "db"}, issuer), issuer
+}
+
+func TestRenewDue(t *testing.T) {
+	a, issuer := newTestAgent(t)
+	var hooked [][]string
+	a.Hook = func(names []string) error {
+		hooked = append(hooked, names)
+		return nil
+	}
+
+	// web has no certificate yet, db is not due
+	next, err := a.RenewDue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issuer.issued != 1 || !reflect.DeepEqual(hooked, [][]string{{"web"}}) {
+		t.Fatalf("Issued %d certificates and hooked %v, want web only", issuer.issued, hooked)
+	}
+	if !depot.CheckCertificate(a.d, "web") {
+		t.Fatal("Certificate of web was not written")
+	}
+	// certificates are valid from 10 minutes ago until an hour from now
+	if d := time.Until(next); d < 35*time.Minute || d > 38*time.Minute {
+		t.Fatalf("Next renewal in %v, want about 37m", d)
+	}
+
+	if _, err := a.RenewDue(); err != nil || issuer.issued != 1 || len(hooked) != 1 {
+		t.Fatalf("Renewed certificates which are not due: %d issued, %v", issuer.issued, err)
+	}
+
+	a.now = func() time.Time { return time.Now().Add(40 * time.Minute) }
+	if _, err := a.RenewDue(); err != nil {
+		t.Fatal(err)
+	}
+	if issuer.issued != 3 || !reflect.DeepEqual(hooked[1], []string{"web", "db"}) {
+		t.Fatalf("Issued %d certificates and hooked %v, want web and db renewed", issuer.issued, hooked)
+	}
+}
+
+func TestRenewChain(t *testing.T) {
+	a, _ := newTestAgent(t)
+	a.Chain = true
+	crt, err := a.Renew("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := crt.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := a.issuer.(*testIssuer).crt.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The depot keeps only the certificate, the chain goes to its own file
+	data, err := a.d.Get(depot.CrtTag("web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(leaf) {
+		t.Fatal("Certificate file does not hold only the certificate")
+	}
+	data, err = a.d.Get(depot.ChainTag("web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(leaf)+string(ca) {
+		t.Fatal("Chain file does not hold the certificate followed by its chain")
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	a, issuer := newTestAgent(t)
+	issuer.err = errors.New("unavailable")
+	a.RetryInterval = 10 * time.Millisecond
+	var errs int
+	a.Logf = func(format string, args ...interface{}) { errs++ }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := a.Run(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Run returned %v", err)
+	}
+	if errs < 2 {
+		t.Fatalf("Failed renewal was attempted %d times, want retries", errs)
+	}
+}
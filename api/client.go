@@ -0,0 +1,70 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxResponseSize limits the responses read by Client
+const maxResponseSize = 1 << 20
+
+// Client makes requests to an API server
+type Client struct {
+	// URL is the base URL of the server, such as https://ca.example.com:8200
+	URL string
+	// Token is the bearer token of the client. It is not sent if empty, for clients
+	// authenticating with a TLS client certificate configured in HTTPClient.
+	Token string
+	// HTTPClient makes the requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// Sign requests a certificate for req.CSR
+func (c *Client) Sign(req SignRequest) (*SignResponse, error) {
+	var res SignResponse
+	if err := c.post("/v1/sign", req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) post(path string, body, v interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(c.URL, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err = io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		var e errorResponse
+		if json.Unmarshal(data, &e) != nil || e.Error == "" {
+			return fmt.Errorf("%s %s: %s", path, res.Status, bytes.TrimSpace(data))
+		}
+		return fmt.Errorf("%s %s: %s", path, res.Status, e.Error)
+	}
+	return json.Unmarshal(data, v)
+}
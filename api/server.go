@@ -0,0 +1,457 @@
+// Package api implements a JSON HTTP API to a certificate authority in a depot, so that
+// pipelines can request and revoke certificates remotely instead of copying the depot around.
+//
+// Clients authenticate with a bearer token, or with a TLS client certificate verified by the
+// HTTP server and not issued through the CA of the API, since clients can request certificates
+// with any common name from it. Each token and client certificate has a Policy limiting what it may do. The CRL
+// and the certificate chain of the CA are public.
+package api
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/pkix"
+	"github.com/square/certstrap/service"
+)
+
+const maxRequestSize = 64 << 10
+
+// Policy limits what a client may do
+type Policy struct {
+	// Name identifies the client. It is recorded as the operator in the CA index.
+	Name string
+	// Profiles lists the profiles the client may sign with, only service.ProfileHost if empty
+	Profiles []string
+	// Domains limits the common and DNS names of signed certificates, and the names they are
+	// recorded under in the CA index, to these domains and their subdomains. Every name is allowed if empty.
+	Domains []string
+	// MaxValidity limits the lifetime of signed certificates, unlimited if zero
+	MaxValidity time.Duration
+	// Revoke allows the client to revoke certificates whose name in the CA index and DNS names are within Domains
+	Revoke bool
+}
+
+// Server serves the API under /v1/. It implements http.Handler.
+type Server struct {
+	ca *service.CA
+	// expiry parses the expires field of sign requests, which is defaultExpires if omitted
+	expiry         func(expires string) (time.Time, error)
+	defaultExpires string
+
+	// Tokens maps bearer tokens to the policy of their client
+	Tokens map[string]*Policy
+	// Clients maps the common names of verified TLS client certificates to the policy of their
+	// client. Certificates whose chain passes through the CA of the server are ignored.
+	Clients map[string]*Policy
+}
+
+// SignRequest is the body of POST /v1/sign
+type SignRequest struct {
+	// CSR is the PEM-encoded certificate request
+	CSR string `json:"csr"`
+	// Profile is the profile to sign with, service.ProfileHost if empty
+	Profile string `json:"profile,omitempty"`
+	// Expires is how long until the certificate expires, in the form of sign --expires
+	Expires string `json:"expires,omitempty"`
+	// Name is the name to record the certificate under in the CA index, by default
+	// the first DNS name of the request, or its common name
+	Name string `json:"name,omitempty"`
+}
+
+// SignResponse is the body of a successful response to POST /v1/sign
+type SignResponse struct {
+	Name     string    `json:"name"`
+	Serial   string    `json:"serial"`
+	NotAfter time.Time `json:"not_after"`
+	// Certificate is the PEM-encoded certificate
+	Certificate string `json:"certificate"`
+	// Chain holds the PEM-encoded CA certificate and intermediates to serve with the certificate
+	Chain string `json:"chain"`
+}
+
+// RevokeRequest is the body of POST /v1/revoke
+type RevokeRequest struct {
+	// Name is the name the certificate is recorded under in the CA index
+	Name string `json:"name"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+var nameUnacceptable = regexp.MustCompile("[^a-zA-Z0-9._-]+")
+
+// NewServer creates an API server for ca. expiry parses how long until signed certificates
+// expire, which is defaultExpires unless a request gives it. Clients are added to Tokens and Clients.
+func NewServer(ca *service.CA, expiry func(string) (time.Time, error), defaultExpires string) *Server {
+	return &Server{
+		ca:             ca,
+		Tokens:         map[string]*Policy{},
+		Clients:        map[string]*Policy{},
+		expiry:         expiry,
+		defaultExpires: defaultExpires,
+	}
+}
+
+// ServeHTTP handles API requests
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/sign":
+		s.handleSign(w, r)
+	case "/v1/revoke":
+		s.handleRevoke(w, r)
+	case "/v1/certificates":
+		s.handleCertificates(w, r)
+	case "/v1/crl":
+		s.handleCRL(w, r)
+	case "/v1/chain":
+		s.handleChain(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// authenticate returns the policy of the client making r, or nil after writing an error response
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) *Policy {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token := []byte(strings.TrimPrefix(auth, "Bearer "))
+		var policy *Policy
+		// Compare against every token so that timing does not reveal which one matched
+		for t, p := range s.Tokens {
+			if subtle.ConstantTimeCompare(token, []byte(t)) == 1 {
+				policy = p
+			}
+		}
+		if policy != nil {
+			return policy
+		}
+	} else if r.TLS != nil {
+		for _, chain := range r.TLS.VerifiedChains {
+			if s.throughCA(chain) {
+				continue
+			}
+			if policy, ok := s.Clients[chain[0].Subject.CommonName]; ok {
+				return policy
+			}
+		}
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="certstrap"`)
+	writeError(w, http.StatusUnauthorized, "missing or invalid credentials")
+	return nil
+}
+
+// throughCA reports whether chain passes through the CA of the server. A client allowed to sign
+// could otherwise request a certificate with the common name of another client and take its policy.
+func (s *Server) throughCA(chain []*x509.Certificate) bool {
+	ca, err := s.ca.Certificate().GetRawCertificate()
+	if err != nil {
+		return true
+	}
+	for _, crt := range chain {
+		if bytes.Equal(crt.RawSubjectPublicKeyInfo, ca.RawSubjectPublicKeyInfo) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleSign(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodPost) {
+		return
+	}
+	policy := s.authenticate(w, r)
+	if policy == nil {
+		return
+	}
+	var req SignRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	csr, err := pkix.NewCertificateSigningRequestFromPEM([]byte(req.CSR))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid csr: "+err.Error())
+		return
+	}
+	raw, err := csr.GetRawCertificateSigningRequest()
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid csr: "+err.Error())
+		return
+	}
+
+	profile := req.Profile
+	if profile == "" {
+		profile = service.ProfileHost
+	}
+	allowed := policy.Profiles
+	if len(allowed) == 0 {
+		allowed = []string{service.ProfileHost}
+	}
+	if !slices.Contains(allowed, profile) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("profile %q is not allowed", profile))
+		return
+	}
+	if len(policy.Domains) > 0 && (len(raw.IPAddresses) > 0 || len(raw.URIs) > 0 || len(raw.EmailAddresses) > 0) {
+		writeError(w, http.StatusForbidden, "only DNS names are allowed")
+		return
+	}
+	names := append([]string{}, raw.DNSNames...)
+	if raw.Subject.CommonName != "" {
+		names = append(names, raw.Subject.CommonName)
+	}
+	for _, name := range names {
+		if len(policy.Domains) > 0 && !pkix.WithinDomains(name, policy.Domains) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("name %q is not allowed", name))
+			return
+		}
+	}
+
+	expires := req.Expires
+	if expires == "" {
+		expires = s.defaultExpires
+	}
+	notAfter, err := s.expiry(expires)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid expires: "+err.Error())
+		return
+	}
+	if policy.MaxValidity > 0 && notAfter.After(pkix.Now().Add(policy.MaxValidity)) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("certificates may not be valid for longer than %v", policy.MaxValidity))
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = raw.Subject.CommonName
+		if len(raw.DNSNames) > 0 {
+			name = raw.DNSNames[0]
+		}
+	}
+	name = nameUnacceptable.ReplaceAllString(name, "_")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "a name is required for a csr without common or DNS names")
+		return
+	}
+	if len(policy.Domains) > 0 && !pkix.WithinDomains(name, policy.Domains) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("name %q is not allowed", name))
+		return
+	}
+
+	unlock, err := s.ca.Lock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	crt, err := s.ca.Sign(service.SignRequest{
+		Name:     name,
+		CSR:      csr,
+		Profile:  profile,
+		NotAfter: notAfter,
+		Operator: policy.Name,
+	})
+	//nolint:errcheck
+	unlock()
+	if errors.Is(err, service.ErrWeakKey) {
+		writeError(w, http.StatusBadRequest, "invalid csr: "+err.Error())
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, "cannot sign certificate: "+err.Error())
+		return
+	}
+
+	res := SignResponse{Name: name}
+	rawCrt, err := crt.GetRawCertificate()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	res.Serial = fmt.Sprintf("%X", rawCrt.SerialNumber)
+	res.NotAfter = rawCrt.NotAfter.UTC()
+	crtPEM, err := crt.Export()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	res.Certificate = string(crtPEM)
+	chain, err := exportCertificates(s.ca.Chain())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	res.Chain = string(chain)
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodPost) {
+		return
+	}
+	policy := s.authenticate(w, r)
+	if policy == nil {
+		return
+	}
+	if !policy.Revoke {
+		writeError(w, http.StatusForbidden, "revoking certificates is not allowed")
+		return
+	}
+	var req RevokeRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "name must be provided")
+		return
+	}
+
+	unlock, err := s.ca.Lock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	//nolint:errcheck
+	defer unlock()
+
+	entry, err := s.ca.FindCertificate(nameUnacceptable.ReplaceAllString(req.Name, "_"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if len(policy.Domains) > 0 {
+		for _, name := range append([]string{entry.Name}, entry.DNSNames...) {
+			if !pkix.WithinDomains(name, policy.Domains) {
+				writeError(w, http.StatusForbidden, fmt.Sprintf("name %q is not allowed", name))
+				return
+			}
+		}
+	}
+	if err := s.ca.Revoke(entry, service.ReasonUnspecified, policy.Name); err != nil {
+		writeError(w, http.StatusInternalServerError, "cannot revoke certificate: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+func (s *Server) handleCertificates(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodGet) {
+		return
+	}
+	if s.authenticate(w, r) == nil {
+		return
+	}
+	entries, err := s.ca.Certificates()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	status := r.URL.Query().Get("status")
+	result := []*depot.IndexEntry{}
+	for _, e := range entries {
+		if status == "" || e.Status == status {
+			result = append(result, e)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleCRL(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodGet) {
+		return
+	}
+	crl, err := s.ca.CRL()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if r.URL.Query().Get("format") == "pem" {
+		data, err := crl.Export()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		write(w, "application/x-pem-file", data)
+		return
+	}
+	write(w, "application/pkix-crl", crl.DERBytes())
+}
+
+func (s *Server) handleChain(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodGet) {
+		return
+	}
+	crts := s.ca.Chain()
+	if root := s.ca.Root(); root != nil {
+		crts = append(append([]*pkix.Certificate{}, crts...), root)
+	}
+	data, err := exportCertificates(crts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	write(w, "application/pem-certificate-chain", data)
+}
+
+func exportCertificates(crts []*pkix.Certificate) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, crt := range crts {
+		data, err := crt.Export()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+func checkMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, r.URL.Path+" must be requested with "+method)
+		return false
+	}
+	return true
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func write(w http.ResponseWriter, contentType string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	//nolint:errcheck
+	w.Write(data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	//nolint:errcheck
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
@@ -0,0 +1,314 @@
+package api
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/pkix"
+	"github.com/square/certstrap/service"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(newTestAPIServer(t))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestAPIServer(t *testing.T) *Server {
+	dir, err := os.MkdirTemp("", "certstrap-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	d, err := depot.NewFileDepot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := pkix.CreateRSAKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := pkix.CreateCertificateAuthority(key, "", time.Now().Add(24*time.Hour), "", "", "", "", "API CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := pkix.CreateCertificateRevocationList(key, crt, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := depot.PutCertificate(d, "ca", crt); err != nil {
+		t.Fatal(err)
+	}
+	if err := depot.PutCertificateRevocationList(d, "ca", crl); err != nil {
+		t.Fatal(err)
+	}
+	ca, err := service.NewCA(d, "ca", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiry := func(expires string) (time.Time, error) {
+		d, err := time.ParseDuration(expires)
+		return time.Now().Add(d), err
+	}
+	server := NewServer(ca, expiry, "1h")
+	server.Tokens["ci-token"] = &Policy{Name: "ci", Domains: []string{"ci.example.com"}, MaxValidity: 2 * time.Hour}
+	server.Tokens["admin-token"] = &Policy{Name: "admin", Profiles: []string{service.ProfileHost, service.ProfileIntermediate}, Revoke: true}
+	return server
+}
+
+func newTestCSR(t *testing.T, name string) string {
+	key, err := pkix.CreateRSAKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := pkix.CreateCertificateSigningRequest(key, "", nil, []string{name}, nil, "", "", "", "", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := csr.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func do(t *testing.T, srv *httptest.Server, method, path, token string, body interface{}) (*http.Response, []byte) {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, data
+}
+
+func TestSign(t *testing.T) {
+	srv := newTestServer(t)
+
+	res, body := do(t, srv, http.MethodPost, "/v1/sign", "ci-token", SignRequest{CSR: newTestCSR(t, "build.ci.example.com")})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Signing failed: %s: %s", res.Status, body)
+	}
+	var signed SignResponse
+	if err := json.Unmarshal(body, &signed); err != nil {
+		t.Fatal(err)
+	}
+	crt, err := pkix.NewCertificateFromPEM([]byte(signed.Certificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := crt.GetRawCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Name != "build.ci.example.com" || raw.DNSNames[0] != "build.ci.example.com" {
+		t.Fatalf("Unexpected response %+v for certificate of %v", signed, raw.DNSNames)
+	}
+	if d := time.Until(raw.NotAfter); d > time.Hour || d < 50*time.Minute {
+		t.Fatalf("Certificate expires in %v, want the default of 1h", d)
+	}
+
+	for _, tc := range []struct {
+		token  string
+		req    SignRequest
+		status int
+	}{
+		{"", SignRequest{CSR: newTestCSR(t, "build.ci.example.com")}, http.StatusUnauthorized},
+		{"wrong", SignRequest{CSR: newTestCSR(t, "build.ci.example.com")}, http.StatusUnauthorized},
+		{"ci-token", SignRequest{CSR: newTestCSR(t, "www.example.com")}, http.StatusForbidden},
+		{"ci-token", SignRequest{CSR: newTestCSR(t, "build.ci.example.com"), Profile: service.ProfileIntermediate}, http.StatusForbidden},
+		{"ci-token", SignRequest{CSR: newTestCSR(t, "build.ci.example.com"), Expires: "3h"}, http.StatusForbidden},
+		{"ci-token", SignRequest{CSR: "not a csr"}, http.StatusBadRequest},
+		{"admin-token", SignRequest{CSR: newTestCSR(t, "sub-ca"), Profile: service.ProfileIntermediate}, http.StatusOK},
+		{"admin-token", SignRequest{CSR: newTestCSR(t, "www.example.com"), Profile: "unknown"}, http.StatusForbidden},
+	} {
+		if res, body := do(t, srv, http.MethodPost, "/v1/sign", tc.token, tc.req); res.StatusCode != tc.status {
+			t.Errorf("Signing %+v with %q: got %s, want %d: %s", tc.req.Profile, tc.token, res.Status, tc.status, body)
+		}
+	}
+}
+
+func TestRevokeAndList(t *testing.T) {
+	srv := newTestServer(t)
+	if res, body := do(t, srv, http.MethodPost, "/v1/sign", "ci-token", SignRequest{CSR: newTestCSR(t, "build.ci.example.com")}); res.StatusCode != http.StatusOK {
+		t.Fatalf("Signing failed: %s: %s", res.Status, body)
+	}
+
+	if res, _ := do(t, srv, http.MethodPost, "/v1/revoke", "ci-token", RevokeRequest{Name: "build.ci.example.com"}); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("Revoking without permission: got %s, want 403", res.Status)
+	}
+	if res, _ := do(t, srv, http.MethodPost, "/v1/revoke", "admin-token", RevokeRequest{Name: "unknown"}); res.StatusCode != http.StatusNotFound {
+		t.Fatalf("Revoking an unknown certificate: got %s, want 404", res.Status)
+	}
+	if res, body := do(t, srv, http.MethodPost, "/v1/revoke", "admin-token", RevokeRequest{Name: "build.ci.example.com"}); res.StatusCode != http.StatusOK {
+		t.Fatalf("Revoking failed: %s: %s", res.Status, body)
+	}
+
+	res, body := do(t, srv, http.MethodGet, "/v1/certificates?status=revoked", "ci-token", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Listing failed: %s: %s", res.Status, body)
+	}
+	var entries []*depot.IndexEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "build.ci.example.com" || entries[0].Operator != "admin" {
+		t.Fatalf("Unexpected revoked certificates %s", body)
+	}
+	if res, _ := do(t, srv, http.MethodGet, "/v1/certificates", "", nil); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Listing without a token: got %s, want 401", res.Status)
+	}
+
+	res, body = do(t, srv, http.MethodGet, "/v1/crl", "", nil)
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/pkix-crl" {
+		t.Fatalf("Fetching CRL failed: %s, %s", res.Status, res.Header.Get("Content-Type"))
+	}
+	crl, err := x509.ParseDERCRL(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(crl.TBSCertList.RevokedCertificates); n != 1 {
+		t.Fatalf("CRL has %d revoked certificates, want 1", n)
+	}
+	if res, body := do(t, srv, http.MethodGet, "/v1/crl?format=pem", "", nil); res.StatusCode != http.StatusOK || !strings.HasPrefix(string(body), "-----BEGIN X509 CRL-----") {
+		t.Fatalf("Fetching PEM CRL failed: %s: %s", res.Status, body)
+	}
+}
+
+func TestChain(t *testing.T) {
+	srv := newTestServer(t)
+	res, body := do(t, srv, http.MethodGet, "/v1/chain", "", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Fetching chain failed: %s: %s", res.Status, body)
+	}
+	crt, err := pkix.NewCertificateFromPEM(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := crt.GetRawCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.Subject.CommonName != "API CA" {
+		t.Fatalf("Chain starts with %q", raw.Subject.CommonName)
+	}
+	if res, _ := do(t, srv, http.MethodPost, "/v1/chain", "", nil); res.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("Posting to /v1/chain: got %s, want 405", res.Status)
+	}
+}
+
+func TestClientSign(t *testing.T) {
+	srv := newTestServer(t)
+	client := &Client{URL: srv.URL + "/", Token: "ci-token"}
+	res, err := client.Sign(SignRequest{CSR: newTestCSR(t, "build.ci.example.com"), Expires: "30m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Name != "build.ci.example.com" || !strings.HasPrefix(res.Certificate, "-----BEGIN CERTIFICATE-----") {
+		t.Fatalf("Unexpected response %+v", res)
+	}
+
+	client.Token = "wrong"
+	if _, err := client.Sign(SignRequest{CSR: newTestCSR(t, "build.ci.example.com")}); err == nil || !strings.Contains(err.Error(), "missing or invalid credentials") {
+		t.Fatalf("Expected the error of the server, got %v", err)
+	}
+}
+
+func TestClientCertificateThroughCA(t *testing.T) {
+	server := newTestAPIServer(t)
+	server.Clients["deployer"] = &Policy{Name: "deployer", Revoke: true}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	authenticated := func(chain ...*x509.Certificate) bool {
+		req := httptest.NewRequest(http.MethodGet, "/v1/certificates", nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{chain}}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec.Code == http.StatusOK
+	}
+
+	// A token client mints a certificate with the common name of the deployer client
+	res, body := do(t, srv, http.MethodPost, "/v1/sign", "admin-token", SignRequest{CSR: newTestCSR(t, "deployer")})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", res.StatusCode, body)
+	}
+	var signed SignResponse
+	if err := json.Unmarshal(body, &signed); err != nil {
+		t.Fatal(err)
+	}
+	crt, err := pkix.NewCertificateFromPEM([]byte(signed.Certificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	minted, err := crt.GetRawCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := server.ca.Certificate().GetRawCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authenticated(minted, ca) {
+		t.Fatal("Expected a certificate issued by the CA of the server not to authenticate a client")
+	}
+
+	// The deployer authenticates with a certificate of a separate client CA
+	clientKey, err := pkix.CreateRSAKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCA, err := pkix.CreateCertificateAuthority(clientKey, "", time.Now().Add(time.Hour), "", "", "", "", "Client CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := pkix.NewCertificateSigningRequestFromPEM([]byte(newTestCSR(t, "deployer")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err = pkix.CreateCertificateHost(clientCA, clientKey, csr, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := crt.GetRawCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawClientCA, err := clientCA.GetRawCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !authenticated(leaf, rawClientCA) {
+		t.Fatal("Expected a certificate of the client CA to authenticate the client")
+	}
+}
@@ -18,6 +18,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/square/certstrap/cmd"
@@ -39,6 +40,17 @@ func main() {
 			Usage:  "Location to store certificates, keys and other files.",
 			EnvVar: "",
 		},
+		// now and seed make the output reproducible, for test fixtures only
+		cli.StringFlag{
+			Name:   "now",
+			Usage:  "Current time in RFC 3339 format, instead of the system clock",
+			Hidden: true,
+		},
+		cli.StringFlag{
+			Name:   "seed",
+			Usage:  "Seed of all randomness, instead of the system random source. Keys created with it are not secret.",
+			Hidden: true,
+		},
 	}
 	app.Author = "Square Inc., CoreOS"
 	app.Email = ""
@@ -47,8 +59,26 @@ func main() {
 		cmd.NewCertRequestCommand(),
 		cmd.NewSignCommand(),
 		cmd.NewRevokeCommand(),
+		cmd.NewRenewCommand(),
+		cmd.NewRotateCACommand(),
+		cmd.NewLogCommand(),
+		cmd.NewExpiringCommand(),
+		cmd.NewExportCommand(),
+		cmd.NewACMECommand(),
+		cmd.NewESTCommand(),
+		cmd.NewSCEPCommand(),
+		cmd.NewServeCommand(),
+		cmd.NewPublishCommand(),
+		cmd.NewAgentCommand(),
+		cmd.NewSSHCommand(),
+		cmd.NewApplyCommand(),
+		cmd.NewKeyCommand(),
 	}
 	app.Before = func(c *cli.Context) error {
+		if err := cmd.InitReproducible(c.String("now"), c.String("seed")); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return err
+		}
 		return cmd.InitDepot(c.String("depot-path"))
 	}
 
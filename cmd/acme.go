@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/square/certstrap/acme"
+	"github.com/urfave/cli"
+)
+
+// NewACMECommand sets up an "acme" command to run an ACME server backed by a CA in the depot
+func NewACMECommand() cli.Command {
+	return cli.Command{
+		Name:  "acme",
+		Usage: "Issue certificates over ACME",
+		Subcommands: []cli.Command{
+			{
+				Name:  "serve",
+				Usage: "Run an ACME server signing with a CA in the depot",
+				Description: "Serve an ACME (RFC 8555) directory at /directory that issues host certificates signed by the CA.\n" +
+					"   Identifiers are validated with the http-01 challenge, or authorized without a challenge\n" +
+					"   with --mode trust-all or --mode pre-authorized. Accounts and orders are kept in memory.",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:  "CA",
+						Usage: "Name of CA to issue certificates with",
+					},
+					cli.StringFlag{
+						Name:  "passphrase",
+						Usage: "Passphrase to decrypt the CA private key",
+					},
+					cli.StringFlag{
+						Name:  "listen",
+						Value: ":14000",
+						Usage: "Address to listen on",
+					},
+					cli.StringFlag{
+						Name:  "mode",
+						Value: string(acme.ModeHTTP01),
+						Usage: fmt.Sprintf("How identifiers are authorized, one of %s, %s, %s", acme.ModeHTTP01, acme.ModeTrustAll, acme.ModePreAuthorized),
+					},
+					cli.StringFlag{
+						Name:  "allow-domain",
+						Usage: "Only issue certificates for these domains and their subdomains, comma separated (default: any domain)",
+					},
+					cli.StringFlag{
+						Name:  "pre-authorize",
+						Usage: "Domains, including their subdomains, authorized without a challenge in pre-authorized mode, comma separated",
+					},
+					cli.IntFlag{
+						Name:  "http-port",
+						Value: 80,
+						Usage: "Port to fetch http-01 challenge responses from",
+					},
+					cli.StringFlag{
+						Name:  "expires",
+						Value: "90 days",
+						Usage: "How long until the issued certificates expire, in the same form as sign --expires",
+					},
+					cli.StringFlag{
+						Name:  "tls-cert",
+						Usage: "Certificate to serve the directory over HTTPS with",
+					},
+					cli.StringFlag{
+						Name:  "tls-key",
+						Usage: "Unencrypted private key of --tls-cert",
+					},
+				}, passphraseSourceFlags...),
+				Action: acmeServeAction,
+			},
+		},
+	}
+}
+
+func acmeServeAction(c *cli.Context) {
+	checkNotSeeded(c)
+	if !c.IsSet("CA") {
+		fmt.Fprintln(os.Stderr, "A CA must be provided with --CA.")
+		os.Exit(1)
+	}
+	if c.IsSet("tls-cert") != c.IsSet("tls-key") {
+		fmt.Fprintln(os.Stderr, "--tls-cert and --tls-key must be provided together.")
+		os.Exit(1)
+	}
+	// Check the expiry once up front, it is computed again for every certificate
+	if _, err := parseExpiry(c.String("expires")); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid expiry: %s\n", err)
+		os.Exit(1)
+	}
+
+	issuer, err := newDepotIssuer(c, formatName(c.String("CA")), c.String("expires"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Load CA error:", err)
+		os.Exit(1)
+	}
+	policy := acme.Policy{
+		Mode:           acme.Mode(c.String("mode")),
+		AllowedDomains: splitList(c.String("allow-domain")),
+		PreAuthorized:  splitList(c.String("pre-authorize")),
+	}
+	if policy.Mode == acme.ModePreAuthorized && len(policy.PreAuthorized) == 0 {
+		fmt.Fprintln(os.Stderr, "Pre-authorized mode requires --pre-authorize.")
+		os.Exit(1)
+	}
+	server, err := acme.NewServer(issuer, policy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Create ACME server error:", err)
+		os.Exit(1)
+	}
+	server.HTTPPort = c.Int("http-port")
+
+	fmt.Fprintf(os.Stderr, "Serving ACME directory for CA \"%s\" on %s/directory\n", issuer.Name(), c.String("listen"))
+	if c.IsSet("tls-cert") {
+		err = http.ListenAndServeTLS(c.String("listen"), c.String("tls-cert"), c.String("tls-key"), server)
+	} else {
+		err = http.ListenAndServe(c.String("listen"), server)
+	}
+	fmt.Fprintln(os.Stderr, "ACME server error:", err)
+	os.Exit(1)
+}
+
+// splitList splits a comma separated flag value, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/square/certstrap/agent"
+	"github.com/square/certstrap/api"
+	"github.com/square/certstrap/pkix"
+	"github.com/urfave/cli"
+)
+
+// NewAgentCommand sets up an "agent" command to keep short-lived certificates renewed
+func NewAgentCommand() cli.Command {
+	return cli.Command{
+		Name:      "agent",
+		Usage:     "Renew certificates automatically",
+		ArgsUsage: "NAME...",
+		Description: "Keep the certificates of the given names in the depot valid, renewing them once --renew-fraction\n" +
+			"   of their lifetime has passed. Certificates are issued by a CA in the depot (--CA) or by a remote\n" +
+			"   certstrap serve API (--server), for the certificate request of each name in the depot, or a request\n" +
+			"   made from its unencrypted key and current certificate. Names without a certificate are issued one at once.\n" +
+			"   Certificate files are replaced atomically, and --hook runs after every round of renewals with the\n" +
+			"   renewed names in $CERTSTRAP_RENEWED.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "CA",
+				Usage: "Name of CA in the depot to issue certificates with",
+			},
+			cli.StringFlag{
+				Name:  "passphrase",
+				Usage: "Passphrase to decrypt private-key PEM block of CA",
+			},
+			cli.StringFlag{
+				Name:  "server",
+				Usage: "URL of a certstrap serve API to request certificates from (example: https://ca.example.com:8200)",
+			},
+			cli.StringFlag{
+				Name:   "token",
+				Usage:  "Bearer token to authenticate to --server with",
+				EnvVar: "CERTSTRAP_API_TOKEN",
+			},
+			cli.StringFlag{
+				Name:  "server-ca",
+				Usage: "PEM file of the CA certificates to verify --server with (default: system roots)",
+			},
+			cli.StringFlag{
+				Name:  "expires",
+				Value: "24 hours",
+				Usage: "How long until issued certificates expire (example: 1 day 2 hours 30 minutes)",
+			},
+			cli.Float64Flag{
+				Name:  "renew-fraction",
+				Value: agent.DefaultFraction,
+				Usage: "Fraction of the lifetime of certificates after which they are renewed",
+			},
+			cli.DurationFlag{
+				Name:  "retry-interval",
+				Value: agent.DefaultRetryInterval,
+				Usage: "How long to wait before retrying a failed renewal",
+			},
+			cli.BoolFlag{
+				Name:  "chain",
+				Usage: "Also write the certificate followed by the chain of its issuers to NAME.chain.pem",
+			},
+			cli.StringFlag{
+				Name:  "hook",
+				Usage: "Shell command to run after certificates are renewed (example: \"systemctl reload nginx\")",
+			},
+			cli.BoolFlag{
+				Name:  "once",
+				Usage: "Renew the certificates which are due and exit, instead of running until interrupted",
+			},
+		},
+		Action: agentAction,
+	}
+}
+
+func agentAction(c *cli.Context) {
+	checkNotSeeded(c)
+	if len(c.Args()) == 0 {
+		fmt.Fprintln(os.Stderr, "At least one name must be provided.")
+		os.Exit(1)
+	}
+	if c.IsSet("CA") == c.IsSet("server") {
+		fmt.Fprintln(os.Stderr, "Either a CA must be provided with --CA, or a server with --server.")
+		os.Exit(1)
+	}
+	if f := c.Float64("renew-fraction"); f <= 0 || f >= 1 {
+		fmt.Fprintln(os.Stderr, "--renew-fraction must be between 0 and 1.")
+		os.Exit(1)
+	}
+	if _, err := parseExpiry(c.String("expires")); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid expiry: %s\n", err)
+		os.Exit(1)
+	}
+
+	var issuer agent.Issuer
+	var err error
+	if c.IsSet("CA") {
+		issuer, err = newDepotIssuer(c, formatName(c.String("CA")), c.String("expires"))
+	} else {
+		issuer, err = newRemoteIssuer(c)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Load issuer error:", err)
+		os.Exit(1)
+	}
+
+	var names []string
+	for _, name := range c.Args() {
+		names = append(names, formatName(name))
+	}
+	a := agent.New(d, names, issuer)
+	a.Fraction = c.Float64("renew-fraction")
+	a.RetryInterval = c.Duration("retry-interval")
+	a.Chain = c.Bool("chain")
+	a.Logf = func(format string, args ...interface{}) {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+	if hook := c.String("hook"); hook != "" {
+		a.Hook = func(renewed []string) error {
+			return runHook(hook, renewed)
+		}
+	}
+
+	if c.Bool("once") {
+		if _, err := a.RenewDue(); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "Renewing certificates of %s\n", strings.Join(names, ", "))
+	//nolint:errcheck
+	a.Run(ctx)
+}
+
+// remoteIssuer requests certificates from a certstrap serve API
+type remoteIssuer struct {
+	client  *api.Client
+	expires string
+}
+
+func newRemoteIssuer(c *cli.Context) (*remoteIssuer, error) {
+	client := &api.Client{URL: c.String("server"), Token: c.String("token")}
+	if c.IsSet("server-ca") {
+		data, err := os.ReadFile(c.String("server-ca"))
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates in %s", c.String("server-ca"))
+		}
+		client.HTTPClient = &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		}}
+	}
+	return &remoteIssuer{client: client, expires: c.String("expires")}, nil
+}
+
+// Issue requests a certificate for csr, returning it followed by its chain
+func (i *remoteIssuer) Issue(csr *pkix.CertificateSigningRequest) ([]*pkix.Certificate, error) {
+	data, err := csr.Export()
+	if err != nil {
+		return nil, err
+	}
+	res, err := i.client.Sign(api.SignRequest{CSR: string(data), Expires: i.expires})
+	if err != nil {
+		return nil, err
+	}
+	return readCertificates([]byte(res.Certificate + res.Chain))
+}
+
+// readCertificates reads the PEM-encoded certificates in data
+func readCertificates(data []byte) ([]*pkix.Certificate, error) {
+	var crts []*pkix.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			crts = append(crts, pkix.NewCertificateFromDER(block.Bytes))
+		}
+	}
+	if len(crts) == 0 {
+		return nil, errors.New("no certificates")
+	}
+	return crts, nil
+}
+
+// runHook runs the shell command hook with the renewed names in $CERTSTRAP_RENEWED
+func runHook(hook string, renewed []string) error {
+	cmd := exec.Command("/bin/sh", "-c", hook)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", hook)
+	}
+	cmd.Env = append(os.Environ(), "CERTSTRAP_RENEWED="+strings.Join(renewed, " "))
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
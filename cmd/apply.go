@@ -0,0 +1,366 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/manifest"
+	"github.com/square/certstrap/pkix"
+	"github.com/square/certstrap/service"
+	"github.com/urfave/cli"
+)
+
+// Defaults of the certificates of a manifest, as for the init, request-cert and sign commands
+const (
+	applyCAKey        = "rsa:4096"
+	applyKey          = "rsa:2048"
+	applyCALifetime   = "18 months"
+	applyLeafLifetime = "2 years"
+)
+
+// NewApplyCommand sets up an "apply" command to create the certificates declared in a manifest
+func NewApplyCommand() cli.Command {
+	return cli.Command{
+		Name:  "apply",
+		Usage: "Create the CAs and certificates declared in a manifest",
+		Description: "Create the CAs, intermediates and leaf certificates declared in a YAML manifest that are missing from\n" +
+			"   the depot, issuers first. Certificates already in the depot are left unchanged, so applying a manifest\n" +
+			"   again only creates what was added to it. The plan is printed before anything is changed.",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "file, f",
+				Usage: "Manifest file to apply",
+			},
+			cli.StringFlag{
+				Name:  "passphrase",
+				Usage: "Passphrase of the private keys of CAs and intermediates (leaf keys are not encrypted)",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the plan without changing the depot",
+			},
+			allowWeakFlag,
+		}, passphraseSourceFlags...),
+		Action: applyAction,
+	}
+}
+
+// applyStep is a certificate of the manifest and what applying it does
+type applyStep struct {
+	crt *manifest.Certificate
+	// name and issuer are the depot names of the certificate and its issuer
+	name   string
+	issuer string
+	// exists is set if the certificate is in the depot, and keyExists if its private key is
+	exists    bool
+	keyExists bool
+}
+
+func applyAction(c *cli.Context) {
+	if c.String("file") == "" {
+		fmt.Fprintln(os.Stderr, "A manifest must be provided with --file.")
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(c.String("file"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Read manifest error:", err)
+		os.Exit(1)
+	}
+	m, err := manifest.Parse(data)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid manifest:", err)
+		os.Exit(1)
+	}
+
+	defer lockDepot()()
+
+	steps, err := planManifest(m, c.Bool("allow-weak"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid manifest:", err)
+		os.Exit(1)
+	}
+
+	create := 0
+	for _, step := range steps {
+		if !step.exists {
+			create++
+		}
+	}
+	fmt.Printf("Plan: %d to create, %d unchanged.\n", create, len(steps)-create)
+	for _, step := range steps {
+		if step.exists {
+			fmt.Printf("  = %s (%s)\n", step.name, describeStep(step))
+		} else if step.keyExists {
+			fmt.Printf("  + %s (%s, existing key)\n", step.name, describeStep(step))
+		} else {
+			fmt.Printf("  + %s (%s, %s key, expires in %s)\n", step.name, describeStep(step), stepKey(step), stepLifetime(step))
+		}
+	}
+	if c.Bool("dry-run") || create == 0 {
+		return
+	}
+
+	a := &applier{c: c, m: m, keys: map[string]*pkix.Key{}}
+	for _, step := range steps {
+		if step.exists {
+			continue
+		}
+		if err := a.apply(step); err != nil {
+			fmt.Fprintf(os.Stderr, "Create %s error: %v\n", step.name, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// planManifest checks the certificates of m against the depot, in the order they are created.
+// Weak key types are rejected for the keys to create unless allowWeak is set.
+func planManifest(m *manifest.Manifest, allowWeak bool) ([]*applyStep, error) {
+	ordered, err := m.Ordered()
+	if err != nil {
+		return nil, err
+	}
+	var steps []*applyStep
+	names := map[string]string{}
+	for _, crt := range ordered {
+		step := &applyStep{crt: crt, name: formatName(crt.Name)}
+		if other, ok := names[step.name]; ok {
+			return nil, fmt.Errorf("certificates %q and %q have the same depot name %s", other, crt.Name, step.name)
+		}
+		names[step.name] = crt.Name
+		step.exists = depot.CheckCertificate(d, step.name)
+		step.keyExists = depot.CheckPrivateKey(d, step.name)
+
+		if step.exists && crt.IsCA() {
+			if err := checkDepotCA(step.name); err != nil {
+				return nil, fmt.Errorf("certificate %q: %v", crt.Name, err)
+			}
+		}
+		if crt.Issuer != "" {
+			step.issuer = formatName(crt.Issuer)
+			if m.Get(crt.Issuer) == nil {
+				if err := checkDepotCA(step.issuer); err != nil {
+					return nil, fmt.Errorf("issuer %q of %q is not declared in the manifest, and %v", crt.Issuer, crt.Name, err)
+				}
+			}
+		}
+		keyType, err := pkix.ParseKeyType(stepKey(step))
+		if err != nil {
+			return nil, fmt.Errorf("certificate %q: %v", crt.Name, err)
+		}
+		if keyType.Weak() && !allowWeak && !step.exists && !step.keyExists {
+			return nil, fmt.Errorf("certificate %q: %s keys are weak, use --allow-weak to use one anyway", crt.Name, keyType)
+		}
+		if _, err := parseExpiry(stepLifetime(step)); err != nil {
+			return nil, fmt.Errorf("certificate %q: invalid lifetime %q: %v", crt.Name, stepLifetime(step), err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// checkDepotCA checks that the depot has a CA certificate under name
+func checkDepotCA(name string) error {
+	crt, err := depot.GetCertificate(d, name)
+	if err != nil {
+		return fmt.Errorf("CA %s is not in the depot", name)
+	}
+	raw, err := crt.GetRawCertificate()
+	if err != nil {
+		return err
+	}
+	if !raw.IsCA {
+		return fmt.Errorf("%s in the depot is not a CA certificate", name)
+	}
+	return nil
+}
+
+func describeStep(step *applyStep) string {
+	switch step.crt.Kind {
+	case manifest.KindCA:
+		return "root CA"
+	case manifest.KindIntermediate:
+		return "intermediate CA issued by " + step.issuer
+	}
+	profile := step.crt.Profile
+	if profile == "" {
+		profile = service.ProfileHost
+	}
+	return profile + " certificate issued by " + step.issuer
+}
+
+func stepKey(step *applyStep) string {
+	switch {
+	case step.crt.Key != "":
+		return step.crt.Key
+	case step.crt.IsCA():
+		return applyCAKey
+	}
+	return applyKey
+}
+
+func stepLifetime(step *applyStep) string {
+	switch {
+	case step.crt.Lifetime != "":
+		return step.crt.Lifetime
+	case step.crt.Kind == manifest.KindCA:
+		return applyCALifetime
+	}
+	return applyLeafLifetime
+}
+
+// applier creates the certificates of a manifest
+type applier struct {
+	c *cli.Context
+	m *manifest.Manifest
+	// keys holds the private keys of CAs, by depot name
+	keys map[string]*pkix.Key
+	// passphrase encrypts new CA keys, asked for once
+	passphrase []byte
+	asked      bool
+}
+
+func (a *applier) apply(step *applyStep) error {
+	crt := step.crt
+	expires, err := parseExpiry(stepLifetime(step))
+	if err != nil {
+		return err
+	}
+	key, err := a.key(step)
+	if err != nil {
+		return err
+	}
+	commonName := crt.Subject.CommonName
+	if commonName == "" {
+		commonName = crt.Name
+	}
+
+	var signed *pkix.Certificate
+	if crt.Kind == manifest.KindCA {
+		signed, err = pkix.CreateCertificateAuthorityWithOptions(key, crt.Subject.OrganizationalUnit, expires,
+			crt.Subject.Organization, crt.Subject.Country, crt.Subject.Province, crt.Subject.Locality, commonName,
+			crt.PermitDomains, pkix.WithPathlenOption(a.m.PathLength(crt), false))
+		if err != nil {
+			return err
+		}
+	} else {
+		csr, err := pkix.CreateCertificateSigningRequest(key, crt.Subject.OrganizationalUnit, crt.SANs.IPs(), crt.SANs.DNS,
+			crt.SANs.URIs(), crt.Subject.Organization, crt.Subject.Country, crt.Subject.Province, crt.Subject.Locality, commonName)
+		if err != nil {
+			return err
+		}
+		issuerKey, err := a.caKey(step.issuer)
+		if err != nil {
+			return fmt.Errorf("get CA key of %s: %v", step.issuer, err)
+		}
+		ca, err := service.NewCA(d, step.issuer, issuerKey)
+		if err != nil {
+			return err
+		}
+		profile := crt.Profile
+		if crt.Kind == manifest.KindIntermediate {
+			profile = service.ProfileIntermediate
+		}
+		signed, err = ca.Sign(service.SignRequest{
+			Name:       step.name,
+			CSR:        csr,
+			Profile:    profile,
+			NotAfter:   expires,
+			PathLength: a.m.PathLength(crt),
+			Operator:   currentOperator(),
+			AllowWeak:  a.c.Bool("allow-weak"),
+		})
+		if err != nil {
+			return err
+		}
+		if err := depot.PutCertificateSigningRequest(d, step.name, csr); err != nil {
+			return err
+		}
+	}
+
+	if err := depot.PutCertificate(d, step.name, signed); err != nil {
+		return err
+	}
+	if crt.IsCA() {
+		// An empty CRL, so that the CA can revoke the certificates it issues
+		crl, err := pkix.CreateCertificateRevocationList(key, signed, expires)
+		if err != nil {
+			return err
+		}
+		if err := depot.PutCertificateRevocationList(d, step.name, crl); err != nil {
+			return err
+		}
+	}
+	if crt.Kind == manifest.KindCA {
+		fmt.Printf("Created %s/%s.crt\n", depotDir, step.name)
+	} else {
+		fmt.Printf("Created %s/%s.crt signed by %s/%s.key\n", depotDir, step.name, depotDir, step.issuer)
+	}
+	return nil
+}
+
+// key returns the private key of step, creating and saving it unless it exists
+func (a *applier) key(step *applyStep) (*pkix.Key, error) {
+	if step.keyExists {
+		if step.crt.IsCA() {
+			return a.caKey(step.name)
+		}
+		return depot.GetPrivateKey(d, step.name)
+	}
+	keyType, err := pkix.ParseKeyType(stepKey(step))
+	if err != nil {
+		return nil, err
+	}
+	key, err := keyType.Create()
+	if err != nil {
+		return nil, err
+	}
+	if !step.crt.IsCA() {
+		if err := depot.PutPrivateKey(d, step.name, key); err != nil {
+			return nil, err
+		}
+		fmt.Printf("Created %s/%s.key\n", depotDir, step.name)
+		return key, nil
+	}
+
+	if !a.asked {
+		if a.passphrase, err = newPassPhrase(a.c); err != nil {
+			return nil, err
+		}
+		a.asked = true
+	}
+	if len(a.passphrase) > 0 {
+		err = depot.PutEncryptedPrivateKey(d, step.name, key, a.passphrase)
+	} else {
+		err = depot.PutPrivateKey(d, step.name, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(a.passphrase) > 0 {
+		fmt.Printf("Created %s/%s.key (encrypted by passphrase)\n", depotDir, step.name)
+	} else {
+		fmt.Printf("Created %s/%s.key\n", depotDir, step.name)
+	}
+	a.keys[step.name] = key
+	return key, nil
+}
+
+// caKey returns the private key of the CA name, asking for its passphrase if it is encrypted
+func (a *applier) caKey(name string) (*pkix.Key, error) {
+	if key, ok := a.keys[name]; ok {
+		return key, nil
+	}
+	key, err := depot.GetPrivateKey(d, name)
+	if err != nil && a.asked {
+		key, err = depot.GetEncryptedPrivateKey(d, name, a.passphrase)
+	}
+	if err != nil {
+		key, err = getCAPrivateKey(a.c, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.keys[name] = key
+	return key, nil
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/est"
+	"github.com/urfave/cli"
+)
+
+// NewESTCommand sets up an "est" command to run an EST server backed by a CA in the depot
+func NewESTCommand() cli.Command {
+	return cli.Command{
+		Name:  "est",
+		Usage: "Enroll devices over EST",
+		Subcommands: []cli.Command{
+			{
+				Name:  "serve",
+				Usage: "Run an EST server signing with a CA in the depot",
+				Description: "Serve the EST (RFC 7030) cacerts, simpleenroll and simplereenroll operations under /.well-known/est/\n" +
+					"   over HTTPS. Clients enroll with a user from --users-file or a client certificate issued by a CA of\n" +
+					"   --client-ca, for names within their domains from --domains-file, and re-enroll with their current certificate.",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:  "CA",
+						Usage: "Name of CA to issue certificates with",
+					},
+					cli.StringFlag{
+						Name:  "passphrase",
+						Usage: "Passphrase to decrypt the CA private key",
+					},
+					cli.StringFlag{
+						Name:  "listen",
+						Value: ":8443",
+						Usage: "Address to listen on",
+					},
+					cli.StringFlag{
+						Name:  "tls-cert",
+						Usage: "Certificate to serve EST over HTTPS with",
+					},
+					cli.StringFlag{
+						Name:  "tls-key",
+						Usage: "Unencrypted private key of --tls-cert",
+					},
+					cli.StringFlag{
+						Name:  "users-file",
+						Usage: "File of name:password lines, one for each client allowed to enroll with HTTP basic authentication",
+					},
+					cli.StringFlag{
+						Name:  "domains-file",
+						Usage: "File of name:domain,... lines, limiting the names each user or client certificate common name may enroll for",
+					},
+					cli.StringFlag{
+						Name:  "client-ca",
+						Usage: "Names of CAs in the depot whose certificates may authenticate clients, comma separated. Must not be the issuing CA.",
+					},
+					cli.StringFlag{
+						Name:  "expires",
+						Value: "1 year",
+						Usage: "How long until the issued certificates expire, in the same form as sign --expires",
+					},
+				}, passphraseSourceFlags...),
+				Action: estServeAction,
+			},
+		},
+	}
+}
+
+func estServeAction(c *cli.Context) {
+	checkNotSeeded(c)
+	if !c.IsSet("CA") {
+		fmt.Fprintln(os.Stderr, "A CA must be provided with --CA.")
+		os.Exit(1)
+	}
+	if !c.IsSet("tls-cert") || !c.IsSet("tls-key") {
+		fmt.Fprintln(os.Stderr, "EST must be served over HTTPS, --tls-cert and --tls-key must be provided.")
+		os.Exit(1)
+	}
+	if !c.IsSet("domains-file") {
+		fmt.Fprintln(os.Stderr, "A domains file must be provided with --domains-file.")
+		os.Exit(1)
+	}
+	if _, err := parseExpiry(c.String("expires")); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid expiry: %s\n", err)
+		os.Exit(1)
+	}
+
+	// Clients can enroll for any name within their domains from the issuing CA, so it must not
+	// authenticate clients by their common name
+	clientCAs := splitList(c.String("client-ca"))
+	if len(clientCAs) == 0 {
+		fmt.Fprintln(os.Stderr, "A client CA must be provided with --client-ca, a CA other than the issuing CA.")
+		os.Exit(1)
+	}
+
+	issuer, err := newDepotIssuer(c, formatName(c.String("CA")), c.String("expires"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Load CA error:", err)
+		os.Exit(1)
+	}
+	server, err := est.NewServer(issuer, issuer.caCertificates())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Create EST server error:", err)
+		os.Exit(1)
+	}
+	if c.IsSet("users-file") {
+		if server.Users, err = readUsersFile(c.String("users-file")); err != nil {
+			fmt.Fprintln(os.Stderr, "Read users file error:", err)
+			os.Exit(1)
+		}
+	}
+	if server.Domains, err = readDomainsFile(c.String("domains-file")); err != nil {
+		fmt.Fprintln(os.Stderr, "Read domains file error:", err)
+		os.Exit(1)
+	}
+
+	// The issuing CA verifies the certificates clients re-enroll with. The server ignores them
+	// for enrollment.
+	pool := x509.NewCertPool()
+	caRaw, err := issuer.Certificate().GetRawCertificate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Load CA error:", err)
+		os.Exit(1)
+	}
+	pool.AddCert(caRaw)
+	for _, name := range clientCAs {
+		if formatName(name) == issuer.Name() {
+			fmt.Fprintf(os.Stderr, "The issuing CA \"%s\" cannot be a client CA, since clients can enroll for names of other clients from it.\n", name)
+			os.Exit(1)
+		}
+		crt, err := depot.GetCertificate(d, formatName(name))
+		if err == nil {
+			var raw *x509.Certificate
+			if raw, err = crt.GetRawCertificate(); err == nil {
+				pool.AddCert(raw)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Load client CA \"%s\" error: %v\n", name, err)
+			os.Exit(1)
+		}
+	}
+
+	httpServer := &http.Server{
+		Addr:    c.String("listen"),
+		Handler: server,
+		TLSConfig: &tls.Config{
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			ClientCAs:  pool,
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+	fmt.Fprintf(os.Stderr, "Serving EST for CA \"%s\" on %s%s\n", issuer.Name(), c.String("listen"), est.PathPrefix)
+	err = httpServer.ListenAndServeTLS(c.String("tls-cert"), c.String("tls-key"))
+	fmt.Fprintln(os.Stderr, "EST server error:", err)
+	os.Exit(1)
+}
+
+// readUsersFile reads name:password lines, skipping blank lines and # comments
+func readUsersFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	users := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		kv := strings.SplitN(text, ":", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("line %d is not name:password", line)
+		}
+		users[kv[0]] = kv[1]
+	}
+	return users, scanner.Err()
+}
+
+// readDomainsFile reads name:domain,... lines, skipping blank lines and # comments
+func readDomainsFile(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	domains := map[string][]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		kv := strings.SplitN(text, ":", 2)
+		if len(kv) != 2 || kv[0] == "" || len(splitList(kv[1])) == 0 {
+			return nil, fmt.Errorf("line %d is not name:domain,...", line)
+		}
+		domains[kv[0]] = splitList(kv[1])
+	}
+	return domains, scanner.Err()
+}
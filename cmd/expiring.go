@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/square/certstrap/depot"
+	"github.com/urfave/cli"
+)
+
+const (
+	certTypeRoot         = "root"
+	certTypeIntermediate = "intermediate"
+	certTypeLeaf         = "leaf"
+
+	certStatusOK       = "ok"
+	certStatusExpiring = "expiring"
+	certStatusExpired  = "expired"
+	certStatusRevoked  = "revoked"
+)
+
+// certExpiry describes how close a depot certificate is to expiring
+type certExpiry struct {
+	Name      string        `json:"name"`
+	Type      string        `json:"type"`
+	Subject   string        `json:"subject"`
+	Serial    string        `json:"serial"`
+	NotAfter  time.Time     `json:"not_after"`
+	Remaining time.Duration `json:"-"`
+	Status    string        `json:"status"`
+}
+
+// MarshalJSON reports the remaining time in whole seconds.
+func (e *certExpiry) MarshalJSON() ([]byte, error) {
+	type alias certExpiry
+	return json.Marshal(&struct {
+		*alias
+		Remaining int64 `json:"remaining_seconds"`
+	}{(*alias)(e), int64(e.Remaining / time.Second)})
+}
+
+// NewExpiringCommand sets up an "expiring" command to report certificates nearing expiry
+func NewExpiringCommand() cli.Command {
+	return cli.Command{
+		Name:        "expiring",
+		Aliases:     []string{"audit"},
+		Usage:       "Report certificates nearing expiry",
+		Description: "Scan the depot for CA, intermediate and leaf certificates that expire soon, have expired or have been revoked. Exits non-zero if any unrevoked certificate expires within the given window.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "within",
+				Value: "30 days",
+				Usage: "Report certificates expiring within this time (example: 1 year 2 days 3 months 4 hours)",
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "text",
+				Usage: "Output format: text, json or prometheus",
+			},
+			cli.StringFlag{
+				Name:  "output",
+				Usage: "Path to write the report to instead of stdout (written atomically, e.g. for the Prometheus textfile collector)",
+			},
+			cli.BoolFlag{
+				Name:  "all",
+				Usage: "Include certificates that are not expiring in text and json output",
+			},
+		},
+		Action: expiringAction,
+	}
+}
+
+func expiringAction(c *cli.Context) {
+	threshold, err := parseExpiry(c.String("within"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid window: %s\n", err)
+		os.Exit(1)
+	}
+	window := threshold.Sub(nowFunc().UTC())
+
+	// A file that cannot be read does not keep the other certificates out of the report
+	expiries, problems := checkExpiries(d, window)
+	for _, err := range problems {
+		fmt.Fprintln(os.Stderr, "Skipped unreadable file:", err)
+	}
+
+	report := expiries
+	if !c.Bool("all") {
+		report = nil
+		for _, e := range expiries {
+			if e.Status != certStatusOK {
+				report = append(report, e)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	switch c.String("format") {
+	case "text":
+		writeExpiriesText(&buf, report)
+	case "json":
+		err = writeExpiriesJSON(&buf, report)
+	case "prometheus":
+		// Metrics always cover every certificate so alerts can resolve.
+		writeExpiriesPrometheus(&buf, expiries)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format %q, must be one of text, json or prometheus\n", c.String("format"))
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Print report error:", err)
+		os.Exit(1)
+	}
+
+	if c.IsSet("output") {
+		err = depot.WriteFileAtomic(c.String("output"), buf.Bytes(), 0644)
+	} else {
+		_, err = os.Stdout.Write(buf.Bytes())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Write report error:", err)
+		os.Exit(1)
+	}
+
+	for _, e := range expiries {
+		if e.Status == certStatusExpiring || e.Status == certStatusExpired {
+			os.Exit(1)
+		}
+	}
+}
+
+// checkExpiries inspects every certificate in the depot, flagging those
+// which expire within window, have already expired or have been revoked.
+// Certificates and CRLs that cannot be read are left out and listed in problems.
+func checkExpiries(d *depot.FileDepot, window time.Duration) (expiries []*certExpiry, problems []error) {
+	revoked, problems := revokedSerials(d)
+
+	for _, tag := range d.List() {
+		name := depot.GetNameFromCrtTag(tag)
+		if name == "" {
+			continue
+		}
+		crt, err := depot.GetCertificate(d, name)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %v", name, err))
+			continue
+		}
+		rawCrt, err := crt.GetRawCertificate()
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %v", name, err))
+			continue
+		}
+
+		e := &certExpiry{
+			Name:      name,
+			Type:      certificateType(rawCrt),
+			Subject:   rawCrt.Subject.String(),
+			Serial:    fmt.Sprintf("%X", rawCrt.SerialNumber),
+			NotAfter:  rawCrt.NotAfter.UTC(),
+			Remaining: crt.GetExpirationDuration(),
+			Status:    certStatusOK,
+		}
+		switch {
+		case revoked[hex.EncodeToString(rawCrt.AuthorityKeyId)][e.Serial]:
+			e.Status = certStatusRevoked
+		case e.Remaining <= 0:
+			e.Status = certStatusExpired
+		case e.Remaining <= window:
+			e.Status = certStatusExpiring
+		}
+		expiries = append(expiries, e)
+	}
+
+	sort.SliceStable(expiries, func(i, j int) bool {
+		return expiries[i].NotAfter.Before(expiries[j].NotAfter)
+	})
+	return expiries, problems
+}
+
+// revokedSerials returns the revoked serial numbers of every CRL in the depot,
+// keyed by the subject key ID of the CA that issued the CRL. CRLs that cannot be
+// read are left out and listed in problems.
+func revokedSerials(d *depot.FileDepot) (revoked map[string]map[string]bool, problems []error) {
+	revoked = make(map[string]map[string]bool)
+	for _, tag := range d.List() {
+		ca := depot.GetNameFromCrlTag(tag)
+		if ca == "" {
+			continue
+		}
+		caCrt, err := depot.GetCertificate(d, ca)
+		if err != nil {
+			// A CRL without its CA cannot be matched to any certificate.
+			continue
+		}
+		rawCACrt, err := caCrt.GetRawCertificate()
+		if err != nil {
+			// The CA certificate itself is reported as unreadable by checkExpiries.
+			continue
+		}
+		crl, err := depot.GetCertificateRevocationList(d, ca)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s.crl: %v", ca, err))
+			continue
+		}
+		certList, err := x509.ParseDERCRL(crl.DERBytes())
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s.crl: %v", ca, err))
+			continue
+		}
+
+		serials := make(map[string]bool)
+		for _, rc := range certList.TBSCertList.RevokedCertificates {
+			serials[fmt.Sprintf("%X", rc.SerialNumber)] = true
+		}
+		revoked[hex.EncodeToString(rawCACrt.SubjectKeyId)] = serials
+	}
+	return revoked, problems
+}
+
+// certificateType classifies a certificate as root CA, intermediate CA or leaf.
+func certificateType(crt *x509.Certificate) string {
+	switch {
+	case !crt.IsCA:
+		return certTypeLeaf
+	case bytes.Equal(crt.RawIssuer, crt.RawSubject) && crt.CheckSignatureFrom(crt) == nil:
+		return certTypeRoot
+	default:
+		return certTypeIntermediate
+	}
+}
+
+func writeExpiriesText(w io.Writer, expiries []*certExpiry) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tTYPE\tNAME\tNOT AFTER\tREMAINING\tSUBJECT")
+	for _, e := range expiries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			strings.ToUpper(e.Status), e.Type, e.Name, e.NotAfter.Format(time.RFC3339),
+			e.Remaining.Truncate(time.Second), e.Subject)
+	}
+	tw.Flush()
+}
+
+func writeExpiriesJSON(w io.Writer, expiries []*certExpiry) error {
+	if expiries == nil {
+		expiries = []*certExpiry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(expiries)
+}
+
+func writeExpiriesPrometheus(w io.Writer, expiries []*certExpiry) {
+	metrics := []struct {
+		name, help string
+		value      func(*certExpiry) float64
+	}{{
+		"certstrap_certificate_expiry_seconds",
+		"Seconds until the certificate expires, negative once expired.",
+		func(e *certExpiry) float64 { return e.Remaining.Seconds() },
+	}, {
+		"certstrap_certificate_not_after_timestamp_seconds",
+		"Unix time at which the certificate expires.",
+		func(e *certExpiry) float64 { return float64(e.NotAfter.Unix()) },
+	}, {
+		"certstrap_certificate_expiring",
+		"Whether the certificate is unrevoked and expires within the reporting window or has expired.",
+		func(e *certExpiry) float64 { return boolMetric(e.Status == certStatusExpiring || e.Status == certStatusExpired) },
+	}, {
+		"certstrap_certificate_revoked",
+		"Whether the certificate appears on the CRL of its issuer.",
+		func(e *certExpiry) float64 { return boolMetric(e.Status == certStatusRevoked) },
+	}}
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", m.name)
+		for _, e := range expiries {
+			fmt.Fprintf(w, "%s{name=\"%s\",type=\"%s\",serial=\"%s\",subject=\"%s\"} %g\n",
+				m.name, escapeLabel(e.Name), e.Type, e.Serial, escapeLabel(e.Subject), m.value(e))
+		}
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a Prometheus label value.
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
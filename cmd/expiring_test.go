@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/certstrap/depot"
+	"github.com/urfave/cli"
+)
+
+func TestCheckExpiries(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "certstrap-expiring")
+	if err != nil {
+		t.Fatalf("could not create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	d, err = depot.NewFileDepot(tmp)
+	if err != nil {
+		t.Fatalf("could not create file depot: %v", err)
+	}
+
+	// The CA expires in a minute, so the host certificate is capped to that as well.
+	setupCA(t, d)
+	setupCN(t, d)
+
+	expiries, problems := checkExpiries(d, time.Second)
+	if len(problems) != 0 {
+		t.Fatalf("could not check expiries: %v", problems)
+	}
+	if len(expiries) != 2 {
+		t.Fatalf("unexpected number of certificates: want = 2, got = %d", len(expiries))
+	}
+	for _, e := range expiries {
+		if e.Status != certStatusOK {
+			t.Fatalf("%s: unexpected status %s outside of window", e.Name, e.Status)
+		}
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("CA", "", "")
+	fs.String("CN", "", "")
+	if err := fs.Parse([]string{"-CA", caName, "-CN", cnName}); err != nil {
+		t.Fatal("could not parse flags")
+	}
+	new(revokeCommand).run(cli.NewContext(nil, fs, nil))
+
+	// An unreadable certificate is reported without hiding the others
+	if err := os.WriteFile(filepath.Join(tmp, "broken.crt"), []byte("not a certificate"), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	expiries, problems = checkExpiries(d, 24*time.Hour)
+	if len(problems) != 1 || !strings.HasPrefix(problems[0].Error(), "broken: ") {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+	got := make(map[string]*certExpiry)
+	for _, e := range expiries {
+		got[e.Name] = e
+	}
+	if e := got[caName]; e == nil || e.Type != certTypeRoot || e.Status != certStatusExpiring {
+		t.Fatalf("unexpected CA report: %+v", e)
+	}
+	if e := got[cnName]; e == nil || e.Type != certTypeLeaf || e.Status != certStatusRevoked {
+		t.Fatalf("unexpected leaf report: %+v", e)
+	}
+
+	var buf bytes.Buffer
+	writeExpiriesPrometheus(&buf, expiries)
+	for _, want := range []string{
+		`certstrap_certificate_expiring{name="ca",type="root",`,
+		`certstrap_certificate_revoked{name="cn",type="leaf",`,
+		"# TYPE certstrap_certificate_expiry_seconds gauge",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("prometheus output does not contain %q:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := writeExpiriesJSON(&buf, expiries); err != nil {
+		t.Fatalf("could not write json: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"remaining_seconds": `) {
+		t.Fatalf("json output does not contain remaining seconds:\n%s", buf.String())
+	}
+}
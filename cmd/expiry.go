@@ -5,9 +5,11 @@ import (
 	"regexp"
 	"strconv"
 	"time"
+
+	"github.com/square/certstrap/pkix"
 )
 
-var nowFunc = time.Now
+var nowFunc = pkix.Now
 
 func parseExpiry(fromNow string) (time.Time, error) {
 	now := nowFunc().UTC()
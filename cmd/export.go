@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/pkix"
+	"github.com/urfave/cli"
+)
+
+// NewExportCommand sets up an "export" command to write certificates and their chains out of the depot
+func NewExportCommand() cli.Command {
+	return cli.Command{
+		Name:        "export",
+		Usage:       "Export a certificate and its chain",
+		Description: "Export a certificate from the depot, optionally followed by its issuing certificates ordered up to the root.",
+		ArgsUsage:   "<name>",
+		Flags: append(append([]cli.Flag{
+			cli.BoolFlag{
+				Name:  "chain",
+				Usage: "Include the intermediate certificates that issued the certificate",
+			},
+			cli.BoolFlag{
+				Name:  "include-root",
+				Usage: "Include the root certificate at the end of the chain",
+			},
+			cli.StringFlag{
+				Name:  "out",
+				Usage: "File to write the certificates to (default: stdout)",
+			},
+			formatFlag(formatPEM, formatDER, formatPKCS7, formatJWK, formatJKS, formatK8sSecret, formatK8sCASecret, formatSPIFFE),
+			cli.BoolFlag{
+				Name:  "truststore",
+				Usage: "With --format jks, write a truststore holding the root CA of the certificate instead of a keystore",
+			},
+			cli.StringFlag{
+				Name:  "store-password",
+				Usage: "Password protecting a JKS keystore or truststore",
+			},
+			cli.StringFlag{
+				Name:  "alias",
+				Usage: "Alias of the key in a JKS keystore (default: the certificate name)",
+			},
+			cli.StringFlag{
+				Name:  "passphrase",
+				Usage: "Passphrase to decrypt the private key for a JKS keystore or Kubernetes secret",
+			},
+			cli.StringFlag{
+				Name:  "namespace",
+				Usage: "Namespace of a Kubernetes secret",
+			},
+			cli.StringSliceFlag{
+				Name:  "label",
+				Usage: "Label of a Kubernetes secret as key=value (can be specified multiple times)",
+			},
+			cli.StringFlag{
+				Name:  "secret-name",
+				Usage: "Name of a Kubernetes secret (default: derived from the certificate name)",
+			},
+			shareFileFlag,
+		}, passphraseSourceFlags...), storePasswordSourceFlags...),
+		Action: exportAction,
+		Subcommands: []cli.Command{
+			{
+				Name:        "bundle",
+				Usage:       "Export all root certificates as a trust bundle",
+				Description: "Concatenate every root CA certificate in the depot into a single PEM file, suitable as a trust store.",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:  "out",
+						Usage: "File to write the bundle to (default: stdout)",
+					},
+					formatFlag(formatPEM, formatPKCS7, formatJWK, formatJKS, formatSPIFFE),
+					cli.StringFlag{
+						Name:  "store-password",
+						Usage: "Password protecting a JKS truststore",
+					},
+				}, storePasswordSourceFlags...),
+				Action: exportBundleAction,
+			},
+		},
+	}
+}
+
+func exportAction(c *cli.Context) {
+	if len(c.Args()) != 1 {
+		fmt.Fprintln(os.Stderr, "One name must be provided.")
+		os.Exit(1)
+	}
+	formattedName := strings.Replace(c.Args()[0], " ", "_", -1)
+	format := getFormat(c, formatPEM, formatDER, formatPKCS7, formatJWK, formatJKS, formatK8sSecret, formatK8sCASecret, formatSPIFFE)
+	if format == formatDER && (c.Bool("chain") || c.Bool("include-root")) {
+		fmt.Fprintln(os.Stderr, "DER format holds a single certificate, use pem or pkcs7 to export a chain")
+		os.Exit(1)
+	}
+
+	if !depot.CheckCertificate(d, formattedName) {
+		fmt.Fprintf(os.Stderr, "Certificate \"%s\" does not exist!\n", formattedName)
+		os.Exit(1)
+	}
+
+	chain, err := depot.GetCertificateChain(d, formattedName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Build certificate chain error:", err)
+		os.Exit(1)
+	}
+
+	switch format {
+	case formatJKS:
+		data, err := exportJKS(c, formattedName, chain)
+		if err == nil {
+			perm := os.FileMode(exportKeyPerm)
+			if c.Bool("truststore") {
+				perm = exportPerm
+			}
+			err = writeExport(c.String("out"), data, perm)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Export keystore error:", err)
+			os.Exit(1)
+		}
+		return
+	case formatK8sSecret, formatK8sCASecret:
+		data, err := exportK8sSecret(c, formattedName, chain, format == formatK8sCASecret)
+		if err == nil {
+			// The Secret holds the private key unencrypted in tls.key
+			err = writeExport(c.String("out"), data, exportKeyPerm)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Export secret error:", err)
+			os.Exit(1)
+		}
+		return
+	case formatSPIFFE:
+		// The trust bundle holds the root the certificate chains to
+		root := chain[len(chain)-1]
+		if !depot.IsRootCertificate(root) {
+			fmt.Fprintf(os.Stderr, "Root CA of \"%s\" is not in the depot\n", formattedName)
+			os.Exit(1)
+		}
+		data, err := pkix.ExportSPIFFEBundle([]*pkix.Certificate{root})
+		if err == nil {
+			err = writeExport(c.String("out"), append(data, '\n'), exportPerm)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Export bundle error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	crts := chain[:1]
+	if c.Bool("chain") || c.Bool("include-root") {
+		crts = chain
+		last := chain[len(chain)-1]
+		if !depot.IsRootCertificate(last) {
+			fmt.Fprintf(os.Stderr, "Warning: chain of \"%s\" is incomplete, the issuer of the last certificate is not in the depot\n", formattedName)
+		} else if !c.Bool("include-root") && len(chain) > 1 {
+			crts = chain[:len(chain)-1]
+		}
+	}
+
+	data, err := encodeCertificates(format, crts)
+	if err == nil {
+		err = writeExport(c.String("out"), data, exportPerm)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Export certificate error:", err)
+		os.Exit(1)
+	}
+}
+
+func exportBundleAction(c *cli.Context) {
+	format := getFormat(c, formatPEM, formatPKCS7, formatJWK, formatJKS, formatSPIFFE)
+
+	roots, err := depot.GetRootCertificates(d)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Read root certificates error:", err)
+		os.Exit(1)
+	}
+	if len(roots) == 0 {
+		fmt.Fprintln(os.Stderr, "No root certificates in the depot")
+		os.Exit(1)
+	}
+
+	var data []byte
+	switch format {
+	case formatJWK:
+		if data, err = pkix.ExportCertificatesJWKS(roots); err == nil {
+			data = append(data, '\n')
+		}
+	case formatSPIFFE:
+		if data, err = pkix.ExportSPIFFEBundle(roots); err == nil {
+			data = append(data, '\n')
+		}
+	case formatJKS:
+		var password []byte
+		if password, err = getStorePassword(c); err == nil {
+			data, err = pkix.ExportJKS(trustedJKSEntries(roots), password)
+		}
+	default:
+		data, err = encodeCertificates(format, roots)
+	}
+	if err == nil {
+		err = writeExport(c.String("out"), data, exportPerm)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Export bundle error:", err)
+		os.Exit(1)
+	}
+}
+
+// getExportKey loads the private key of name from the depot, asking for its passphrase if it is
+// encrypted, or for the shares of its passphrase if it is split.
+func getExportKey(c *cli.Context, name string) (*pkix.Key, error) {
+	if !depot.CheckPrivateKey(d, name) {
+		return nil, fmt.Errorf("private key \"%s\" does not exist", name)
+	}
+	return getFlagPrivateKey(c, name, "passphrase", name+" key")
+}
+
+// Modes of exported files. Files holding a private key are only readable by their owner,
+// like the keys in the depot, since keystore protection is weak.
+const (
+	exportPerm    = 0644
+	exportKeyPerm = 0600
+)
+
+// writeExport writes data to path with mode perm, or to stdout if path is empty.
+func writeExport(path string, data []byte, perm os.FileMode) error {
+	if path == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := depot.WriteFileAtomic(path, data, perm); err != nil {
+		return err
+	}
+	fmt.Printf("Created %s\n", path)
+	return nil
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/pkix"
+	"github.com/urfave/cli"
+)
+
+// Output formats selectable with --format. Files in the depot are always PEM;
+// other formats are written alongside them.
+const (
+	formatPEM   = "pem"
+	formatDER   = "der"
+	formatPKCS7 = "pkcs7"
+	formatJWK   = "jwk"
+	formatJKS   = "jks"
+	// formatSPIFFE is a SPIFFE trust bundle, the JWKS of the X.509 authorities of a trust domain
+	formatSPIFFE = "spiffe"
+)
+
+// formatExtensions are the file extensions of certificates written in non-PEM formats
+var formatExtensions = map[string]string{
+	formatDER:   ".cer",
+	formatPKCS7: ".p7b",
+	formatJWK:   ".jwk",
+}
+
+// csrFormatExtensions are the file extensions after ".csr" of certificate requests written in non-PEM formats
+var csrFormatExtensions = map[string]string{
+	formatDER: ".der",
+	formatJWK: ".jwk",
+}
+
+func formatFlag(formats ...string) cli.StringFlag {
+	return cli.StringFlag{
+		Name:  "format",
+		Value: formatPEM,
+		Usage: fmt.Sprintf("Output format, one of %s", strings.Join(formats, ", ")),
+	}
+}
+
+// getFormat returns the value of the --format flag, exiting if it is not one of formats.
+func getFormat(c *cli.Context, formats ...string) string {
+	format := strings.ToLower(c.String("format"))
+	for _, f := range formats {
+		if format == f {
+			return format
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown format %q, must be one of %s\n", c.String("format"), strings.Join(formats, ", "))
+	os.Exit(1)
+	return ""
+}
+
+// encodeCertificates encodes crts, a certificate followed by its chain, in format.
+// DER only holds the first certificate, and JWK carries the chain in its x5c member.
+func encodeCertificates(format string, crts []*pkix.Certificate) ([]byte, error) {
+	switch format {
+	case formatPEM:
+		var buf bytes.Buffer
+		for _, crt := range crts {
+			data, err := crt.Export()
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(data)
+		}
+		return buf.Bytes(), nil
+	case formatDER:
+		return crts[0].DERBytes(), nil
+	case formatPKCS7:
+		return pkix.ExportCertificatesPKCS7(crts)
+	case formatJWK:
+		data, err := crts[0].ExportJWK(crts[1:]...)
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// encodeCertificateSigningRequest encodes csr as PEM or DER
+func encodeCertificateSigningRequest(format string, csr *pkix.CertificateSigningRequest) ([]byte, error) {
+	switch format {
+	case formatPEM:
+		return csr.Export()
+	case formatDER:
+		return csr.DERBytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q for certificate requests", format)
+	}
+}
+
+// putFormattedCertificates writes crts in a non-PEM format next to the PEM files of name in the depot
+// and returns the path written.
+func putFormattedCertificates(format, name string, crts []*pkix.Certificate) (string, error) {
+	data, err := encodeCertificates(format, crts)
+	if err != nil {
+		return "", err
+	}
+	ext := formatExtensions[format]
+	return fmt.Sprintf("%s/%s%s", depotDir, name, ext), d.Put(depot.FormattedCrtTag(name, ext), data)
+}
+
+// putFormattedCertificateSigningRequest writes csr as DER, or the public key of the request as JWK,
+// next to the PEM files of name in the depot and returns the path written.
+func putFormattedCertificateSigningRequest(format, name string, csr *pkix.CertificateSigningRequest, key *pkix.Key) (string, error) {
+	var data []byte
+	switch format {
+	case formatDER:
+		data = csr.DERBytes()
+	case formatJWK:
+		jwk, err := key.ExportPublicJWK()
+		if err != nil {
+			return "", err
+		}
+		data = append(jwk, '\n')
+	default:
+		return "", fmt.Errorf("unsupported format %q for certificate requests", format)
+	}
+	ext := csrFormatExtensions[format]
+	return fmt.Sprintf("%s/%s.csr%s", depotDir, name, ext), d.Put(depot.FormattedCsrTag(name, ext), data)
+}
+
+// printFormatted prints data produced by encodeCertificates or an Export function to stdout
+func printFormatted(format string, data []byte) error {
+	if format == formatPEM {
+		// keep the blank line that PEM output has always been followed by
+		data = append(data, '\n')
+	}
+	_, err := os.Stdout.Write(data)
+	return err
+}
@@ -33,7 +33,7 @@ func NewInitCommand() cli.Command {
 		Name:        "init",
 		Usage:       "Create Certificate Authority",
 		Description: "Create Certificate Authority, including certificate, key and extra information file.",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.StringFlag{
 				Name:  "passphrase",
 				Usage: "Passphrase to encrypt private key PEM block",
@@ -41,12 +41,14 @@ func NewInitCommand() cli.Command {
 			cli.IntFlag{
 				Name:  "key-bits",
 				Value: 4096,
-				Usage: "Size (in bits) of RSA keypair to generate (example: 4096)",
+				Usage: "Size (in bits) of RSA keypair to generate (example: 4096, same as --key-type rsa:4096)",
 			},
 			cli.StringFlag{
 				Name:  "curve",
-				Usage: fmt.Sprintf("Elliptic curve name. Must be one of %s.", supportedCurves()),
+				Usage: fmt.Sprintf("Key type other than RSA by its curve name, one of %s (same as --key-type)", supportedCurves()),
 			},
+			keyTypeFlag,
+			allowWeakFlag,
 			cli.IntFlag{
 				Name:   "years",
 				Hidden: true,
@@ -88,10 +90,16 @@ func NewInitCommand() cli.Command {
 				Name:  "stdout",
 				Usage: "Print certificate to stdout in addition to saving file",
 			},
+			formatFlag(formatPEM, formatDER, formatPKCS7, formatJWK),
+			signatureAlgorithmFlag(),
 			cli.StringSliceFlag{
 				Name:  "permit-domain",
 				Usage: "Create a CA restricted to subdomains of this domain (can be specified multiple times)",
 			},
+			cli.StringFlag{
+				Name:  "spiffe-trust-domain",
+				Usage: "Create a CA for this SPIFFE trust domain, whose URI names are restricted to the trust domain (example: example.org)",
+			},
 			cli.IntFlag{
 				Name:  "path-length",
 				Value: 0,
@@ -101,7 +109,15 @@ func NewInitCommand() cli.Command {
 				Name:  "exclude-path-length",
 				Usage: "Exclude 'Path Length Constraint' from this CA certificate",
 			},
-		},
+			cli.StringFlag{
+				Name:  "split",
+				Usage: "Encrypt the private key with a random passphrase split into M shares, N of which are needed to use it (example: 2/3)",
+			},
+			cli.StringFlag{
+				Name:  "share-dir",
+				Usage: "Save the shares of --split to files in this directory instead of printing them",
+			},
+		}, passphraseSourceFlags...),
 		Action: initAction,
 	}
 }
@@ -113,6 +129,15 @@ func initAction(c *cli.Context) {
 	}
 
 	formattedName := strings.Replace(c.String("common-name"), " ", "_", -1)
+	format := getFormat(c, formatPEM, formatDER, formatPKCS7, formatJWK)
+	signatureAlgorithm := getSignatureAlgorithm(c)
+	// the key type flags are ignored for a key that is read with --key
+	var keyType *pkix.KeyType
+	if !c.IsSet("key") {
+		keyType = getKeyType(c)
+	}
+
+	defer lockDepot()()
 
 	if depot.CheckCertificate(d, formattedName) || depot.CheckPrivateKey(d, formattedName) {
 		fmt.Fprintf(os.Stderr, "CA with specified name \"%s\" already exists!\n", formattedName)
@@ -124,6 +149,13 @@ func initAction(c *cli.Context) {
 		os.Exit(1)
 	}
 
+	if td := c.String("spiffe-trust-domain"); td != "" {
+		if err := pkix.ValidateSPIFFETrustDomain(td); err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid SPIFFE trust domain:", err)
+			os.Exit(1)
+		}
+	}
+
 	var err error
 	expires := c.String("expires")
 	if years := c.Int("years"); years != 0 {
@@ -139,11 +171,30 @@ func initAction(c *cli.Context) {
 	}
 
 	var passphrase []byte
-	if c.IsSet("passphrase") {
-		passphrase = []byte(c.String("passphrase"))
+	var shares []string
+	var threshold int
+	if c.IsSet("split") {
+		for _, flag := range []string{"passphrase", "passphrase-file", "passphrase-env", "passphrase-fd", "passphrase-cmd"} {
+			if c.IsSet(flag) {
+				fmt.Fprintf(os.Stderr, "The \"split\" flag generates the passphrase, it cannot be used with \"%s\"!\n", flag)
+				os.Exit(1)
+			}
+		}
+		var count int
+		if threshold, count, err = parseSplit(c.String("split")); err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid split:", err)
+			os.Exit(1)
+		}
+		if passphrase, shares, err = newSplitPassPhrase(threshold, count); err != nil {
+			fmt.Fprintln(os.Stderr, "Split passphrase error:", err)
+			os.Exit(1)
+		}
 	} else {
-		passphrase, err = createPassPhrase()
-		if err != nil {
+		if c.IsSet("share-dir") {
+			fmt.Fprintf(os.Stderr, "The \"share-dir\" flag can only be used with \"split\"!\n")
+			os.Exit(1)
+		}
+		if passphrase, err = newPassPhrase(c); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
@@ -164,22 +215,10 @@ func initAction(c *cli.Context) {
 			os.Exit(1)
 		}
 		fmt.Printf("Read %s\n", c.String("key"))
-	case c.IsSet("curve"):
-		curve := c.String("curve")
-		key, err = createKeyOnCurve(curve)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Create %s Key error: %v\n", curve, err)
-			os.Exit(1)
-		}
-		if len(passphrase) > 0 {
-			fmt.Printf("Created %s/%s.key (encrypted by passphrase)\n", depotDir, formattedName)
-		} else {
-			fmt.Printf("Created %s/%s.key\n", depotDir, formattedName)
-		}
 	default:
-		key, err = pkix.CreateRSAKey(c.Int("key-bits"))
+		key, err = keyType.Create()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Create RSA Key error:", err)
+			fmt.Fprintf(os.Stderr, "Create %s Key error: %v\n", keyType, err)
 			os.Exit(1)
 		}
 		if len(passphrase) > 0 {
@@ -189,8 +228,13 @@ func initAction(c *cli.Context) {
 		}
 	}
 
+	checkSignatureAlgorithm(key, signatureAlgorithm)
 	opts := []pkix.Option{
 		pkix.WithPathlenOption(c.Int("path-length"), c.Bool("exclude-path-length")),
+		pkix.WithSignatureAlgorithmOption(signatureAlgorithm),
+	}
+	if td := c.String("spiffe-trust-domain"); td != "" {
+		opts = append(opts, pkix.WithSPIFFETrustDomainOption(td))
 	}
 
 	crt, err := pkix.CreateCertificateAuthorityWithOptions(key, c.String("organizational-unit"), expiresTime, c.String("organization"), c.String("country"), c.String("province"), c.String("locality"), c.String("common-name"), c.StringSlice("permit-domain"), opts...)
@@ -202,18 +246,27 @@ func initAction(c *cli.Context) {
 	fmt.Printf("Created %s/%s.crt\n", depotDir, formattedName)
 
 	if c.Bool("stdout") {
-		crtBytes, err := crt.Export()
+		crtBytes, err := encodeCertificates(format, []*pkix.Certificate{crt})
+		if err == nil {
+			err = printFormatted(format, crtBytes)
+		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Print CA certificate error:", err)
 			os.Exit(1)
-		} else {
-			fmt.Println(string(crtBytes))
 		}
 	}
 
 	if err = depot.PutCertificate(d, formattedName, crt); err != nil {
 		fmt.Fprintln(os.Stderr, "Save certificate error:", err)
 	}
+	if format != formatPEM {
+		path, err := putFormattedCertificates(format, formattedName, []*pkix.Certificate{crt})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Save certificate error:", err)
+		} else {
+			fmt.Printf("Created %s\n", path)
+		}
+	}
 	if len(passphrase) > 0 {
 		if err = depot.PutEncryptedPrivateKey(d, formattedName, key, passphrase); err != nil {
 			fmt.Fprintln(os.Stderr, "Save encrypted private key error:", err)
@@ -223,7 +276,6 @@ func initAction(c *cli.Context) {
 			fmt.Fprintln(os.Stderr, "Save private key error:", err)
 		}
 	}
-
 	// Create an empty CRL, this is useful for Java apps which mandate a CRL.
 	crl, err := pkix.CreateCertificateRevocationList(key, crt, expiresTime)
 	if err != nil {
@@ -235,4 +287,24 @@ func initAction(c *cli.Context) {
 		os.Exit(1)
 	}
 	fmt.Printf("Created %s/%s.crl\n", depotDir, formattedName)
+
+	if len(shares) > 0 {
+		if err = depot.PutSplit(d, formattedName, &depot.Split{Threshold: threshold, Shares: len(shares)}); err != nil {
+			fmt.Fprintln(os.Stderr, "Save split record error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Created %s/%s.split\n", depotDir, formattedName)
+		if dir := c.String("share-dir"); dir != "" {
+			if err = putShares(dir, formattedName, shares); err != nil {
+				fmt.Fprintln(os.Stderr, "Save shares error:", err)
+				os.Exit(1)
+			}
+		} else {
+			fmt.Printf("The passphrase of %s/%s.key is split into %d shares, any %d of which unlock it. Give each to a different person:\n",
+				depotDir, formattedName, len(shares), threshold)
+			for i, share := range shares {
+				fmt.Printf("Share %d of %d: %s\n", i+1, len(shares), share)
+			}
+		}
+	}
 }
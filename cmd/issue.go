@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/square/certstrap/pkix"
+	"github.com/square/certstrap/service"
+	"github.com/urfave/cli"
+)
+
+// depotIssuer issues host certificates with a CA in the depot and records them in its index
+type depotIssuer struct {
+	*service.CA
+	expires string
+
+	mu sync.Mutex
+}
+
+func newDepotIssuer(c *cli.Context, ca, expires string) (*depotIssuer, error) {
+	key, err := getCAPrivateKey(c, ca)
+	if err != nil {
+		return nil, err
+	}
+	authority, err := service.NewCA(d, ca, key)
+	if err != nil {
+		return nil, err
+	}
+	return &depotIssuer{CA: authority, expires: expires}, nil
+}
+
+// caCertificates returns the CA certificate followed by its chain up to and including the root
+func (i *depotIssuer) caCertificates() []*pkix.Certificate {
+	crts := append([]*pkix.Certificate{}, i.Chain()...)
+	if root := i.Root(); root != nil {
+		crts = append(crts, root)
+	}
+	return crts
+}
+
+// Issue signs csr and adds the certificate to the CA index under its serial number. The
+// names in csr are chosen by the requester, so they must not decide which index entries
+// the certificate is listed with.
+func (i *depotIssuer) Issue(csr *pkix.CertificateSigningRequest) ([]*pkix.Certificate, error) {
+	raw, err := csr.GetRawCertificateSigningRequest()
+	if err != nil {
+		return nil, err
+	}
+	name := raw.Subject.CommonName
+	if len(raw.DNSNames) > 0 {
+		name = raw.DNSNames[0]
+	}
+	expiresTime, err := parseExpiry(i.expires)
+	if err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	unlock, err := i.Lock()
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer unlock()
+
+	crt, err := i.Sign(service.SignRequest{
+		CSR:      csr,
+		Profile:  service.ProfileHost,
+		NotAfter: expiresTime,
+		Operator: currentOperator(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "Issued certificate for %s signed by %s/%s.key\n", name, depotDir, i.Name())
+	return append([]*pkix.Certificate{crt}, i.Chain()...), nil
+}
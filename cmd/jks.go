@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/square/certstrap/pkix"
+	"github.com/urfave/cli"
+)
+
+// exportJKS builds a JKS keystore holding the private key of name and its chain,
+// or with --truststore a truststore holding the root of the chain.
+func exportJKS(c *cli.Context, name string, chain []*pkix.Certificate) ([]byte, error) {
+	if c.Bool("truststore") {
+		password, err := getStorePassword(c)
+		if err != nil {
+			return nil, err
+		}
+		return pkix.ExportJKS(trustedJKSEntries(chain[len(chain)-1:]), password)
+	}
+
+	key, err := getExportKey(c, name)
+	if err != nil {
+		return nil, err
+	}
+	password, err := getStorePassword(c)
+	if err != nil {
+		return nil, err
+	}
+
+	alias := name
+	if c.IsSet("alias") {
+		alias = c.String("alias")
+	}
+	entry := &pkix.JKSEntry{Alias: alias, Created: nowFunc(), Key: key, Certificates: chain}
+	return pkix.ExportJKS([]*pkix.JKSEntry{entry}, password)
+}
+
+// trustedJKSEntries makes a trusted certificate entry for each certificate, aliased by its
+// common name. Common names shared by several certificates get a numeric suffix.
+func trustedJKSEntries(crts []*pkix.Certificate) []*pkix.JKSEntry {
+	var entries []*pkix.JKSEntry
+	seen := map[string]int{}
+	for _, crt := range crts {
+		alias := "ca"
+		if raw, err := crt.GetRawCertificate(); err == nil && raw.Subject.CommonName != "" {
+			alias = strings.ToLower(strings.Replace(raw.Subject.CommonName, " ", "_", -1))
+		}
+		seen[alias]++
+		if n := seen[alias]; n > 1 {
+			alias = fmt.Sprintf("%s-%d", alias, n)
+		}
+		entries = append(entries, &pkix.JKSEntry{Alias: alias, Created: nowFunc(), Certificates: []*pkix.Certificate{crt}})
+	}
+	return entries
+}
+
+// storePasswordSourceFlags read the JKS store password from somewhere other than the command line
+var storePasswordSourceFlags = passphraseSources("store-password", "the store password")
+
+// getStorePassword returns the password given by the --store-password flags, or asks for the keystore password.
+func getStorePassword(c *cli.Context) ([]byte, error) {
+	password, err := getFlagPassPhrase(c, "store-password", "keystore")
+	if err != nil {
+		return nil, err
+	}
+	if len(password) == 0 {
+		return nil, errors.New("keystore password must not be empty")
+	}
+	return password, nil
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/pkix"
+	"github.com/urfave/cli"
+)
+
+const (
+	// formatK8sSecret is a kubernetes.io/tls Secret holding a certificate, its key and the root CA
+	formatK8sSecret = "k8s-secret"
+	// formatK8sCASecret is a kubernetes.io/tls Secret holding a CA certificate and key,
+	// as expected by the CA Issuer of cert-manager
+	formatK8sCASecret = "k8s-ca-secret"
+
+	k8sSecretTypeTLS = "kubernetes.io/tls"
+)
+
+var (
+	// k8sNameRegexp matches DNS-1123 subdomains, which Secret names must be
+	k8sNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+	// k8sLabelKeyRegexp matches label keys with an optional DNS subdomain prefix
+	k8sLabelKeyRegexp = regexp.MustCompile(`^([a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*/)?[A-Za-z0-9]([-A-Za-z0-9_.]{0,61}[A-Za-z0-9])?$`)
+	// k8sLabelValueRegexp matches label values
+	k8sLabelValueRegexp = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]{0,61}[A-Za-z0-9])?)?$`)
+
+	k8sInvalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+)
+
+// k8sSecret is a Kubernetes Secret manifest
+type k8sSecret struct {
+	Name      string
+	Namespace string
+	Labels    map[string]string
+	Type      string
+	Data      map[string][]byte
+}
+
+// exportK8sSecret builds a Secret manifest for the certificate name and its chain.
+// With ca set, the certificate must be a CA and the Secret is meant for a cert-manager CA Issuer.
+func exportK8sSecret(c *cli.Context, name string, chain []*pkix.Certificate, ca bool) ([]byte, error) {
+	raw, err := chain[0].GetRawCertificate()
+	if err != nil {
+		return nil, err
+	}
+	if ca && !raw.IsCA {
+		return nil, fmt.Errorf("certificate \"%s\" is not a CA", name)
+	}
+
+	secretName := k8sSecretName(name)
+	if c.IsSet("secret-name") {
+		secretName = c.String("secret-name")
+	}
+	if len(secretName) > 253 || !k8sNameRegexp.MatchString(secretName) {
+		return nil, fmt.Errorf("invalid secret name %q, must be a lowercase DNS subdomain", secretName)
+	}
+	labels, err := parseK8sLabels(c.StringSlice("label"))
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := getExportKey(c, name)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err := key.ExportPrivate()
+	if err != nil {
+		return nil, err
+	}
+
+	// tls.crt holds the certificate and its intermediates, ca.crt the root they chain to
+	crts := chain
+	root := chain[len(chain)-1]
+	if depot.IsRootCertificate(root) {
+		if len(chain) > 1 {
+			crts = chain[:len(chain)-1]
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: chain of \"%s\" is incomplete, the issuer of the last certificate is not in the depot\n", name)
+	}
+	crtBytes, err := encodeCertificates(formatPEM, crts)
+	if err != nil {
+		return nil, err
+	}
+	caBytes, err := root.Export()
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &k8sSecret{
+		Name:      secretName,
+		Namespace: c.String("namespace"),
+		Labels:    labels,
+		Type:      k8sSecretTypeTLS,
+		Data: map[string][]byte{
+			"tls.crt": crtBytes,
+			"tls.key": keyBytes,
+			"ca.crt":  caBytes,
+		},
+	}
+	return secret.Marshal(), nil
+}
+
+// k8sSecretName turns a depot name into a valid Secret name
+func k8sSecretName(name string) string {
+	name = strings.ToLower(name)
+	name = k8sInvalidNameChars.ReplaceAllString(name, "-")
+	return strings.Trim(name, "-.")
+}
+
+// parseK8sLabels parses labels given as key=value
+func parseK8sLabels(labels []string) (map[string]string, error) {
+	parsed := map[string]string{}
+	for _, label := range labels {
+		kv := strings.SplitN(label, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid label %q, must be key=value", label)
+		}
+		if !k8sLabelKeyRegexp.MatchString(kv[0]) {
+			return nil, fmt.Errorf("invalid label key %q", kv[0])
+		}
+		if !k8sLabelValueRegexp.MatchString(kv[1]) {
+			return nil, fmt.Errorf("invalid label value %q", kv[1])
+		}
+		parsed[kv[0]] = kv[1]
+	}
+	return parsed, nil
+}
+
+// Marshal returns the Secret as a YAML manifest
+func (s *k8sSecret) Marshal() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("apiVersion: v1\nkind: Secret\nmetadata:\n")
+	fmt.Fprintf(&buf, "  name: %s\n", yamlString(s.Name))
+	if s.Namespace != "" {
+		fmt.Fprintf(&buf, "  namespace: %s\n", yamlString(s.Namespace))
+	}
+	if len(s.Labels) > 0 {
+		buf.WriteString("  labels:\n")
+		for _, k := range sortedKeys(s.Labels) {
+			fmt.Fprintf(&buf, "    %s: %s\n", yamlString(k), yamlString(s.Labels[k]))
+		}
+	}
+	fmt.Fprintf(&buf, "type: %s\n", s.Type)
+	buf.WriteString("data:\n")
+	keys := make([]string, 0, len(s.Data))
+	for k := range s.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "  %s: %s\n", k, base64.StdEncoding.EncodeToString(s.Data[k]))
+	}
+	return buf.Bytes()
+}
+
+// yamlString quotes s as a YAML double-quoted scalar, which accepts JSON string syntax
+func yamlString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestK8sSecretName(t *testing.T) {
+	for name, want := range map[string]string{
+		"host1.example.com": "host1.example.com",
+		"My_CA":             "my-ca",
+		"_CA_":              "ca",
+	} {
+		if got := k8sSecretName(name); got != want {
+			t.Errorf("k8sSecretName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestParseK8sLabels(t *testing.T) {
+	labels, err := parseK8sLabels([]string{"app=web", "example.com/team=infra", "empty="})
+	if err != nil {
+		t.Fatal("Failed parsing labels:", err)
+	}
+	if labels["app"] != "web" || labels["example.com/team"] != "infra" || labels["empty"] != "" {
+		t.Fatalf("Unexpected labels %v", labels)
+	}
+
+	for _, label := range []string{"app", "-app=web", "app=we b", "app=" + string(make([]byte, 64))} {
+		if _, err := parseK8sLabels([]string{label}); err == nil {
+			t.Errorf("Expect error parsing label %q", label)
+		}
+	}
+}
+
+func TestK8sSecretMarshal(t *testing.T) {
+	secret := &k8sSecret{
+		Name:      "web",
+		Namespace: "prod",
+		Labels:    map[string]string{"tier": "front", "app": "web"},
+		Type:      k8sSecretTypeTLS,
+		Data:      map[string][]byte{"tls.key": []byte("key"), "tls.crt": []byte("crt")},
+	}
+	want := `apiVersion: v1
+kind: Secret
+metadata:
+  name: "web"
+  namespace: "prod"
+  labels:
+    "app": "web"
+    "tier": "front"
+type: kubernetes.io/tls
+data:
+  tls.crt: Y3J0
+  tls.key: a2V5
+`
+	if got := string(secret.Marshal()); got != want {
+		t.Fatalf("Unexpected manifest:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/pkix"
+	"github.com/urfave/cli"
+)
+
+// NewKeyCommand sets up a "key" command to manage the private keys of the depot
+func NewKeyCommand() cli.Command {
+	return cli.Command{
+		Name:  "key",
+		Usage: "Manage private keys in the depot",
+		Subcommands: []cli.Command{
+			{
+				Name:  "passwd",
+				Usage: "Change or remove the passphrase of a private key",
+				Description: "Decrypt a private key of the depot with its passphrase and encrypt it again with a new one, or store\n" +
+					"   it unencrypted if the new passphrase is empty. The key file is replaced atomically and keeps its permissions.\n" +
+					"   A passphrase split by init --split is recombined from its shares, and is no longer split afterwards.",
+				ArgsUsage: "NAME",
+				Flags: append(append([]cli.Flag{
+					cli.StringFlag{
+						Name:  "passphrase",
+						Usage: "Current passphrase of the private key",
+					},
+					shareFileFlag,
+				}, passphraseSourceFlags...), append([]cli.Flag{
+					cli.StringFlag{
+						Name:  "new-passphrase",
+						Usage: "New passphrase of the private key (empty to remove encryption)",
+					},
+				}, passphraseSources("new-passphrase", "the new passphrase")...)...),
+				Action: keyPasswdAction,
+			},
+		},
+	}
+}
+
+func keyPasswdAction(c *cli.Context) {
+	if len(c.Args()) != 1 {
+		fmt.Fprintln(os.Stderr, "One key name must be provided.")
+		os.Exit(1)
+	}
+	name := strings.Replace(c.Args()[0], " ", "_", -1)
+
+	defer lockDepot()()
+
+	if _, err := d.Stat(depot.PrivKeyTag(name)); err != nil {
+		fmt.Fprintln(os.Stderr, "Read key error:", err)
+		os.Exit(1)
+	}
+	key, err := getFlagPrivateKey(c, name, "passphrase", name+" key")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Decrypt key error:", err)
+		os.Exit(1)
+	}
+
+	pass, ok, err := readPassphraseFlags(c, "new-passphrase")
+	if !ok && err == nil {
+		pass, err = createPassPhrase()
+		err = promptError(c, "new-passphrase", err)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Get new passphrase error:", err)
+		os.Exit(1)
+	}
+
+	var keyBytes []byte
+	if len(pass) > 0 {
+		keyBytes, err = key.ExportEncryptedPrivate(pass)
+	} else {
+		keyBytes, err = key.ExportPrivate()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Export key error:", err)
+		os.Exit(1)
+	}
+	// Check the new file before it replaces the old one
+	if len(pass) > 0 {
+		_, err = pkix.NewKeyFromEncryptedPrivateKeyPEM(keyBytes, pass)
+	} else {
+		_, err = pkix.NewKeyFromPrivateKeyPEM(keyBytes)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Export key error:", err)
+		os.Exit(1)
+	}
+	if err := d.ReplaceKeepMode(depot.PrivKeyTag(name), keyBytes); err != nil {
+		fmt.Fprintln(os.Stderr, "Save key error:", err)
+		os.Exit(1)
+	}
+	if len(pass) > 0 {
+		fmt.Printf("Updated %s/%s.key (encrypted by passphrase)\n", depotDir, name)
+	} else {
+		fmt.Printf("Updated %s/%s.key (not encrypted)\n", depotDir, name)
+	}
+	// The new passphrase is not split, so the shares are of no more use
+	if depot.CheckSplit(d, name) {
+		if err := depot.DeleteSplit(d, name); err != nil {
+			fmt.Fprintln(os.Stderr, "Delete split record error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted %s/%s.split\n", depotDir, name)
+	}
+}
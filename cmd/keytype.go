@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/square/certstrap/pkix"
+	"github.com/urfave/cli"
+)
+
+// keyTypeFlag selects the type of a new key. --curve and --key-bits are kept as shorthands
+// for the key types other than RSA and for rsa:BITS.
+var keyTypeFlag = cli.StringFlag{
+	Name:  "key-type",
+	Usage: fmt.Sprintf("Type of key to generate, one of %s (example: rsa:3072, ec:P-384)", strings.Join(pkix.KeyTypes(), ", ")),
+}
+
+// allowWeakFlag permits key types that are weak, such as RSA keys below 2048 bits or P-224
+var allowWeakFlag = cli.BoolFlag{
+	Name:  "allow-weak",
+	Usage: "Allow weak keys, such as RSA keys below 2048 bits or P-224 keys",
+}
+
+// supportedCurves returns the list of supported curve names as a comma separated
+// string for use in help text and error messages.
+func supportedCurves() string {
+	return strings.Join(pkix.Curves(), ", ")
+}
+
+// keyTypeFromFlags returns the key type selected by --key-type, --curve or --key-bits,
+// in that order, rejecting weak key types unless --allow-weak is given
+func keyTypeFromFlags(c *cli.Context) (*pkix.KeyType, error) {
+	var set []string
+	for _, flag := range []string{"key-type", "curve", "key-bits"} {
+		if c.IsSet(flag) {
+			set = append(set, "--"+flag)
+		}
+	}
+	if len(set) > 1 {
+		return nil, fmt.Errorf("only one of %s can be given", strings.Join(set, ", "))
+	}
+
+	var keyType *pkix.KeyType
+	var err error
+	switch {
+	case c.IsSet("key-type"):
+		keyType, err = pkix.ParseKeyType(c.String("key-type"))
+	case c.IsSet("curve"):
+		if !slices.Contains(pkix.Curves(), c.String("curve")) {
+			return nil, fmt.Errorf("unknown curve %q, curve must be one of %s", c.String("curve"), supportedCurves())
+		}
+		keyType, err = pkix.ParseKeyType(c.String("curve"))
+	default:
+		keyType, err = pkix.ParseKeyType(fmt.Sprintf("rsa:%d", c.Int("key-bits")))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return keyType, checkWeakKeyType(c, keyType)
+}
+
+// checkWeakKeyType fails for a weak key type unless --allow-weak is given
+func checkWeakKeyType(c *cli.Context, keyType *pkix.KeyType) error {
+	if keyType.Weak() && !c.Bool("allow-weak") {
+		return fmt.Errorf("%s keys are weak, use --allow-weak to use one anyway", keyType)
+	}
+	return nil
+}
+
+// getKeyType returns the key type selected by the flags, exiting if it is unknown or weak
+func getKeyType(c *cli.Context) *pkix.KeyType {
+	keyType, err := keyTypeFromFlags(c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid key type:", err)
+		os.Exit(1)
+	}
+	return keyType
+}
+
+// createKeyFromFlags creates a new key as selected by the --key-type, --curve and --key-bits flags.
+func createKeyFromFlags(c *cli.Context) (*pkix.Key, error) {
+	keyType, err := keyTypeFromFlags(c)
+	if err != nil {
+		return nil, err
+	}
+	return keyType.Create()
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/square/certstrap/depot"
+	"github.com/urfave/cli"
+)
+
+// NewLogCommand sets up a "log" command to query the issued-certificate index of a CA
+func NewLogCommand() cli.Command {
+	return cli.Command{
+		Name:        "log",
+		Usage:       "Show certificates issued by a CA",
+		Description: "Show the issued-certificate index of a CA, which records every certificate signed or revoked by it.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "CA",
+				Usage: "Name of CA to show the index of",
+			},
+			cli.StringFlag{
+				Name:  "name",
+				Usage: "Only show entries for certificates with this depot name",
+			},
+			cli.StringFlag{
+				Name:  "serial",
+				Usage: "Only show entries for the certificate with this hex serial number",
+			},
+			cli.StringFlag{
+				Name:  "status",
+				Usage: fmt.Sprintf("Only show entries with this status (%s, %s or %s)", depot.StatusIssued, depot.StatusRevoked, depot.StatusSuperseded),
+			},
+			cli.BoolFlag{
+				Name:  "current",
+				Usage: "Show only the current status of every certificate instead of the full audit trail",
+			},
+			cli.BoolFlag{
+				Name:  "json",
+				Usage: "Print entries as JSON lines",
+			},
+		},
+		Action: logAction,
+	}
+}
+
+func logAction(c *cli.Context) {
+	if c.String("CA") == "" {
+		fmt.Fprintln(os.Stderr, "CA name must be provided")
+		os.Exit(1)
+	}
+	formattedCAName := strings.Replace(c.String("CA"), " ", "_", -1)
+
+	if !depot.CheckCertificate(d, formattedCAName) {
+		fmt.Fprintf(os.Stderr, "CA \"%s\" does not exist!\n", formattedCAName)
+		os.Exit(1)
+	}
+
+	entries, err := depot.GetIndex(d, formattedCAName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Read CA index error:", err)
+		os.Exit(1)
+	}
+	if c.Bool("current") {
+		entries = depot.LatestIndexEntries(entries)
+	}
+	entries = filterIndexEntries(entries, c.String("name"), c.String("serial"), c.String("status"))
+
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				fmt.Fprintln(os.Stderr, "Print CA index error:", err)
+				os.Exit(1)
+			}
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIMESTAMP\tSTATUS\tSERIAL\tNAME\tNOT AFTER\tOPERATOR\tSUBJECT")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Timestamp.Format(time.RFC3339), e.Status, e.Serial, e.Name,
+			e.NotAfter.Format(time.RFC3339), e.Operator, e.Subject)
+	}
+	w.Flush()
+}
+
+func filterIndexEntries(entries []*depot.IndexEntry, name, serial, status string) []*depot.IndexEntry {
+	var result []*depot.IndexEntry
+	for _, e := range entries {
+		if name != "" && e.Name != strings.Replace(name, " ", "_", -1) {
+			continue
+		}
+		if serial != "" && !strings.EqualFold(e.Serial, serial) {
+			continue
+		}
+		if status != "" && e.Status != status {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli"
+	"golang.org/x/term"
+)
+
+// passphraseSourceFlags read the passphrase from somewhere other than the command line,
+// which leaks into ps and shell history. They are alternatives to --passphrase.
+var passphraseSourceFlags = passphraseSources("passphrase", "the passphrase")
+
+// passphraseSources returns the flags reading the passphrase of the flag name from a file,
+// an environment variable, a file descriptor or a command
+func passphraseSources(name, what string) []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  name + "-file",
+			Usage: fmt.Sprintf("Read %s from the first line of this file", what),
+		},
+		cli.StringFlag{
+			Name:  name + "-env",
+			Usage: fmt.Sprintf("Read %s from this environment variable", what),
+		},
+		cli.IntFlag{
+			Name:  name + "-fd",
+			Usage: fmt.Sprintf("Read %s from the first line of this file descriptor (0 for stdin)", what),
+		},
+		cli.StringFlag{
+			Name:  name + "-cmd",
+			Usage: fmt.Sprintf("Run this shell command and read %s from the first line of its output", what),
+		},
+	}
+}
+
+// errNotTerminal is returned instead of prompting for a passphrase when stdin is not a
+// terminal, rather than reading stdin or waiting for input that never comes
+var errNotTerminal = errors.New("stdin is not a terminal, cannot prompt for a passphrase")
+
+// stdinIsTerminal reports whether passphrases can be prompted for
+var stdinIsTerminal = func() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// flagPassphrases caches the passphrases read from the passphrase flags by flag name,
+// since a file descriptor or command can only be read once
+var flagPassphrases = map[string][]byte{}
+
+// passphraseFromFlags returns the passphrase given by --passphrase or one of
+// passphraseSourceFlags. ok is false if none is set.
+func passphraseFromFlags(c *cli.Context) (pass []byte, ok bool, err error) {
+	return readPassphraseFlags(c, "passphrase")
+}
+
+// readPassphraseFlags returns the passphrase given by the flag name or one of the flags
+// of passphraseSources(name). ok is false if none is set.
+func readPassphraseFlags(c *cli.Context, name string) (pass []byte, ok bool, err error) {
+	if pass, ok := flagPassphrases[name]; ok {
+		return pass, true, nil
+	}
+	var set []string
+	for _, flag := range []string{name, name + "-file", name + "-env", name + "-fd", name + "-cmd"} {
+		if c.IsSet(flag) {
+			set = append(set, "--"+flag)
+		}
+	}
+	switch len(set) {
+	case 0:
+		return nil, false, nil
+	case 1:
+	default:
+		return nil, false, fmt.Errorf("only one of %s can be given", strings.Join(set, ", "))
+	}
+
+	switch {
+	case c.IsSet(name):
+		pass = []byte(c.String(name))
+	case c.IsSet(name + "-file"):
+		data, err := os.ReadFile(c.String(name + "-file"))
+		if err != nil {
+			return nil, false, fmt.Errorf("read passphrase file: %v", err)
+		}
+		pass = firstLine(data)
+	case c.IsSet(name + "-env"):
+		value, found := os.LookupEnv(c.String(name + "-env"))
+		if !found {
+			return nil, false, fmt.Errorf("passphrase environment variable %s is not set", c.String(name+"-env"))
+		}
+		pass = []byte(value)
+	case c.IsSet(name + "-fd"):
+		fd := c.Int(name + "-fd")
+		if fd < 0 {
+			return nil, false, fmt.Errorf("invalid passphrase file descriptor %d", fd)
+		}
+		f := os.Stdin
+		if fd != 0 {
+			f = os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+			defer f.Close()
+		}
+		// Only the first line is read, so the writer need not close the descriptor
+		pass, err = readLine(f)
+		if err != nil {
+			return nil, false, fmt.Errorf("read passphrase file descriptor: %v", err)
+		}
+	case c.IsSet(name + "-cmd"):
+		cmd := exec.Command("/bin/sh", "-c", c.String(name+"-cmd"))
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", c.String(name+"-cmd"))
+		}
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = os.Stderr
+		data, err := cmd.Output()
+		if err != nil {
+			return nil, false, fmt.Errorf("passphrase command failed: %v", err)
+		}
+		pass = firstLine(data)
+	}
+	flagPassphrases[name] = pass
+	return pass, true, nil
+}
+
+// firstLine returns data up to its first line ending
+func firstLine(data []byte) []byte {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[:i]
+	}
+	return bytes.TrimSuffix(data, []byte("\r"))
+}
+
+// readLine reads r up to the first line ending or EOF, one byte at a time so that nothing
+// after the line is consumed
+func readLine(r io.Reader) ([]byte, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bytes.TrimSuffix(line, []byte("\r")), nil
+}
+
+// newPassPhrase returns the passphrase to encrypt a new private key with, given by the
+// passphrase flags or otherwise prompted for twice. It is empty for no encryption.
+func newPassPhrase(c *cli.Context) ([]byte, error) {
+	return newFlagPassPhrase(c, "passphrase")
+}
+
+// newFlagPassPhrase is newPassPhrase for the passphrase given by the flag or one of the flags
+// of passphraseSources(flag)
+func newFlagPassPhrase(c *cli.Context, flag string) ([]byte, error) {
+	if pass, ok, err := readPassphraseFlags(c, flag); ok || err != nil {
+		return pass, err
+	}
+	pass, err := createPassPhrase()
+	return pass, promptError(c, flag, err)
+}
+
+// promptError adds the flags of the command giving the passphrase of the flag name to errNotTerminal
+func promptError(c *cli.Context, name string, err error) error {
+	if err != errNotTerminal || !slices.Contains(c.FlagNames(), name) {
+		return err
+	}
+	flags := []string{"--" + name}
+	for _, flag := range c.FlagNames() {
+		if strings.HasPrefix(flag, name+"-") {
+			flags = append(flags, "--"+flag)
+		}
+	}
+	return fmt.Errorf("%v, use one of %s", err, strings.Join(flags, ", "))
+}
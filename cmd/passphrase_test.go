@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func newPassphraseContext(t *testing.T, args ...string) *cli.Context {
+	flags := append([]cli.Flag{cli.StringFlag{Name: "passphrase"}}, passphraseSourceFlags...)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, f := range flags {
+		f.Apply(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	flagPassphrases = map[string][]byte{}
+	t.Cleanup(func() { flagPassphrases = map[string][]byte{} })
+	c := cli.NewContext(nil, fs, nil)
+	c.Command = cli.Command{Flags: flags}
+	return c
+}
+
+func TestPassphraseFromFlags(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pass")
+	if err := os.WriteFile(file, []byte("from file\r\nsecond line\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CERTSTRAP_TEST_PASSPHRASE", "from env")
+
+	tests := map[string][]string{
+		"":          {"-passphrase", ""},
+		"from flag": {"-passphrase", "from flag"},
+		"from file": {"-passphrase-file", file},
+		"from env":  {"-passphrase-env", "CERTSTRAP_TEST_PASSPHRASE"},
+	}
+	if runtime.GOOS != "windows" {
+		tests["from cmd"] = []string{"-passphrase-cmd", "echo 'from cmd'"}
+	}
+	for want, args := range tests {
+		pass, ok, err := passphraseFromFlags(newPassphraseContext(t, args...))
+		if err != nil || !ok || string(pass) != want {
+			t.Errorf("Passphrase of %v is %q, %v, %v", args, pass, ok, err)
+		}
+	}
+
+	if _, ok, err := passphraseFromFlags(newPassphraseContext(t)); ok || err != nil {
+		t.Errorf("Passphrase without flags: %v, %v", ok, err)
+	}
+	for _, args := range [][]string{
+		{"-passphrase", "a", "-passphrase-env", "CERTSTRAP_TEST_PASSPHRASE"},
+		{"-passphrase-file", filepath.Join(t.TempDir(), "missing")},
+		{"-passphrase-env", "CERTSTRAP_TEST_UNSET"},
+		{"-passphrase-cmd", "exit 1"},
+	} {
+		if _, _, err := passphraseFromFlags(newPassphraseContext(t, args...)); err == nil {
+			t.Errorf("Expected an error reading the passphrase of %v", args)
+		}
+	}
+}
+
+func TestPassphraseNotTerminal(t *testing.T) {
+	defer func(f func() bool) { stdinIsTerminal = f }(stdinIsTerminal)
+	stdinIsTerminal = func() bool { return false }
+
+	_, err := newPassPhrase(newPassphraseContext(t))
+	if err == nil || !strings.Contains(err.Error(), "--passphrase-fd") {
+		t.Fatalf("Expected an error naming the passphrase flags, got %v", err)
+	}
+	if _, err := getPassPhrase(newPassphraseContext(t), "CA key"); err == nil {
+		t.Fatal("Expected an error asking for a passphrase")
+	}
+	if pass, err := getPassPhrase(newPassphraseContext(t, "-passphrase", "flag"), "CA key"); err != nil || string(pass) != "flag" {
+		t.Fatalf("Passphrase is %q, %v", pass, err)
+	}
+}
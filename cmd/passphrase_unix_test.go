@@ -0,0 +1,37 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestPassphraseFromFd(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if _, err := w.WriteString("from fd\nrest"); err != nil {
+		t.Fatal(err)
+	}
+	// The descriptor is closed once read, so it must not be the one r owns
+	fd, err := syscall.Dup(int(r.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pass, ok, err := passphraseFromFlags(newPassphraseContext(t, "-passphrase-fd", strconv.Itoa(fd)))
+	if err != nil || !ok || string(pass) != "from fd" {
+		t.Fatalf("Passphrase is %q, %v, %v", pass, ok, err)
+	}
+	rest := make([]byte, 4)
+	if n, err := r.Read(rest); err != nil || string(rest[:n]) != "rest" {
+		t.Fatalf("Read %q after the passphrase, %v", rest[:n], err)
+	}
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/publish"
+	"github.com/urfave/cli"
+)
+
+// NewPublishCommand sets up a "publish" command to publish the certificates and CRLs of CAs in the depot
+func NewPublishCommand() cli.Command {
+	caFlag := cli.StringFlag{
+		Name:  "CA",
+		Usage: "Names of CAs to publish, comma separated (default: every CA in the depot)",
+	}
+	return cli.Command{
+		Name:  "publish",
+		Usage: "Publish CA certificates and CRLs",
+		Description: "Publish the certificate and CRL of CAs, for the CRL distribution point and authority information\n" +
+			"   access URLs of the certificates they issue. For a CA named CA, CA.crt and CA.crl are DER-encoded,\n" +
+			"   and CA.crt.pem and CA.crl.pem PEM-encoded.",
+		Subcommands: []cli.Command{
+			{
+				Name:  "serve",
+				Usage: "Serve CA certificates and CRLs over HTTP",
+				Description: "Serve the published files from the depot with their content types and caching headers. Files are\n" +
+					"   reread when they change in the depot, so a CRL rewritten by revoke is served immediately.",
+				Flags: []cli.Flag{
+					caFlag,
+					cli.StringFlag{
+						Name:  "listen",
+						Value: ":8080",
+						Usage: "Address to listen on",
+					},
+					cli.DurationFlag{
+						Name:  "max-age",
+						Value: publish.DefaultMaxAge,
+						Usage: "How long clients may cache files (CRLs are never cached past their next update)",
+					},
+					cli.StringFlag{
+						Name:  "tls-cert",
+						Usage: "Certificate to serve HTTPS with (optional, CRL and AIA clients usually expect plain HTTP)",
+					},
+					cli.StringFlag{
+						Name:  "tls-key",
+						Usage: "Unencrypted private key of --tls-cert",
+					},
+				},
+				Action: publishServeAction,
+			},
+			{
+				Name:        "export",
+				Usage:       "Write CA certificates and CRLs to a directory",
+				Description: "Write the published files to a directory, to be served by any web server.",
+				Flags: []cli.Flag{
+					caFlag,
+					cli.StringFlag{
+						Name:  "dir",
+						Usage: "Directory to write the files to",
+					},
+				},
+				Action: publishExportAction,
+			},
+		},
+	}
+}
+
+func newPublisher(c *cli.Context) *publish.Publisher {
+	var cas []string
+	for _, name := range splitList(c.String("CA")) {
+		cas = append(cas, formatName(name))
+	}
+	return publish.New(d, cas)
+}
+
+func publishServeAction(c *cli.Context) {
+	if c.IsSet("tls-cert") != c.IsSet("tls-key") {
+		fmt.Fprintln(os.Stderr, "--tls-cert and --tls-key must be provided together.")
+		os.Exit(1)
+	}
+	publisher := newPublisher(c)
+	publisher.MaxAge = c.Duration("max-age")
+	files, err := publisher.Files()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Read published files error:", err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "No CA to publish.")
+		os.Exit(1)
+	}
+
+	httpServer := &http.Server{Addr: c.String("listen"), Handler: publisher}
+	fmt.Fprintf(os.Stderr, "Publishing %d files on %s\n", len(files), c.String("listen"))
+	if c.IsSet("tls-cert") {
+		err = httpServer.ListenAndServeTLS(c.String("tls-cert"), c.String("tls-key"))
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	fmt.Fprintln(os.Stderr, "Publish server error:", err)
+	os.Exit(1)
+}
+
+func publishExportAction(c *cli.Context) {
+	if c.String("dir") == "" {
+		fmt.Fprintln(os.Stderr, "A directory must be provided with --dir.")
+		os.Exit(1)
+	}
+	files, err := newPublisher(c).Files()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Read published files error:", err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "No CA to publish.")
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(c.String("dir"), 0755); err != nil {
+		fmt.Fprintln(os.Stderr, "Create directory error:", err)
+		os.Exit(1)
+	}
+	for _, f := range files {
+		path := filepath.Join(c.String("dir"), f.Name)
+		if err := depot.WriteFileAtomic(path, f.Data, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, "Write file error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Created %s\n", path)
+	}
+}
@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/pkix"
+	"github.com/square/certstrap/service"
+	"github.com/urfave/cli"
+)
+
+// NewRenewCommand sets up a "renew" command to reissue an existing certificate
+func NewRenewCommand() cli.Command {
+	return cli.Command{
+		Name:        "renew",
+		Usage:       "Renew certificate",
+		Description: "Reissue a certificate with the same subject, subject alternative names and profile, a new serial number and a new validity period. The old certificate is moved to the archive directory of the depot.",
+		Flags: append(append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "passphrase",
+				Usage: "Passphrase to decrypt private-key PEM block of CA",
+			},
+			cli.StringFlag{
+				Name:  "key-passphrase",
+				Usage: "Passphrase to decrypt the existing private key, or to encrypt the new private key with --rekey",
+			},
+			cli.StringFlag{
+				Name:  "expires",
+				Value: "2 years",
+				Usage: "How long until the certificate expires (example: 1 year 2 days 3 months 4 hours)",
+			},
+			cli.StringFlag{
+				Name:  "CA",
+				Usage: "Name of CA to issue cert with",
+			},
+			cli.BoolFlag{
+				Name:  "rekey",
+				Usage: "Generate a fresh key pair and certificate request instead of reusing the existing ones",
+			},
+			cli.IntFlag{
+				Name:  "key-bits",
+				Usage: "Size (in bits) of RSA keypair to generate with --rekey (default: same as the existing key)",
+			},
+			cli.StringFlag{
+				Name:  "curve",
+				Usage: fmt.Sprintf("Key type other than RSA of the key generated with --rekey by its curve name, one of %s (same as --key-type)", supportedCurves()),
+			},
+			keyTypeFlag,
+			allowWeakFlag,
+			signatureAlgorithmFlag(),
+			cli.BoolFlag{
+				Name:  "supersede",
+				Usage: "Revoke the old certificate in the CA's CRL with reason 'superseded'",
+			},
+			cli.BoolFlag{
+				Name:  "stdout",
+				Usage: "Print certificate to stdout in addition to saving file",
+			},
+			shareFileFlag,
+		}, passphraseSourceFlags...), passphraseSources("key-passphrase", "the passphrase of the renewed key")...),
+		Action: renewAction,
+	}
+}
+
+func renewAction(c *cli.Context) {
+	if len(c.Args()) != 1 {
+		fmt.Fprintln(os.Stderr, "One host name must be provided.")
+		os.Exit(1)
+	}
+	if c.String("CA") == "" {
+		fmt.Fprintln(os.Stderr, "CA name must be provided.")
+		os.Exit(1)
+	}
+
+	formattedReqName := strings.Replace(c.Args()[0], " ", "_", -1)
+	formattedCAName := strings.Replace(c.String("CA"), " ", "_", -1)
+	signatureAlgorithm := getSignatureAlgorithm(c)
+
+	defer lockDepot()()
+
+	oldCrt, err := depot.GetCertificate(d, formattedReqName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Get certificate error:", err)
+		os.Exit(1)
+	}
+	rawOldCrt, err := oldCrt.GetRawCertificate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Get certificate error:", err)
+		os.Exit(1)
+	}
+
+	expiresTime, err := parseExpiry(c.String("expires"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid expiry: %s\n", err)
+		os.Exit(1)
+	}
+
+	caCrt, err := depot.GetCertificate(d, formattedCAName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Get CA certificate error:", err)
+		os.Exit(1)
+	}
+	rawCACrt, err := caCrt.GetRawCertificate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "GetRawCertificate failed on CA certificate:", err)
+		os.Exit(1)
+	}
+	// The old certificate can only be revoked by the CA which issued it.
+	if c.Bool("supersede") && !bytes.Equal(rawOldCrt.RawIssuer, rawCACrt.RawSubject) {
+		fmt.Fprintf(os.Stderr, "Certificate \"%s\" was not issued by \"%s\", cannot supersede it.\n", formattedReqName, formattedCAName)
+		os.Exit(1)
+	}
+
+	caKey, err := getCAPrivateKey(c, formattedCAName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Get CA key error: ", err)
+		os.Exit(1)
+	}
+	ca, err := service.NewCA(d, formattedCAName, caKey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Load CA error:", err)
+		os.Exit(1)
+	}
+
+	// key is the private key of the renewed certificate, if it is known, and newKey the one
+	// generated with --rekey
+	var key, newKey *pkix.Key
+	var csr *pkix.CertificateSigningRequest
+	switch {
+	case c.Bool("rekey"):
+		newKey, err = createRenewalKey(c, rawOldCrt.PublicKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Create key error:", err)
+			os.Exit(1)
+		}
+		key = newKey
+		csr, err = pkix.CreateCertificateSigningRequestFromCertificate(newKey, oldCrt)
+	case depot.CheckCertificateSigningRequest(d, formattedReqName):
+		// The key is only checked against the request if it is not encrypted
+		key, _ = depot.GetPrivateKey(d, formattedReqName)
+		csr, err = depot.GetCertificateSigningRequest(d, formattedReqName)
+	default:
+		key, err = getRenewalKey(c, formattedReqName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Get key error:", err)
+			os.Exit(1)
+		}
+		csr, err = pkix.CreateCertificateSigningRequestFromCertificate(key, oldCrt)
+	}
+	if err == nil && key != nil {
+		err = checkRequestKey(csr, key)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Get certificate request error:", err)
+		os.Exit(1)
+	}
+
+	// Everything that can fail is done before the old certificate is archived, so that a failed
+	// renewal leaves the depot as it was
+	var newKeyPass []byte
+	if newKey != nil {
+		if newKeyPass, err = newFlagPassPhrase(c, "key-passphrase"); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	var entry *depot.IndexEntry
+	if c.Bool("supersede") {
+		entry, err = depot.NewIndexEntry(formattedReqName, oldCrt, depot.StatusIssued, currentOperator())
+		if err == nil {
+			err = ca.CheckIssued(oldCrt)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Revoke old certificate error:", err)
+			os.Exit(1)
+		}
+	}
+
+	signReq := service.SignRequest{
+		Name:               formattedReqName,
+		CSR:                csr,
+		Profile:            renewalProfile(rawOldCrt),
+		NotAfter:           expiresTime,
+		Operator:           currentOperator(),
+		SignatureAlgorithm: signatureAlgorithm,
+		AllowWeak:          c.Bool("allow-weak"),
+	}
+	if rawOldCrt.IsCA {
+		// Keep the path length and name constraints of the old CA, as a cross-signed certificate does
+		signReq.Options = []pkix.Option{
+			pkix.WithPathlenOption(rawOldCrt.MaxPathLen, rawOldCrt.MaxPathLen < 0),
+			pkix.WithNameConstraintsOption(rawOldCrt),
+		}
+	}
+	crtOut, err := ca.Sign(signReq)
+	if errors.Is(err, service.ErrWeakKey) {
+		fmt.Fprintf(os.Stderr, "Invalid certificate request key: %v, use --allow-weak to sign it anyway\n", err)
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "Create certificate error:", err)
+		os.Exit(1)
+	}
+
+	archived, err := depot.ArchiveCertificate(d, formattedReqName, oldCrt)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Archive certificate error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Archived %s/%s\n", depotDir, archived)
+
+	if newKey != nil {
+		if len(newKeyPass) > 0 {
+			err = depot.ReplaceEncryptedPrivateKey(d, formattedReqName, newKey, newKeyPass)
+		} else {
+			err = depot.ReplacePrivateKey(d, formattedReqName, newKey)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Save private key error:", err)
+			os.Exit(1)
+		}
+		if err = depot.ReplaceCertificateSigningRequest(d, formattedReqName, csr); err != nil {
+			fmt.Fprintln(os.Stderr, "Save certificate request error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Created %s/%s.key\n", depotDir, formattedReqName)
+		fmt.Printf("Created %s/%s.csr\n", depotDir, formattedReqName)
+	}
+
+	if err = depot.ReplaceCertificate(d, formattedReqName, crtOut); err != nil {
+		fmt.Fprintln(os.Stderr, "Save certificate error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Renewed %s/%s.crt signed by %s/%s.key\n", depotDir, formattedReqName, depotDir, formattedCAName)
+
+	if c.Bool("stdout") {
+		crtBytes, err := crtOut.Export()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Print certificate error:", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(crtBytes))
+	}
+
+	if c.Bool("supersede") {
+		if err = ca.Revoke(entry, service.ReasonSuperseded, currentOperator()); err != nil {
+			fmt.Fprintln(os.Stderr, "Revoke old certificate error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Revoked old certificate %s in %s/%s.crl\n", entry.Serial, depotDir, formattedCAName)
+	}
+}
+
+// getRenewalKey loads the existing private key of the certificate being renewed.
+func getRenewalKey(c *cli.Context, name string) (*pkix.Key, error) {
+	key, err := depot.GetPrivateKey(d, name)
+	if err == nil {
+		return key, nil
+	}
+	pass, err := getFlagPassPhrase(c, "key-passphrase", name+" key")
+	if err != nil {
+		return nil, err
+	}
+	return depot.GetEncryptedPrivateKey(d, name, pass)
+}
+
+// renewalProfile returns the profile the certificate crt was issued with
+func renewalProfile(crt *x509.Certificate) string {
+	switch {
+	case crt.IsCA:
+		return service.ProfileIntermediate
+	case len(crt.URIs) == 1 && crt.URIs[0].Scheme == "spiffe":
+		return service.ProfileSVID
+	default:
+		return service.ProfileHost
+	}
+}
+
+// checkRequestKey fails unless csr requests a certificate for the public key of key
+func checkRequestKey(csr *pkix.CertificateSigningRequest, key *pkix.Key) error {
+	raw, err := csr.GetRawCertificateSigningRequest()
+	if err != nil {
+		return err
+	}
+	csrKeyID, err := pkix.GenerateSubjectKeyID(raw.PublicKey)
+	if err != nil {
+		return err
+	}
+	keyID, err := pkix.GenerateSubjectKeyID(key.Public)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(csrKeyID, keyID) {
+		return errors.New("the certificate request does not match the private key")
+	}
+	return nil
+}
+
+// createRenewalKey creates the key for --rekey, of the same type as the existing
+// key unless --key-type, --curve or --key-bits is given.
+func createRenewalKey(c *cli.Context, pub crypto.PublicKey) (*pkix.Key, error) {
+	if c.IsSet("key-type") || c.IsSet("curve") || c.IsSet("key-bits") {
+		return createKeyFromFlags(c)
+	}
+
+	keyType, err := pkix.KeyTypeOf(pub)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWeakKeyType(c, keyType); err != nil {
+		return nil, err
+	}
+	return keyType.Create()
+}
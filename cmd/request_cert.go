@@ -34,7 +34,7 @@ func NewCertRequestCommand() cli.Command {
 		Name:        "request-cert",
 		Usage:       "Create certificate request for host",
 		Description: "Create certificate for host, including certificate signing request and key. Must sign the request in order to generate a certificate.",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.StringFlag{
 				Name:  "passphrase",
 				Usage: "Passphrase to encrypt private-key PEM block",
@@ -42,12 +42,14 @@ func NewCertRequestCommand() cli.Command {
 			cli.IntFlag{
 				Name:  "key-bits",
 				Value: 2048,
-				Usage: "Size (in bits) of RSA keypair to generate (example: 4096)",
+				Usage: "Size (in bits) of RSA keypair to generate (example: 4096, same as --key-type rsa:4096)",
 			},
 			cli.StringFlag{
 				Name:  "curve",
-				Usage: fmt.Sprintf("Elliptic curve name. Must be one of %s.", supportedCurves()),
+				Usage: fmt.Sprintf("Key type other than RSA by its curve name, one of %s (same as --key-type)", supportedCurves()),
 			},
+			keyTypeFlag,
+			allowWeakFlag,
 			cli.StringFlag{
 				Name:  "organization, o",
 				Usage: "Sets the Organization (O) field of the certificate",
@@ -84,6 +86,10 @@ func NewCertRequestCommand() cli.Command {
 				Name:  "uri",
 				Usage: "URI values to add as subject alt name (comma separated)",
 			},
+			cli.StringFlag{
+				Name:  "spiffe-id",
+				Usage: "SPIFFE ID to request an X509-SVID for, as its only URI subject alt name (sign with --profile svid)",
+			},
 			cli.StringFlag{
 				Name:  "key",
 				Usage: "Path to private key PEM file (if blank or if file doesn't exist, will generate new keypair)",
@@ -92,11 +98,13 @@ func NewCertRequestCommand() cli.Command {
 				Name:  "csr",
 				Usage: "Path to CSR output PEM file (if blank, will use --depot-path and default name)",
 			},
+			formatFlag(formatPEM, formatDER, formatJWK),
+			signatureAlgorithmFlag(),
 			cli.BoolFlag{
 				Name:  "stdout",
 				Usage: "Print signing request to stdout in addition to saving file",
 			},
-		},
+		}, passphraseSourceFlags...),
 		Action: newCertAction,
 	}
 }
@@ -121,6 +129,20 @@ func newCertAction(c *cli.Context) {
 		os.Exit(1)
 	}
 
+	// An X509-SVID has exactly one URI
+	if c.IsSet("spiffe-id") {
+		if len(uris) > 0 {
+			fmt.Fprintln(os.Stderr, "--spiffe-id and --uri cannot be used together, an X509-SVID has exactly one URI.")
+			os.Exit(1)
+		}
+		id, err := pkix.ParseSPIFFEID(c.String("spiffe-id"))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		uris = append(uris, id)
+	}
+
 	domains := strings.Split(c.String("domain"), ",")
 	if c.String("domain") == "" {
 		domains = nil
@@ -137,8 +159,22 @@ func newCertAction(c *cli.Context) {
 		fmt.Fprintln(os.Stderr, "Must provide Common Name, domain, or URI")
 		os.Exit(1)
 	}
+	// SPIFFE does not rely on the common name, so it is only set for an X509-SVID if given
+	commonName := name
+	if c.IsSet("spiffe-id") {
+		commonName = c.String("common-name")
+	}
 
 	var formattedName = formatName(name)
+	format := getFormat(c, formatPEM, formatDER, formatJWK)
+	signatureAlgorithm := getSignatureAlgorithm(c)
+	// the key type flags are ignored for a key that is read with --key
+	var keyType *pkix.KeyType
+	if !c.IsSet("key") {
+		keyType = getKeyType(c)
+	}
+
+	defer lockDepot()()
 
 	// skip the check if the --csr option is specified
 	if !c.IsSet("csr") && (depot.CheckCertificateSigningRequest(d, formattedName) || depot.CheckPrivateKey(d, formattedName)) {
@@ -146,15 +182,10 @@ func newCertAction(c *cli.Context) {
 		os.Exit(1)
 	}
 
-	var passphrase []byte
-	if c.IsSet("passphrase") {
-		passphrase = []byte(c.String("passphrase"))
-	} else {
-		passphrase, err = createPassPhrase()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
-		}
+	passphrase, err := newPassPhrase(c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
 	// generate new key if one doesn't exist already
@@ -174,22 +205,10 @@ func newCertAction(c *cli.Context) {
 			os.Exit(1)
 		}
 		fmt.Printf("Read %s\n", keyFilepath)
-	case c.IsSet("curve"):
-		curve := c.String("curve")
-		key, err = createKeyOnCurve(curve)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Create %s Key error: %v", curve, err)
-			os.Exit(1)
-		}
-		if len(passphrase) > 0 {
-			fmt.Printf("Created %s (encrypted by passphrase)\n", keyFilepath)
-		} else {
-			fmt.Printf("Created %s\n", keyFilepath)
-		}
 	default:
-		key, err = pkix.CreateRSAKey(c.Int("key-bits"))
+		key, err = keyType.Create()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Create RSA Key error:", err)
+			fmt.Fprintf(os.Stderr, "Create %s Key error: %v\n", keyType, err)
 			os.Exit(1)
 		}
 		if len(passphrase) > 0 {
@@ -199,7 +218,9 @@ func newCertAction(c *cli.Context) {
 		}
 	}
 
-	csr, err := pkix.CreateCertificateSigningRequest(key, c.String("organizational-unit"), ips, domains, uris, c.String("organization"), c.String("country"), c.String("province"), c.String("locality"), name)
+	checkSignatureAlgorithm(key, signatureAlgorithm)
+	csr, err := pkix.CreateCertificateSigningRequest(key, c.String("organizational-unit"), ips, domains, uris, c.String("organization"), c.String("country"), c.String("province"), c.String("locality"), commonName,
+		pkix.WithCSRSignatureAlgorithmOption(signatureAlgorithm))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Create certificate request error:", err)
 		os.Exit(1)
@@ -207,19 +228,34 @@ func newCertAction(c *cli.Context) {
 		fmt.Printf("Created %s\n", fileName(c, "csr", depotDir, formattedName, "csr"))
 	}
 
+	// JWK describes the public key only, the request itself stays PEM
+	csrFormat := format
+	if format == formatJWK {
+		csrFormat = formatPEM
+	}
+
 	if c.Bool("stdout") {
-		csrBytes, err := csr.Export()
+		csrBytes, err := encodeCertificateSigningRequest(csrFormat, csr)
+		if err == nil {
+			err = printFormatted(csrFormat, csrBytes)
+		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Print certificate request error:", err)
 			os.Exit(1)
-		} else {
-			fmt.Println(string(csrBytes))
 		}
 	}
 
-	if err = putCertificateSigningRequest(c, d, formattedName, csr); err != nil {
+	if err = putCertificateSigningRequest(c, d, formattedName, csrFormat, csr); err != nil {
 		fmt.Fprintln(os.Stderr, "Save certificate request error:", err)
 	}
+	if format != formatPEM && !(format == formatDER && c.IsSet("csr")) {
+		path, err := putFormattedCertificateSigningRequest(format, formattedName, csr, key)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Save certificate request error:", err)
+		} else {
+			fmt.Printf("Created %s\n", path)
+		}
+	}
 	if len(passphrase) > 0 {
 		if err = putEncryptedPrivateKey(c, d, formattedName, key, passphrase); err != nil {
 			fmt.Fprintln(os.Stderr, "Save encrypted private key error:", err)
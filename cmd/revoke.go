@@ -1,17 +1,12 @@
 package cmd
 
 import (
-	"crypto/rand"
-	"crypto/x509"
-	x509pkix "crypto/x509/pkix"
 	"errors"
 	"fmt"
 	"os"
 	"strings"
-	"time"
 
-	"github.com/square/certstrap/depot"
-	"github.com/square/certstrap/pkix"
+	"github.com/square/certstrap/service"
 	"github.com/urfave/cli"
 )
 
@@ -25,7 +20,7 @@ func NewRevokeCommand() cli.Command {
 		Name:        "revoke",
 		Usage:       "Revoke certificate",
 		Description: "Add certificate to the CA's CRL.",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.StringFlag{
 				Name:  "passphrase",
 				Usage: "Passphrase to decrypt private-key PEM block of CA",
@@ -38,7 +33,8 @@ func NewRevokeCommand() cli.Command {
 				Name:  "CA",
 				Usage: "Name of CA under which certificate was issued",
 			},
-		},
+			shareFileFlag,
+		}, passphraseSourceFlags...),
 		Action: new(revokeCommand).run,
 	}
 }
@@ -67,76 +63,18 @@ func (c *revokeCommand) parseArgs(ctx *cli.Context) error {
 func (c *revokeCommand) run(ctx *cli.Context) {
 	c.checkErr(c.parseArgs(ctx))
 
-	caCert, err := c.CAx509Certificate()
-	c.checkErr(err)
+	defer lockDepot()()
 
-	cnCert, err := c.CNx509Certificate()
+	key, err := getCAPrivateKey(ctx, c.ca)
+	if err != nil {
+		c.checkErr(fmt.Errorf("get CA key error: %v", err))
+	}
+	ca, err := service.NewCA(d, c.ca, key)
 	c.checkErr(err)
 
-	revoked, err := c.revokedCertificates()
+	entry, err := ca.FindCertificate(c.cn)
 	c.checkErr(err)
 
-	revoked = append(revoked, x509pkix.RevokedCertificate{
-		SerialNumber:   cnCert.SerialNumber,
-		RevocationTime: time.Now(),
-	})
-
-	err = c.saveRevokedCertificates(ctx, caCert, revoked)
+	err = ca.Revoke(entry, service.ReasonUnspecified, currentOperator())
 	c.checkErr(err)
 }
-
-func (c *revokeCommand) CAx509Certificate() (*x509.Certificate, error) {
-	cert, err := depot.GetCertificate(d, c.ca)
-	if err != nil {
-		return nil, err
-	}
-	return cert.GetRawCertificate()
-}
-
-func (c *revokeCommand) CNx509Certificate() (*x509.Certificate, error) {
-	cert, err := depot.GetCertificate(d, c.cn)
-	if err != nil {
-		return nil, err
-	}
-	return cert.GetRawCertificate()
-}
-
-func (c *revokeCommand) revokedCertificates() ([]x509pkix.RevokedCertificate, error) {
-	list, err := depot.GetCertificateRevocationList(d, c.ca)
-	if err != nil {
-		return nil, err
-	}
-
-	certList, err := x509.ParseDERCRL(list.DERBytes())
-	if err != nil {
-		return nil, err
-	}
-
-	return certList.TBSCertList.RevokedCertificates, nil
-}
-
-func (c *revokeCommand) saveRevokedCertificates(ctx *cli.Context, cert *x509.Certificate, list []x509pkix.RevokedCertificate) error {
-	privateKey, err := depot.GetPrivateKey(d, c.ca)
-	if err != nil {
-		pass, err := getPassPhrase(ctx, "CA key")
-		if err != nil {
-			return fmt.Errorf("error retreiving passphrase when saving revoked certificates: %v", err)
-		}
-		privateKey, err = depot.GetEncryptedPrivateKey(d, c.ca, pass)
-		if err != nil {
-			return fmt.Errorf("get CA key error when saving revoked certificates: %v", err)
-		}
-	}
-
-	crlBytes, err := cert.CreateCRL(rand.Reader, privateKey.Private, list, time.Now(), time.Now().Add(2*8760*time.Hour))
-	if err != nil {
-		return fmt.Errorf("could not create CRL: %v", err)
-	}
-	if err := d.Delete(depot.CrlTag(c.ca)); err != nil {
-		return fmt.Errorf("could not delete CRL: %v", err)
-	}
-	if err = depot.PutCertificateRevocationList(d, c.ca, pkix.NewCertificateRevocationListFromDER(crlBytes)); err != nil {
-		return fmt.Errorf("could not put revokation list: %v", err)
-	}
-	return nil
-}
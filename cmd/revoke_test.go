@@ -63,6 +63,63 @@ func TestRevokeCmd(t *testing.T) {
 	}
 }
 
+func TestRevokeCmdFromIndex(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "certstrap-revoke")
+	if err != nil {
+		t.Fatalf("could not create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	d, err = depot.NewFileDepot(tmp)
+	if err != nil {
+		t.Fatalf("could not create file depot: %v", err)
+	}
+
+	setupCA(t, d)
+	setupCN(t, d)
+
+	cnCert, _ := depot.GetCertificate(d, cnName)
+	cnX509, _ := cnCert.GetRawCertificate()
+	if err := recordIssued(caName, cnName, cnCert); err != nil {
+		t.Fatalf("could not record issued cert: %v", err)
+	}
+	if err := depot.DeleteCertificate(d, cnName); err != nil {
+		t.Fatalf("could not delete cert: %v", err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("CA", "", "")
+	fs.String("CN", "", "")
+	if err := fs.Parse([]string{"-CA", "ca", "-CN", "cn"}); err != nil {
+		t.Fatal("could not parse flags")
+	}
+
+	new(revokeCommand).run(cli.NewContext(nil, fs, nil))
+
+	list, err := depot.GetCertificateRevocationList(d, caName)
+	if err != nil {
+		t.Fatalf("could not get crl: %v", err)
+	}
+	certList, err := x509.ParseDERCRL(list.DERBytes())
+	if err != nil {
+		t.Fatalf("could not parse crl: %v", err)
+	}
+	if len(certList.TBSCertList.RevokedCertificates) != 1 {
+		t.Fatalf("unexpected number of revoked certs: want = 1, got = %d", len(certList.TBSCertList.RevokedCertificates))
+	}
+	if cnX509.SerialNumber.Cmp(certList.TBSCertList.RevokedCertificates[0].SerialNumber) != 0 {
+		t.Fatalf("certificates serial numbers are not equal")
+	}
+
+	entries, err := depot.GetIndex(d, caName)
+	if err != nil {
+		t.Fatalf("could not read index: %v", err)
+	}
+	if len(entries) != 2 || entries[1].Status != depot.StatusRevoked {
+		t.Fatalf("expected revocation to be recorded in index, got %+v", entries)
+	}
+}
+
 func setupCA(t *testing.T, dt depot.Depot) {
 	// create private key
 	key, err := pkix.CreateRSAKey(2048)
@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/pkix"
+	"github.com/urfave/cli"
+)
+
+// NewRotateCACommand sets up a "rotate-ca" command to roll over to a new CA
+func NewRotateCACommand() cli.Command {
+	return cli.Command{
+		Name:  "rotate-ca",
+		Usage: "Roll over to a new Certificate Authority",
+		Description: "Create a new Certificate Authority to replace an existing one. The old and new CA certificates are cross-signed " +
+			"by each other, so chains through either CA keep working while clients move to the new CA, and a trust bundle " +
+			"containing both CA certificates is written.",
+		Flags: append(append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "CA",
+				Usage: "Name of the CA to replace",
+			},
+			cli.StringFlag{
+				Name:  "ca-passphrase",
+				Usage: "Passphrase to decrypt private-key PEM block of the old CA",
+			},
+			cli.StringFlag{
+				Name:  "passphrase",
+				Usage: "Passphrase to encrypt private key PEM block of the new CA",
+			},
+			cli.IntFlag{
+				Name:  "key-bits",
+				Value: 4096,
+				Usage: "Size (in bits) of RSA keypair to generate (example: 4096, same as --key-type rsa:4096)",
+			},
+			cli.StringFlag{
+				Name:  "curve",
+				Usage: fmt.Sprintf("Key type other than RSA by its curve name, one of %s (same as --key-type)", supportedCurves()),
+			},
+			keyTypeFlag,
+			allowWeakFlag,
+			cli.StringFlag{
+				Name:  "expires",
+				Value: "18 months",
+				Usage: "How long until the new and cross-signed certificates expire (example: 1 year 2 days 3 months 4 hours)",
+			},
+			cli.StringFlag{
+				Name:  "organization, o",
+				Usage: "Sets the Organization (O) field of the certificate (default: same as the old CA)",
+			},
+			cli.StringFlag{
+				Name:  "organizational-unit, ou",
+				Usage: "Sets the Organizational Unit (OU) field of the certificate (default: same as the old CA)",
+			},
+			cli.StringFlag{
+				Name:  "country, c",
+				Usage: "Sets the Country (C) field of the certificate (default: same as the old CA)",
+			},
+			cli.StringFlag{
+				Name:  "common-name, cn",
+				Usage: "Sets the Common Name (CN) field of the new CA certificate",
+			},
+			cli.StringFlag{
+				Name:  "province, st",
+				Usage: "Sets the State/Province (ST) field of the certificate (default: same as the old CA)",
+			},
+			cli.StringFlag{
+				Name:  "locality, l",
+				Usage: "Sets the Locality (L) field of the certificate (default: same as the old CA)",
+			},
+			cli.IntFlag{
+				Name:  "path-length",
+				Usage: "Maximum number of non-self-issued intermediate certificates that may follow the new CA certificate (default: one more than the old CA, to allow for the cross-signed certificate)",
+			},
+			cli.BoolFlag{
+				Name:  "exclude-path-length",
+				Usage: "Exclude 'Path Length Constraint' from the new CA certificate",
+			},
+			shareFileFlag,
+		}, passphraseSources("ca-passphrase", "the passphrase of the old CA key")...), passphraseSourceFlags...),
+		Action: rotateCAAction,
+	}
+}
+
+func rotateCAAction(c *cli.Context) {
+	if c.String("CA") == "" {
+		fmt.Fprintln(os.Stderr, "Must supply name of the CA to replace")
+		os.Exit(1)
+	}
+	if !c.IsSet("common-name") {
+		fmt.Fprintln(os.Stderr, "Must supply Common Name for the new CA")
+		os.Exit(1)
+	}
+	if c.IsSet("path-length") && c.IsSet("exclude-path-length") {
+		fmt.Fprintf(os.Stderr, "The \"path-length\" and \"exclude-path-length\" flags cannot be used together!\n")
+		os.Exit(1)
+	}
+
+	oldName := strings.Replace(c.String("CA"), " ", "_", -1)
+	newName := strings.Replace(c.String("common-name"), " ", "_", -1)
+	keyType := getKeyType(c)
+
+	defer lockDepot()()
+
+	if depot.CheckCertificate(d, newName) || depot.CheckPrivateKey(d, newName) {
+		fmt.Fprintf(os.Stderr, "CA with specified name \"%s\" already exists!\n", newName)
+		os.Exit(1)
+	}
+
+	oldCrt, err := depot.GetCertificate(d, oldName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Get CA certificate error:", err)
+		os.Exit(1)
+	}
+	rawOldCrt, err := oldCrt.GetRawCertificate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "GetRawCertificate failed on CA certificate:", err)
+		os.Exit(1)
+	}
+	if !rawOldCrt.IsCA {
+		fmt.Fprintln(os.Stderr, "Selected CA certificate is not allowed to sign certificates.")
+		os.Exit(1)
+	}
+
+	oldKey, err := getFlagPrivateKey(c, oldName, "ca-passphrase", "old CA key")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Get CA key error:", err)
+		os.Exit(1)
+	}
+
+	expiresTime, err := parseExpiry(c.String("expires"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid expiry: %s\n", err)
+		os.Exit(1)
+	}
+
+	passphrase, err := newPassPhrase(c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	newKey, err := keyType.Create()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Create Key error:", err)
+		os.Exit(1)
+	}
+
+	// The cross-signed old CA sits between the new root and the old CA's
+	// certificates, so the new CA needs one more level of path length.
+	pathlen, excludePathlen := rawOldCrt.MaxPathLen+1, rawOldCrt.MaxPathLen < 0
+	if c.IsSet("path-length") {
+		pathlen, excludePathlen = c.Int("path-length"), false
+	}
+	if c.Bool("exclude-path-length") {
+		excludePathlen = true
+	}
+
+	subject := rawOldCrt.Subject
+	newCrt, err := pkix.CreateCertificateAuthorityWithOptions(newKey,
+		flagOrFirst(c, "organizational-unit", subject.OrganizationalUnit), expiresTime,
+		flagOrFirst(c, "organization", subject.Organization),
+		flagOrFirst(c, "country", subject.Country),
+		flagOrFirst(c, "province", subject.Province),
+		flagOrFirst(c, "locality", subject.Locality),
+		c.String("common-name"), nil,
+		pkix.WithPathlenOption(pathlen, excludePathlen), pkix.WithNameConstraintsOption(rawOldCrt))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Create certificate error:", err)
+		os.Exit(1)
+	}
+
+	if err = depot.PutCertificate(d, newName, newCrt); err != nil {
+		fmt.Fprintln(os.Stderr, "Save certificate error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Created %s/%s.crt\n", depotDir, newName)
+	if len(passphrase) > 0 {
+		err = depot.PutEncryptedPrivateKey(d, newName, newKey, passphrase)
+	} else {
+		err = depot.PutPrivateKey(d, newName, newKey)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Save private key error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Created %s/%s.key\n", depotDir, newName)
+
+	crl, err := pkix.CreateCertificateRevocationList(newKey, newCrt, expiresTime)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Create CRL error:", err)
+		os.Exit(1)
+	}
+	if err = depot.PutCertificateRevocationList(d, newName, crl); err != nil {
+		fmt.Fprintln(os.Stderr, "Save CRL error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Created %s/%s.crl\n", depotDir, newName)
+
+	// New CA signed by the old one, for clients that only trust the old CA yet
+	putCrossSigned(oldName, oldCrt, oldKey, newName, newCrt, expiresTime)
+	// Old CA signed by the new one, so certificates issued by the old CA chain to the new CA
+	putCrossSigned(newName, newCrt, newKey, oldName, oldCrt, expiresTime)
+
+	if err = depot.PutCertificateBundle(d, newName, []*pkix.Certificate{newCrt, oldCrt}); err != nil {
+		fmt.Fprintln(os.Stderr, "Save trust bundle error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Created %s/%s.bundle.pem\n", depotDir, newName)
+
+	if rawOldCrt.MaxPathLen == 0 && rawOldCrt.MaxPathLenZero {
+		fmt.Fprintf(os.Stderr, "Warning: \"%s\" has a path length of 0, so clients which enforce it on trust anchors will reject certificates issued by \"%s\" through the cross-signed certificate.\n", oldName, newName)
+	}
+}
+
+// putCrossSigned cross-signs the CA certificate crt with the issuing CA and stores the result
+// as "<name>-cross-<issuerName>.crt", recording it in the index of the issuing CA.
+func putCrossSigned(issuerName string, issuerCrt *pkix.Certificate, issuerKey *pkix.Key, name string, crt *pkix.Certificate, expiresTime time.Time) {
+	crossCrt, err := pkix.CrossSignCertificateAuthority(issuerCrt, issuerKey, crt, expiresTime)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Cross-sign certificate error:", err)
+		os.Exit(1)
+	}
+
+	crossName := name + "-cross-" + issuerName
+	if err = depot.PutCertificate(d, crossName, crossCrt); err != nil {
+		fmt.Fprintln(os.Stderr, "Save certificate error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Created %s/%s.crt signed by %s/%s.key\n", depotDir, crossName, depotDir, issuerName)
+
+	if err = recordIssued(issuerName, crossName, crossCrt); err != nil {
+		fmt.Fprintln(os.Stderr, "Update CA index error:", err)
+	}
+}
+
+// flagOrFirst returns the value of a flag if it is set, or else the first of the given values.
+func flagOrFirst(c *cli.Context, name string, values []string) string {
+	if c.IsSet(name) || len(values) == 0 {
+		return c.String(name)
+	}
+	return values[0]
+}
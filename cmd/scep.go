@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/square/certstrap/scep"
+	"github.com/urfave/cli"
+)
+
+// NewSCEPCommand sets up a "scep" command to run a SCEP server backed by a CA in the depot
+func NewSCEPCommand() cli.Command {
+	return cli.Command{
+		Name:  "scep",
+		Usage: "Enroll devices over SCEP",
+		Subcommands: []cli.Command{
+			{
+				Name:  "serve",
+				Usage: "Run a SCEP server signing with a CA in the depot",
+				Description: "Serve the SCEP (RFC 8894) GetCACert, GetCACaps and PKIOperation operations, as used by MDM-managed\n" +
+					"   devices. Enrollment requires the challenge password; devices renew by signing the request with their\n" +
+					"   current certificate. The CA must have an RSA key.",
+				Flags: append(append([]cli.Flag{
+					cli.StringFlag{
+						Name:  "CA",
+						Usage: "Name of CA to issue certificates with",
+					},
+					cli.StringFlag{
+						Name:  "passphrase",
+						Usage: "Passphrase to decrypt the CA private key",
+					},
+					cli.StringFlag{
+						Name:  "listen",
+						Value: ":8080",
+						Usage: "Address to listen on",
+					},
+					cli.StringFlag{
+						Name:  "challenge-password",
+						Usage: "Challenge password devices must present to enroll. Prefer the --challenge-password-file, -env, -fd or -cmd flags, which keep it off the command line",
+					},
+					cli.StringFlag{
+						Name:  "expires",
+						Value: "1 year",
+						Usage: "How long until the issued certificates expire, in the same form as sign --expires",
+					},
+					cli.StringFlag{
+						Name:  "tls-cert",
+						Usage: "Certificate to serve SCEP over HTTPS with (optional, SCEP messages are encrypted and signed)",
+					},
+					cli.StringFlag{
+						Name:  "tls-key",
+						Usage: "Unencrypted private key of --tls-cert",
+					},
+				}, passphraseSourceFlags...), passphraseSources("challenge-password", "the challenge password")...),
+				Action: scepServeAction,
+			},
+		},
+	}
+}
+
+func scepServeAction(c *cli.Context) {
+	checkNotSeeded(c)
+	if !c.IsSet("CA") {
+		fmt.Fprintln(os.Stderr, "A CA must be provided with --CA.")
+		os.Exit(1)
+	}
+	challenge, _, err := readPassphraseFlags(c, "challenge-password")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Read challenge password error:", err)
+		os.Exit(1)
+	}
+	if len(challenge) == 0 {
+		fmt.Fprintln(os.Stderr, "A challenge password must be provided with --challenge-password or its -file, -env, -fd or -cmd flags.")
+		os.Exit(1)
+	}
+	if c.IsSet("tls-cert") != c.IsSet("tls-key") {
+		fmt.Fprintln(os.Stderr, "--tls-cert and --tls-key must be provided together.")
+		os.Exit(1)
+	}
+	if _, err := parseExpiry(c.String("expires")); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid expiry: %s\n", err)
+		os.Exit(1)
+	}
+
+	issuer, err := newDepotIssuer(c, formatName(c.String("CA")), c.String("expires"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Load CA error:", err)
+		os.Exit(1)
+	}
+	server, err := scep.NewServer(issuer, issuer.caCertificates(), issuer.Key())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Create SCEP server error:", err)
+		os.Exit(1)
+	}
+	server.Challenge = func(password string) bool {
+		return subtle.ConstantTimeCompare([]byte(password), challenge) == 1
+	}
+
+	httpServer := &http.Server{Addr: c.String("listen"), Handler: server}
+	fmt.Fprintf(os.Stderr, "Serving SCEP for CA \"%s\" on %s\n", issuer.Name(), c.String("listen"))
+	if c.IsSet("tls-cert") {
+		err = httpServer.ListenAndServeTLS(c.String("tls-cert"), c.String("tls-key"))
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	fmt.Fprintln(os.Stderr, "SCEP server error:", err)
+	os.Exit(1)
+}
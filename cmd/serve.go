@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/square/certstrap/api"
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/service"
+	"github.com/urfave/cli"
+)
+
+// policyFile is the format of serve --policy-file
+type policyFile struct {
+	Clients []struct {
+		Name string `json:"name"`
+		// Token authenticates the client as a bearer token
+		Token string `json:"token"`
+		// ClientCN authenticates the client with a TLS client certificate with this common name,
+		// issued by one of the CAs of --client-ca
+		ClientCN   string   `json:"client_cn"`
+		Profiles   []string `json:"profiles"`
+		Domains    []string `json:"domains"`
+		MaxExpires string   `json:"max_expires"`
+		Revoke     bool     `json:"revoke"`
+	} `json:"clients"`
+}
+
+// NewServeCommand sets up a "serve" command to run the certstrap HTTP API for a CA in the depot
+func NewServeCommand() cli.Command {
+	return cli.Command{
+		Name:  "serve",
+		Usage: "Run an HTTP API signing with a CA in the depot",
+		Description: "Serve a JSON API over HTTPS so that clients can sign certificate requests (POST /v1/sign), revoke\n" +
+			"   certificates (POST /v1/revoke) and list the CA index (GET /v1/certificates). The CRL (GET /v1/crl) and\n" +
+			"   the CA chain (GET /v1/chain) are public. Clients authenticate with a bearer token or a TLS client\n" +
+			"   certificate listed in --policy-file, which also limits what each of them may do.",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "CA",
+				Usage: "Name of CA to issue certificates with",
+			},
+			cli.StringFlag{
+				Name:  "passphrase",
+				Usage: "Passphrase to decrypt the CA private key",
+			},
+			cli.StringFlag{
+				Name:  "listen",
+				Value: ":8200",
+				Usage: "Address to listen on",
+			},
+			cli.StringFlag{
+				Name:  "policy-file",
+				Usage: "JSON file listing the clients allowed to use the API and their policies",
+			},
+			cli.StringFlag{
+				Name:  "tls-cert",
+				Usage: "Certificate to serve the API over HTTPS with",
+			},
+			cli.StringFlag{
+				Name:  "tls-key",
+				Usage: "Unencrypted private key of --tls-cert",
+			},
+			cli.StringFlag{
+				Name:  "client-ca",
+				Usage: "Names of CAs in the depot whose certificates may authenticate clients with a client_cn, comma separated. Must not be the issuing CA.",
+			},
+			cli.StringFlag{
+				Name:  "expires",
+				Value: "2 years",
+				Usage: "How long until signed certificates expire if a request does not say, in the same form as sign --expires",
+			},
+		}, passphraseSourceFlags...),
+		Action: serveAction,
+	}
+}
+
+func serveAction(c *cli.Context) {
+	checkNotSeeded(c)
+	if !c.IsSet("CA") {
+		fmt.Fprintln(os.Stderr, "A CA must be provided with --CA.")
+		os.Exit(1)
+	}
+	if !c.IsSet("policy-file") {
+		fmt.Fprintln(os.Stderr, "A policy file must be provided with --policy-file.")
+		os.Exit(1)
+	}
+	if !c.IsSet("tls-cert") || !c.IsSet("tls-key") {
+		fmt.Fprintln(os.Stderr, "The API must be served over HTTPS, --tls-cert and --tls-key must be provided.")
+		os.Exit(1)
+	}
+	if _, err := parseExpiry(c.String("expires")); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid expiry: %s\n", err)
+		os.Exit(1)
+	}
+
+	formattedCAName := formatName(c.String("CA"))
+	key, err := getCAPrivateKey(c, formattedCAName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Get CA key error:", err)
+		os.Exit(1)
+	}
+	ca, err := service.NewCA(d, formattedCAName, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Load CA error:", err)
+		os.Exit(1)
+	}
+	server := api.NewServer(ca, parseExpiry, c.String("expires"))
+	if err := readPolicyFile(c.String("policy-file"), server); err != nil {
+		fmt.Fprintln(os.Stderr, "Read policy file error:", err)
+		os.Exit(1)
+	}
+
+	// Clients can request certificates with any common name from the issuing CA, so it must not
+	// authenticate clients by their common name
+	clientCAs := splitList(c.String("client-ca"))
+	if len(server.Clients) > 0 && len(clientCAs) == 0 {
+		fmt.Fprintln(os.Stderr, "Clients with a client_cn require --client-ca, a CA other than the issuing CA.")
+		os.Exit(1)
+	}
+	pool := x509.NewCertPool()
+	for _, name := range clientCAs {
+		if formatName(name) == formattedCAName {
+			fmt.Fprintf(os.Stderr, "The issuing CA \"%s\" cannot be a client CA, since clients can request certificates with any common name from it.\n", name)
+			os.Exit(1)
+		}
+		crt, err := depot.GetCertificate(d, formatName(name))
+		if err == nil {
+			var raw *x509.Certificate
+			if raw, err = crt.GetRawCertificate(); err == nil {
+				pool.AddCert(raw)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Load client CA \"%s\" error: %v\n", name, err)
+			os.Exit(1)
+		}
+	}
+
+	httpServer := &http.Server{
+		Addr:    c.String("listen"),
+		Handler: server,
+		TLSConfig: &tls.Config{
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			ClientCAs:  pool,
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+	fmt.Fprintf(os.Stderr, "Serving API for CA \"%s\" on %s/v1/\n", formattedCAName, c.String("listen"))
+	err = httpServer.ListenAndServeTLS(c.String("tls-cert"), c.String("tls-key"))
+	fmt.Fprintln(os.Stderr, "API server error:", err)
+	os.Exit(1)
+}
+
+// readPolicyFile adds the clients listed in the policy file at path to server
+func readPolicyFile(path string, server *api.Server) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file policyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	if len(file.Clients) == 0 {
+		return errors.New("no clients")
+	}
+	for i, client := range file.Clients {
+		if client.Name == "" {
+			return fmt.Errorf("client %d has no name", i+1)
+		}
+		if (client.Token == "") == (client.ClientCN == "") {
+			return fmt.Errorf("client %s must have either a token or a client_cn", client.Name)
+		}
+		for _, profile := range client.Profiles {
+			if !slices.Contains(service.Profiles(), profile) {
+				return fmt.Errorf("client %s: unknown profile %q, must be one of %s", client.Name, profile, strings.Join(service.Profiles(), ", "))
+			}
+		}
+		policy := &api.Policy{
+			Name:     client.Name,
+			Profiles: client.Profiles,
+			Domains:  client.Domains,
+			Revoke:   client.Revoke,
+		}
+		if client.MaxExpires != "" {
+			// Take the time first, so that the validity is not cut short by the time parsing takes
+			now := nowFunc()
+			maxTime, err := parseExpiry(client.MaxExpires)
+			if err != nil {
+				return fmt.Errorf("client %s: invalid max_expires: %v", client.Name, err)
+			}
+			policy.MaxValidity = maxTime.Sub(now)
+		}
+
+		if client.Token != "" {
+			if _, ok := server.Tokens[client.Token]; ok {
+				return fmt.Errorf("client %s reuses the token of another client", client.Name)
+			}
+			server.Tokens[client.Token] = policy
+		} else {
+			if _, ok := server.Clients[client.ClientCN]; ok {
+				return fmt.Errorf("client %s reuses the client_cn of another client", client.Name)
+			}
+			server.Clients[client.ClientCN] = policy
+		}
+	}
+	return nil
+}
@@ -18,12 +18,15 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/square/certstrap/depot"
 	"github.com/square/certstrap/pkix"
+	"github.com/square/certstrap/service"
 	"github.com/urfave/cli"
 )
 
@@ -33,7 +36,7 @@ func NewSignCommand() cli.Command {
 		Name:        "sign",
 		Usage:       "Sign certificate request",
 		Description: "Sign certificate request with CA, and generate certificate for the host.",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.StringFlag{
 				Name:  "passphrase",
 				Usage: "Passphrase to decrypt private-key PEM block of CA",
@@ -63,16 +66,25 @@ func NewSignCommand() cli.Command {
 				Name:  "stdout",
 				Usage: "Print certificate to stdout in addition to saving file",
 			},
+			formatFlag(formatPEM, formatDER, formatPKCS7, formatJWK),
+			signatureAlgorithmFlag(),
+			cli.StringFlag{
+				Name:  "profile",
+				Value: service.ProfileHost,
+				Usage: fmt.Sprintf("Profile to issue the certificate with (one of %s)", strings.Join(service.Profiles(), ", ")),
+			},
 			cli.BoolFlag{
 				Name:  "intermediate",
-				Usage: "Whether generated certificate should be a intermediate",
+				Usage: "Whether generated certificate should be a intermediate (same as --profile intermediate)",
 			},
 			cli.IntFlag{
 				Name:  "path-length",
 				Value: 0,
 				Usage: "Maximum number of non-self-issued intermediate certificates that may follow this CA certificate in a valid certification path",
 			},
-		},
+			shareFileFlag,
+			allowWeakFlag,
+		}, passphraseSourceFlags...),
 		Action: newSignAction,
 	}
 }
@@ -86,6 +98,11 @@ func newSignAction(c *cli.Context) {
 	formattedReqName := strings.Replace(c.Args()[0], " ", "_", -1)
 	formattedCAName := strings.Replace(c.String("CA"), " ", "_", -1)
 
+	format := getFormat(c, formatPEM, formatDER, formatPKCS7, formatJWK)
+	signatureAlgorithm := getSignatureAlgorithm(c)
+
+	defer lockDepot()()
+
 	if depot.CheckCertificate(d, formattedReqName) {
 		fmt.Fprintf(os.Stderr, "Certificate \"%s\" already exists!\n", formattedReqName)
 		os.Exit(1)
@@ -128,56 +145,83 @@ func newSignAction(c *cli.Context) {
 		os.Exit(1)
 	}
 
-	key, err := depot.GetPrivateKey(d, formattedCAName)
+	profile := c.String("profile")
+	if c.Bool("intermediate") {
+		profile = service.ProfileIntermediate
+	}
+	if !slices.Contains(service.Profiles(), profile) {
+		fmt.Fprintf(os.Stderr, "Unknown profile \"%s\", must be one of %s.\n", profile, strings.Join(service.Profiles(), ", "))
+		os.Exit(1)
+	}
+	if c.IsSet("path-length") && profile != service.ProfileIntermediate {
+		fmt.Fprintln(os.Stderr, "The 'path-length' can only be used with 'intermediate' flag.")
+		os.Exit(1)
+	}
+
+	key, err := getCAPrivateKey(c, formattedCAName)
 	if err != nil {
-		pass, err := getPassPhrase(c, "CA key")
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Get CA key error: ", err)
-			os.Exit(1)
-		}
-		key, err = depot.GetEncryptedPrivateKey(d, formattedCAName, pass)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Get CA key error: ", err)
-			os.Exit(1)
-		}
+		fmt.Fprintln(os.Stderr, "Get CA key error: ", err)
+		os.Exit(1)
+	}
+	ca, err := service.NewCA(d, formattedCAName, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Load CA error:", err)
+		os.Exit(1)
 	}
 
-	var crtOut *pkix.Certificate
-	if c.Bool("intermediate") {
+	if profile == service.ProfileIntermediate {
 		fmt.Fprintln(os.Stderr, "Building intermediate")
-
-		opts := []pkix.Option{
-			pkix.WithPathlenOption(c.Int("path-length"), false),
-		}
-
-		crtOut, err = pkix.CreateIntermediateCertificateAuthorityWithOptions(crt, key, csr, expiresTime, opts...)
-	} else {
-		if c.IsSet("path-length") {
-			fmt.Fprintln(os.Stderr, "The 'path-length' can only be used with 'intermediate' flag.")
-			os.Exit(1)
-		}
-
-		crtOut, err = pkix.CreateCertificateHost(crt, key, csr, expiresTime)
 	}
-
-	if err != nil {
+	crtOut, err := ca.Sign(service.SignRequest{
+		Name:               formattedReqName,
+		CSR:                csr,
+		Profile:            profile,
+		NotAfter:           expiresTime,
+		PathLength:         c.Int("path-length"),
+		Operator:           currentOperator(),
+		SignatureAlgorithm: signatureAlgorithm,
+		AllowWeak:          c.Bool("allow-weak"),
+	})
+	if errors.Is(err, service.ErrWeakKey) {
+		fmt.Fprintf(os.Stderr, "Invalid certificate request key: %v, use --allow-weak to sign it anyway\n", err)
+		os.Exit(1)
+	} else if err != nil {
 		fmt.Fprintln(os.Stderr, "Create certificate error:", err)
 		os.Exit(1)
 	} else {
 		fmt.Printf("Created %s/%s.crt from %s/%s.csr signed by %s/%s.key\n", depotDir, formattedReqName, depotDir, formattedReqName, depotDir, formattedCAName)
 	}
 
+	// PKCS#7 and JWK carry the chain of issuers along with the certificate
+	crts := []*pkix.Certificate{crtOut}
+	if format == formatPKCS7 || format == formatJWK {
+		chain, err := depot.GetCertificateChain(d, formattedCAName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Build certificate chain error:", err)
+			os.Exit(1)
+		}
+		crts = append(crts, chain...)
+	}
+
 	if c.Bool("stdout") {
-		crtBytes, err := crtOut.Export()
+		crtBytes, err := encodeCertificates(format, crts)
+		if err == nil {
+			err = printFormatted(format, crtBytes)
+		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Print certificate error:", err)
 			os.Exit(1)
-		} else {
-			fmt.Println(string(crtBytes))
 		}
 	}
 
-	if err = putCertificate(c, d, formattedReqName, crtOut); err != nil {
+	if err = putCertificate(c, d, formattedReqName, format, crts); err != nil {
 		fmt.Fprintln(os.Stderr, "Save certificate error:", err)
+	} else if format != formatPEM && !c.IsSet("cert") {
+		path, err := putFormattedCertificates(format, formattedReqName, crts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Save certificate error:", err)
+		} else {
+			fmt.Printf("Created %s\n", path)
+		}
 	}
 }
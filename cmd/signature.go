@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/square/certstrap/pkix"
+	"github.com/urfave/cli"
+)
+
+func signatureAlgorithmFlag() cli.StringFlag {
+	return cli.StringFlag{
+		Name:  "signature-algorithm",
+		Usage: fmt.Sprintf("Signature algorithm, one of %s (default depends on the signing key)", strings.Join(pkix.SignatureAlgorithms(), ", ")),
+	}
+}
+
+// getSignatureAlgorithm returns the value of the --signature-algorithm flag, exiting if it is
+// unknown. It is x509.UnknownSignatureAlgorithm, the default of the signing key, if the flag
+// is not set. Whether the key can sign with it is checked once the key is loaded.
+func getSignatureAlgorithm(c *cli.Context) x509.SignatureAlgorithm {
+	if c.String("signature-algorithm") == "" {
+		return x509.UnknownSignatureAlgorithm
+	}
+	algo, err := pkix.ParseSignatureAlgorithm(c.String("signature-algorithm"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid signature algorithm:", err)
+		os.Exit(1)
+	}
+	return algo
+}
+
+// checkSignatureAlgorithm exits if key cannot sign with algo
+func checkSignatureAlgorithm(key *pkix.Key, algo x509.SignatureAlgorithm) {
+	if err := pkix.CheckSignatureAlgorithm(key, algo); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid signature algorithm:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/howeyc/gopass"
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/shamir"
+	"github.com/urfave/cli"
+)
+
+// splitSecretSize is the number of random bytes of a split passphrase. The passphrase
+// is their hex encoding, and each share is one byte longer.
+const splitSecretSize = 32
+
+// shareFileFlag gives the shares of a split CA key passphrase without prompting for them
+var shareFileFlag = cli.StringSliceFlag{
+	Name:  "share-file",
+	Usage: "Read a share of the split passphrase of the CA key from the first line of this file (can be specified multiple times)",
+}
+
+// parseSplit parses N/M: M shares, any N of which recombine the passphrase
+func parseSplit(s string) (threshold, shares int, err error) {
+	n, m, ok := strings.Cut(s, "/")
+	if ok {
+		threshold, err = strconv.Atoi(n)
+	}
+	if ok && err == nil {
+		shares, err = strconv.Atoi(m)
+	}
+	if !ok || err != nil {
+		return 0, 0, fmt.Errorf("invalid split %q, must be N/M (example: 2/3)", s)
+	}
+	switch {
+	case threshold < 2:
+		return 0, 0, errors.New("at least 2 shares must be required")
+	case shares < threshold:
+		return 0, 0, fmt.Errorf("cannot require %d of only %d shares", threshold, shares)
+	case shares > shamir.MaxShares:
+		return 0, 0, fmt.Errorf("cannot split into more than %d shares", shamir.MaxShares)
+	}
+	return threshold, shares, nil
+}
+
+// newSplitPassPhrase generates a random passphrase and splits it into shares
+func newSplitPassPhrase(threshold, shares int) (pass []byte, out []string, err error) {
+	secret := make([]byte, splitSecretSize)
+	// The passphrase protects the key, so it never comes from the seeded randomness of --seed
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return nil, nil, err
+	}
+	parts, err := shamir.Split(rand.Reader, secret, shares, threshold)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, part := range parts {
+		out = append(out, hex.EncodeToString(part))
+	}
+	return []byte(hex.EncodeToString(secret)), out, nil
+}
+
+// putShares writes each share to its own file in dir, which only the owner can read
+func putShares(dir, name string, shares []string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for i, share := range shares {
+		path := filepath.Join(dir, fmt.Sprintf("%s.share-%d", name, i+1))
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(f, share)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %s\n", path)
+	}
+	return nil
+}
+
+// getSplitPassPhrase recombines the split passphrase of the private key name from the
+// files given by --share-file, or otherwise from as many shares as it needs prompted for
+func getSplitPassPhrase(c *cli.Context, name string) ([]byte, error) {
+	split, err := depot.GetSplit(d, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var shares [][]byte
+	if files := c.StringSlice("share-file"); len(files) > 0 {
+		if len(files) < split.Threshold {
+			return nil, fmt.Errorf("%d of the %d shares are needed to unlock %s key, got %d", split.Threshold, split.Shares, name, len(files))
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("read share file: %v", err)
+			}
+			share, err := decodeShare(firstLine(data))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", file, err)
+			}
+			shares = append(shares, share)
+		}
+	} else {
+		if !stdinIsTerminal() {
+			err := fmt.Errorf("stdin is not a terminal, cannot prompt for the shares of the passphrase of %s key", name)
+			if slices.Contains(c.FlagNames(), "share-file") {
+				err = fmt.Errorf("%v, use --share-file", err)
+			}
+			return nil, err
+		}
+		fmt.Printf("The passphrase of %s key is split, %d of its %d shares are needed.\n", name, split.Threshold, split.Shares)
+		for i := 1; i <= split.Threshold; i++ {
+			line, err := gopass.GetPasswdPrompt(fmt.Sprintf("Enter share %d of %d: ", i, split.Threshold), false, os.Stdin, os.Stdout)
+			if err != nil {
+				return nil, err
+			}
+			share, err := decodeShare(line)
+			if err != nil {
+				return nil, err
+			}
+			shares = append(shares, share)
+		}
+	}
+
+	secret, err := shamir.Combine(shares)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(hex.EncodeToString(secret)), nil
+}
+
+func decodeShare(line []byte) ([]byte, error) {
+	share, err := hex.DecodeString(strings.TrimSpace(string(line)))
+	if err != nil || len(share) != splitSecretSize+1 {
+		return nil, errors.New("malformed share")
+	}
+	return share, nil
+}
@@ -0,0 +1,423 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/sshca"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshCriticalOptions are the critical options understood by sshd. A certificate with any
+// other critical option is refused, so they are rejected when signing.
+var sshCriticalOptions = []string{"force-command", "source-address", "verify-required"}
+
+// NewSSHCommand sets up an "ssh" command to run an OpenSSH certificate authority
+func NewSSHCommand() cli.Command {
+	caFlag := cli.StringFlag{
+		Name:  "CA",
+		Usage: "Name of SSH CA to use",
+	}
+	passphraseFlag := cli.StringFlag{
+		Name:  "passphrase",
+		Usage: "Passphrase to decrypt private key PEM block of SSH CA",
+	}
+	signFlags := append([]cli.Flag{
+		caFlag,
+		passphraseFlag,
+		cli.StringFlag{
+			Name:  "key-id",
+			Usage: "Key ID of the certificate, logged by sshd and used to revoke it (default: the first principal)",
+		},
+		cli.StringFlag{
+			Name:  "out",
+			Usage: "File to write the certificate to (default: PUBKEY_FILE with -cert.pub in place of .pub)",
+		},
+	}, passphraseSourceFlags...)
+	return cli.Command{
+		Name:  "ssh",
+		Usage: "Run an SSH certificate authority",
+		Description: "Issue OpenSSH user and host certificates, and revoke them with a key revocation list (KRL).\n" +
+			"   For an SSH CA named CA, the depot holds its private key CA.key, its public key CA.pub in\n" +
+			"   authorized_keys format, and its KRL CA.krl for the RevokedKeys option of sshd.",
+		Subcommands: []cli.Command{
+			{
+				Name:      "init",
+				Usage:     "Create SSH certificate authority",
+				ArgsUsage: "NAME",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:  "passphrase",
+						Usage: "Passphrase to encrypt private key PEM block",
+					},
+					cli.IntFlag{
+						Name:  "key-bits",
+						Value: 4096,
+						Usage: "Size (in bits) of RSA keypair to generate (example: 4096, same as --key-type rsa:4096)",
+					},
+					cli.StringFlag{
+						Name:  "curve",
+						Usage: fmt.Sprintf("Key type other than RSA by its curve name, one of %s (same as --key-type)", supportedCurves()),
+					},
+					keyTypeFlag,
+					allowWeakFlag,
+				}, passphraseSourceFlags...),
+				Action: sshInitAction,
+			},
+			{
+				Name:      "sign-user",
+				Usage:     "Issue an SSH user certificate",
+				ArgsUsage: "PUBKEY_FILE",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:  "principals",
+						Usage: "User names the certificate is valid for, comma separated",
+					},
+					cli.StringFlag{
+						Name:  "expires",
+						Value: "1 day",
+						Usage: "How long until the certificate expires (example: 1 year 2 days 3 months 4 hours)",
+					},
+					cli.StringSliceFlag{
+						Name:  "critical-option",
+						Usage: fmt.Sprintf("Critical option as name=value, one of %s (can be specified multiple times)", strings.Join(sshCriticalOptions, ", ")),
+					},
+					cli.StringSliceFlag{
+						Name:  "extension",
+						Usage: "Extension as name or name=value, in addition to the default extensions (can be specified multiple times)",
+					},
+					cli.BoolFlag{
+						Name:  "no-default-extensions",
+						Usage: fmt.Sprintf("Omit the default extensions %s", strings.Join(sshca.DefaultUserExtensions, ", ")),
+					},
+				}, signFlags...),
+				Action: sshSignUserAction,
+			},
+			{
+				Name:      "sign-host",
+				Usage:     "Issue an SSH host certificate",
+				ArgsUsage: "PUBKEY_FILE",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:  "principals",
+						Usage: "Host names the certificate is valid for, comma separated",
+					},
+					cli.StringFlag{
+						Name:  "expires",
+						Value: "1 year",
+						Usage: "How long until the certificate expires (example: 1 year 2 days 3 months 4 hours)",
+					},
+				}, signFlags...),
+				Action: sshSignHostAction,
+			},
+			{
+				Name:  "revoke",
+				Usage: "Revoke SSH certificates and keys",
+				Description: "Add certificates and keys to the KRL of the SSH CA. A certificate file issued by the CA is\n" +
+					"   revoked by its serial number, any other certificate or public key file by its key.",
+				ArgsUsage: "[FILE...]",
+				Flags: []cli.Flag{
+					caFlag,
+					cli.StringSliceFlag{
+						Name:  "serial",
+						Usage: "Serial number of a certificate to revoke (can be specified multiple times)",
+					},
+					cli.StringSliceFlag{
+						Name:  "key-id",
+						Usage: "Key ID of certificates to revoke (can be specified multiple times)",
+					},
+				},
+				Action: sshRevokeAction,
+			},
+		},
+	}
+}
+
+func sshInitAction(c *cli.Context) {
+	if len(c.Args()) != 1 {
+		fmt.Fprintln(os.Stderr, "One SSH CA name must be provided.")
+		os.Exit(1)
+	}
+	name := formatName(c.Args()[0])
+	keyType := getKeyType(c)
+
+	defer lockDepot()()
+
+	if depot.CheckPrivateKey(d, name) || d.Check(depot.SSHPublicKeyTag(name)) {
+		fmt.Fprintf(os.Stderr, "CA with specified name \"%s\" already exists!\n", name)
+		os.Exit(1)
+	}
+
+	passphrase, err := newPassPhrase(c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	key, err := keyType.Create()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Create key error:", err)
+		os.Exit(1)
+	}
+	ca, err := sshca.NewCA(key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Create SSH CA error:", err)
+		os.Exit(1)
+	}
+
+	if len(passphrase) > 0 {
+		err = depot.PutEncryptedPrivateKey(d, name, key, passphrase)
+	} else {
+		err = depot.PutPrivateKey(d, name, key)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Save private key error:", err)
+		os.Exit(1)
+	}
+	if len(passphrase) > 0 {
+		fmt.Printf("Created %s/%s.key (encrypted by passphrase)\n", depotDir, name)
+	} else {
+		fmt.Printf("Created %s/%s.key\n", depotDir, name)
+	}
+
+	if err := d.Put(depot.SSHPublicKeyTag(name), ssh.MarshalAuthorizedKey(ca.PublicKey())); err != nil {
+		fmt.Fprintln(os.Stderr, "Save public key error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Created %s/%s.pub\n", depotDir, name)
+
+	krl := sshca.NewKRL(ca.PublicKey(), name)
+	krl.Version = 1
+	krl.GeneratedDate = nowFunc()
+	if err := d.Put(depot.KRLTag(name), krl.Marshal()); err != nil {
+		fmt.Fprintln(os.Stderr, "Save KRL error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Created %s/%s.krl\n", depotDir, name)
+}
+
+func sshSignUserAction(c *cli.Context) {
+	req := sshca.CertificateRequest{
+		CertType:        ssh.UserCert,
+		CriticalOptions: map[string]string{},
+		Extensions:      map[string]string{},
+	}
+	for _, option := range c.StringSlice("critical-option") {
+		name, value, ok := strings.Cut(option, "=")
+		if !ok || !slices.Contains(sshCriticalOptions, name) {
+			fmt.Fprintf(os.Stderr, "Invalid critical option %q, must be name=value with name one of %s\n", option, strings.Join(sshCriticalOptions, ", "))
+			os.Exit(1)
+		}
+		req.CriticalOptions[name] = value
+	}
+	if !c.Bool("no-default-extensions") {
+		for _, name := range sshca.DefaultUserExtensions {
+			req.Extensions[name] = ""
+		}
+	}
+	for _, extension := range c.StringSlice("extension") {
+		name, value, _ := strings.Cut(extension, "=")
+		if name == "" {
+			fmt.Fprintf(os.Stderr, "Invalid extension %q\n", extension)
+			os.Exit(1)
+		}
+		req.Extensions[name] = value
+	}
+	sshSign(c, req)
+}
+
+func sshSignHostAction(c *cli.Context) {
+	sshSign(c, sshca.CertificateRequest{CertType: ssh.HostCert})
+}
+
+// sshSign completes req from the flags of sign-user and sign-host, and issues the certificate
+func sshSign(c *cli.Context, req sshca.CertificateRequest) {
+	if len(c.Args()) != 1 {
+		fmt.Fprintln(os.Stderr, "One public key file must be provided.")
+		os.Exit(1)
+	}
+	if !c.IsSet("CA") {
+		fmt.Fprintln(os.Stderr, "An SSH CA must be provided with --CA.")
+		os.Exit(1)
+	}
+	if req.Principals = splitList(c.String("principals")); len(req.Principals) == 0 {
+		fmt.Fprintln(os.Stderr, "At least one principal must be provided with --principals.")
+		os.Exit(1)
+	}
+	req.KeyID = c.String("key-id")
+	if req.KeyID == "" {
+		req.KeyID = req.Principals[0]
+	}
+
+	path := c.Args()[0]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Read public key error:", err)
+		os.Exit(1)
+	}
+	var comment string
+	req.PublicKey, comment, _, _, err = ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Read public key error:", err)
+		os.Exit(1)
+	}
+
+	// ValidAfter is set to be 10min earlier to fix gap on time difference between hosts
+	req.ValidAfter = nowFunc().Add(-10 * time.Minute)
+	req.ValidBefore, err = parseExpiry(c.String("expires"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid expiry: %s\n", err)
+		os.Exit(1)
+	}
+
+	name := formatName(c.String("CA"))
+	ca, krl, err := loadSSHCA(c, name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Load SSH CA error:", err)
+		os.Exit(1)
+	}
+	if krl.IsRevoked(req.PublicKey) {
+		fmt.Fprintf(os.Stderr, "Key %s is revoked by SSH CA \"%s\".\n", ssh.FingerprintSHA256(req.PublicKey), name)
+		os.Exit(1)
+	}
+
+	crt, err := ca.Sign(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Sign certificate error:", err)
+		os.Exit(1)
+	}
+
+	out := c.String("out")
+	if out == "" {
+		out = strings.TrimSuffix(path, ".pub") + "-cert.pub"
+	}
+	crtBytes := ssh.MarshalAuthorizedKey(crt)
+	if comment != "" {
+		crtBytes = append(bytes.TrimSuffix(crtBytes, []byte("\n")), " "+comment+"\n"...)
+	}
+	if err := depot.WriteFileAtomic(out, crtBytes, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "Save certificate error:", err)
+		os.Exit(1)
+	}
+	kind := "user"
+	if req.CertType == ssh.HostCert {
+		kind = "host"
+	}
+	fmt.Printf("Signed %s certificate %q with serial %d for %s\n", kind, req.KeyID, crt.Serial, strings.Join(req.Principals, ", "))
+	fmt.Printf("Created %s\n", out)
+}
+
+func sshRevokeAction(c *cli.Context) {
+	if !c.IsSet("CA") {
+		fmt.Fprintln(os.Stderr, "An SSH CA must be provided with --CA.")
+		os.Exit(1)
+	}
+	if len(c.Args()) == 0 && len(c.StringSlice("serial")) == 0 && len(c.StringSlice("key-id")) == 0 {
+		fmt.Fprintln(os.Stderr, "A certificate or key file, --serial or --key-id must be provided.")
+		os.Exit(1)
+	}
+	name := formatName(c.String("CA"))
+
+	defer lockDepot()()
+
+	krl, err := getKRL(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Read KRL error:", err)
+		os.Exit(1)
+	}
+
+	for _, s := range c.StringSlice("serial") {
+		serial, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid serial number %q\n", s)
+			os.Exit(1)
+		}
+		krl.RevokeSerial(serial)
+		fmt.Printf("Revoked serial %d\n", serial)
+	}
+	for _, id := range c.StringSlice("key-id") {
+		krl.RevokeKeyID(id)
+		fmt.Printf("Revoked key ID %q\n", id)
+	}
+	for _, path := range c.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Read key error:", err)
+			os.Exit(1)
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Read key %s error: %v\n", path, err)
+			os.Exit(1)
+		}
+		if crt, ok := key.(*ssh.Certificate); ok && bytes.Equal(crt.SignatureKey.Marshal(), krl.CAKey.Marshal()) {
+			krl.RevokeSerial(crt.Serial)
+			fmt.Printf("Revoked certificate %q with serial %d\n", crt.KeyId, crt.Serial)
+		} else {
+			krl.RevokeKey(key)
+			fmt.Printf("Revoked key %s\n", ssh.FingerprintSHA256(key))
+		}
+	}
+
+	krl.Version++
+	krl.GeneratedDate = nowFunc()
+	if err := d.Replace(depot.KRLTag(name), krl.Marshal()); err != nil {
+		fmt.Fprintln(os.Stderr, "Save KRL error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Updated %s/%s.krl\n", depotDir, name)
+}
+
+// loadSSHCA loads the SSH CA name and its KRL from the depot
+func loadSSHCA(c *cli.Context, name string) (*sshca.CA, *sshca.KRL, error) {
+	if !d.Check(depot.SSHPublicKeyTag(name)) {
+		return nil, nil, fmt.Errorf("no SSH CA named \"%s\"", name)
+	}
+	key, err := getCAPrivateKey(c, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := sshca.NewCA(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	krl, err := getKRL(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(krl.CAKey.Marshal(), ca.PublicKey().Marshal()) {
+		return nil, nil, errors.New("KRL is not for the key of the SSH CA")
+	}
+	return ca, krl, nil
+}
+
+// getKRL reads the KRL of the SSH CA name from the depot
+func getKRL(name string) (*sshca.KRL, error) {
+	data, err := d.Get(depot.KRLTag(name))
+	if err != nil {
+		return nil, err
+	}
+	krl, err := sshca.ParseKRL(data)
+	if err != nil {
+		return nil, err
+	}
+	if krl.CAKey == nil {
+		// KRLs only list their CA once a certificate is revoked by serial or key ID
+		pub, err := d.Get(depot.SSHPublicKeyTag(name))
+		if err != nil {
+			return nil, err
+		}
+		if krl.CAKey, _, _, _, err = ssh.ParseAuthorizedKey(pub); err != nil {
+			return nil, err
+		}
+	}
+	return krl, nil
+}
@@ -22,6 +22,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/user"
+	"time"
 
 	"github.com/howeyc/gopass"
 	"github.com/square/certstrap/depot"
@@ -46,7 +48,50 @@ func InitDepot(path string) error {
 	return nil
 }
 
+// InitReproducible fixes the clock at now, an RFC 3339 time, and derives all randomness
+// from seed, for the flags creating reproducible fixtures. Empty arguments are ignored.
+func InitReproducible(now, seed string) error {
+	if now != "" {
+		t, err := time.Parse(time.RFC3339, now)
+		if err != nil {
+			return fmt.Errorf("invalid --now: %v", err)
+		}
+		pkix.SetClock(func() time.Time { return t })
+	}
+	if seed != "" {
+		pkix.SetRandom(pkix.NewSeededRandom(seed))
+	}
+	return nil
+}
+
+// checkNotSeeded exits if the hidden --seed flag is given to a long-running command, which
+// would issue predictable serial numbers and nonces to its clients
+func checkNotSeeded(c *cli.Context) {
+	if c.GlobalIsSet("seed") {
+		fmt.Fprintln(os.Stderr, "--seed is for test fixtures only, it cannot be used with the servers or the agent.")
+		os.Exit(1)
+	}
+}
+
+// lockDepot takes the depot lock so that concurrent certstrap runs do not
+// race on the same files. It exits if the lock cannot be acquired.
+// The lock is released when the returned function is called or the process exits.
+func lockDepot() func() {
+	unlock, err := d.Lock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Lock depot error:", err)
+		os.Exit(1)
+	}
+	return func() {
+		//nolint:errcheck
+		unlock()
+	}
+}
+
 func createPassPhrase() ([]byte, error) {
+	if !stdinIsTerminal() {
+		return nil, errNotTerminal
+	}
 	pass1, err := gopass.GetPasswdPrompt("Enter passphrase (empty for no passphrase): ", false, os.Stdin, os.Stdout)
 	if err != nil {
 		return nil, err
@@ -63,6 +108,9 @@ func createPassPhrase() ([]byte, error) {
 }
 
 func askPassPhrase(name string) ([]byte, error) {
+	if !stdinIsTerminal() {
+		return nil, errNotTerminal
+	}
 	pass, err := gopass.GetPasswdPrompt(fmt.Sprintf("Enter passphrase for %v (empty for no passphrase): ", name), false, os.Stdin, os.Stdout)
 	if err != nil {
 		return nil, err
@@ -71,26 +119,68 @@ func askPassPhrase(name string) ([]byte, error) {
 }
 
 func getPassPhrase(c *cli.Context, name string) ([]byte, error) {
-	if c.IsSet("passphrase") {
-		return []byte(c.String("passphrase")), nil
+	return getFlagPassPhrase(c, "passphrase", name)
+}
+
+// getFlagPassPhrase returns the passphrase given by the flag or one of the flags of
+// passphraseSources(flag), or otherwise asks for the passphrase of name.
+func getFlagPassPhrase(c *cli.Context, flag, name string) ([]byte, error) {
+	if pass, ok, err := readPassphraseFlags(c, flag); ok || err != nil {
+		return pass, err
+	}
+	pass, err := askPassPhrase(name)
+	return pass, promptError(c, flag, err)
+}
+
+// getCAPrivateKey loads the private key of a CA from the depot,
+// asking for its passphrase if the key is encrypted, or for the shares of its passphrase if it is split.
+func getCAPrivateKey(c *cli.Context, name string) (*pkix.Key, error) {
+	return getFlagPrivateKey(c, name, "passphrase", "CA key")
+}
+
+// getFlagPrivateKey loads the private key of name from the depot like getCAPrivateKey, taking
+// its passphrase from the flag or one of the flags of passphraseSources(flag).
+func getFlagPrivateKey(c *cli.Context, name, flag, what string) (*pkix.Key, error) {
+	key, err := depot.GetPrivateKey(d, name)
+	if err == nil {
+		return key, nil
+	}
+	if _, ok, err := readPassphraseFlags(c, flag); err == nil && !ok && depot.CheckSplit(d, name) {
+		pass, err := getSplitPassPhrase(c, name)
+		if err != nil {
+			return nil, err
+		}
+		key, err := depot.GetEncryptedPrivateKey(d, name, pass)
+		if err != nil {
+			return nil, fmt.Errorf("the shares do not unlock %s key: %v", name, err)
+		}
+		return key, nil
+	}
+	pass, err := getFlagPassPhrase(c, flag, what)
+	if err != nil {
+		return nil, err
 	}
-	return askPassPhrase(name)
+	return depot.GetEncryptedPrivateKey(d, name, pass)
 }
 
-func putCertificate(c *cli.Context, d *depot.FileDepot, name string, crt *pkix.Certificate) error {
+// putCertificate saves crts, a certificate followed by its chain, to the file given by --cert in format,
+// or otherwise saves the certificate to the depot as PEM.
+func putCertificate(c *cli.Context, d *depot.FileDepot, name, format string, crts []*pkix.Certificate) error {
 	if c.IsSet("cert") {
-		bytes, err := crt.Export()
+		bytes, err := encodeCertificates(format, crts)
 		if err != nil {
 			return err
 		}
 		return os.WriteFile(c.String("cert"), bytes, depot.LeafPerm)
 	}
-	return depot.PutCertificate(d, name, crt)
+	return depot.PutCertificate(d, name, crts[0])
 }
 
-func putCertificateSigningRequest(c *cli.Context, d *depot.FileDepot, name string, csr *pkix.CertificateSigningRequest) error {
+// putCertificateSigningRequest saves csr to the file given by --csr in format,
+// or otherwise to the depot as PEM.
+func putCertificateSigningRequest(c *cli.Context, d *depot.FileDepot, name, format string, csr *pkix.CertificateSigningRequest) error {
 	if c.IsSet("csr") {
-		bytes, err := csr.Export()
+		bytes, err := encodeCertificateSigningRequest(format, csr)
 		if err != nil {
 			return err
 		}
@@ -99,13 +189,21 @@ func putCertificateSigningRequest(c *cli.Context, d *depot.FileDepot, name strin
 	return depot.PutCertificateSigningRequest(d, name, csr)
 }
 
+// getCertificateSigningRequest reads the PEM or DER file given by --csr, or otherwise the CSR in the depot.
 func getCertificateSigningRequest(c *cli.Context, d *depot.FileDepot, name string) (*pkix.CertificateSigningRequest, error) {
 	if c.IsSet("csr") {
-		bytes, err := os.ReadFile(c.String("csr"))
+		data, err := os.ReadFile(c.String("csr"))
 		if err != nil {
 			return nil, err
 		}
-		return pkix.NewCertificateSigningRequestFromPEM(bytes)
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+			return pkix.NewCertificateSigningRequestFromPEM(data)
+		}
+		csr := pkix.NewCertificateSigningRequestFromDER(data)
+		if _, err := csr.GetRawCertificateSigningRequest(); err != nil {
+			return nil, err
+		}
+		return csr, nil
 	}
 	return depot.GetCertificateSigningRequest(d, name)
 }
@@ -144,3 +242,23 @@ func fileExists(filepath string) bool {
 	_, err := os.Stat(filepath)
 	return !os.IsNotExist(err)
 }
+
+// currentOperator returns the name of the user running certstrap, as recorded in CA indexes.
+func currentOperator() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
+
+// recordIssued adds a newly issued certificate to the index of the CA that signed it.
+func recordIssued(ca, name string, crt *pkix.Certificate) error {
+	entry, err := depot.NewIndexEntry(name, crt, depot.StatusIssued, currentOperator())
+	if err != nil {
+		return err
+	}
+	return depot.AppendIndexEntry(d, ca, entry)
+}
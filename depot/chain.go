@@ -0,0 +1,109 @@
+package depot
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"sort"
+
+	"github.com/square/certstrap/pkix"
+)
+
+type depotCertificate struct {
+	name string
+	crt  *pkix.Certificate
+	raw  *x509.Certificate
+}
+
+// certificates loads every certificate in the depot, sorted by name. Files that cannot be
+// read or parsed are skipped, so that one broken file does not break every chain in the depot.
+func (d *FileDepot) certificates() []*depotCertificate {
+	var crts []*depotCertificate
+	for _, tag := range d.List() {
+		name := GetNameFromCrtTag(tag)
+		if name == "" {
+			continue
+		}
+		if c, err := d.certificate(name); err == nil {
+			crts = append(crts, c)
+		}
+	}
+	sort.Slice(crts, func(i, j int) bool { return crts[i].name < crts[j].name })
+	return crts
+}
+
+// certificate loads the certificate with the given name
+func (d *FileDepot) certificate(name string) (*depotCertificate, error) {
+	crt, err := GetCertificate(d, name)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := crt.GetRawCertificate()
+	if err != nil {
+		return nil, err
+	}
+	return &depotCertificate{name, crt, raw}, nil
+}
+
+// isSelfSigned reports whether crt is a root certificate.
+func isSelfSigned(crt *x509.Certificate) bool {
+	return bytes.Equal(crt.RawIssuer, crt.RawSubject) && crt.CheckSignatureFrom(crt) == nil
+}
+
+// GetCertificateChain returns the certificate with the given name followed by its issuers
+// found in the depot, ordered from the certificate up to the root. Issuers are matched by
+// authority and subject key ID and checked by signature. When several certificates match,
+// such as a CA and its cross-signed copy, a self-signed one is preferred.
+// The chain ends early if an issuer is missing from the depot, in which case the last
+// certificate returned is not self-signed.
+func GetCertificateChain(d *FileDepot, name string) ([]*pkix.Certificate, error) {
+	current, err := d.certificate(name)
+	if err != nil {
+		return nil, fmt.Errorf("certificate %q: %v", name, err)
+	}
+	crts := d.certificates()
+
+	chain := []*pkix.Certificate{current.crt}
+	seen := map[string]bool{current.name: true}
+	for !isSelfSigned(current.raw) {
+		var issuer *depotCertificate
+		for _, c := range crts {
+			if seen[c.name] || !c.raw.IsCA {
+				continue
+			}
+			if len(current.raw.AuthorityKeyId) > 0 && !bytes.Equal(current.raw.AuthorityKeyId, c.raw.SubjectKeyId) {
+				continue
+			}
+			if current.raw.CheckSignatureFrom(c.raw) != nil {
+				continue
+			}
+			if issuer == nil || (!isSelfSigned(issuer.raw) && isSelfSigned(c.raw)) {
+				issuer = c
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer.crt)
+		seen[issuer.name] = true
+		current = issuer
+	}
+	return chain, nil
+}
+
+// GetRootCertificates returns all self-signed CA certificates in the depot, sorted by name
+func GetRootCertificates(d *FileDepot) ([]*pkix.Certificate, error) {
+	var roots []*pkix.Certificate
+	for _, c := range d.certificates() {
+		if c.raw.IsCA && isSelfSigned(c.raw) {
+			roots = append(roots, c.crt)
+		}
+	}
+	return roots, nil
+}
+
+// IsRootCertificate reports whether crt is a self-signed CA certificate
+func IsRootCertificate(crt *pkix.Certificate) bool {
+	raw, err := crt.GetRawCertificate()
+	return err == nil && raw.IsCA && isSelfSigned(raw)
+}
@@ -0,0 +1,122 @@
+package depot
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/square/certstrap/pkix"
+)
+
+func putTestCA(t *testing.T, d *FileDepot, name string, expiry time.Time) (*pkix.Certificate, *pkix.Key) {
+	key, err := pkix.CreateEd25519Key()
+	if err != nil {
+		t.Fatal("Failed creating key:", err)
+	}
+	crt, err := pkix.CreateCertificateAuthorityWithOptions(key, "", expiry, "", "", "", "", name, nil, pkix.WithPathlenOption(2, false))
+	if err != nil {
+		t.Fatal("Failed creating CA:", err)
+	}
+	if err := PutCertificate(d, name, crt); err != nil {
+		t.Fatal("Failed putting certificate:", err)
+	}
+	return crt, key
+}
+
+func signTestCSR(t *testing.T, d *FileDepot, name string, caCrt *pkix.Certificate, caKey *pkix.Key, intermediate bool) (*pkix.Certificate, *pkix.Key) {
+	key, err := pkix.CreateEd25519Key()
+	if err != nil {
+		t.Fatal("Failed creating key:", err)
+	}
+	csr, err := pkix.CreateCertificateSigningRequest(key, "", nil, nil, nil, "", "", "", "", name)
+	if err != nil {
+		t.Fatal("Failed creating csr:", err)
+	}
+	var crt *pkix.Certificate
+	if intermediate {
+		crt, err = pkix.CreateIntermediateCertificateAuthority(caCrt, caKey, csr, time.Now().Add(time.Hour))
+	} else {
+		crt, err = pkix.CreateCertificateHost(caCrt, caKey, csr, time.Now().Add(time.Hour))
+	}
+	if err != nil {
+		t.Fatal("Failed signing certificate:", err)
+	}
+	if err := PutCertificate(d, name, crt); err != nil {
+		t.Fatal("Failed putting certificate:", err)
+	}
+	return crt, key
+}
+
+func TestGetCertificateChain(t *testing.T) {
+	d := getDepot(t)
+	defer os.RemoveAll(dir)
+
+	root, rootKey := putTestCA(t, d, "root", time.Now().Add(2*time.Hour))
+	other, otherKey := putTestCA(t, d, "other", time.Now().Add(2*time.Hour))
+	inter, interKey := signTestCSR(t, d, "inter", root, rootKey, true)
+	leaf, _ := signTestCSR(t, d, "leaf", inter, interKey, false)
+
+	// a cross-signed copy of root must not be preferred over root itself
+	cross, err := pkix.CrossSignCertificateAuthority(other, otherKey, root, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal("Failed cross-signing:", err)
+	}
+	if err := PutCertificate(d, "a-root-cross-other", cross); err != nil {
+		t.Fatal("Failed putting certificate:", err)
+	}
+
+	// an unrelated certificate that does not parse is skipped
+	if err := d.Put(CrtTag("broken"), []byte("not a certificate")); err != nil {
+		t.Fatal("Failed putting certificate:", err)
+	}
+
+	chain, err := GetCertificateChain(d, "leaf")
+	if err != nil {
+		t.Fatal("Failed building chain:", err)
+	}
+	want := []*pkix.Certificate{leaf, inter, root}
+	if len(chain) != len(want) {
+		t.Fatalf("Expect chain of %d certificates, got %d", len(want), len(chain))
+	}
+	for i := range want {
+		got, _ := chain[i].Export()
+		exp, _ := want[i].Export()
+		if !bytes.Equal(got, exp) {
+			t.Fatalf("Unexpected certificate at position %d of chain", i)
+		}
+	}
+	if !IsRootCertificate(chain[2]) || IsRootCertificate(chain[1]) {
+		t.Fatal("Expect chain to end at the root")
+	}
+
+	if _, err := GetCertificateChain(d, "missing"); err == nil {
+		t.Fatal("Expect error for missing certificate")
+	}
+	if _, err := GetCertificateChain(d, "broken"); err == nil {
+		t.Fatal("Expect error for a certificate that does not parse")
+	}
+
+	roots, err := GetRootCertificates(d)
+	if err != nil {
+		t.Fatal("Failed getting roots:", err)
+	}
+	if len(roots) != 2 {
+		t.Fatalf("Expect 2 roots, got %d", len(roots))
+	}
+
+	// Without the root in the depot the chain stops at the intermediate
+	if err := DeleteCertificate(d, "root"); err != nil {
+		t.Fatal("Failed deleting certificate:", err)
+	}
+	if err := DeleteCertificate(d, "a-root-cross-other"); err != nil {
+		t.Fatal("Failed deleting certificate:", err)
+	}
+	chain, err = GetCertificateChain(d, "leaf")
+	if err != nil {
+		t.Fatal("Failed building chain:", err)
+	}
+	if len(chain) != 2 || IsRootCertificate(chain[1]) {
+		t.Fatal("Expect incomplete chain without root")
+	}
+}
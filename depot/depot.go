@@ -23,11 +23,15 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 const (
 	// DefaultFileDepotDir is the default directory where .key/.csr/.crt files can be found
 	DefaultFileDepotDir = "out"
+
+	// lockFileName is the file used to hold the advisory lock on the depot directory
+	lockFileName = ".lock"
 )
 
 // Tag includes name and permission requirement
@@ -46,6 +50,8 @@ type Tag struct {
 // Depot is in charge of data storage
 type Depot interface {
 	Put(tag *Tag, data []byte) error
+	Replace(tag *Tag, data []byte) error
+	Append(tag *Tag, data []byte) error
 	Check(tag *Tag) bool
 	Get(tag *Tag) ([]byte, error)
 	Delete(tag *Tag) error
@@ -71,32 +77,135 @@ func (d *FileDepot) path(name string) string {
 	return filepath.Join(d.dirPath, name)
 }
 
-// Put inserts the data into the file specified by the tag
+// Put inserts the data into the file specified by the tag.
+// The data is written to a temporary file which is then linked into place,
+// so the file is either absent or complete even if the process crashes.
+// Put fails if the file already exists.
 func (d *FileDepot) Put(tag *Tag, data []byte) error {
 	if data == nil {
 		return errors.New("data is nil")
 	}
 
+	name := d.path(tag.name)
+	tmp, err := writeTemp(name, data)
+	if err != nil {
+		return err
+	}
+	return commitNew(tmp, name, tag.perm)
+}
+
+// Replace atomically replaces the file specified by the tag with data,
+// creating it if it does not exist yet.
+func (d *FileDepot) Replace(tag *Tag, data []byte) error {
+	if data == nil {
+		return errors.New("data is nil")
+	}
+
+	return WriteFileAtomic(d.path(tag.name), data, tag.perm)
+}
+
+// WriteFileAtomic atomically replaces the file at path with data and mode perm, like Replace
+// does for the files of a depot. It is for files kept outside of a depot.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := writeTemp(path, data)
+	if err != nil {
+		return err
+	}
+	return commitReplace(tmp, path, perm)
+}
+
+// ReplaceKeepMode is like Replace, but a file that already exists keeps its permissions,
+// which may have been tightened since it was created
+func (d *FileDepot) ReplaceKeepMode(tag *Tag, data []byte) error {
+	if fi, err := os.Stat(d.path(tag.name)); err == nil {
+		tag = &Tag{tag.name, fi.Mode().Perm()}
+	}
+	return d.Replace(tag, data)
+}
+
+// Append adds data to the end of the file specified by the tag, creating it if needed.
+// The data is synced to disk before Append returns.
+func (d *FileDepot) Append(tag *Tag, data []byte) error {
+	if data == nil {
+		return errors.New("data is nil")
+	}
+
 	if err := os.MkdirAll(d.dirPath, 0755); err != nil {
 		return err
 	}
 
 	name := d.path(tag.name)
-	perm := tag.perm
+	if err := d.check(tag); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 
-	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, tag.perm)
 	if err != nil {
 		return err
 	}
-
 	if _, err := file.Write(data); err != nil {
 		file.Close()
-		os.Remove(name)
 		return err
 	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
 
-	file.Close()
-	return nil
+// writeTemp writes data to a temporary file next to name and returns its path.
+// The temporary file is removed again if anything goes wrong.
+func writeTemp(name string, data []byte) (string, error) {
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(dir, "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	tmp := file.Name()
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// Lock takes an exclusive advisory lock on the depot directory, waiting until
+// any other holder releases it. The returned function releases the lock.
+// The lock is also released when the process exits.
+func (d *FileDepot) Lock() (func() error, error) {
+	if err := os.MkdirAll(d.dirPath, 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(d.path(lockFileName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not lock depot %v: %v", d.dirPath, err)
+	}
+
+	return func() error {
+		defer file.Close()
+		return unlockFile(file)
+	}, nil
 }
 
 // Check returns whether the file at the tag location exists and has permissions at least as restrictive as the given tag.
@@ -139,7 +248,8 @@ func (d *FileDepot) Delete(tag *Tag) error {
 	return os.Remove(d.path(tag.name))
 }
 
-// List returns all tags in the specified depot
+// List returns all tags in the specified depot.
+// Hidden files, such as the lock file and in-flight temporary files, are skipped.
 func (d *FileDepot) List() []*Tag {
 	var tags = make([]*Tag, 0)
 
@@ -158,6 +268,9 @@ func (d *FileDepot) List() []*Tag {
 		if rel != info.Name() {
 			return nil
 		}
+		if strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
 		tags = append(tags, &Tag{info.Name(), info.Mode()})
 		return nil
 	})
@@ -171,6 +284,14 @@ type File struct {
 	Data []byte
 }
 
+// Stat returns the FileInfo of the file at the specified tag, checking its permissions like Get
+func (d *FileDepot) Stat(tag *Tag) (os.FileInfo, error) {
+	if err := d.check(tag); err != nil {
+		return nil, err
+	}
+	return os.Stat(d.path(tag.name))
+}
+
 // GetFile returns the File at the specified tag in the given depot
 func (d *FileDepot) GetFile(tag *Tag) (*File, error) {
 	if err := d.check(tag); err != nil {
@@ -21,7 +21,9 @@ import (
 	"bytes"
 	"io/fs"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 const (
@@ -69,6 +71,134 @@ func TestDepotCRUD(t *testing.T) {
 	}
 }
 
+func TestDepotReplace(t *testing.T) {
+	d := getDepot(t)
+	defer os.RemoveAll(dir)
+
+	// Replace creates the file if it doesn't exist yet
+	if err := d.Replace(tag, []byte(data)); err != nil {
+		t.Fatal("Failed replacing file in Depot:", err)
+	}
+	if err := d.Replace(tag, []byte("new "+data)); err != nil {
+		t.Fatal("Failed replacing file in Depot:", err)
+	}
+
+	file, err := d.GetFile(tag)
+	if err != nil {
+		t.Fatal("Failed getting file from Depot:", err)
+	}
+	if !bytes.Equal(file.Data, []byte("new "+data)) {
+		t.Fatal("Failed getting the replaced data")
+	}
+	if file.Info.Mode() != tag.perm {
+		t.Fatal("Failed setting permission")
+	}
+
+	if err := d.Replace(tag, nil); err == nil {
+		t.Fatal("Expect not to replace with nil data")
+	}
+}
+
+func TestDepotReplaceKeepMode(t *testing.T) {
+	d := getDepot(t)
+	defer os.RemoveAll(dir)
+
+	if err := d.ReplaceKeepMode(tag, []byte(data)); err != nil {
+		t.Fatal("Failed replacing file in Depot:", err)
+	}
+	if fi, err := d.Stat(tag); err != nil || fi.Mode() != tag.perm {
+		t.Fatal("Failed setting permission of a new file:", err)
+	}
+
+	if err := os.Chmod(d.path(tag.name), tag.perm&0444); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ReplaceKeepMode(tag, []byte("new "+data)); err != nil {
+		t.Fatal("Failed replacing file in Depot:", err)
+	}
+	file, err := d.GetFile(tag)
+	if err != nil {
+		t.Fatal("Failed getting file from Depot:", err)
+	}
+	if !bytes.Equal(file.Data, []byte("new "+data)) || file.Info.Mode() != tag.perm&0444 {
+		t.Fatalf("Replaced file has mode %v", file.Info.Mode())
+	}
+}
+
+func TestDepotNoTempFiles(t *testing.T) {
+	d := getDepot(t)
+	defer os.RemoveAll(dir)
+
+	if err := d.Put(tag, []byte(data)); err != nil {
+		t.Fatal("Failed putting file into Depot:", err)
+	}
+	if err := d.Put(tag, []byte(data)); err == nil {
+		t.Fatal("Expect not to put file into Depot twice")
+	}
+	if err := d.Replace(tag2, []byte(data)); err != nil {
+		t.Fatal("Failed replacing file in Depot:", err)
+	}
+
+	entries, err := os.ReadDir(d.dirPath)
+	if err != nil {
+		t.Fatal("Failed reading depot directory:", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expect only 2 files in depot, found %d", len(entries))
+	}
+}
+
+func TestDepotLock(t *testing.T) {
+	d := getDepot(t)
+	defer os.RemoveAll(dir)
+
+	unlock, err := d.Lock()
+	if err != nil {
+		t.Fatal("Failed locking depot:", err)
+	}
+
+	// The lock file must not show up as a depot entry
+	if tags := d.List(); len(tags) != 0 {
+		t.Fatal("Expect lock file to be excluded from list, got", len(tags))
+	}
+	if _, err := os.Stat(filepath.Join(d.dirPath, lockFileName)); err != nil {
+		t.Fatal("Expect lock file to exist:", err)
+	}
+
+	// A second depot on the same directory has to wait for the first lock.
+	d2, err := NewFileDepot(dir)
+	if err != nil {
+		t.Fatal("Failed init Depot:", err)
+	}
+	locked := make(chan func() error)
+	go func() {
+		unlock2, err := d2.Lock()
+		if err != nil {
+			t.Error("Failed locking depot:", err)
+		}
+		locked <- unlock2
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("Expect second lock to block while the first is held")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatal("Failed unlocking depot:", err)
+	}
+
+	select {
+	case unlock2 := <-locked:
+		if err := unlock2(); err != nil {
+			t.Fatal("Failed unlocking depot:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expect second lock to be acquired after the first is released")
+	}
+}
+
 func TestDepotPutNil(t *testing.T) {
 	d := getDepot(t)
 	defer os.RemoveAll(dir)
@@ -171,6 +301,25 @@ func TestDepotGetFile(t *testing.T) {
 	}
 }
 
+func TestDepotStat(t *testing.T) {
+	d := getDepot(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := d.Stat(tag); !os.IsNotExist(err) {
+		t.Fatal("Expect not exist error for a missing file:", err)
+	}
+	if err := d.Put(tag, []byte(data)); err != nil {
+		t.Fatal("Failed putting file into Depot:", err)
+	}
+	fi, err := d.Stat(tag)
+	if err != nil {
+		t.Fatal("Failed getting file info from Depot:", err)
+	}
+	if fi.Size() != int64(len(data)) {
+		t.Fatalf("Stat returned size %d, want %d", fi.Size(), len(data))
+	}
+}
+
 func TestCheckPermissions(t *testing.T) {
 	tests := []struct {
 		required fs.FileMode
@@ -0,0 +1,57 @@
+//go:build !windows
+// +build !windows
+
+package depot
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// commitNew moves the temporary file tmp to name with the given permissions.
+// It fails if name already exists. The temporary file is always removed.
+func commitNew(tmp, name string, perm os.FileMode) error {
+	defer os.Remove(tmp)
+
+	if err := os.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	// A hard link never replaces an existing file, which gives us the
+	// same semantics as O_EXCL while still publishing a complete file.
+	if err := os.Link(tmp, name); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
+
+// commitReplace moves the temporary file tmp over name with the given permissions.
+func commitReplace(tmp, name string, perm os.FileMode) error {
+	if err := os.Chmod(tmp, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
+
+// syncDir flushes directory entries so that a rename survives a crash.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
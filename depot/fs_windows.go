@@ -0,0 +1,46 @@
+package depot
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// commitNew moves the temporary file tmp to name with the given permissions.
+// It fails if name already exists. The temporary file is always removed.
+func commitNew(tmp, name string, perm os.FileMode) error {
+	// Windows refuses to remove a read-only link, so the permissions are
+	// applied once the temporary name is gone.
+	err := os.Link(tmp, name)
+	if rmErr := os.Remove(tmp); err == nil {
+		err = rmErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Chmod(name, perm)
+}
+
+// commitReplace moves the temporary file tmp over name with the given permissions.
+func commitReplace(tmp, name string, perm os.FileMode) error {
+	// A read-only target cannot be replaced on Windows.
+	if _, err := os.Stat(name); err == nil {
+		if err := os.Chmod(name, 0666); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Chmod(name, perm)
+}
+
+func lockFile(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, new(windows.Overlapped))
+}
+
+func unlockFile(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, new(windows.Overlapped))
+}
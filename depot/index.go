@@ -0,0 +1,133 @@
+package depot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/square/certstrap/pkix"
+)
+
+const (
+	// StatusIssued marks an index entry for a newly issued certificate
+	StatusIssued = "issued"
+	// StatusRevoked marks an index entry for a revoked certificate
+	StatusRevoked = "revoked"
+	// StatusSuperseded marks an index entry for a certificate revoked after renewal
+	StatusSuperseded = "superseded"
+)
+
+// IndexEntry is a single record in the issued-certificate index of a CA.
+// The index is append-only: a change of status is recorded as a new entry
+// for the same serial number.
+type IndexEntry struct {
+	// Serial is the hex-encoded serial number of the certificate
+	Serial string `json:"serial"`
+	// Name is the depot name the certificate was issued under
+	Name        string    `json:"name"`
+	Subject     string    `json:"subject"`
+	DNSNames    []string  `json:"dns_names,omitempty"`
+	IPAddresses []string  `json:"ip_addresses,omitempty"`
+	URIs        []string  `json:"uris,omitempty"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	Status      string    `json:"status"`
+	Operator    string    `json:"operator,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// NewIndexEntry creates an index entry with the given status for a certificate
+func NewIndexEntry(name string, crt *pkix.Certificate, status, operator string) (*IndexEntry, error) {
+	rawCrt, err := crt.GetRawCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &IndexEntry{
+		Serial:    fmt.Sprintf("%X", rawCrt.SerialNumber),
+		Name:      name,
+		Subject:   rawCrt.Subject.String(),
+		DNSNames:  rawCrt.DNSNames,
+		NotBefore: rawCrt.NotBefore.UTC(),
+		NotAfter:  rawCrt.NotAfter.UTC(),
+		Status:    status,
+		Operator:  operator,
+		Timestamp: pkix.Now().UTC(),
+	}
+	for _, ip := range rawCrt.IPAddresses {
+		e.IPAddresses = append(e.IPAddresses, ip.String())
+	}
+	for _, uri := range rawCrt.URIs {
+		e.URIs = append(e.URIs, uri.String())
+	}
+	return e, nil
+}
+
+// AppendIndexEntry records an entry in the index of the given CA
+func AppendIndexEntry(d Depot, ca string, e *IndexEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return d.Append(IndexTag(ca), append(b, '\n'))
+}
+
+// GetIndex returns all entries in the index of the given CA in the order they were recorded.
+// A CA which has not issued anything yet has an empty index.
+func GetIndex(d Depot, ca string) ([]*IndexEntry, error) {
+	b, err := d.Get(IndexTag(ca))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*IndexEntry
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		e := new(IndexEntry)
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("malformed index entry on line %d: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// LatestIndexEntries collapses an index to the most recent entry for every serial number,
+// keeping the order in which the certificates were first recorded.
+func LatestIndexEntries(entries []*IndexEntry) []*IndexEntry {
+	var serials []string
+	latest := make(map[string]*IndexEntry)
+	for _, e := range entries {
+		if _, ok := latest[e.Serial]; !ok {
+			serials = append(serials, e.Serial)
+		}
+		latest[e.Serial] = e
+	}
+
+	result := make([]*IndexEntry, 0, len(serials))
+	for _, serial := range serials {
+		result = append(result, latest[serial])
+	}
+	return result
+}
+
+// FindIssuedIndexEntry returns the most recently issued certificate with the given depot name
+// which has not been revoked since, or nil if there is none.
+func FindIssuedIndexEntry(entries []*IndexEntry, name string) *IndexEntry {
+	latest := LatestIndexEntries(entries)
+	for i := len(latest) - 1; i >= 0; i-- {
+		if latest[i].Name == name && latest[i].Status == StatusIssued {
+			return latest[i]
+		}
+	}
+	return nil
+}
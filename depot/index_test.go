@@ -0,0 +1,92 @@
+package depot
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/square/certstrap/pkix"
+)
+
+func TestDepotAppend(t *testing.T) {
+	d := getDepot(t)
+	defer os.RemoveAll(dir)
+
+	if err := d.Append(tag, []byte("first\n")); err != nil {
+		t.Fatal("Failed appending to file in Depot:", err)
+	}
+	if err := d.Append(tag, []byte("second\n")); err != nil {
+		t.Fatal("Failed appending to file in Depot:", err)
+	}
+
+	b, err := d.Get(tag)
+	if err != nil {
+		t.Fatal("Failed getting file from Depot:", err)
+	}
+	if string(b) != "first\nsecond\n" {
+		t.Fatalf("Unexpected file contents: %q", b)
+	}
+
+	if err := d.Append(tag, nil); err == nil {
+		t.Fatal("Expect not to append nil data")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	d := getDepot(t)
+	defer os.RemoveAll(dir)
+
+	entries, err := GetIndex(d, "ca")
+	if err != nil {
+		t.Fatal("Failed reading missing index:", err)
+	}
+	if len(entries) != 0 {
+		t.Fatal("Expect missing index to be empty")
+	}
+
+	key, err := pkix.CreateRSAKey(1024)
+	if err != nil {
+		t.Fatal("Failed creating key:", err)
+	}
+	crt, err := pkix.CreateCertificateAuthority(key, "", time.Now().Add(time.Hour), "", "", "", "", "host", nil)
+	if err != nil {
+		t.Fatal("Failed creating certificate:", err)
+	}
+
+	issued, err := NewIndexEntry("host", crt, StatusIssued, "alice")
+	if err != nil {
+		t.Fatal("Failed creating index entry:", err)
+	}
+	if issued.Serial != "1" || issued.Subject != "CN=host" || issued.Operator != "alice" {
+		t.Fatalf("Unexpected index entry: %+v", issued)
+	}
+	if err := AppendIndexEntry(d, "ca", issued); err != nil {
+		t.Fatal("Failed appending index entry:", err)
+	}
+
+	if e := FindIssuedIndexEntry([]*IndexEntry{issued}, "host"); e == nil || e.Serial != "1" {
+		t.Fatal("Expect to find issued entry for host")
+	}
+
+	revoked := *issued
+	revoked.Status = StatusRevoked
+	if err := AppendIndexEntry(d, "ca", &revoked); err != nil {
+		t.Fatal("Failed appending index entry:", err)
+	}
+
+	entries, err = GetIndex(d, "ca")
+	if err != nil {
+		t.Fatal("Failed reading index:", err)
+	}
+	if len(entries) != 2 || entries[0].Status != StatusIssued || entries[1].Status != StatusRevoked {
+		t.Fatalf("Unexpected index entries: %+v", entries)
+	}
+
+	latest := LatestIndexEntries(entries)
+	if len(latest) != 1 || latest[0].Status != StatusRevoked {
+		t.Fatalf("Unexpected latest index entries: %+v", latest)
+	}
+	if e := FindIssuedIndexEntry(entries, "host"); e != nil {
+		t.Fatal("Expect revoked certificate not to be found as issued")
+	}
+}
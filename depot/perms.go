@@ -6,4 +6,6 @@ package depot
 const (
 	BranchPerm = 0440
 	LeafPerm   = 0444
+	// IndexPerm is used for append-only files, which must stay writable by the owner
+	IndexPerm = 0644
 )
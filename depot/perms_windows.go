@@ -7,4 +7,5 @@ const (
 	// resulting permission denied errors for Windows users.
 	BranchPerm = 0444
 	LeafPerm   = 0444
+	IndexPerm  = 0666
 )
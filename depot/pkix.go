@@ -18,6 +18,8 @@
 package depot
 
 import (
+	"fmt"
+	"path"
 	"strings"
 
 	"github.com/square/certstrap/pkix"
@@ -28,6 +30,12 @@ const (
 	csrSuffix     = ".csr"
 	privKeySuffix = ".key"
 	crlSuffix     = ".crl"
+	indexSuffix   = ".index"
+	bundleSuffix  = ".bundle.pem"
+	chainSuffix   = ".chain.pem"
+
+	// archiveDir is the depot subdirectory holding replaced certificates
+	archiveDir = "archive"
 )
 
 // CrtTag returns a tag corresponding to a certificate
@@ -50,6 +58,38 @@ func CrlTag(prefix string) *Tag {
 	return &Tag{prefix + crlSuffix, LeafPerm}
 }
 
+// IndexTag returns a tag corresponding to the issued-certificate index of a CA
+func IndexTag(prefix string) *Tag {
+	return &Tag{prefix + indexSuffix, IndexPerm}
+}
+
+// BundleTag returns a tag corresponding to a bundle of trusted certificates
+func BundleTag(prefix string) *Tag {
+	return &Tag{prefix + bundleSuffix, LeafPerm}
+}
+
+// FormattedCrtTag returns a tag corresponding to a certificate in a format other than PEM,
+// named with the file extension of that format, such as ".cer"
+func FormattedCrtTag(prefix, ext string) *Tag {
+	return &Tag{prefix + ext, LeafPerm}
+}
+
+// FormattedCsrTag returns a tag corresponding to a certificate request in a format other than
+// PEM, named with the file extension of that format after ".csr", such as ".csr.der"
+func FormattedCsrTag(prefix, ext string) *Tag {
+	return &Tag{prefix + csrSuffix + ext, LeafPerm}
+}
+
+// ChainTag returns a tag corresponding to a certificate followed by the chain of its issuers
+func ChainTag(prefix string) *Tag {
+	return &Tag{prefix + chainSuffix, LeafPerm}
+}
+
+// ArchivedCrtTag returns a tag corresponding to an archived certificate with the given hex serial number
+func ArchivedCrtTag(prefix, serial string) *Tag {
+	return &Tag{path.Join(archiveDir, prefix+"."+serial+crtSuffix), LeafPerm}
+}
+
 // GetNameFromCrtTag returns the host name from a certificate file tag
 func GetNameFromCrtTag(tag *Tag) string {
 	return getName(tag, crtSuffix)
@@ -79,6 +119,19 @@ func PutCertificate(d Depot, name string, crt *pkix.Certificate) error {
 	return d.Put(CrtTag(name), b)
 }
 
+// PutCertificateBundle creates a file holding several certificates for a given name in the depot
+func PutCertificateBundle(d Depot, name string, crts []*pkix.Certificate) error {
+	var b []byte
+	for _, crt := range crts {
+		crtBytes, err := crt.Export()
+		if err != nil {
+			return err
+		}
+		b = append(b, crtBytes...)
+	}
+	return d.Put(BundleTag(name), b)
+}
+
 // CheckCertificate checks the depot for existence of a certificate file for a given CA name
 func CheckCertificate(d Depot, name string) bool {
 	return d.Check(CrtTag(name))
@@ -93,6 +146,44 @@ func GetCertificate(d Depot, name string) (crt *pkix.Certificate, err error) {
 	return pkix.NewCertificateFromPEM(b)
 }
 
+// ReplaceCertificate atomically replaces the certificate file for a given name in the depot
+func ReplaceCertificate(d Depot, name string, crt *pkix.Certificate) error {
+	b, err := crt.Export()
+	if err != nil {
+		return err
+	}
+	return d.Replace(CrtTag(name), b)
+}
+
+// ReplaceCertificateChain atomically replaces the chain file for a given name in the depot
+// with crts, the certificate followed by the chain of its issuers
+func ReplaceCertificateChain(d Depot, name string, crts []*pkix.Certificate) error {
+	var b []byte
+	for _, crt := range crts {
+		crtBytes, err := crt.Export()
+		if err != nil {
+			return err
+		}
+		b = append(b, crtBytes...)
+	}
+	return d.Replace(ChainTag(name), b)
+}
+
+// ArchiveCertificate stores a copy of a certificate under the archive directory of the depot,
+// named after the certificate and its serial number. It returns the path of the copy within the depot.
+func ArchiveCertificate(d Depot, name string, crt *pkix.Certificate) (string, error) {
+	rawCrt, err := crt.GetRawCertificate()
+	if err != nil {
+		return "", err
+	}
+	b, err := crt.Export()
+	if err != nil {
+		return "", err
+	}
+	tag := ArchivedCrtTag(name, fmt.Sprintf("%X", rawCrt.SerialNumber))
+	return tag.name, d.Put(tag, b)
+}
+
 // DeleteCertificate removes a certificate file for a given name from the depot
 func DeleteCertificate(d Depot, name string) error {
 	return d.Delete(CrtTag(name))
@@ -121,6 +212,15 @@ func GetCertificateSigningRequest(d Depot, name string) (crt *pkix.CertificateSi
 	return pkix.NewCertificateSigningRequestFromPEM(b)
 }
 
+// ReplaceCertificateSigningRequest atomically replaces the certificate signing request file for a given name in the depot
+func ReplaceCertificateSigningRequest(d Depot, name string, csr *pkix.CertificateSigningRequest) error {
+	b, err := csr.Export()
+	if err != nil {
+		return err
+	}
+	return d.Replace(CsrTag(name), b)
+}
+
 // DeleteCertificateSigningRequest removes a certificate signing request file for a given host name from the depot
 func DeleteCertificateSigningRequest(d Depot, name string) error {
 	return d.Delete(CsrTag(name))
@@ -158,6 +258,24 @@ func PutEncryptedPrivateKey(d Depot, name string, key *pkix.Key, passphrase []by
 	return d.Put(PrivKeyTag(name), b)
 }
 
+// ReplacePrivateKey atomically replaces the private key file for a given name in the depot
+func ReplacePrivateKey(d Depot, name string, key *pkix.Key) error {
+	b, err := key.ExportPrivate()
+	if err != nil {
+		return err
+	}
+	return d.Replace(PrivKeyTag(name), b)
+}
+
+// ReplaceEncryptedPrivateKey atomically replaces the private key file for a given name in the depot with an encrypted key
+func ReplaceEncryptedPrivateKey(d Depot, name string, key *pkix.Key, passphrase []byte) error {
+	b, err := key.ExportEncryptedPrivate(passphrase)
+	if err != nil {
+		return err
+	}
+	return d.Replace(PrivKeyTag(name), b)
+}
+
 // GetEncryptedPrivateKey retrieves an encrypted private key file for a given name from the depot
 func GetEncryptedPrivateKey(d Depot, name string, passphrase []byte) (key *pkix.Key, err error) {
 	b, err := d.Get(PrivKeyTag(name))
@@ -176,6 +294,15 @@ func PutCertificateRevocationList(d Depot, name string, crl *pkix.CertificateRev
 	return d.Put(CrlTag(name), b)
 }
 
+// ReplaceCertificateRevocationList atomically replaces the CRL file for a given name and ca in the depot
+func ReplaceCertificateRevocationList(d Depot, name string, crl *pkix.CertificateRevocationList) error {
+	b, err := crl.Export()
+	if err != nil {
+		return err
+	}
+	return d.Replace(CrlTag(name), b)
+}
+
 //GetCertificateRevocationList gets a CRL file for a given name and ca in the depot.
 func GetCertificateRevocationList(d Depot, name string) (*pkix.CertificateRevocationList, error) {
 	b, err := d.Get(CrlTag(name))
@@ -0,0 +1,55 @@
+package depot
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const splitSuffix = ".split"
+
+// Split records that the passphrase of a private key is split into Shamir shares, any
+// Threshold of which recombine it. The shares themselves are never kept in the depot.
+type Split struct {
+	Threshold int `json:"threshold"`
+	Shares    int `json:"shares"`
+}
+
+// SplitTag returns a tag corresponding to the split passphrase record of a private key
+func SplitTag(prefix string) *Tag {
+	return &Tag{prefix + splitSuffix, LeafPerm}
+}
+
+// PutSplit records that the passphrase of the private key name is split as s
+func PutSplit(d Depot, name string, s *Split) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return d.Put(SplitTag(name), append(b, '\n'))
+}
+
+// CheckSplit reports whether the passphrase of the private key name is split
+func CheckSplit(d Depot, name string) bool {
+	return d.Check(SplitTag(name))
+}
+
+// GetSplit returns how the passphrase of the private key name is split
+func GetSplit(d Depot, name string) (*Split, error) {
+	b, err := d.Get(SplitTag(name))
+	if err != nil {
+		return nil, err
+	}
+	s := new(Split)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("malformed split record: %v", err)
+	}
+	if s.Threshold < 2 || s.Shares < s.Threshold {
+		return nil, fmt.Errorf("malformed split record: threshold %d of %d shares", s.Threshold, s.Shares)
+	}
+	return s, nil
+}
+
+// DeleteSplit removes the split passphrase record of the private key name
+func DeleteSplit(d Depot, name string) error {
+	return d.Delete(SplitTag(name))
+}
@@ -0,0 +1,38 @@
+package depot
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	d := getDepot(t)
+	defer os.RemoveAll(dir)
+
+	if CheckSplit(d, "ca") {
+		t.Fatal("Expect no split record")
+	}
+	if err := PutSplit(d, "ca", &Split{Threshold: 2, Shares: 3}); err != nil {
+		t.Fatal("Failed saving split record:", err)
+	}
+	if !CheckSplit(d, "ca") {
+		t.Fatal("Expect a split record")
+	}
+	s, err := GetSplit(d, "ca")
+	if err != nil {
+		t.Fatal("Failed getting split record:", err)
+	}
+	if s.Threshold != 2 || s.Shares != 3 {
+		t.Fatalf("Unexpected split record: %+v", s)
+	}
+	if err := DeleteSplit(d, "ca"); err != nil || CheckSplit(d, "ca") {
+		t.Fatal("Failed deleting split record:", err)
+	}
+
+	if err := d.Put(SplitTag("bad"), []byte(`{"threshold":3,"shares":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetSplit(d, "bad"); err == nil {
+		t.Fatal("Expect an error for a malformed split record")
+	}
+}
@@ -0,0 +1,16 @@
+package depot
+
+const (
+	sshPublicKeySuffix = ".pub"
+	krlSuffix          = ".krl"
+)
+
+// SSHPublicKeyTag returns a tag corresponding to the OpenSSH public key of an SSH CA
+func SSHPublicKeyTag(prefix string) *Tag {
+	return &Tag{prefix + sshPublicKeySuffix, LeafPerm}
+}
+
+// KRLTag returns a tag corresponding to the OpenSSH key revocation list of an SSH CA
+func KRLTag(prefix string) *Tag {
+	return &Tag{prefix + krlSuffix, LeafPerm}
+}
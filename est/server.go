@@ -0,0 +1,275 @@
+// Package est implements the simple enrollment operations of an EST (RFC 7030) server,
+// issuing certificates through a caller-provided Issuer.
+//
+// The server handles /.well-known/est/cacerts, /simpleenroll and /simplereenroll.
+// Clients authenticate with HTTP basic authentication or a TLS client certificate;
+// verifying client certificates is left to the tls.Config of the HTTP server. Clients enroll
+// for names within their Domains, and with a client certificate not issued through the CA of
+// the server, since clients can enroll for any name they are allowed from it.
+package est
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/square/certstrap/pkix"
+)
+
+// Issuer signs certificate requests of authenticated clients
+type Issuer interface {
+	// Issue returns the certificate for csr followed by the chain of intermediates to serve with it
+	Issue(csr *pkix.CertificateSigningRequest) ([]*pkix.Certificate, error)
+}
+
+const (
+	// PathPrefix is the path under which the EST operations are served
+	PathPrefix = "/.well-known/est/"
+
+	pkcs7CertsOnlyResponse = "application/pkcs7-mime; smime-type=certs-only"
+	pkcs10ContentType      = "application/pkcs10"
+
+	maxRequestSize = 64 << 10
+)
+
+// Server is an EST server. It implements http.Handler.
+type Server struct {
+	issuer  Issuer
+	caCerts []byte
+	// ca is the issuing CA certificate
+	ca *x509.Certificate
+
+	// Users maps the names of clients allowed to authenticate with HTTP basic authentication
+	// to their passwords. Basic authentication is refused if it is empty.
+	Users map[string]string
+	// Domains maps user names and the common names of client certificates to the domains the
+	// common and DNS names they enroll for must be within. Users and client certificates without
+	// domains cannot enroll, but may still re-enroll with a client certificate.
+	Domains map[string][]string
+	// Realm is the realm announced to clients that did not authenticate
+	Realm string
+}
+
+// NewServer creates an EST server issuing certificates with issuer. caCerts is the chain
+// of the issuing CA returned by /cacerts, ordered from the CA up to the root.
+func NewServer(issuer Issuer, caCerts []*pkix.Certificate) (*Server, error) {
+	if len(caCerts) == 0 {
+		return nil, errors.New("no CA certificate")
+	}
+	ca, err := caCerts[0].GetRawCertificate()
+	if err != nil {
+		return nil, err
+	}
+	certs, err := pkix.ExportCertificatesPKCS7(caCerts)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{issuer: issuer, caCerts: certs, ca: ca, Realm: "certstrap"}, nil
+}
+
+// ServeHTTP routes EST requests
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, PathPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	switch op := strings.TrimPrefix(r.URL.Path, PathPrefix); op {
+	case "cacerts":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "cacerts must be requested with GET", http.StatusMethodNotAllowed)
+			return
+		}
+		writeBase64(w, pkcs7CertsOnlyResponse, s.caCerts)
+	case "simpleenroll", "simplereenroll":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, op+" must be requested with POST", http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleEnroll(w, r, op == "simplereenroll")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleEnroll issues a certificate for the PKCS#10 request in the body. Enrollment requires
+// a client with domains, and the request names must be within them. Re-enrollment requires a
+// client certificate, and the request must keep its subject and subject alternative names.
+func (s *Server) handleEnroll(w http.ResponseWriter, r *http.Request, reenroll bool) {
+	var clientCrt *x509.Certificate
+	var domains []string
+	if reenroll {
+		clientCrt = clientCertificate(r)
+	} else if domains = s.clientDomains(r); domains == nil {
+		domains = s.userDomains(r)
+	}
+	if clientCrt == nil && domains == nil {
+		if !reenroll && len(s.Users) > 0 {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", s.Realm))
+		}
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != pkcs10ContentType {
+		http.Error(w, "requests must have content type "+pkcs10ContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, "cannot read request", http.StatusBadRequest)
+		return
+	}
+	csr, raw, err := parseCSR(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if reenroll {
+		err = checkReenroll(raw, clientCrt)
+	} else {
+		err = checkDomains(raw, domains)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	crts, err := s.issuer.Issue(csr)
+	if err != nil {
+		http.Error(w, "cannot issue certificate: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data, err := pkix.ExportCertificatesPKCS7(crts)
+	if err != nil {
+		http.Error(w, "cannot encode certificate", http.StatusInternalServerError)
+		return
+	}
+	writeBase64(w, pkcs7CertsOnlyResponse, data)
+}
+
+// userDomains returns the domains of the user whose credentials the request carries, or nil
+func (s *Server) userDomains(r *http.Request) []string {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return nil
+	}
+	want, ok := s.Users[user]
+	if !ok || subtle.ConstantTimeCompare([]byte(pass), []byte(want)) != 1 {
+		return nil
+	}
+	return s.Domains[user]
+}
+
+// clientDomains returns the domains of the verified TLS client certificate of the request, or
+// nil. Certificates whose chain passes through the CA of the server are ignored.
+func (s *Server) clientDomains(r *http.Request) []string {
+	if r.TLS == nil {
+		return nil
+	}
+	for _, chain := range r.TLS.VerifiedChains {
+		if s.throughCA(chain) {
+			continue
+		}
+		if domains, ok := s.Domains[chain[0].Subject.CommonName]; ok {
+			return domains
+		}
+	}
+	return nil
+}
+
+// throughCA reports whether chain passes through the CA of the server. A client could otherwise
+// enroll for the common name of another client and take its domains.
+func (s *Server) throughCA(chain []*x509.Certificate) bool {
+	for _, crt := range chain {
+		if bytes.Equal(crt.RawSubjectPublicKeyInfo, s.ca.RawSubjectPublicKeyInfo) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientCertificate returns the verified TLS client certificate of the request, if any
+func clientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// parseCSR decodes a base64-encoded PKCS#10 request and checks its signature
+func parseCSR(body []byte) (*pkix.CertificateSigningRequest, *x509.CertificateRequest, error) {
+	der, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(body), nil)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("request is not base64 encoded")
+	}
+	csr := pkix.NewCertificateSigningRequestFromDER(der)
+	raw, err := csr.GetRawCertificateSigningRequest()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse certificate request")
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, fmt.Errorf("invalid certificate request signature")
+	}
+	return csr, raw, nil
+}
+
+// checkReenroll checks that a re-enrollment request keeps the names of the current certificate
+func checkReenroll(csr *x509.CertificateRequest, crt *x509.Certificate) error {
+	if !bytes.Equal(csr.RawSubject, crt.RawSubject) {
+		return fmt.Errorf("request subject %q does not match the client certificate", csr.Subject)
+	}
+	if !reflect.DeepEqual(csr.DNSNames, crt.DNSNames) ||
+		!reflect.DeepEqual(csr.EmailAddresses, crt.EmailAddresses) ||
+		fmt.Sprint(csr.IPAddresses) != fmt.Sprint(crt.IPAddresses) ||
+		fmt.Sprint(csr.URIs) != fmt.Sprint(crt.URIs) {
+		return fmt.Errorf("request subject alternative names do not match the client certificate")
+	}
+	return nil
+}
+
+// checkDomains checks that the common and DNS names of an enrollment request are within domains,
+// and that it has no other subject alternative names
+func checkDomains(csr *x509.CertificateRequest, domains []string) error {
+	if len(csr.IPAddresses) > 0 || len(csr.URIs) > 0 || len(csr.EmailAddresses) > 0 {
+		return fmt.Errorf("only DNS names are allowed")
+	}
+	names := append([]string{}, csr.DNSNames...)
+	if csr.Subject.CommonName != "" {
+		names = append(names, csr.Subject.CommonName)
+	}
+	for _, name := range names {
+		if !pkix.WithinDomains(name, domains) {
+			return fmt.Errorf("name %q is not allowed", name)
+		}
+	}
+	return nil
+}
+
+// writeBase64 writes data base64-encoded in lines of 64 characters, as EST responses are
+func writeBase64(w http.ResponseWriter, contentType string, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var buf bytes.Buffer
+	for len(encoded) > 64 {
+		buf.WriteString(encoded[:64])
+		buf.WriteString("\r\n")
+		encoded = encoded[64:]
+	}
+	buf.WriteString(encoded)
+	buf.WriteString("\r\n")
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Transfer-Encoding", "base64")
+	w.WriteHeader(http.StatusOK)
+	//nolint:errcheck
+	w.Write(buf.Bytes())
+}
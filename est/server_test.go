@@ -0,0 +1,289 @@
+package est
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	certpkix "github.com/square/certstrap/pkix"
+)
+
+type testIssuer struct {
+	crt *certpkix.Certificate
+	key *certpkix.Key
+}
+
+func (i *testIssuer) Issue(csr *certpkix.CertificateSigningRequest) ([]*certpkix.Certificate, error) {
+	crt, err := certpkix.CreateCertificateHost(i.crt, i.key, csr, time.Now().Add(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	return []*certpkix.Certificate{crt}, nil
+}
+
+func newTestCA(t *testing.T, name string) *testIssuer {
+	key, err := certpkix.CreateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := certpkix.CreateCertificateAuthority(key, "", time.Now().Add(time.Hour), "", "", "", "", name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIssuer{crt: crt, key: key}
+}
+
+// newTestServer starts an EST server over TLS which accepts client certificates issued by its
+// CA and by clientCA
+func newTestServer(t *testing.T) (*httptest.Server, *testIssuer, *testIssuer) {
+	issuer := newTestCA(t, "EST Test CA")
+	clientCA := newTestCA(t, "EST Test Client CA")
+	server, err := NewServer(issuer, []*certpkix.Certificate{issuer.crt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Users = map[string]string{"device": "secret", "nodomains": "secret"}
+	server.Domains = map[string][]string{"device": {"example.com"}, "robot": {"robots.example.com"}}
+
+	pool := x509.NewCertPool()
+	for _, ca := range []*testIssuer{issuer, clientCA} {
+		raw, err := ca.crt.GetRawCertificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool.AddCert(raw)
+	}
+	srv := httptest.NewUnstartedServer(server)
+	srv.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: pool}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv, issuer, clientCA
+}
+
+// useClientCertificate makes client authenticate with crt from now on
+func useClientCertificate(client *http.Client, crt *x509.Certificate, key *ecdsa.PrivateKey) {
+	client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{{
+		Certificate: [][]byte{crt.Raw},
+		PrivateKey:  key,
+	}}
+	// the client certificate is only sent on a new connection
+	client.CloseIdleConnections()
+}
+
+func createCSR(t *testing.T, cn string) ([]byte, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: cn},
+		DNSNames: []string{cn},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(der)), key
+}
+
+func post(t *testing.T, client *http.Client, url string, body []byte, user, pass string) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/pkcs10")
+	req.Header.Set("Content-Transfer-Encoding", "base64")
+	if user != "" {
+		req.SetBasicAuth(user, pass)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// readCertificates decodes a base64 PKCS#7 certs-only response
+func readCertificates(t *testing.T, res *http.Response) []*x509.Certificate {
+	t.Helper()
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %s: %s", res.Status, body)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != pkcs7CertsOnlyResponse {
+		t.Fatalf("got content type %q, want %q", ct, pkcs7CertsOnlyResponse)
+	}
+	der, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(body), nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crts, err := certpkix.NewCertificatesFromPKCS7(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raws []*x509.Certificate
+	for _, crt := range crts {
+		raw, err := crt.GetRawCertificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		raws = append(raws, raw)
+	}
+	return raws
+}
+
+func TestCACerts(t *testing.T) {
+	srv, issuer, _ := newTestServer(t)
+	res, err := srv.Client().Get(srv.URL + PathPrefix + "cacerts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	crts := readCertificates(t, res)
+	want, _ := issuer.crt.GetRawCertificate()
+	if len(crts) != 1 || !crts[0].Equal(want) {
+		t.Fatalf("cacerts did not return the CA certificate")
+	}
+}
+
+func TestEnroll(t *testing.T) {
+	srv, issuer, _ := newTestServer(t)
+	client := srv.Client()
+	url := srv.URL + PathPrefix
+
+	csr, key := createCSR(t, "device1.example.com")
+	for _, tc := range []struct {
+		user, pass string
+	}{
+		{"", ""},
+		{"device", "wrong"},
+		{"other", "secret"},
+		{"nodomains", "secret"},
+	} {
+		res := post(t, client, url+"simpleenroll", csr, tc.user, tc.pass)
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("enrolling as %q with password %q: got status %s, want 401", tc.user, tc.pass, res.Status)
+		}
+		if res.Header.Get("WWW-Authenticate") == "" {
+			t.Fatal("401 response has no WWW-Authenticate header")
+		}
+	}
+
+	crts := readCertificates(t, post(t, client, url+"simpleenroll", csr, "device", "secret"))
+	ca, _ := issuer.crt.GetRawCertificate()
+	if err := crts[0].CheckSignatureFrom(ca); err != nil {
+		t.Fatalf("enrolled certificate is not signed by the CA: %v", err)
+	}
+	if crts[0].Subject.CommonName != "device1.example.com" {
+		t.Fatalf("enrolled certificate is for %q", crts[0].Subject.CommonName)
+	}
+
+	// Re-enrollment authenticates with the enrolled certificate
+	res := post(t, client, url+"simplereenroll", csr, "device", "secret")
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("re-enrolling without a client certificate: got status %s, want 401", res.Status)
+	}
+
+	useClientCertificate(client, crts[0], key)
+	newCSR, _ := createCSR(t, "device1.example.com")
+	renewed := readCertificates(t, post(t, client, url+"simplereenroll", newCSR, "", ""))
+	if renewed[0].SerialNumber.Cmp(crts[0].SerialNumber) == 0 {
+		t.Fatal("re-enrollment returned the same certificate")
+	}
+
+	otherCSR, _ := createCSR(t, "device2.example.com")
+	res = post(t, client, url+"simplereenroll", otherCSR, "", "")
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("re-enrolling for another subject: got status %s, want 403", res.Status)
+	}
+
+	// Certificates issued through the CA of the server do not authenticate enrollment
+	res = post(t, client, url+"simpleenroll", otherCSR, "", "")
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("enrolling with a certificate of the CA: got status %s, want 401", res.Status)
+	}
+
+	outsideCSR, _ := createCSR(t, "device1.example.org")
+	res = post(t, client, url+"simpleenroll", outsideCSR, "device", "secret")
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("enrolling outside the user domains: got status %s, want 403", res.Status)
+	}
+}
+
+func TestEnrollClientCertificate(t *testing.T) {
+	srv, _, clientCA := newTestServer(t)
+	client := srv.Client()
+	url := srv.URL + PathPrefix
+
+	csr, key := createCSR(t, "robot")
+	robot, err := clientCA.Issue(certpkix.NewCertificateSigningRequestFromDER(decodeBase64(t, csr)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := robot[0].GetRawCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	useClientCertificate(client, raw, key)
+
+	allowed, _ := createCSR(t, "r1.robots.example.com")
+	crts := readCertificates(t, post(t, client, url+"simpleenroll", allowed, "", ""))
+	if crts[0].Subject.CommonName != "r1.robots.example.com" {
+		t.Fatalf("enrolled certificate is for %q", crts[0].Subject.CommonName)
+	}
+
+	other, _ := createCSR(t, "device1.example.com")
+	res := post(t, client, url+"simpleenroll", other, "", "")
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("enrolling outside the client domains: got status %s, want 403", res.Status)
+	}
+}
+
+func decodeBase64(t *testing.T, data []byte) []byte {
+	der, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestEnrollBadRequest(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	url := srv.URL + PathPrefix + "simpleenroll"
+
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader([]byte("csr")))
+	req.Header.Set("Content-Type", "text/plain")
+	req.SetBasicAuth("device", "secret")
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("enrolling with the wrong content type: got status %s, want 415", res.Status)
+	}
+
+	res = post(t, srv.Client(), url, []byte("not a CSR"), "device", "secret")
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("enrolling with an invalid CSR: got status %s, want 400", res.Status)
+	}
+}
@@ -0,0 +1,269 @@
+// Package manifest reads declarations of the CAs, intermediates and leaf certificates of a
+// depot from a YAML file, for the apply command to create whatever is missing.
+//
+// A manifest lists certificates by name. Each has a kind, its issuer, subject, subject
+// alternative names, key type, lifetime and profile:
+//
+//	certificates:
+//	  - name: Root CA
+//	    kind: ca
+//	    key: P-384
+//	    lifetime: 10 years
+//	  - name: Issuing CA
+//	    kind: intermediate
+//	    issuer: Root CA
+//	  - name: web
+//	    issuer: Issuing CA
+//	    subject:
+//	      common-name: web.example.com
+//	    sans:
+//	      dns: [web.example.com]
+//	    lifetime: 90 days
+//
+// The issuer of a certificate is either declared in the same manifest or an existing CA
+// of the depot.
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"slices"
+
+	"github.com/square/certstrap/service"
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of certificates
+const (
+	// KindCA is a self-signed root CA
+	KindCA = "ca"
+	// KindIntermediate is an intermediate CA signed by its issuer
+	KindIntermediate = "intermediate"
+	// KindLeaf is an end-entity certificate signed by its issuer with a profile
+	KindLeaf = "leaf"
+)
+
+// Manifest declares the certificates of a depot
+type Manifest struct {
+	Certificates []*Certificate `yaml:"certificates"`
+}
+
+// Certificate declares a certificate and its private key
+type Certificate struct {
+	// Name identifies the certificate in the manifest and, with unsupported characters
+	// replaced, in the depot
+	Name string `yaml:"name"`
+	// Kind is KindCA, KindIntermediate or KindLeaf, KindLeaf if empty
+	Kind string `yaml:"kind"`
+	// Issuer is the name of the CA signing the certificate, empty for KindCA
+	Issuer  string  `yaml:"issuer"`
+	Subject Subject `yaml:"subject"`
+	SANs    SANs    `yaml:"sans"`
+	// Key is the key type: rsa:BITS, ec:CURVE or ed25519 as given to --key-type, or a
+	// curve name such as P-256 as given to --curve
+	Key string `yaml:"key"`
+	// Lifetime is how long until the certificate expires, such as "1 year 6 months"
+	Lifetime string `yaml:"lifetime"`
+	// Profile is the profile a leaf certificate is signed with, service.ProfileHost if empty
+	Profile string `yaml:"profile"`
+	// PathLength is the maximum number of intermediates that may follow a CA certificate,
+	// by default the number of levels of intermediates declared below it
+	PathLength *int `yaml:"path-length"`
+	// PermitDomains restricts a root CA to these domains and their subdomains
+	PermitDomains []string `yaml:"permit-domains"`
+}
+
+// Subject is the distinguished name of a certificate. CommonName defaults to the name
+// of the certificate.
+type Subject struct {
+	CommonName         string `yaml:"common-name"`
+	Organization       string `yaml:"organization"`
+	OrganizationalUnit string `yaml:"organizational-unit"`
+	Country            string `yaml:"country"`
+	Province           string `yaml:"province"`
+	Locality           string `yaml:"locality"`
+}
+
+// SANs are the subject alternative names of a certificate
+type SANs struct {
+	DNS []string `yaml:"dns"`
+	IP  []string `yaml:"ip"`
+	URI []string `yaml:"uri"`
+}
+
+// IsCA reports whether the certificate is a CA that may issue other certificates
+func (c *Certificate) IsCA() bool {
+	return c.Kind == KindCA || c.Kind == KindIntermediate
+}
+
+// IPs returns the parsed IP addresses of the certificate
+func (s SANs) IPs() []net.IP {
+	var ips []net.IP
+	for _, ip := range s.IP {
+		ips = append(ips, net.ParseIP(ip))
+	}
+	return ips
+}
+
+// URIs returns the parsed URIs of the certificate
+func (s SANs) URIs() []*url.URL {
+	var uris []*url.URL
+	for _, uri := range s.URI {
+		u, _ := url.Parse(uri)
+		uris = append(uris, u)
+	}
+	return uris
+}
+
+// Parse reads and validates a manifest. Unknown fields are rejected, so that a misspelt
+// field is not silently ignored.
+func Parse(data []byte) (*Manifest, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	m := &Manifest{}
+	if err := dec.Decode(m); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Get returns the certificate declared with name, or nil
+func (m *Manifest) Get(name string) *Certificate {
+	for _, c := range m.Certificates {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (m *Manifest) validate() error {
+	if len(m.Certificates) == 0 {
+		return errors.New("manifest declares no certificates")
+	}
+	names := map[string]bool{}
+	for i, c := range m.Certificates {
+		if c == nil || c.Name == "" {
+			return fmt.Errorf("certificate %d has no name", i+1)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("certificate %q is declared twice", c.Name)
+		}
+		names[c.Name] = true
+		if c.Kind == "" {
+			c.Kind = KindLeaf
+		}
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("certificate %q: %v", c.Name, err)
+		}
+	}
+	for _, c := range m.Certificates {
+		if issuer := m.Get(c.Issuer); issuer != nil && !issuer.IsCA() {
+			return fmt.Errorf("certificate %q: issuer %q is not a CA", c.Name, c.Issuer)
+		}
+	}
+	_, err := m.Ordered()
+	return err
+}
+
+func (c *Certificate) validate() error {
+	switch c.Kind {
+	case KindCA:
+		if c.Issuer != "" {
+			return errors.New("a root CA has no issuer")
+		}
+	case KindIntermediate, KindLeaf:
+		if c.Issuer == "" {
+			return errors.New("issuer is missing")
+		}
+		if c.Issuer == c.Name {
+			return errors.New("certificate issues itself, use kind ca for a root CA")
+		}
+		if len(c.PermitDomains) > 0 {
+			return errors.New("permit-domains can only be set on a root CA")
+		}
+	default:
+		return fmt.Errorf("unknown kind %q, must be one of %s, %s, %s", c.Kind, KindCA, KindIntermediate, KindLeaf)
+	}
+	if c.Kind == KindLeaf {
+		if c.PathLength != nil {
+			return errors.New("path-length can only be set on a CA")
+		}
+		if c.Profile == service.ProfileIntermediate {
+			return fmt.Errorf("use kind %s for intermediate CAs", KindIntermediate)
+		}
+		if c.Profile != "" && !slices.Contains(service.Profiles(), c.Profile) {
+			return fmt.Errorf("unknown profile %q", c.Profile)
+		}
+	} else if c.Profile != "" {
+		return errors.New("profile can only be set on a leaf certificate")
+	}
+	if c.PathLength != nil && *c.PathLength < 0 {
+		return errors.New("path-length is negative")
+	}
+	for _, ip := range c.SANs.IP {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid IP address %q", ip)
+		}
+	}
+	for _, uri := range c.SANs.URI {
+		if _, err := url.Parse(uri); err != nil {
+			return fmt.Errorf("invalid URI %q: %v", uri, err)
+		}
+	}
+	return nil
+}
+
+// PathLength returns the path length constraint of the CA certificate c: PathLength if
+// set, or otherwise the longest chain of intermediates the manifest declares below c
+func (m *Manifest) PathLength(c *Certificate) int {
+	if c.PathLength != nil {
+		return *c.PathLength
+	}
+	length := 0
+	for _, sub := range m.Certificates {
+		if sub.Issuer == c.Name && sub.Kind == KindIntermediate {
+			if l := m.PathLength(sub) + 1; l > length {
+				length = l
+			}
+		}
+	}
+	return length
+}
+
+// Ordered returns the certificates of the manifest with every issuer declared in the manifest
+// ahead of the certificates it issues, and otherwise in the order they are declared
+func (m *Manifest) Ordered() ([]*Certificate, error) {
+	var ordered []*Certificate
+	done := map[string]bool{}
+	var visit func(c *Certificate, path []string) error
+	visit = func(c *Certificate, path []string) error {
+		if done[c.Name] {
+			return nil
+		}
+		if slices.Contains(path, c.Name) {
+			return fmt.Errorf("certificates issue each other: %v", append(path, c.Name))
+		}
+		if issuer := m.Get(c.Issuer); issuer != nil {
+			if err := visit(issuer, append(path, c.Name)); err != nil {
+				return err
+			}
+		}
+		done[c.Name] = true
+		ordered = append(ordered, c)
+		return nil
+	}
+	for _, c := range m.Certificates {
+		if err := visit(c, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
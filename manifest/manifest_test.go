@@ -0,0 +1,85 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+)
+
+const testManifest = `
+certificates:
+  - name: web
+    issuer: Issuing CA
+    subject:
+      common-name: web.example.com
+    sans:
+      dns: [web.example.com]
+      ip: [10.0.0.1]
+    lifetime: 90 days
+  - name: Issuing CA
+    kind: intermediate
+    issuer: Root CA
+    path-length: 0
+  - name: Root CA
+    kind: ca
+    key: P-384
+  - name: external
+    issuer: Existing CA
+    profile: svid
+    sans:
+      uri: [spiffe://example.org/web]
+`
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := m.Get("web")
+	if web == nil || web.Kind != KindLeaf || web.IsCA() || len(web.SANs.IPs()) != 1 || web.Subject.CommonName != "web.example.com" {
+		t.Fatalf("Unexpected certificate %+v", web)
+	}
+	if ca := m.Get("Issuing CA"); !ca.IsCA() || ca.PathLength == nil || *ca.PathLength != 0 {
+		t.Fatalf("Unexpected intermediate %+v", ca)
+	}
+
+	if l := m.PathLength(m.Get("Root CA")); l != 1 {
+		t.Fatalf("Root CA has path length %d", l)
+	}
+
+	ordered, err := m.Ordered()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range ordered {
+		names = append(names, c.Name)
+	}
+	if got := strings.Join(names, ","); got != "Root CA,Issuing CA,web,external" {
+		t.Fatalf("Certificates are ordered %s", got)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, manifest := range []string{
+		``,
+		`certificates: [{name: a, kind: ca, colour: blue}]`,
+		`certificates: [{kind: ca}]`,
+		`certificates: [{name: a, kind: ca}, {name: a, kind: ca}]`,
+		`certificates: [{name: a, kind: root}]`,
+		`certificates: [{name: a, kind: ca, issuer: b}]`,
+		`certificates: [{name: a}]`,
+		`certificates: [{name: a, issuer: a}]`,
+		`certificates: [{name: a, kind: ca}, {name: b, issuer: a}, {name: c, issuer: b}]`,
+		`certificates: [{name: a, kind: intermediate, issuer: b}, {name: b, kind: intermediate, issuer: a}]`,
+		`certificates: [{name: a, kind: ca, profile: host}]`,
+		`certificates: [{name: a, issuer: b, profile: intermediate}]`,
+		`certificates: [{name: a, issuer: b, profile: unknown}]`,
+		`certificates: [{name: a, issuer: b, path-length: 1}]`,
+		`certificates: [{name: a, kind: intermediate, issuer: b, permit-domains: [example.com]}]`,
+		`certificates: [{name: a, issuer: b, sans: {ip: [10.0.0]}}]`,
+	} {
+		if _, err := Parse([]byte(manifest)); err == nil {
+			t.Errorf("Expected an error parsing %s", manifest)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package pkcs7
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+
+	oidEncryptionDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidEncryptionAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidEncryptionAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidEncryptionAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// EncryptionAlgorithm is a content encryption algorithm of EnvelopedData structures
+type EncryptionAlgorithm int
+
+const (
+	// EncryptionAlgorithmAES128CBC is AES-128 in CBC mode
+	EncryptionAlgorithmAES128CBC EncryptionAlgorithm = iota
+	// EncryptionAlgorithmAES192CBC is AES-192 in CBC mode
+	EncryptionAlgorithmAES192CBC
+	// EncryptionAlgorithmAES256CBC is AES-256 in CBC mode
+	EncryptionAlgorithmAES256CBC
+	// EncryptionAlgorithmDESEDE3CBC is triple DES in CBC mode, only for peers that support nothing else
+	EncryptionAlgorithmDESEDE3CBC
+)
+
+var encryptionAlgorithms = []struct {
+	oid     asn1.ObjectIdentifier
+	keySize int
+	block   func(key []byte) (cipher.Block, error)
+}{
+	EncryptionAlgorithmAES128CBC:  {oidEncryptionAES128CBC, 16, aes.NewCipher},
+	EncryptionAlgorithmAES192CBC:  {oidEncryptionAES192CBC, 24, aes.NewCipher},
+	EncryptionAlgorithmAES256CBC:  {oidEncryptionAES256CBC, 32, aes.NewCipher},
+	EncryptionAlgorithmDESEDE3CBC: {oidEncryptionDESEDE3CBC, 24, des.NewTripleDESCipher},
+}
+
+type envelopedData struct {
+	Version              int
+	RecipientInfos       []recipientInfo `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type recipientInfo struct {
+	Version                int
+	IssuerAndSerialNumber  issuerAndSerial
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// EnvelopedData is a parsed EnvelopedData structure, whose content is encrypted
+// for recipients with RSA keys
+type EnvelopedData struct {
+	// Algorithm encrypts the content
+	Algorithm EncryptionAlgorithm
+
+	recipients []recipientInfo
+	iv         []byte
+	encrypted  []byte
+}
+
+// Encrypt creates a DER-encoded EnvelopedData structure holding content encrypted with algorithm.
+// The content key is encrypted with RSA PKCS #1 v1.5 for each recipient, which must have an RSA key.
+// The content key, the IV and the key encryption padding are read from rand.
+func Encrypt(rand io.Reader, content []byte, recipients []*x509.Certificate, algorithm EncryptionAlgorithm) ([]byte, error) {
+	if algorithm < 0 || int(algorithm) >= len(encryptionAlgorithms) {
+		return nil, errors.New("pkcs7: unknown encryption algorithm")
+	}
+	alg := encryptionAlgorithms[algorithm]
+	key := make([]byte, alg.keySize)
+	if _, err := io.ReadFull(rand, key); err != nil {
+		return nil, err
+	}
+	block, err := alg.block(key)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, block.BlockSize())
+	if _, err := io.ReadFull(rand, iv); err != nil {
+		return nil, err
+	}
+	// PKCS #5 padding always adds at least one byte
+	pad := block.BlockSize() - len(content)%block.BlockSize()
+	encrypted := append(append([]byte{}, content...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	var infos []recipientInfo
+	for _, crt := range recipients {
+		pub, ok := crt.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("pkcs7: unsupported recipient key type %T", crt.PublicKey)
+		}
+		encryptedKey, err := rsa.EncryptPKCS1v15(rand, pub, key)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, recipientInfo{
+			IssuerAndSerialNumber:  issuerAndSerial{Issuer: asn1.RawValue{FullBytes: crt.RawIssuer}, SerialNumber: crt.SerialNumber},
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidEncryptionRSA, Parameters: asn1.NullRawValue},
+			EncryptedKey:           encryptedKey,
+		})
+	}
+	params, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	return marshalContentInfo(oidEnvelopedData, envelopedData{
+		RecipientInfos: infos,
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: alg.oid, Parameters: asn1.RawValue{FullBytes: params}},
+			EncryptedContent:           asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: encrypted},
+		},
+	})
+}
+
+// ParseEnvelopedData parses a DER-encoded EnvelopedData structure
+func ParseEnvelopedData(data []byte) (*EnvelopedData, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(data, &ci); err != nil {
+		return nil, err
+	}
+	if !ci.ContentType.Equal(oidEnvelopedData) {
+		return nil, fmt.Errorf("pkcs7: unsupported content type %v", ci.ContentType)
+	}
+	var ed envelopedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		return nil, err
+	}
+
+	e := &EnvelopedData{Algorithm: -1, recipients: ed.RecipientInfos}
+	eci := ed.EncryptedContentInfo
+	for i, alg := range encryptionAlgorithms {
+		if alg.oid.Equal(eci.ContentEncryptionAlgorithm.Algorithm) {
+			e.Algorithm = EncryptionAlgorithm(i)
+		}
+	}
+	if e.Algorithm < 0 {
+		return nil, fmt.Errorf("pkcs7: unsupported content encryption algorithm %v", eci.ContentEncryptionAlgorithm.Algorithm)
+	}
+	if _, err := asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &e.iv); err != nil {
+		return nil, fmt.Errorf("pkcs7: cannot parse IV: %v", err)
+	}
+
+	e.encrypted = eci.EncryptedContent.Bytes
+	if eci.EncryptedContent.IsCompound {
+		// BER allows the content to be split into several OCTET STRINGs
+		chunks, err := splitSet(eci.EncryptedContent.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		e.encrypted = nil
+		for _, chunk := range chunks {
+			var b []byte
+			if _, err := asn1.Unmarshal(chunk, &b); err != nil {
+				return nil, err
+			}
+			e.encrypted = append(e.encrypted, b...)
+		}
+	}
+	return e, nil
+}
+
+// Decrypt decrypts the content with the RSA key of crt, which must be one of the recipients.
+// rand is passed to key.Decrypt.
+func (e *EnvelopedData) Decrypt(rand io.Reader, crt *x509.Certificate, key crypto.Decrypter) ([]byte, error) {
+	var encryptedKey []byte
+	for _, ri := range e.recipients {
+		if ri.IssuerAndSerialNumber.SerialNumber.Cmp(crt.SerialNumber) == 0 &&
+			bytes.Equal(ri.IssuerAndSerialNumber.Issuer.FullBytes, crt.RawIssuer) {
+			encryptedKey = ri.EncryptedKey
+		}
+	}
+	if encryptedKey == nil {
+		return nil, errors.New("pkcs7: certificate is not a recipient")
+	}
+
+	alg := encryptionAlgorithms[e.Algorithm]
+	if _, ok := key.Public().(*rsa.PublicKey); !ok {
+		return nil, fmt.Errorf("pkcs7: unsupported recipient key type %T", key.Public())
+	}
+	// With SessionKeyLen, invalid padding yields a random key instead of an error,
+	// which does not reveal whether the padding was valid
+	contentKey, err := key.Decrypt(rand, encryptedKey, &rsa.PKCS1v15DecryptOptions{SessionKeyLen: alg.keySize})
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := alg.block(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.iv) != block.BlockSize() || len(e.encrypted) == 0 || len(e.encrypted)%block.BlockSize() != 0 {
+		return nil, errors.New("pkcs7: malformed encrypted content")
+	}
+	plain := make([]byte, len(e.encrypted))
+	cipher.NewCBCDecrypter(block, e.iv).CryptBlocks(plain, e.encrypted)
+
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > block.BlockSize() || !bytes.Equal(plain[len(plain)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, errors.New("pkcs7: cannot decrypt content")
+	}
+	return plain[:len(plain)-pad], nil
+}
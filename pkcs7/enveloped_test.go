@@ -0,0 +1,66 @@
+package pkcs7
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt := newTestCertificate(t, key)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newTestCertificate(t, otherKey)
+	other.SerialNumber.SetInt64(43)
+
+	for _, alg := range []EncryptionAlgorithm{
+		EncryptionAlgorithmAES128CBC,
+		EncryptionAlgorithmAES192CBC,
+		EncryptionAlgorithmAES256CBC,
+		EncryptionAlgorithmDESEDE3CBC,
+	} {
+		for _, content := range [][]byte{[]byte("secret"), bytes.Repeat([]byte{1}, 32)} {
+			der, err := Encrypt(rand.Reader, content, []*x509.Certificate{crt}, alg)
+			if err != nil {
+				t.Fatal("Failed encrypting:", err)
+			}
+			ed, err := ParseEnvelopedData(der)
+			if err != nil {
+				t.Fatal("Failed parsing:", err)
+			}
+			if ed.Algorithm != alg {
+				t.Fatalf("Algorithm mismatch: got %d, want %d", ed.Algorithm, alg)
+			}
+			plain, err := ed.Decrypt(rand.Reader, crt, key)
+			if err != nil {
+				t.Fatal("Failed decrypting:", err)
+			}
+			if !bytes.Equal(plain, content) {
+				t.Fatalf("Content mismatch: got %x, want %x", plain, content)
+			}
+			if _, err := ed.Decrypt(rand.Reader, other, otherKey); err == nil {
+				t.Fatal("Expect error decrypting for a certificate that is not a recipient")
+			}
+		}
+	}
+}
+
+func TestEncryptUnsupportedRecipient(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Encrypt(rand.Reader, []byte("secret"), []*x509.Certificate{newTestCertificate(t, key)}, EncryptionAlgorithmAES128CBC); err == nil {
+		t.Fatal("Expect error encrypting for an ECDSA recipient")
+	}
+}
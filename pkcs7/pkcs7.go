@@ -0,0 +1,121 @@
+// Package pkcs7 implements the parts of PKCS #7 (RFC 2315) that certstrap
+// needs to exchange certificates and CRLs with other tools, and to sign and
+// encrypt SCEP messages.
+package pkcs7
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+var (
+	oidData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []asn1.RawValue `asn1:"set"`
+}
+
+// SignedData holds the certificates and CRLs carried by a PKCS #7 SignedData structure.
+type SignedData struct {
+	// Certificates are the DER-encoded certificates
+	Certificates [][]byte
+	// CRLs are the DER-encoded certificate revocation lists
+	CRLs [][]byte
+}
+
+// Degenerate creates a DER-encoded SignedData structure without signers that only
+// carries certificates and CRLs, as found in .p7b files.
+func Degenerate(certs, crls [][]byte) ([]byte, error) {
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{},
+		ContentInfo:      contentInfo{ContentType: oidData},
+		Certificates:     implicitSet(0, certs),
+		CRLs:             implicitSet(1, crls),
+		SignerInfos:      []asn1.RawValue{},
+	}
+	return marshalContentInfo(oidSignedData, sd)
+}
+
+// ParseSignedData parses a DER-encoded SignedData structure and returns the
+// certificates and CRLs it carries. Signatures are not verified.
+func ParseSignedData(data []byte) (*SignedData, error) {
+	var ci contentInfo
+	rest, err := asn1.Unmarshal(data, &ci)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("pkcs7: trailing data after content info")
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("pkcs7: unsupported content type %v", ci.ContentType)
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+	certs, err := splitSet(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	crls, err := splitSet(sd.CRLs.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedData{Certificates: certs, CRLs: crls}, nil
+}
+
+func marshalContentInfo(contentType asn1.ObjectIdentifier, content interface{}) ([]byte, error) {
+	b, err := asn1.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: contentType,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+}
+
+// implicitSet encodes DER values as an implicitly tagged SET OF, or returns the
+// zero value so that an empty set is omitted.
+func implicitSet(tag int, values [][]byte) asn1.RawValue {
+	if len(values) == 0 {
+		return asn1.RawValue{}
+	}
+	var b []byte
+	for _, v := range values {
+		b = append(b, v...)
+	}
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: b}
+}
+
+// splitSet splits the contents of a SET OF into its DER-encoded elements.
+func splitSet(data []byte) ([][]byte, error) {
+	var values [][]byte
+	for len(data) > 0 {
+		var v asn1.RawValue
+		var err error
+		data, err = asn1.Unmarshal(data, &v)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v.FullBytes)
+	}
+	return values, nil
+}
@@ -0,0 +1,61 @@
+package pkcs7
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDegenerate(t *testing.T) {
+	certs := [][]byte{
+		{0x30, 0x03, 0x02, 0x01, 0x01},
+		{0x30, 0x03, 0x02, 0x01, 0x02},
+	}
+	crls := [][]byte{{0x30, 0x03, 0x02, 0x01, 0x03}}
+
+	for _, tc := range []struct {
+		certs, crls [][]byte
+	}{
+		{certs, nil},
+		{nil, crls},
+		{certs, crls},
+		{nil, nil},
+	} {
+		der, err := Degenerate(tc.certs, tc.crls)
+		if err != nil {
+			t.Fatal("Failed encoding:", err)
+		}
+		sd, err := ParseSignedData(der)
+		if err != nil {
+			t.Fatal("Failed parsing:", err)
+		}
+		if !equal(sd.Certificates, tc.certs) || !equal(sd.CRLs, tc.crls) {
+			t.Fatalf("Round trip mismatch: got %x/%x, want %x/%x", sd.Certificates, sd.CRLs, tc.certs, tc.crls)
+		}
+	}
+}
+
+func TestParseSignedDataErrors(t *testing.T) {
+	if _, err := ParseSignedData([]byte{0x30, 0x00}); err == nil {
+		t.Fatal("Expect error parsing empty content info")
+	}
+
+	der, err := marshalContentInfo(oidData, []byte("data"))
+	if err != nil {
+		t.Fatal("Failed encoding:", err)
+	}
+	if _, err := ParseSignedData(der); err == nil {
+		t.Fatal("Expect error parsing non-SignedData content")
+	}
+}
+
+func equal(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,304 @@
+package pkcs7
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+
+	// register the digests signatures can be made with
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+var (
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidDigestSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidDigestSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidDigestSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidDigestSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidEncryptionRSA        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSignatureECDSASHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+var digestOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:   oidDigestSHA1,
+	crypto.SHA256: oidDigestSHA256,
+	crypto.SHA384: oidDigestSHA384,
+	crypto.SHA512: oidDigestSHA512,
+}
+
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// Attribute is an authenticated attribute signed along with the content of a SignedData structure
+type Attribute struct {
+	Type asn1.ObjectIdentifier
+	// Value is encoded with encoding/asn1
+	Value interface{}
+}
+
+// SignedMessage is a SignedData structure whose signature has been verified
+type SignedMessage struct {
+	// Content is the signed content
+	Content []byte
+	// Certificates are the certificates carried by the message
+	Certificates []*x509.Certificate
+	// Signer is the certificate of the signer, one of Certificates
+	Signer *x509.Certificate
+
+	attributes []attribute
+}
+
+// Sign creates a DER-encoded SignedData structure holding content, signed with key by the owner of crt
+// using SHA-256. The authenticated attributes hold the content type, the message digest and attrs.
+// crt is included in the certificates of the structure, followed by certs. rand is passed to key.Sign.
+func Sign(rand io.Reader, content []byte, crt *x509.Certificate, key crypto.Signer, attrs []Attribute, certs ...*x509.Certificate) ([]byte, error) {
+	var encAlg asn1.ObjectIdentifier
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		encAlg = oidEncryptionRSA
+	case *ecdsa.PublicKey:
+		encAlg = oidSignatureECDSASHA256
+	default:
+		return nil, fmt.Errorf("pkcs7: unsupported signing key type %T", key.Public())
+	}
+	digest := crypto.SHA256.New()
+	digest.Write(content)
+
+	contentType, err := asn1.Marshal(oidData)
+	if err != nil {
+		return nil, err
+	}
+	messageDigest, err := asn1.Marshal(digest.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	encoded := [][]byte{}
+	for _, a := range []attribute{
+		{Type: oidAttributeContentType, Values: []asn1.RawValue{{FullBytes: contentType}}},
+		{Type: oidAttributeMessageDigest, Values: []asn1.RawValue{{FullBytes: messageDigest}}},
+	} {
+		b, err := asn1.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, b)
+	}
+	for _, a := range attrs {
+		v, err := asn1.Marshal(a.Value)
+		if err != nil {
+			return nil, err
+		}
+		b, err := asn1.Marshal(attribute{Type: a.Type, Values: []asn1.RawValue{{FullBytes: v}}})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, b)
+	}
+	// DER orders the elements of a SET OF by their encoding
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	attrBytes := bytes.Join(encoded, nil)
+
+	// The signature covers the attributes encoded as a SET OF, rather than with their implicit tag
+	signed, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: attrBytes})
+	if err != nil {
+		return nil, err
+	}
+	h := crypto.SHA256.New()
+	h.Write(signed)
+	sig, err := key.Sign(rand, h.Sum(nil), crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	si, err := asn1.Marshal(signerInfo{
+		Version:                   1,
+		IssuerAndSerialNumber:     issuerAndSerial{Issuer: asn1.RawValue{FullBytes: crt.RawIssuer}, SerialNumber: crt.SerialNumber},
+		DigestAlgorithm:           pkix.AlgorithmIdentifier{Algorithm: oidDigestSHA256, Parameters: asn1.NullRawValue},
+		AuthenticatedAttributes:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrBytes},
+		DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: encAlg},
+		EncryptedDigest:           sig,
+	})
+	if err != nil {
+		return nil, err
+	}
+	octets, err := asn1.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	raw := [][]byte{crt.Raw}
+	for _, c := range certs {
+		raw = append(raw, c.Raw)
+	}
+	return marshalContentInfo(oidSignedData, signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidDigestSHA256, Parameters: asn1.NullRawValue}},
+		ContentInfo: contentInfo{
+			ContentType: oidData,
+			Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: octets},
+		},
+		Certificates: implicitSet(0, raw),
+		SignerInfos:  []asn1.RawValue{{FullBytes: si}},
+	})
+}
+
+// Verify parses a DER-encoded SignedData structure with one signer and checks its signature.
+// The certificate of the signer must be carried by the structure; it is not verified.
+func Verify(data []byte) (*SignedMessage, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(data, &ci); err != nil {
+		return nil, err
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("pkcs7: unsupported content type %v", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("pkcs7: expected one signer, found %d", len(sd.SignerInfos))
+	}
+	var si signerInfo
+	if _, err := asn1.Unmarshal(sd.SignerInfos[0].FullBytes, &si); err != nil {
+		return nil, err
+	}
+
+	msg := &SignedMessage{}
+	if len(sd.ContentInfo.Content.Bytes) > 0 {
+		if _, err := asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &msg.Content); err != nil {
+			return nil, fmt.Errorf("pkcs7: cannot parse content: %v", err)
+		}
+	}
+	certs, err := splitSet(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	for _, der := range certs {
+		crt, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		msg.Certificates = append(msg.Certificates, crt)
+		if si.IssuerAndSerialNumber.SerialNumber.Cmp(crt.SerialNumber) == 0 &&
+			bytes.Equal(si.IssuerAndSerialNumber.Issuer.FullBytes, crt.RawIssuer) {
+			msg.Signer = crt
+		}
+	}
+	if msg.Signer == nil {
+		return nil, errors.New("pkcs7: certificate of the signer is missing")
+	}
+
+	hash, err := digestHash(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(msg.Content)
+	contentDigest := h.Sum(nil)
+
+	signed := msg.Content
+	if len(si.AuthenticatedAttributes.Bytes) > 0 {
+		if msg.attributes, err = parseAttributes(si.AuthenticatedAttributes.Bytes); err != nil {
+			return nil, err
+		}
+		var messageDigest []byte
+		if err := msg.UnmarshalAttribute(oidAttributeMessageDigest, &messageDigest); err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(messageDigest, contentDigest) {
+			return nil, errors.New("pkcs7: message digest does not match the content")
+		}
+		if signed, err = asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: si.AuthenticatedAttributes.Bytes}); err != nil {
+			return nil, err
+		}
+	}
+	h = hash.New()
+	h.Write(signed)
+	if err := verifySignature(msg.Signer.PublicKey, hash, h.Sum(nil), si.EncryptedDigest); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// UnmarshalAttribute decodes the value of the authenticated attribute typ into out
+func (m *SignedMessage) UnmarshalAttribute(typ asn1.ObjectIdentifier, out interface{}) error {
+	for _, a := range m.attributes {
+		if a.Type.Equal(typ) {
+			if len(a.Values) != 1 {
+				return fmt.Errorf("pkcs7: attribute %v has %d values", typ, len(a.Values))
+			}
+			_, err := asn1.Unmarshal(a.Values[0].FullBytes, out)
+			return err
+		}
+	}
+	return fmt.Errorf("pkcs7: attribute %v is missing", typ)
+}
+
+func parseAttributes(data []byte) ([]attribute, error) {
+	var attrs []attribute
+	for len(data) > 0 {
+		var a attribute
+		var err error
+		if data, err = asn1.Unmarshal(data, &a); err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, a)
+	}
+	return attrs, nil
+}
+
+func digestHash(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	for hash, o := range digestOIDs {
+		if o.Equal(oid) {
+			return hash, nil
+		}
+	}
+	return 0, fmt.Errorf("pkcs7: unsupported digest algorithm %v", oid)
+}
+
+// verifySignature checks a signature over digest. The digest algorithm of the signer info
+// is used rather than the one named by its signature algorithm, which tools do not agree on.
+func verifySignature(pub crypto.PublicKey, hash crypto.Hash, digest, sig []byte) error {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, hash, digest, sig)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, sig) {
+			return errors.New("pkcs7: ECDSA verification failure")
+		}
+		return nil
+	default:
+		return fmt.Errorf("pkcs7: unsupported signer key type %T", pub)
+	}
+}
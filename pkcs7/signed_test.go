@@ -0,0 +1,94 @@
+package pkcs7
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var oidTestAttribute = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 7}
+
+// newTestCertificate creates a self-signed certificate for key
+func newTestCertificate(t *testing.T, key crypto.Signer) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "pkcs7 test"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crt
+}
+
+func TestSignVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []crypto.Signer{rsaKey, ecKey} {
+		crt := newTestCertificate(t, key)
+		content := []byte("signed content")
+		der, err := Sign(rand.Reader, content, crt, key, []Attribute{{Type: oidTestAttribute, Value: "transaction"}})
+		if err != nil {
+			t.Fatal("Failed signing:", err)
+		}
+
+		msg, err := Verify(der)
+		if err != nil {
+			t.Fatalf("Failed verifying %T signature: %v", key, err)
+		}
+		if !bytes.Equal(msg.Content, content) {
+			t.Fatalf("Content mismatch: got %q, want %q", msg.Content, content)
+		}
+		if !msg.Signer.Equal(crt) {
+			t.Fatal("Signer is not the signing certificate")
+		}
+		var value string
+		if err := msg.UnmarshalAttribute(oidTestAttribute, &value); err != nil || value != "transaction" {
+			t.Fatalf("Attribute mismatch: got %q, %v", value, err)
+		}
+		if err := msg.UnmarshalAttribute(asn1.ObjectIdentifier{1, 2, 3}, &value); err == nil {
+			t.Fatal("Expect error reading a missing attribute")
+		}
+
+		// The certificates of signed structures can be read without verifying them
+		if _, err := ParseSignedData(der); err != nil {
+			t.Fatal("Failed parsing signed data:", err)
+		}
+		tampered := bytes.Replace(der, content, []byte("altered content"[:len(content)]), 1)
+		if _, err := Verify(tampered); err == nil {
+			t.Fatal("Expect error verifying tampered content")
+		}
+	}
+}
+
+func TestVerifyDegenerate(t *testing.T) {
+	der, err := Degenerate(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(der); err == nil {
+		t.Fatal("Expect error verifying a structure without signers")
+	}
+}
@@ -59,6 +59,11 @@ func NewCertificateFromPEM(data []byte) (c *Certificate, err error) {
 	return
 }
 
+// DERBytes returns DER-formatted bytes of the certificate
+func (c *Certificate) DERBytes() []byte {
+	return c.derBytes
+}
+
 // build crt field if needed
 func (c *Certificate) buildX509Certificate() error {
 	if c.crt != nil {
@@ -87,9 +92,9 @@ func (c *Certificate) GetRawCertificate() (*x509.Certificate, error) {
 // GetExpirationDuration gets time duration before expiration
 func (c *Certificate) GetExpirationDuration() time.Duration {
 	if err := c.buildX509Certificate(); err != nil {
-		return time.Until(time.Unix(0, 0))
+		return time.Unix(0, 0).Sub(clock())
 	}
-	return time.Until(c.crt.NotAfter)
+	return c.crt.NotAfter.Sub(clock())
 }
 
 // CheckAuthority checks the authority of certificate against itself.
@@ -122,7 +127,7 @@ func (c *Certificate) VerifyHost(hostCert *Certificate, name string) error {
 		Intermediates: nil,
 		Roots:         roots,
 		// if zero, the current time is used
-		CurrentTime: time.Now(),
+		CurrentTime: clock(),
 		// An empty list means ExtKeyUsageServerAuth.
 		KeyUsages: nil,
 	}
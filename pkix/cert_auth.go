@@ -18,8 +18,8 @@
 package pkix
 
 import (
-	"crypto/rand"
 	"crypto/x509"
+	"errors"
 	"math/big"
 	"time"
 )
@@ -70,7 +70,7 @@ func CreateCertificateAuthorityWithOptions(key *Key, organizationalUnit string,
 
 	applyOptions(&authTemplate, opts)
 
-	crtBytes, err := x509.CreateCertificate(rand.Reader, &authTemplate, &authTemplate, key.Public, key.Private)
+	crtBytes, err := x509.CreateCertificate(random, &authTemplate, &authTemplate, key.Public, key.Private)
 	if err != nil {
 		return nil, err
 	}
@@ -90,8 +90,7 @@ func CreateIntermediateCertificateAuthority(crtAuth *Certificate, keyAuth *Key,
 func CreateIntermediateCertificateAuthorityWithOptions(crtAuth *Certificate, keyAuth *Key, csr *CertificateSigningRequest, proposedExpiry time.Time, opts ...Option) (*Certificate, error) {
 	authTemplate := newAuthTemplate()
 
-	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	serialNumber, err := newSerialNumber()
 	if err != nil {
 		return nil, err
 	}
@@ -104,7 +103,7 @@ func CreateIntermediateCertificateAuthorityWithOptions(crtAuth *Certificate, key
 
 	authTemplate.RawSubject = rawCsr.RawSubject
 
-	caExpiry := time.Now().Add(crtAuth.GetExpirationDuration())
+	caExpiry := clock().Add(crtAuth.GetExpirationDuration())
 	// ensure cert doesn't expire after issuer
 	if caExpiry.Before(proposedExpiry) {
 		authTemplate.NotAfter = caExpiry
@@ -128,7 +127,64 @@ func CreateIntermediateCertificateAuthorityWithOptions(crtAuth *Certificate, key
 
 	applyOptions(&authTemplate, opts)
 
-	crtOutBytes, err := x509.CreateCertificate(rand.Reader, &authTemplate, rawCrtAuth, rawCsr.PublicKey, keyAuth.Private)
+	crtOutBytes, err := x509.CreateCertificate(random, &authTemplate, rawCrtAuth, rawCsr.PublicKey, keyAuth.Private)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewCertificateFromDER(crtOutBytes), nil
+}
+
+// CrossSignCertificateAuthority issues a new certificate for an existing CA certificate,
+// signed by the given authority. The subject, public key, subject key ID and constraints
+// of crt are kept, so chains built through either certificate validate during a CA rollover.
+func CrossSignCertificateAuthority(crtAuth *Certificate, keyAuth *Key, crt *Certificate, proposedExpiry time.Time, opts ...Option) (*Certificate, error) {
+	authTemplate := newAuthTemplate()
+
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	authTemplate.SerialNumber.Set(serialNumber)
+
+	rawCrt, err := crt.GetRawCertificate()
+	if err != nil {
+		return nil, err
+	}
+	if !rawCrt.IsCA {
+		return nil, errors.New("only CA certificates can be cross-signed")
+	}
+
+	authTemplate.RawSubject = rawCrt.RawSubject
+
+	caExpiry := clock().Add(crtAuth.GetExpirationDuration())
+	// ensure cert doesn't expire after issuer
+	if caExpiry.Before(proposedExpiry) {
+		authTemplate.NotAfter = caExpiry
+	} else {
+		authTemplate.NotAfter = proposedExpiry
+	}
+
+	authTemplate.SubjectKeyId = rawCrt.SubjectKeyId
+	if len(authTemplate.SubjectKeyId) == 0 {
+		authTemplate.SubjectKeyId, err = GenerateSubjectKeyID(rawCrt.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	authTemplate.MaxPathLen = rawCrt.MaxPathLen
+	authTemplate.MaxPathLenZero = rawCrt.MaxPathLenZero
+	WithNameConstraintsOption(rawCrt)(&authTemplate)
+
+	rawCrtAuth, err := crtAuth.GetRawCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	applyOptions(&authTemplate, opts)
+
+	crtOutBytes, err := x509.CreateCertificate(random, &authTemplate, rawCrtAuth, rawCrt.PublicKey, keyAuth.Private)
 	if err != nil {
 		return nil, err
 	}
@@ -147,6 +203,22 @@ func WithPathlenOption(pathlen int, excludePathlen bool) func(template *x509.Cer
 	}
 }
 
+// WithNameConstraintsOption copies every name constraint of crt, permitted and excluded, to
+// the certificate, so that a CA certificate issued for the same CA is not less constrained
+func WithNameConstraintsOption(crt *x509.Certificate) Option {
+	return func(template *x509.Certificate) {
+		template.PermittedDNSDomainsCritical = crt.PermittedDNSDomainsCritical
+		template.PermittedDNSDomains = crt.PermittedDNSDomains
+		template.ExcludedDNSDomains = crt.ExcludedDNSDomains
+		template.PermittedIPRanges = crt.PermittedIPRanges
+		template.ExcludedIPRanges = crt.ExcludedIPRanges
+		template.PermittedEmailAddresses = crt.PermittedEmailAddresses
+		template.ExcludedEmailAddresses = crt.ExcludedEmailAddresses
+		template.PermittedURIDomains = crt.PermittedURIDomains
+		template.ExcludedURIDomains = crt.ExcludedURIDomains
+	}
+}
+
 func applyOptions(template *x509.Certificate, opts []Option) {
 	for _, opt := range opts {
 		opt(template)
@@ -158,7 +230,7 @@ func newAuthTemplate() x509.Certificate {
 	return x509.Certificate{
 		SerialNumber: big.NewInt(1),
 		// NotBefore is set to be 10min earlier to fix gap on time difference in cluster
-		NotBefore: time.Now().Add(-10 * time.Minute).UTC(),
+		NotBefore: clock().Add(-10 * time.Minute).UTC(),
 		NotAfter:  time.Time{},
 		// Used for certificate signing only
 		KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
@@ -18,6 +18,9 @@
 package pkix
 
 import (
+	"bytes"
+	"crypto/x509"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -145,3 +148,85 @@ func TestCreateCertificateAuthorityWithOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestCrossSignCertificateAuthority(t *testing.T) {
+	oldKey, err := CreateRSAKey(rsaBits)
+	if err != nil {
+		t.Fatal("Failed creating rsa key:", err)
+	}
+	oldCrt, err := CreateCertificateAuthorityWithOptions(oldKey, "OU", time.Now().AddDate(1, 0, 0), "test", "US", "California", "San Francisco", "Old CA", []string{".example.com"},
+		WithPathlenOption(1, false), WithSPIFFETrustDomainOption("example.org"), func(template *x509.Certificate) {
+			template.ExcludedDNSDomains = []string{"internal.example.com"}
+			template.PermittedEmailAddresses = []string{"example.com"}
+		})
+	if err != nil {
+		t.Fatal("Failed creating certificate authority:", err)
+	}
+	newKey, err := CreateRSAKey(rsaBits)
+	if err != nil {
+		t.Fatal("Failed creating rsa key:", err)
+	}
+	// the new CA needs room for the cross-signed old CA in its path length
+	newCrt, err := CreateCertificateAuthorityWithOptions(newKey, "OU", time.Now().AddDate(5, 0, 0), "test", "US", "California", "San Francisco", "New CA", nil, WithPathlenOption(2, false))
+	if err != nil {
+		t.Fatal("Failed creating certificate authority:", err)
+	}
+
+	// the old CA cross-signed by the new one
+	crossCrt, err := CrossSignCertificateAuthority(newCrt, newKey, oldCrt, time.Now().AddDate(3, 0, 0))
+	if err != nil {
+		t.Fatal("Failed cross-signing certificate authority:", err)
+	}
+	rawCross, err := crossCrt.GetRawCertificate()
+	if err != nil {
+		t.Fatal("Failed to get x509.Certificate:", err)
+	}
+	rawOld, _ := oldCrt.GetRawCertificate()
+	rawNew, _ := newCrt.GetRawCertificate()
+
+	if err = rawCross.CheckSignatureFrom(rawNew); err != nil {
+		t.Fatal("Failed to check signature:", err)
+	}
+	if !bytes.Equal(rawCross.RawSubject, rawOld.RawSubject) {
+		t.Fatal("Failed to preserve subject")
+	}
+	if !bytes.Equal(rawCross.RawSubjectPublicKeyInfo, rawOld.RawSubjectPublicKeyInfo) {
+		t.Fatal("Failed to preserve public key")
+	}
+	if !bytes.Equal(rawCross.SubjectKeyId, rawOld.SubjectKeyId) {
+		t.Fatal("Failed to preserve subject key ID")
+	}
+	if !rawCross.IsCA || rawCross.MaxPathLen != 1 || len(rawCross.PermittedDNSDomains) != 1 || !rawCross.PermittedDNSDomainsCritical {
+		t.Fatal("Failed to preserve CA constraints")
+	}
+	if !reflect.DeepEqual(rawCross.PermittedURIDomains, rawOld.PermittedURIDomains) ||
+		!reflect.DeepEqual(rawCross.ExcludedDNSDomains, rawOld.ExcludedDNSDomains) ||
+		!reflect.DeepEqual(rawCross.PermittedEmailAddresses, rawOld.PermittedEmailAddresses) {
+		t.Fatal("Failed to preserve name constraints")
+	}
+	if rawCross.SerialNumber.Cmp(rawOld.SerialNumber) == 0 {
+		t.Fatal("Expect a new serial number")
+	}
+
+	// A leaf issued by the old CA validates against the new root through the cross-signed certificate
+	csr, err := CreateCertificateSigningRequest(oldKey, "", nil, []string{"host.example.com"}, nil, "", "", "", "", "host.example.com")
+	if err != nil {
+		t.Fatal("Failed creating certificate request:", err)
+	}
+	leaf, err := CreateCertificateHost(oldCrt, oldKey, csr, time.Now().AddDate(0, 6, 0))
+	if err != nil {
+		t.Fatal("Failed creating certificate for host:", err)
+	}
+	rawLeaf, _ := leaf.GetRawCertificate()
+	roots := x509.NewCertPool()
+	roots.AddCert(rawNew)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(rawCross)
+	if _, err := rawLeaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, DNSName: "host.example.com"}); err != nil {
+		t.Fatal("Failed to verify leaf through cross-signed CA:", err)
+	}
+
+	if _, err := CrossSignCertificateAuthority(newCrt, newKey, leaf, time.Now().AddDate(1, 0, 0)); err == nil {
+		t.Fatal("Expect cross-signing a leaf certificate to fail")
+	}
+}
@@ -0,0 +1,91 @@
+package pkix
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// clock and random are where the package takes the current time and randomness from, for
+// validity periods, CRLs, keys, serial numbers and signatures. They are only replaced to
+// create reproducible fixtures.
+var (
+	clock            = time.Now
+	random io.Reader = rand.Reader
+)
+
+// serialNumberLimit bounds the random serial numbers of issued certificates to 128 bits
+var serialNumberLimit = new(big.Int).Lsh(big.NewInt(1), 128)
+
+// SetClock makes the package take the current time from now, or from time.Now if now is nil
+func SetClock(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	clock = now
+}
+
+// Now returns the current time of the clock set with SetClock
+func Now() time.Time {
+	return clock()
+}
+
+// SetRandom makes the package take randomness from r, or from crypto/rand if r is nil.
+// crypto/rsa and crypto/ecdsa mix randomness of their own into what they read from r, so
+// RSA and ECDSA keys and ECDSA signatures are not reproducible even with the same r.
+func SetRandom(r io.Reader) {
+	if r == nil {
+		r = rand.Reader
+	}
+	random = r
+}
+
+// Random returns the source of randomness set with SetRandom
+func Random() io.Reader {
+	return random
+}
+
+// NewSeededRandom returns a reader of the same pseudo-random bytes for the same seed:
+// the AES-256-CTR keystream keyed with the SHA-256 hash of seed. It is for reproducible
+// fixtures only, anything created from it is as secret as seed. It is safe for concurrent
+// use, although the bytes each reader gets then depend on the order of the reads.
+func NewSeededRandom(seed string) io.Reader {
+	key := sha256.Sum256([]byte(seed))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		panic(err)
+	}
+	return &lockedReader{r: &cipher.StreamReader{S: cipher.NewCTR(block, make([]byte, aes.BlockSize)), R: zeroReader{}}}
+}
+
+// lockedReader serializes the reads of r, which is not safe for concurrent use
+type lockedReader struct {
+	mu sync.Mutex
+	r  io.Reader
+}
+
+func (l *lockedReader) Read(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Read(b)
+}
+
+// zeroReader reads zeros, so that a stream cipher reading from it returns its keystream
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}
+
+// newSerialNumber returns a random serial number for an issued certificate
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(random, serialNumberLimit)
+}
@@ -0,0 +1,99 @@
+package pkix
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewSeededRandom(t *testing.T) {
+	read := func(seed string) []byte {
+		b := make([]byte, 64)
+		if _, err := io.ReadFull(NewSeededRandom(seed), b); err != nil {
+			t.Fatal("Failed reading seeded random:", err)
+		}
+		return b
+	}
+	if !bytes.Equal(read("a"), read("a")) {
+		t.Fatal("Expect the same bytes for the same seed")
+	}
+	if bytes.Equal(read("a"), read("b")) {
+		t.Fatal("Expect different bytes for different seeds")
+	}
+}
+
+func TestNewSeededRandomConcurrent(t *testing.T) {
+	r := NewSeededRandom("a")
+	var wg sync.WaitGroup
+	read := make([][]byte, 8)
+	for i := range read {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			read[i] = make([]byte, 32)
+			if _, err := io.ReadFull(r, read[i]); err != nil {
+				t.Error("Failed reading seeded random:", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	// Concurrent reads take consecutive parts of the keystream, never the same one
+	for i := range read {
+		for j := range read[:i] {
+			if bytes.Equal(read[i], read[j]) {
+				t.Fatal("Expect concurrent reads to get different bytes")
+			}
+		}
+	}
+}
+
+func TestSetClockAndRandom(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	SetClock(func() time.Time { return now })
+	defer SetClock(nil)
+	defer SetRandom(nil)
+
+	create := func() (*Certificate, *Certificate) {
+		SetRandom(NewSeededRandom("fixture"))
+		key, err := CreateEd25519Key()
+		if err != nil {
+			t.Fatal("Failed creating key:", err)
+		}
+		ca, err := CreateCertificateAuthority(key, "", now.AddDate(1, 0, 0), "", "", "", "", "CA", nil)
+		if err != nil {
+			t.Fatal("Failed creating CA:", err)
+		}
+		csr, err := CreateCertificateSigningRequest(key, "", nil, []string{"host"}, nil, "", "", "", "", "host")
+		if err != nil {
+			t.Fatal("Failed creating request:", err)
+		}
+		crt, err := CreateCertificateHost(ca, key, csr, now.AddDate(2, 0, 0))
+		if err != nil {
+			t.Fatal("Failed creating certificate:", err)
+		}
+		return ca, crt
+	}
+
+	ca, crt := create()
+	raw, err := crt.GetRawCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := now.Add(-10 * time.Minute); !raw.NotBefore.Equal(want) {
+		t.Fatalf("Expect NotBefore %v, got %v", want, raw.NotBefore)
+	}
+	// The certificate is capped at the expiry of the CA, one year from the clock
+	if want := now.AddDate(1, 0, 0); !raw.NotAfter.Equal(want) {
+		t.Fatalf("Expect NotAfter %v, got %v", want, raw.NotAfter)
+	}
+	if d := ca.GetExpirationDuration(); d != now.AddDate(1, 0, 0).Sub(now) {
+		t.Fatalf("Expect the CA to expire in a year, got %v", d)
+	}
+
+	ca2, crt2 := create()
+	if !bytes.Equal(ca.DERBytes(), ca2.DERBytes()) || !bytes.Equal(crt.DERBytes(), crt2.DERBytes()) {
+		t.Fatal("Expect the same certificates for the same clock and seed")
+	}
+}
@@ -19,7 +19,6 @@ package pkix
 
 import (
 	"bytes"
-	"crypto/rand"
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"errors"
@@ -36,7 +35,7 @@ func CreateCertificateRevocationList(key *Key, ca *Certificate, expiry time.Time
 		return nil, err
 	}
 
-	crlBytes, err := rawCrt.CreateCRL(rand.Reader, key.Private, []pkix.RevokedCertificate{}, time.Now(), expiry)
+	crlBytes, err := rawCrt.CreateCRL(random, key.Private, []pkix.RevokedCertificate{}, clock(), expiry)
 	if err != nil {
 		return nil, err
 	}
@@ -21,7 +21,7 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/ecdsa"
-	"crypto/rand"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
@@ -77,8 +77,21 @@ func ParseAndValidateURIs(uriList string) (res []*url.URL, err error) {
 	return
 }
 
+// WithinDomains reports whether name is one of domains or a subdomain of one, ignoring case
+// and a leading dot of the domains
+func WithinDomains(name string, domains []string) bool {
+	name = strings.ToLower(name)
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "."))
+		if name == d || strings.HasSuffix(name, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
 // CreateCertificateSigningRequest sets up a request to create a csr file with the given parameters
-func CreateCertificateSigningRequest(key *Key, organizationalUnit string, ipList []net.IP, domainList []string, uriList []*url.URL, organization string, country string, province string, locality string, commonName string) (*CertificateSigningRequest, error) {
+func CreateCertificateSigningRequest(key *Key, organizationalUnit string, ipList []net.IP, domainList []string, uriList []*url.URL, organization string, country string, province string, locality string, commonName string, opts ...CSROption) (*CertificateSigningRequest, error) {
 	csrPkixName := pkix.Name{CommonName: commonName}
 
 	if len(organizationalUnit) > 0 {
@@ -102,8 +115,35 @@ func CreateCertificateSigningRequest(key *Key, organizationalUnit string, ipList
 		DNSNames:    domainList,
 		URIs:        uriList,
 	}
+	for _, opt := range opts {
+		opt(csrTemplate)
+	}
+
+	csrBytes, err := x509.CreateCertificateRequest(random, csrTemplate, key.Private)
+	if err != nil {
+		return nil, err
+	}
+	return NewCertificateSigningRequestFromDER(csrBytes), nil
+}
+
+// CreateCertificateSigningRequestFromCertificate creates a csr for key which requests the
+// same subject and subject alternative names as an existing certificate, e.g. to renew it.
+func CreateCertificateSigningRequestFromCertificate(key *Key, crt *Certificate) (*CertificateSigningRequest, error) {
+	rawCrt, err := crt.GetRawCertificate()
+	if err != nil {
+		return nil, err
+	}
 
-	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, csrTemplate, key.Private)
+	// RawSubject keeps the ordering and encoding of the original subject.
+	csrTemplate := &x509.CertificateRequest{
+		RawSubject:     rawCrt.RawSubject,
+		IPAddresses:    rawCrt.IPAddresses,
+		DNSNames:       rawCrt.DNSNames,
+		EmailAddresses: rawCrt.EmailAddresses,
+		URIs:           rawCrt.URIs,
+	}
+
+	csrBytes, err := x509.CreateCertificateRequest(random, csrTemplate, key.Private)
 	if err != nil {
 		return nil, err
 	}
@@ -136,6 +176,11 @@ func NewCertificateSigningRequestFromPEM(data []byte) (*CertificateSigningReques
 	return &CertificateSigningRequest{derBytes: pemBlock.Bytes}, nil
 }
 
+// DERBytes returns DER-formatted bytes of the certificate request
+func (c *CertificateSigningRequest) DERBytes() []byte {
+	return c.derBytes
+}
+
 // build cr field if needed
 func (c *CertificateSigningRequest) buildPKCS10CertificateSigningRequest() error {
 	if c.cr != nil {
@@ -158,6 +203,45 @@ func (c *CertificateSigningRequest) GetRawCertificateSigningRequest() (*x509.Cer
 	return c.cr, nil
 }
 
+// oidChallengePassword identifies the PKCS #9 challengePassword attribute of certificate requests
+var oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+
+type csrAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// ChallengePassword returns the challengePassword attribute of the certificate request,
+// or an empty string if it has none. x509.CertificateRequest does not parse it.
+func (c *CertificateSigningRequest) ChallengePassword() (string, error) {
+	if err := c.buildPKCS10CertificateSigningRequest(); err != nil {
+		return "", err
+	}
+	var info struct {
+		Version    int
+		Subject    asn1.RawValue
+		PublicKey  asn1.RawValue
+		Attributes []csrAttribute `asn1:"tag:0"`
+	}
+	if _, err := asn1.Unmarshal(c.cr.RawTBSCertificateRequest, &info); err != nil {
+		return "", err
+	}
+	for _, attr := range info.Attributes {
+		if !attr.Type.Equal(oidChallengePassword) {
+			continue
+		}
+		if len(attr.Values) != 1 {
+			return "", errors.New("challengePassword attribute must have one value")
+		}
+		var password string
+		if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &password); err != nil {
+			return "", err
+		}
+		return password, nil
+	}
+	return "", nil
+}
+
 // CheckSignature verifies that the signature is a valid signature
 // using the public key in CertificateSigningRequest.
 func (c *CertificateSigningRequest) CheckSignature() error {
@@ -168,32 +252,32 @@ func (c *CertificateSigningRequest) CheckSignature() error {
 }
 
 // checkSignature verifies a signature made by the key on a CSR, such
-// as on the CSR itself.
+// as the signature on the CSR itself, with any algorithm of signatureAlgorithms.
 func checkSignature(csr *x509.CertificateRequest, algo x509.SignatureAlgorithm, signed, signature []byte) error {
-	var hashType crypto.Hash
-	switch algo {
-	case x509.SHA1WithRSA, x509.ECDSAWithSHA1:
-		hashType = crypto.SHA1
-	case x509.SHA256WithRSA, x509.ECDSAWithSHA256:
-		hashType = crypto.SHA256
-	case x509.SHA384WithRSA, x509.ECDSAWithSHA384:
-		hashType = crypto.SHA384
-	case x509.SHA512WithRSA, x509.ECDSAWithSHA512:
-		hashType = crypto.SHA512
-	default:
+	details, ok := lookupSignatureAlgorithm(algo)
+	if !ok {
 		return x509.ErrUnsupportedAlgorithm
 	}
-	if !hashType.Available() {
-		return x509.ErrUnsupportedAlgorithm
+	if publicKeyAlgorithm(csr.PublicKey) != details.pubKeyAlgo {
+		return errors.New("x509: signature algorithm does not match the public key")
 	}
-	h := hashType.New()
+	digest := signed
+	if details.hash != 0 {
+		if !details.hash.Available() {
+			return x509.ErrUnsupportedAlgorithm
+		}
+		h := details.hash.New()
 
-	// nolint:errcheck
-	h.Write(signed)
-	digest := h.Sum(nil)
+		// nolint:errcheck
+		h.Write(signed)
+		digest = h.Sum(nil)
+	}
 	switch pub := csr.PublicKey.(type) {
 	case *rsa.PublicKey:
-		return rsa.VerifyPKCS1v15(pub, hashType, digest, signature)
+		if details.pss {
+			return rsa.VerifyPSS(pub, details.hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		return rsa.VerifyPKCS1v15(pub, details.hash, digest, signature)
 	case *ecdsa.PublicKey:
 		ecdsaSig := new(struct{ R, S *big.Int })
 		if _, err := asn1.Unmarshal(signature, ecdsaSig); err != nil {
@@ -206,8 +290,28 @@ func checkSignature(csr *x509.CertificateRequest, algo x509.SignatureAlgorithm,
 			return errors.New("x509: ECDSA verification failure")
 		}
 		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, digest, signature) {
+			return errors.New("x509: Ed25519 verification failure")
+		}
+		return nil
+	}
+	// Other keys, such as ML-DSA keys, are verified as crypto/x509 verifies certificates
+	return (&x509.Certificate{PublicKey: csr.PublicKey}).CheckSignature(algo, signed, signature)
+}
+
+// publicKeyAlgorithm returns the algorithm of a public key, x509.UnknownPublicKeyAlgorithm
+// if it is not supported
+func publicKeyAlgorithm(pub crypto.PublicKey) x509.PublicKeyAlgorithm {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return x509.RSA
+	case *ecdsa.PublicKey:
+		return x509.ECDSA
+	case ed25519.PublicKey:
+		return x509.Ed25519
 	}
-	return x509.ErrUnsupportedAlgorithm
+	return mldsaPublicKeyAlgorithm(pub)
 }
 
 // Export returns PEM-format bytes
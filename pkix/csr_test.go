@@ -19,7 +19,11 @@ package pkix
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
 	"testing"
+	"time"
 )
 
 const (
@@ -48,6 +52,15 @@ hvcNAQEFBQADgYEAd6zCGoQHwqwcCtETtmEnlry1kienYt8WgMLU89HcJpSTUR7e
 1VfXfkS9MO5SUp9apPq0LIgT3ZcZwhFjgYmM9BTDUeMKT21FLnQbJ3C7xTTtSHQ6
 FlV5Hq5RkPqaigS6EmWl1zQrSZ4330jpt8y9J5rHGbsNwGlR+0xr34xqAYg=
 -----END NEW CERTIFICATE REQUEST-----
+`
+	challengeCSRPEM = `-----BEGIN CERTIFICATE REQUEST-----
+MIHxMIGZAgEAMBYxFDASBgNVBAMMC3NjZXAtZGV2aWNlMFkwEwYHKoZIzj0CAQYI
+KoZIzj0DAQcDQgAET1gN1N2S+bleEM9hfzfMNlmBLTpepZmQ1CoZd1ETJMvcsYS/
+Vvn4VNTBz5NgVyeCsuS9pGx+Lf2lWBFZEpT3qKAhMB8GCSqGSIb3DQEJBzESDBBz
+M2NyZXQtY2hhbGxlbmdlMAoGCCqGSM49BAMCA0cAMEQCIE6ghgodWP1CEYVzcJ2w
+qo+3j+iLSgprdZFrgSQROU7pAiAy5VoYllxOxFVjKgDLyJf3GRHJ6kImHbWSdmKp
+IOfkbQ==
+-----END CERTIFICATE REQUEST-----
 `
 	wrongCSRPEM = `-----BEGIN WRONG CERTIFICATE REQUEST-----
 MIIBgTCB7QIBADBGMQwwCgYDVQQGEwNVU0ExEDAOBgNVBAoTB2V0Y2QtY2ExEDAO
@@ -101,6 +114,52 @@ func TestCreateCertificateSigningRequest(t *testing.T) {
 	}
 }
 
+func TestCreateCertificateSigningRequestFromCertificate(t *testing.T) {
+	crtAuth, err := NewCertificateFromPEM([]byte(certAuthPEM))
+	if err != nil {
+		t.Fatal("Failed to parse certificate from PEM:", err)
+	}
+	keyAuth, err := NewKeyFromPrivateKeyPEM([]byte(rsaPrivKeyAuthPEM))
+	if err != nil {
+		t.Fatal("Failed parsing RSA private key:", err)
+	}
+	csr, err := NewCertificateSigningRequestFromPEM([]byte(csrPEM))
+	if err != nil {
+		t.Fatal("Failed parsing certificate request from PEM:", err)
+	}
+	crt, err := CreateCertificateHost(crtAuth, keyAuth, csr, time.Now().AddDate(1, 0, 0))
+	if err != nil {
+		t.Fatal("Failed creating certificate for host:", err)
+	}
+
+	key, err := CreateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal("Failed creating ecdsa key:", err)
+	}
+	renewCsr, err := CreateCertificateSigningRequestFromCertificate(key, crt)
+	if err != nil {
+		t.Fatal("Failed creating certificate request from certificate:", err)
+	}
+	if err = renewCsr.CheckSignature(); err != nil {
+		t.Fatal("Failed checking signature in certificate request:", err)
+	}
+
+	rawCsr, err := csr.GetRawCertificateSigningRequest()
+	if err != nil {
+		t.Fatal("Failed getting raw certificate request:", err)
+	}
+	rawRenewCsr, err := renewCsr.GetRawCertificateSigningRequest()
+	if err != nil {
+		t.Fatal("Failed getting raw certificate request:", err)
+	}
+	if !bytes.Equal(rawRenewCsr.RawSubject, rawCsr.RawSubject) {
+		t.Fatalf("Failed to preserve subject: %s %s", rawRenewCsr.RawSubject, rawCsr.RawSubject)
+	}
+	if _, ok := rawRenewCsr.PublicKey.(*ecdsa.PublicKey); !ok {
+		t.Fatalf("Expect certificate request for the new key, got %T", rawRenewCsr.PublicKey)
+	}
+}
+
 func TestCertificateSigningRequest(t *testing.T) {
 	csr, err := NewCertificateSigningRequestFromPEM([]byte(csrPEM))
 	if err != nil {
@@ -139,6 +198,31 @@ func TestOldStyleCertificateSigningRequest(t *testing.T) {
 	}
 }
 
+func TestChallengePassword(t *testing.T) {
+	csr, err := NewCertificateSigningRequestFromPEM([]byte(challengeCSRPEM))
+	if err != nil {
+		t.Fatal("Failed parsing certificate request from PEM:", err)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		t.Fatal("Failed checking signature:", err)
+	}
+	password, err := csr.ChallengePassword()
+	if err != nil {
+		t.Fatal("Failed reading challenge password:", err)
+	}
+	if password != "s3cret-challenge" {
+		t.Fatalf("Challenge password mismatch: got %q", password)
+	}
+
+	csr, err = NewCertificateSigningRequestFromPEM([]byte(csrPEM))
+	if err != nil {
+		t.Fatal("Failed parsing certificate request from PEM:", err)
+	}
+	if password, err = csr.ChallengePassword(); err != nil || password != "" {
+		t.Fatalf("Expect no challenge password, got %q, %v", password, err)
+	}
+}
+
 func TestWrongCertificateSigningRequest(t *testing.T) {
 	if _, err := NewCertificateSigningRequestFromPEM([]byte("-")); err == nil {
 		t.Fatal("Expect not to parse from PEM:", err)
@@ -163,3 +247,84 @@ func TestBadCertificateSigningRequest(t *testing.T) {
 		t.Fatal("Expect not to get x509.CertificateRequest")
 	}
 }
+
+func TestCertificateSigningRequestSignatureAlgorithms(t *testing.T) {
+	rsaKey, err := CreateRSAKey(2048)
+	if err != nil {
+		t.Fatal("Failed creating RSA key:", err)
+	}
+	ecKey, err := CreateECDSAKey(elliptic.P384())
+	if err != nil {
+		t.Fatal("Failed creating ECDSA key:", err)
+	}
+	edKey, err := CreateEd25519Key()
+	if err != nil {
+		t.Fatal("Failed creating Ed25519 key:", err)
+	}
+
+	for _, tc := range []struct {
+		key  *Key
+		algo x509.SignatureAlgorithm
+	}{
+		{rsaKey, x509.UnknownSignatureAlgorithm},
+		{rsaKey, x509.SHA384WithRSA},
+		{rsaKey, x509.SHA512WithRSA},
+		{rsaKey, x509.SHA256WithRSAPSS},
+		{rsaKey, x509.SHA384WithRSAPSS},
+		{rsaKey, x509.SHA512WithRSAPSS},
+		{ecKey, x509.ECDSAWithSHA256},
+		{ecKey, x509.ECDSAWithSHA512},
+		{edKey, x509.UnknownSignatureAlgorithm},
+		{edKey, x509.PureEd25519},
+	} {
+		csr, err := CreateCertificateSigningRequest(tc.key, "", nil, []string{csrHostname}, nil, "", "", "", "", csrCN, WithCSRSignatureAlgorithmOption(tc.algo))
+		if err != nil {
+			t.Fatalf("Failed creating certificate request with %v: %v", tc.algo, err)
+		}
+		if err = csr.CheckSignature(); err != nil {
+			t.Fatalf("Failed checking signature with %v: %v", tc.algo, err)
+		}
+		rawCsr, err := csr.GetRawCertificateSigningRequest()
+		if err != nil {
+			t.Fatal("Failed getting raw certificate request:", err)
+		}
+		if tc.algo != x509.UnknownSignatureAlgorithm && rawCsr.SignatureAlgorithm != tc.algo {
+			t.Fatalf("Expect signature algorithm %v, got %v", tc.algo, rawCsr.SignatureAlgorithm)
+		}
+
+		// A tampered signature does not verify
+		rawCsr.Signature[len(rawCsr.Signature)-1] ^= 1
+		if err = checkSignature(rawCsr, rawCsr.SignatureAlgorithm, rawCsr.RawTBSCertificateRequest, rawCsr.Signature); err == nil {
+			t.Fatalf("Expect a tampered signature with %v not to verify", tc.algo)
+		}
+	}
+
+	// The signature algorithm must match the key
+	csr, err := CreateCertificateSigningRequest(ecKey, "", nil, nil, nil, "", "", "", "", csrCN)
+	if err != nil {
+		t.Fatal("Failed creating certificate request:", err)
+	}
+	rawCsr, err := csr.GetRawCertificateSigningRequest()
+	if err != nil {
+		t.Fatal("Failed getting raw certificate request:", err)
+	}
+	if err = checkSignature(rawCsr, x509.SHA256WithRSAPSS, rawCsr.RawTBSCertificateRequest, rawCsr.Signature); err == nil {
+		t.Fatal("Expect an RSA-PSS signature not to verify with an ECDSA key")
+	}
+}
+
+func TestWithinDomains(t *testing.T) {
+	domains := []string{"example.com", ".Example.org"}
+	for name, want := range map[string]bool{
+		"example.com":      true,
+		"www.example.com":  true,
+		"WWW.EXAMPLE.ORG":  true,
+		"badexample.com":   false,
+		"example.com.evil": false,
+		"example.net":      false,
+	} {
+		if got := WithinDomains(name, domains); got != want {
+			t.Errorf("WithinDomains(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
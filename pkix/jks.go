@@ -0,0 +1,377 @@
+package pkix
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/subtle"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	jksMagic   = 0xfeedfeed
+	jksVersion = 2
+
+	jksPrivateKeyTag  = 1
+	jksTrustedCertTag = 2
+
+	jksCertType = "X.509"
+
+	// jksIntegrityWhitener is mixed into the keystore digest by the JDK
+	jksIntegrityWhitener = "Mighty Aphrodite"
+	jksSaltLen           = sha1.Size
+)
+
+// oidJKSKeyProtector identifies the proprietary key protection algorithm of Sun's JKS keystores
+var oidJKSKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+
+// JKSEntry is an entry of a Java keystore. Entries with a Key are private key entries
+// holding the certificate chain of the key; the others are trusted certificate entries
+// holding exactly one certificate.
+type JKSEntry struct {
+	Alias        string
+	Created      time.Time
+	Key          *Key
+	Certificates []*Certificate
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// ExportJKS returns the entries as a JKS keystore. The keystore and its private keys are
+// protected by password. Aliases are lower-cased, as the JDK does for JKS keystores.
+func ExportJKS(entries []*JKSEntry, password []byte) ([]byte, error) {
+	pass := jksPassword(password)
+
+	buf := new(bytes.Buffer)
+	w := &jksWriter{w: buf}
+	w.uint32(jksMagic)
+	w.uint32(jksVersion)
+	w.uint32(uint32(len(entries)))
+
+	aliases := map[string]bool{}
+	for _, e := range entries {
+		alias := strings.ToLower(e.Alias)
+		if aliases[alias] {
+			return nil, fmt.Errorf("duplicate keystore alias %q", alias)
+		}
+		aliases[alias] = true
+
+		if e.Key != nil {
+			protected, err := jksProtectKey(e.Key, pass)
+			if err != nil {
+				return nil, err
+			}
+			w.uint32(jksPrivateKeyTag)
+			w.utf(alias)
+			w.uint64(uint64(e.Created.UnixMilli()))
+			w.bytes(protected)
+			w.uint32(uint32(len(e.Certificates)))
+			for _, crt := range e.Certificates {
+				w.utf(jksCertType)
+				w.bytes(crt.derBytes)
+			}
+		} else {
+			if len(e.Certificates) != 1 {
+				return nil, fmt.Errorf("trusted certificate entry %q must hold one certificate", alias)
+			}
+			w.uint32(jksTrustedCertTag)
+			w.utf(alias)
+			w.uint64(uint64(e.Created.UnixMilli()))
+			w.utf(jksCertType)
+			w.bytes(e.Certificates[0].derBytes)
+		}
+		if w.err != nil {
+			return nil, w.err
+		}
+	}
+
+	digest := jksDigest(pass, buf.Bytes())
+	buf.Write(digest)
+	return buf.Bytes(), nil
+}
+
+// ParseJKS parses a JKS keystore protected by password, checking its integrity
+// and decrypting its private keys
+func ParseJKS(data []byte, password []byte) ([]*JKSEntry, error) {
+	pass := jksPassword(password)
+	if len(data) < sha1.Size {
+		return nil, errors.New("keystore too short")
+	}
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	if subtle.ConstantTimeCompare(digest, jksDigest(pass, body)) != 1 {
+		return nil, errors.New("keystore was tampered with, or password was incorrect")
+	}
+
+	r := &jksReader{r: bytes.NewReader(body)}
+	if r.uint32() != jksMagic || r.uint32() != jksVersion {
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, errors.New("unsupported keystore format")
+	}
+	count := r.uint32()
+
+	var entries []*JKSEntry
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		e := &JKSEntry{}
+		tag := r.uint32()
+		e.Alias = r.utf()
+		e.Created = time.UnixMilli(int64(r.uint64()))
+		switch tag {
+		case jksPrivateKeyTag:
+			protected := r.bytes()
+			n := r.uint32()
+			for j := uint32(0); j < n && r.err == nil; j++ {
+				if r.utf() != jksCertType {
+					return nil, errors.New("unsupported certificate type in keystore")
+				}
+				e.Certificates = append(e.Certificates, NewCertificateFromDER(r.bytes()))
+			}
+			if r.err != nil {
+				break
+			}
+			key, err := jksRecoverKey(protected, pass)
+			if err != nil {
+				return nil, fmt.Errorf("entry %q: %v", e.Alias, err)
+			}
+			e.Key = key
+		case jksTrustedCertTag:
+			if r.utf() != jksCertType {
+				return nil, errors.New("unsupported certificate type in keystore")
+			}
+			e.Certificates = []*Certificate{NewCertificateFromDER(r.bytes())}
+		default:
+			if r.err == nil {
+				return nil, fmt.Errorf("unsupported keystore entry tag %d", tag)
+			}
+		}
+		entries = append(entries, e)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return entries, nil
+}
+
+// jksPassword encodes password as the big-endian UTF-16 bytes the JDK uses for keystore passwords
+func jksPassword(password []byte) []byte {
+	units := utf16.Encode([]rune(string(password)))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.BigEndian.PutUint16(b[2*i:], u)
+	}
+	return b
+}
+
+func jksDigest(pass, data []byte) []byte {
+	h := sha1.New()
+	h.Write(pass)
+	h.Write([]byte(jksIntegrityWhitener))
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// jksKeyStream derives the XOR key stream of the JKS key protector from the salt
+func jksKeyStream(pass, salt []byte, n int) []byte {
+	stream := make([]byte, 0, n+sha1.Size)
+	digest := salt
+	for len(stream) < n {
+		h := sha1.New()
+		h.Write(pass)
+		h.Write(digest)
+		digest = h.Sum(nil)
+		stream = append(stream, digest...)
+	}
+	return stream[:n]
+}
+
+func jksProtectKey(key *Key, pass []byte) ([]byte, error) {
+	plain, err := key.ExportPrivateDER()
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, jksSaltLen)
+	if _, err := io.ReadFull(random, salt); err != nil {
+		return nil, err
+	}
+
+	stream := jksKeyStream(pass, salt, len(plain))
+	encrypted := make([]byte, len(plain))
+	for i := range plain {
+		encrypted[i] = plain[i] ^ stream[i]
+	}
+	check := sha1.Sum(append(append([]byte{}, pass...), plain...))
+
+	protected := append(append(salt, encrypted...), check[:]...)
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidJKSKeyProtector, Parameters: asn1.NullRawValue},
+		EncryptedData: protected,
+	})
+}
+
+func jksRecoverKey(data, pass []byte) (*Key, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	if !info.Algorithm.Algorithm.Equal(oidJKSKeyProtector) {
+		return nil, fmt.Errorf("unsupported key protection algorithm %v", info.Algorithm.Algorithm)
+	}
+	protected := info.EncryptedData
+	if len(protected) < jksSaltLen+sha1.Size {
+		return nil, errors.New("protected key too short")
+	}
+	salt := protected[:jksSaltLen]
+	encrypted := protected[jksSaltLen : len(protected)-sha1.Size]
+	check := protected[len(protected)-sha1.Size:]
+
+	stream := jksKeyStream(pass, salt, len(encrypted))
+	plain := make([]byte, len(encrypted))
+	for i := range encrypted {
+		plain[i] = encrypted[i] ^ stream[i]
+	}
+	sum := sha1.Sum(append(append([]byte{}, pass...), plain...))
+	if subtle.ConstantTimeCompare(sum[:], check) != 1 {
+		return nil, errors.New("cannot recover key, password was incorrect")
+	}
+	return NewKeyFromPrivateKeyDER(plain)
+}
+
+// jksWriter writes the big-endian fields of Java's DataOutputStream, keeping the first error
+type jksWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *jksWriter) write(b []byte) {
+	if w.err == nil {
+		_, w.err = w.w.Write(b)
+	}
+}
+
+func (w *jksWriter) uint16(v uint16) {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	w.write(b)
+}
+
+func (w *jksWriter) uint32(v uint32) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	w.write(b)
+}
+
+func (w *jksWriter) uint64(v uint64) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	w.write(b)
+}
+
+func (w *jksWriter) bytes(b []byte) {
+	w.uint32(uint32(len(b)))
+	w.write(b)
+}
+
+// utf writes s in the modified UTF-8 encoding of DataOutputStream.writeUTF
+func (w *jksWriter) utf(s string) {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		switch {
+		case u >= 0x01 && u <= 0x7f:
+			b = append(b, byte(u))
+		case u <= 0x7ff:
+			b = append(b, byte(0xc0|u>>6), byte(0x80|u&0x3f))
+		default:
+			b = append(b, byte(0xe0|u>>12), byte(0x80|(u>>6)&0x3f), byte(0x80|u&0x3f))
+		}
+	}
+	if len(b) > 0xffff {
+		if w.err == nil {
+			w.err = errors.New("keystore string too long")
+		}
+		return
+	}
+	w.uint16(uint16(len(b)))
+	w.write(b)
+}
+
+// jksReader reads the fields written by jksWriter, keeping the first error
+type jksReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *jksReader) read(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		r.err = errors.New("keystore truncated")
+		return nil
+	}
+	return b
+}
+
+func (r *jksReader) uint32() uint32 {
+	b := r.read(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *jksReader) uint64() uint64 {
+	b := r.read(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *jksReader) bytes() []byte {
+	n := r.uint32()
+	if r.err == nil && n > 1<<24 {
+		r.err = errors.New("keystore entry too large")
+	}
+	return r.read(int(n))
+}
+
+// utf reads a string in the modified UTF-8 encoding of DataInputStream.readUTF
+func (r *jksReader) utf() string {
+	b := r.read(2)
+	if b == nil {
+		return ""
+	}
+	b = r.read(int(binary.BigEndian.Uint16(b)))
+	var units []uint16
+	for i := 0; i < len(b); {
+		switch {
+		case b[i]&0x80 == 0:
+			units = append(units, uint16(b[i]))
+			i++
+		case b[i]&0xe0 == 0xc0 && i+1 < len(b):
+			units = append(units, uint16(b[i]&0x1f)<<6|uint16(b[i+1]&0x3f))
+			i += 2
+		case b[i]&0xf0 == 0xe0 && i+2 < len(b):
+			units = append(units, uint16(b[i]&0x0f)<<12|uint16(b[i+1]&0x3f)<<6|uint16(b[i+2]&0x3f))
+			i += 3
+		default:
+			if r.err == nil {
+				r.err = errors.New("malformed keystore string")
+			}
+			return ""
+		}
+	}
+	return string(utf16.Decode(units))
+}
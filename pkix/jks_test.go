@@ -0,0 +1,89 @@
+package pkix
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"testing"
+	"time"
+)
+
+func TestJKSExportParse(t *testing.T) {
+	key, err := CreateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal("Failed creating ecdsa key:", err)
+	}
+	crtAuth, err := NewCertificateFromPEM([]byte(certAuthPEM))
+	if err != nil {
+		t.Fatal("Failed parsing certificate from PEM:", err)
+	}
+	crtHost, err := NewCertificateFromPEM([]byte(certHostPEM))
+	if err != nil {
+		t.Fatal("Failed parsing certificate from PEM:", err)
+	}
+
+	created := time.Unix(1700000000, 0)
+	entries := []*JKSEntry{
+		{Alias: "Host", Created: created, Key: key, Certificates: []*Certificate{crtHost, crtAuth}},
+		{Alias: "ca-é", Created: created, Certificates: []*Certificate{crtAuth}},
+	}
+	data, err := ExportJKS(entries, []byte(password))
+	if err != nil {
+		t.Fatal("Failed exporting JKS:", err)
+	}
+	if !bytes.HasPrefix(data, []byte{0xfe, 0xed, 0xfe, 0xed, 0, 0, 0, 2, 0, 0, 0, 2}) {
+		t.Fatalf("Unexpected JKS header % x", data[:12])
+	}
+
+	parsed, err := ParseJKS(data, []byte(password))
+	if err != nil {
+		t.Fatal("Failed parsing JKS:", err)
+	}
+	if len(parsed) != 2 {
+		t.Fatalf("Expect 2 entries, got %d", len(parsed))
+	}
+	if parsed[0].Alias != "host" || parsed[1].Alias != "ca-é" {
+		t.Fatalf("Unexpected aliases %q and %q", parsed[0].Alias, parsed[1].Alias)
+	}
+	if !parsed[0].Created.Equal(created) {
+		t.Fatalf("Unexpected creation time %v", parsed[0].Created)
+	}
+	if parsed[0].Key == nil || parsed[1].Key != nil {
+		t.Fatal("Expect a private key entry followed by a trusted certificate entry")
+	}
+	before, _ := key.ExportPrivateDER()
+	after, _ := parsed[0].Key.ExportPrivateDER()
+	if !bytes.Equal(before, after) {
+		t.Fatal("Private key changed after JKS round trip")
+	}
+	if len(parsed[0].Certificates) != 2 || !bytes.Equal(parsed[0].Certificates[0].DERBytes(), crtHost.DERBytes()) {
+		t.Fatal("Certificate chain changed after JKS round trip")
+	}
+	if !bytes.Equal(parsed[1].Certificates[0].DERBytes(), crtAuth.DERBytes()) {
+		t.Fatal("Trusted certificate changed after JKS round trip")
+	}
+
+	if _, err := ParseJKS(data, []byte(wrongPassword)); err == nil {
+		t.Fatal("Expect error parsing JKS with wrong password")
+	}
+	data[20] ^= 1
+	if _, err := ParseJKS(data, []byte(password)); err == nil {
+		t.Fatal("Expect error parsing tampered JKS")
+	}
+}
+
+func TestJKSExportErrors(t *testing.T) {
+	crtAuth, err := NewCertificateFromPEM([]byte(certAuthPEM))
+	if err != nil {
+		t.Fatal("Failed parsing certificate from PEM:", err)
+	}
+	if _, err := ExportJKS([]*JKSEntry{{Alias: "ca"}}, []byte(password)); err == nil {
+		t.Fatal("Expect error exporting trusted entry without certificate")
+	}
+	entries := []*JKSEntry{
+		{Alias: "CA", Certificates: []*Certificate{crtAuth}},
+		{Alias: "ca", Certificates: []*Certificate{crtAuth}},
+	}
+	if _, err := ExportJKS(entries, []byte(password)); err == nil {
+		t.Fatal("Expect error exporting duplicate aliases")
+	}
+}
@@ -0,0 +1,294 @@
+package pkix
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JWK is a JSON Web Key as defined by RFC 7517
+type JWK struct {
+	Kty string   `json:"kty"`
+	Kid string   `json:"kid,omitempty"`
+	Use string   `json:"use,omitempty"`
+	Alg string   `json:"alg,omitempty"`
+	Crv string   `json:"crv,omitempty"`
+	N   string   `json:"n,omitempty"`
+	E   string   `json:"e,omitempty"`
+	X   string   `json:"x,omitempty"`
+	Y   string   `json:"y,omitempty"`
+	D   string   `json:"d,omitempty"`
+	P   string   `json:"p,omitempty"`
+	Q   string   `json:"q,omitempty"`
+	Dp  string   `json:"dp,omitempty"`
+	Dq  string   `json:"dq,omitempty"`
+	Qi  string   `json:"qi,omitempty"`
+	X5c []string `json:"x5c,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set as defined by RFC 7517
+type JWKS struct {
+	Keys []*JWK `json:"keys"`
+}
+
+var jwkCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// NewPublicJWK creates a JWK for a public key, with its RFC 7638 thumbprint as key ID
+func NewPublicJWK(pub crypto.PublicKey) (*JWK, error) {
+	var jwk *JWK
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		jwk = &JWK{
+			Kty: "RSA",
+			N:   b64(pub.N.Bytes()),
+			E:   b64(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk = &JWK{
+			Kty: "EC",
+			Crv: pub.Curve.Params().Name,
+			X:   b64(pub.X.FillBytes(make([]byte, size))),
+			Y:   b64(pub.Y.FillBytes(make([]byte, size))),
+		}
+	case ed25519.PublicKey:
+		jwk = &JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   b64(pub),
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	jwk.Kid = thumbprint
+	return jwk, nil
+}
+
+// Thumbprint returns the base64url-encoded RFC 7638 SHA-256 thumbprint of the key
+func (j *JWK) Thumbprint() (string, error) {
+	// The required members, in lexicographic order and without whitespace
+	var s string
+	switch j.Kty {
+	case "RSA":
+		s = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, j.E, j.Kty, j.N)
+	case "EC":
+		s = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, j.Crv, j.Kty, j.X, j.Y)
+	case "OKP":
+		s = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, j.Crv, j.Kty, j.X)
+	default:
+		return "", fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+	sum := sha256.Sum256([]byte(s))
+	return b64(sum[:]), nil
+}
+
+// JWK returns the public key of the certificate as a JWK, with the certificate
+// followed by chain as its x5c member
+func (c *Certificate) JWK(chain ...*Certificate) (*JWK, error) {
+	if err := c.buildX509Certificate(); err != nil {
+		return nil, err
+	}
+	jwk, err := NewPublicJWK(c.crt.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, crt := range append([]*Certificate{c}, chain...) {
+		jwk.X5c = append(jwk.X5c, base64.StdEncoding.EncodeToString(crt.derBytes))
+	}
+	return jwk, nil
+}
+
+// ExportJWK returns the public key of the certificate as JSON-format JWK,
+// with the certificate followed by chain as its x5c member
+func (c *Certificate) ExportJWK(chain ...*Certificate) ([]byte, error) {
+	jwk, err := c.JWK(chain...)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(jwk, "", "  ")
+}
+
+// ExportCertificatesJWKS returns the public keys of the certificates as JSON-format JWKS
+func ExportCertificatesJWKS(crts []*Certificate) ([]byte, error) {
+	jwks := &JWKS{Keys: []*JWK{}}
+	for _, crt := range crts {
+		jwk, err := crt.JWK()
+		if err != nil {
+			return nil, err
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return json.MarshalIndent(jwks, "", "  ")
+}
+
+// ExportPublicJWK exports JSON-format JWK of the public key
+func (k *Key) ExportPublicJWK() ([]byte, error) {
+	jwk, err := NewPublicJWK(k.Public)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(jwk, "", "  ")
+}
+
+// ExportPrivateJWK exports JSON-format JWK of the private key
+func (k *Key) ExportPrivateJWK() ([]byte, error) {
+	jwk, err := NewPublicJWK(k.Public)
+	if err != nil {
+		return nil, err
+	}
+	switch priv := k.Private.(type) {
+	case *rsa.PrivateKey:
+		if len(priv.Primes) != 2 {
+			return nil, errors.New("unsupported multi-prime RSA key")
+		}
+		priv.Precompute()
+		jwk.D = b64(priv.D.Bytes())
+		jwk.P = b64(priv.Primes[0].Bytes())
+		jwk.Q = b64(priv.Primes[1].Bytes())
+		jwk.Dp = b64(priv.Precomputed.Dp.Bytes())
+		jwk.Dq = b64(priv.Precomputed.Dq.Bytes())
+		jwk.Qi = b64(priv.Precomputed.Qinv.Bytes())
+	case *ecdsa.PrivateKey:
+		jwk.D = b64(priv.D.FillBytes(make([]byte, (priv.Curve.Params().BitSize+7)/8)))
+	case ed25519.PrivateKey:
+		jwk.D = b64(priv.Seed())
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", k.Private)
+	}
+	return json.MarshalIndent(jwk, "", "  ")
+}
+
+// NewKeyFromJWK inits Key from JSON-format JWK bytes. The private key is nil
+// if the JWK only holds a public key.
+func NewKeyFromJWK(data []byte) (*Key, error) {
+	var jwk JWK
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, err
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := b64Int(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64Int(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA public exponent")
+		}
+		pub := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		if jwk.D == "" {
+			return NewKey(pub, nil), nil
+		}
+		priv := &rsa.PrivateKey{PublicKey: *pub}
+		if priv.D, err = b64Int(jwk.D); err != nil {
+			return nil, err
+		}
+		p, err := b64Int(jwk.P)
+		if err != nil {
+			return nil, err
+		}
+		q, err := b64Int(jwk.Q)
+		if err != nil {
+			return nil, err
+		}
+		priv.Primes = []*big.Int{p, q}
+		if err := priv.Validate(); err != nil {
+			return nil, err
+		}
+		priv.Precompute()
+		return NewKeyFromSigner(priv), nil
+	case "EC":
+		curve, ok := jwkCurves[jwk.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := b64Int(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64Int(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("invalid EC public key")
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if jwk.D == "" {
+			return NewKey(pub, nil), nil
+		}
+		d, err := b64Int(jwk.D)
+		if err != nil {
+			return nil, err
+		}
+		priv := &ecdsa.PrivateKey{PublicKey: *pub, D: d}
+		if px, py := curve.ScalarBaseMult(d.Bytes()); px.Cmp(x) != 0 || py.Cmp(y) != 0 {
+			return nil, errors.New("EC private key does not match public key")
+		}
+		return NewKeyFromSigner(priv), nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		if jwk.D == "" {
+			return NewKey(ed25519.PublicKey(x), nil), nil
+		}
+		seed, err := base64.RawURLEncoding.DecodeString(jwk.D)
+		if err != nil {
+			return nil, err
+		}
+		if len(seed) != ed25519.SeedSize {
+			return nil, errors.New("invalid Ed25519 private key")
+		}
+		priv := ed25519.NewKeyFromSeed(seed)
+		if !priv.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(x)) {
+			return nil, errors.New("Ed25519 private key does not match public key")
+		}
+		return NewKeyFromSigner(priv), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func b64Int(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("missing JWK member")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
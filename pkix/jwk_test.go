@@ -0,0 +1,102 @@
+package pkix
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestJWKThumbprint(t *testing.T) {
+	// Example from RFC 7638 section 3.1
+	jwk := &JWK{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatal("Failed computing thumbprint:", err)
+	}
+	if thumbprint != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Fatalf("Unexpected thumbprint %s", thumbprint)
+	}
+}
+
+func TestJWKExportImport(t *testing.T) {
+	rsaKey, err := CreateRSAKey(1024)
+	if err != nil {
+		t.Fatal("Failed creating rsa key:", err)
+	}
+	ecKey, err := CreateECDSAKey(elliptic.P384())
+	if err != nil {
+		t.Fatal("Failed creating ecdsa key:", err)
+	}
+	edKey, err := CreateEd25519Key()
+	if err != nil {
+		t.Fatal("Failed creating ed25519 key:", err)
+	}
+
+	for _, key := range []*Key{rsaKey, ecKey, edKey} {
+		privJWK, err := key.ExportPrivateJWK()
+		if err != nil {
+			t.Fatal("Failed exporting private JWK:", err)
+		}
+		priv, err := NewKeyFromJWK(privJWK)
+		if err != nil {
+			t.Fatal("Failed importing private JWK:", err)
+		}
+		before, _ := key.ExportPrivateDER()
+		after, _ := priv.ExportPrivateDER()
+		if !bytes.Equal(before, after) {
+			t.Fatalf("Private key changed after JWK round trip for %T", key.Private)
+		}
+
+		pubJWK, err := key.ExportPublicJWK()
+		if err != nil {
+			t.Fatal("Failed exporting public JWK:", err)
+		}
+		pub, err := NewKeyFromJWK(pubJWK)
+		if err != nil {
+			t.Fatal("Failed importing public JWK:", err)
+		}
+		if pub.Private != nil {
+			t.Fatal("Expect no private key from public JWK")
+		}
+		beforeID, _ := GenerateSubjectKeyID(key.Public)
+		afterID, _ := GenerateSubjectKeyID(pub.Public)
+		if !bytes.Equal(beforeID, afterID) {
+			t.Fatalf("Public key changed after JWK round trip for %T", key.Public)
+		}
+	}
+}
+
+func TestCertificateJWKS(t *testing.T) {
+	key, err := CreateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal("Failed creating ecdsa key:", err)
+	}
+	crt, err := CreateCertificateAuthority(key, "OU", time.Now().AddDate(1, 0, 0), "test", "US", "California", "San Francisco", "CA Name", nil)
+	if err != nil {
+		t.Fatal("Failed creating certificate authority:", err)
+	}
+
+	data, err := ExportCertificatesJWKS([]*Certificate{crt})
+	if err != nil {
+		t.Fatal("Failed exporting JWKS:", err)
+	}
+	var jwks JWKS
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		t.Fatal("Failed parsing JWKS:", err)
+	}
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kty != "EC" || jwks.Keys[0].Crv != "P-256" || jwks.Keys[0].Kid == "" {
+		t.Fatalf("Unexpected JWKS: %s", data)
+	}
+	if len(jwks.Keys[0].X5c) != 1 {
+		t.Fatalf("Expect certificate in x5c: %s", data)
+	}
+	if jwks.Keys[0].D != "" {
+		t.Fatal("Expect no private key material in JWKS")
+	}
+}
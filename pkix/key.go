@@ -22,7 +22,6 @@ import (
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/x509"
@@ -43,7 +42,7 @@ const (
 
 // CreateRSAKey creates a new Key using RSA algorithm
 func CreateRSAKey(rsaBits int) (*Key, error) {
-	priv, err := rsa.GenerateKey(rand.Reader, rsaBits)
+	priv, err := rsa.GenerateKey(random, rsaBits)
 	if err != nil {
 		return nil, err
 	}
@@ -53,7 +52,7 @@ func CreateRSAKey(rsaBits int) (*Key, error) {
 
 // CreateECDSAKey creates a new ECDSA key on the given curve
 func CreateECDSAKey(c elliptic.Curve) (*Key, error) {
-	priv, err := ecdsa.GenerateKey(c, rand.Reader)
+	priv, err := ecdsa.GenerateKey(c, random)
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +62,7 @@ func CreateECDSAKey(c elliptic.Curve) (*Key, error) {
 
 // CreateEd25519Key creates a new Ed25519 key
 func CreateEd25519Key() (*Key, error) {
-	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	_, priv, err := ed25519.GenerateKey(random)
 	if err != nil {
 		return nil, err
 	}
@@ -147,8 +146,32 @@ func NewKeyFromEncryptedPrivateKeyPEM(data []byte, password []byte) (*Key, error
 	return NewKeyFromSigner(signer), nil
 }
 
+// NewKeyFromPrivateKeyDER inits Key from DER-format private key bytes,
+// which may be PKCS#8, PKCS#1 or SEC 1 encoded
+func NewKeyFromPrivateKeyDER(data []byte) (*Key, error) {
+	if priv, err := x509.ParsePKCS8PrivateKey(data); err == nil {
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %T", priv)
+		}
+		return NewKeyFromSigner(signer), nil
+	}
+	if priv, err := x509.ParsePKCS1PrivateKey(data); err == nil {
+		return NewKeyFromSigner(priv), nil
+	}
+	if priv, err := x509.ParseECPrivateKey(data); err == nil {
+		return NewKeyFromSigner(priv), nil
+	}
+	return nil, errors.New("unrecognized DER private key format")
+}
+
+// ExportPrivateDER exports DER-format PKCS#8 private key
+func (k *Key) ExportPrivateDER() ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(k.Private)
+}
+
 // ExportPrivate exports PEM-format private key. RSA keys are exported
-// as PKCS#1, ECDSA and Ed25519 keys are exported as PKCS#8.
+// as PKCS#1, other keys such as ECDSA, Ed25519 and ML-DSA keys as PKCS#8.
 func (k *Key) ExportPrivate() ([]byte, error) {
 	var privPEMBlock *pem.Block
 	switch priv := k.Private.(type) {
@@ -158,17 +181,15 @@ func (k *Key) ExportPrivate() ([]byte, error) {
 			Type:  rsaPrivateKeyPEMBlockType,
 			Bytes: privBytes,
 		}
-	case *ecdsa.PrivateKey, ed25519.PrivateKey:
+	default:
 		privBytes, err := x509.MarshalPKCS8PrivateKey(priv)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("unsupported key type %T", k.Private)
 		}
 		privPEMBlock = &pem.Block{
 			Type:  pkcs8PrivateKeyPEMBlockType,
 			Bytes: privBytes,
 		}
-	default:
-		return nil, fmt.Errorf("unsupported key type %T", k.Private)
 	}
 
 	return pem.EncodeToMemory(privPEMBlock), nil
@@ -180,23 +201,21 @@ func (k *Key) ExportEncryptedPrivate(password []byte) ([]byte, error) {
 	switch priv := k.Private.(type) {
 	case *rsa.PrivateKey:
 		privBytes := x509.MarshalPKCS1PrivateKey(priv)
-		block, err := x509.EncryptPEMBlock(rand.Reader, rsaPrivateKeyPEMBlockType, privBytes, password, x509.PEMCipher3DES)
+		block, err := x509.EncryptPEMBlock(random, rsaPrivateKeyPEMBlockType, privBytes, password, x509.PEMCipher3DES)
 		if err != nil {
 			return nil, err
 		}
 		privPEMBlock = block
-	case *ecdsa.PrivateKey, ed25519.PrivateKey:
+	default:
 		privBytes, err := x509.MarshalPKCS8PrivateKey(priv)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("unsupported key type %T", k.Private)
 		}
-		block, err := pemutil.EncryptPKCS8PrivateKey(rand.Reader, privBytes, password, x509.PEMCipherAES256)
+		block, err := pemutil.EncryptPKCS8PrivateKey(random, privBytes, password, x509.PEMCipherAES256)
 		if err != nil {
 			return nil, err
 		}
 		privPEMBlock = block
-	default:
-		return nil, fmt.Errorf("unsupported key type %T", k.Private)
 	}
 
 	return pem.EncodeToMemory(privPEMBlock), nil
@@ -227,7 +246,19 @@ func GenerateSubjectKeyID(pub crypto.PublicKey) ([]byte, error) {
 	case ed25519.PublicKey:
 		pubBytes = pub
 	default:
-		return nil, fmt.Errorf("unsupported key type %T", pub)
+		// The subjectPublicKey of other keys, such as ML-DSA keys, as crypto/x509 encodes it
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported key type %T", pub)
+		}
+		var spki struct {
+			Algorithm asn1.RawValue
+			PublicKey asn1.BitString
+		}
+		if _, err := asn1.Unmarshal(der, &spki); err != nil {
+			return nil, err
+		}
+		pubBytes = spki.PublicKey.Bytes
 	}
 
 	hash := sha1.Sum(pubBytes)
@@ -25,6 +25,7 @@ import (
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/pem"
 	"testing"
 )
 
@@ -420,3 +421,43 @@ func TestEncryptedECCImportExport(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyExportImportDER(t *testing.T) {
+	rsaKey, err := NewKeyFromPrivateKeyPEM([]byte(rsaPrivKeyAuthPEM))
+	if err != nil {
+		t.Fatal("Failed parsing RSA key from PEM:", err)
+	}
+	ecKey, err := NewKeyFromPrivateKeyPEM([]byte(p256PrivKeyPEM))
+	if err != nil {
+		t.Fatal("Failed parsing ECDSA key from PEM:", err)
+	}
+	edKey, err := NewKeyFromPrivateKeyPEM([]byte(ed25519PrivKeyPEM))
+	if err != nil {
+		t.Fatal("Failed parsing Ed25519 key from PEM:", err)
+	}
+
+	for _, key := range []*Key{rsaKey, ecKey, edKey} {
+		der, err := key.ExportPrivateDER()
+		if err != nil {
+			t.Fatalf("ExportPrivateDER failed for %T: %v", key.Private, err)
+		}
+		key2, err := NewKeyFromPrivateKeyDER(der)
+		if err != nil {
+			t.Fatalf("NewKeyFromPrivateKeyDER failed for %T: %v", key.Private, err)
+		}
+		pem1, _ := key.ExportPrivate()
+		pem2, _ := key2.ExportPrivate()
+		if !bytes.Equal(pem1, pem2) {
+			t.Fatalf("Key changed after DER round trip for %T", key.Private)
+		}
+	}
+
+	// PKCS#1 DER as produced by other tools
+	pemBlock, _ := pem.Decode([]byte(rsaPrivKeyAuthPEM))
+	if _, err := NewKeyFromPrivateKeyDER(pemBlock.Bytes); err != nil {
+		t.Fatal("Failed parsing PKCS#1 DER:", err)
+	}
+	if _, err := NewKeyFromPrivateKeyDER([]byte("garbage")); err == nil {
+		t.Fatal("Expect error parsing garbage DER")
+	}
+}
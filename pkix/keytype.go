@@ -0,0 +1,146 @@
+package pkix
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Limits on the size of RSA keys: smaller keys cannot be created at all, and keys smaller
+// than minStrongRSABits are weak
+const (
+	minRSABits       = 1024
+	minStrongRSABits = 2048
+)
+
+// KeyType is a type of key, written as rsa:BITS, ec:CURVE, ed25519 or, when built with
+// Go 1.27 or later, mldsa:44, mldsa:65 or mldsa:87
+type KeyType struct {
+	name   string
+	create func() (*Key, error)
+	weak   bool
+}
+
+// String returns the name of the key type, as accepted by ParseKeyType
+func (t *KeyType) String() string {
+	return t.name
+}
+
+// Weak reports whether keys of the type are too weak to be used without good reason,
+// such as RSA keys below 2048 bits or P-224 keys
+func (t *KeyType) Weak() bool {
+	return t.weak
+}
+
+// Create creates a new key of the type
+func (t *KeyType) Create() (*Key, error) {
+	return t.create()
+}
+
+// namedKeyType is a key type that has no size to choose
+type namedKeyType struct {
+	KeyType
+	// curve is the name of the key type for --curve
+	curve string
+	// matches reports whether a public key is of the type
+	matches func(pub crypto.PublicKey) bool
+}
+
+// namedKeyTypes are the key types besides RSA, in the order they are listed
+var namedKeyTypes = []*namedKeyType{
+	ecKeyType(elliptic.P224(), true),
+	ecKeyType(elliptic.P256(), false),
+	ecKeyType(elliptic.P384(), false),
+	ecKeyType(elliptic.P521(), false),
+	{
+		KeyType: KeyType{name: "ed25519", create: CreateEd25519Key},
+		curve:   "Ed25519",
+		matches: func(pub crypto.PublicKey) bool {
+			_, ok := pub.(ed25519.PublicKey)
+			return ok
+		},
+	},
+}
+
+func ecKeyType(curve elliptic.Curve, weak bool) *namedKeyType {
+	name := curve.Params().Name
+	return &namedKeyType{
+		KeyType: KeyType{
+			name:   "ec:" + name,
+			create: func() (*Key, error) { return CreateECDSAKey(curve) },
+			weak:   weak,
+		},
+		curve: name,
+		matches: func(pub crypto.PublicKey) bool {
+			ecPub, ok := pub.(*ecdsa.PublicKey)
+			return ok && ecPub.Curve == curve
+		},
+	}
+}
+
+func rsaKeyType(bits int) *KeyType {
+	return &KeyType{
+		name:   fmt.Sprintf("rsa:%d", bits),
+		create: func() (*Key, error) { return CreateRSAKey(bits) },
+		weak:   bits < minStrongRSABits,
+	}
+}
+
+// KeyTypes returns the names of the key types, with rsa:BITS for RSA keys of any size
+func KeyTypes() []string {
+	names := []string{"rsa:BITS"}
+	for _, t := range namedKeyTypes {
+		names = append(names, t.name)
+	}
+	return names
+}
+
+// Curves returns the names of the key types other than RSA as given to --curve, such
+// as P-256 for ec:P-256
+func Curves() []string {
+	var names []string
+	for _, t := range namedKeyTypes {
+		names = append(names, t.curve)
+	}
+	return names
+}
+
+// ParseKeyType returns the key type named name as returned by KeyTypes, or by Curves.
+// Names are compared case-insensitively.
+func ParseKeyType(name string) (*KeyType, error) {
+	if strings.HasPrefix(strings.ToLower(name), "rsa:") {
+		bits := name[len("rsa:"):]
+		n, err := strconv.Atoi(bits)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA key size %q", bits)
+		}
+		if n < minRSABits {
+			return nil, fmt.Errorf("RSA keys must have at least %d bits", minRSABits)
+		}
+		return rsaKeyType(n), nil
+	}
+	for _, t := range namedKeyTypes {
+		if strings.EqualFold(name, t.name) || strings.EqualFold(name, t.curve) {
+			return &t.KeyType, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key type %q, must be one of %s", name, strings.Join(KeyTypes(), ", "))
+}
+
+// KeyTypeOf returns the type of a public key, such as the key of a certificate request
+func KeyTypeOf(pub crypto.PublicKey) (*KeyType, error) {
+	if pub, ok := pub.(*rsa.PublicKey); ok {
+		return rsaKeyType(pub.N.BitLen()), nil
+	}
+	for _, t := range namedKeyTypes {
+		if t.matches(pub) {
+			return &t.KeyType, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported key type %T", pub)
+}
@@ -0,0 +1,58 @@
+package pkix
+
+import (
+	"testing"
+)
+
+func TestParseKeyType(t *testing.T) {
+	for name, want := range map[string]struct {
+		keyType string
+		weak    bool
+	}{
+		"rsa:3072": {"rsa:3072", false},
+		"RSA:1024": {"rsa:1024", true},
+		"ec:P-384": {"ec:P-384", false},
+		"EC:p-256": {"ec:P-256", false},
+		"P-521":    {"ec:P-521", false},
+		"P-224":    {"ec:P-224", true},
+		"ed25519":  {"ed25519", false},
+		"Ed25519":  {"ed25519", false},
+	} {
+		keyType, err := ParseKeyType(name)
+		if err != nil {
+			t.Errorf("ParseKeyType(%q) failed: %v", name, err)
+			continue
+		}
+		if keyType.String() != want.keyType || keyType.Weak() != want.weak {
+			t.Errorf("ParseKeyType(%q) = %v (weak %v), want %v (weak %v)", name, keyType, keyType.Weak(), want.keyType, want.weak)
+		}
+	}
+	for _, name := range []string{"", "rsa", "rsa:", "rsa:abc", "rsa:512", "ec:P-192", "ec", "dsa:1024"} {
+		if _, err := ParseKeyType(name); err == nil {
+			t.Errorf("Expect ParseKeyType(%q) to fail", name)
+		}
+	}
+}
+
+func TestKeyTypeOf(t *testing.T) {
+	for _, name := range []string{"rsa:1024", "ec:P-224", "ec:P-256", "ed25519"} {
+		keyType, err := ParseKeyType(name)
+		if err != nil {
+			t.Fatal("Failed parsing key type:", err)
+		}
+		key, err := keyType.Create()
+		if err != nil {
+			t.Fatalf("Failed creating %s key: %v", name, err)
+		}
+		got, err := KeyTypeOf(key.Public)
+		if err != nil {
+			t.Fatalf("KeyTypeOf %s key failed: %v", name, err)
+		}
+		if got.String() != name || got.Weak() != keyType.Weak() {
+			t.Fatalf("KeyTypeOf %s key = %v", name, got)
+		}
+	}
+	if _, err := KeyTypeOf("not a key"); err == nil {
+		t.Fatal("Expect KeyTypeOf to fail for an unsupported key")
+	}
+}
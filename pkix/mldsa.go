@@ -0,0 +1,58 @@
+//go:build go1.27
+// +build go1.27
+
+package pkix
+
+import (
+	"crypto"
+	"crypto/mldsa"
+	"crypto/x509"
+)
+
+// ML-DSA (FIPS 204) is only in the standard library from Go 1.27. crypto/x509 encodes its
+// keys as PKCS#8 and signs and verifies certificates and requests with them.
+
+func init() {
+	signatureAlgorithms = append(signatureAlgorithms,
+		signatureAlgorithm{x509.MLDSA44, x509.MLDSA, 0, false, false},
+		signatureAlgorithm{x509.MLDSA65, x509.MLDSA, 0, false, false},
+		signatureAlgorithm{x509.MLDSA87, x509.MLDSA, 0, false, false},
+	)
+	namedKeyTypes = append(namedKeyTypes,
+		mldsaKeyType("44", mldsa.MLDSA44()),
+		mldsaKeyType("65", mldsa.MLDSA65()),
+		mldsaKeyType("87", mldsa.MLDSA87()),
+	)
+}
+
+func mldsaKeyType(level string, params mldsa.Parameters) *namedKeyType {
+	return &namedKeyType{
+		KeyType: KeyType{
+			name:   "mldsa:" + level,
+			create: func() (*Key, error) { return CreateMLDSAKey(params) },
+		},
+		curve: "ML-DSA-" + level,
+		matches: func(pub crypto.PublicKey) bool {
+			mldsaPub, ok := pub.(*mldsa.PublicKey)
+			return ok && mldsaPub.Parameters() == params
+		},
+	}
+}
+
+// CreateMLDSAKey creates a new ML-DSA key with the given parameter set. ML-DSA support
+// is experimental, few other implementations accept its certificates yet.
+func CreateMLDSAKey(params mldsa.Parameters) (*Key, error) {
+	priv, err := mldsa.GenerateKey(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKey(priv.Public(), priv), nil
+}
+
+func mldsaPublicKeyAlgorithm(pub crypto.PublicKey) x509.PublicKeyAlgorithm {
+	if _, ok := pub.(*mldsa.PublicKey); ok {
+		return x509.MLDSA
+	}
+	return x509.UnknownPublicKeyAlgorithm
+}
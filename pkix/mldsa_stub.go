@@ -0,0 +1,13 @@
+//go:build !go1.27
+// +build !go1.27
+
+package pkix
+
+import (
+	"crypto"
+	"crypto/x509"
+)
+
+func mldsaPublicKeyAlgorithm(pub crypto.PublicKey) x509.PublicKeyAlgorithm {
+	return x509.UnknownPublicKeyAlgorithm
+}
@@ -0,0 +1,76 @@
+//go:build go1.27
+// +build go1.27
+
+package pkix
+
+import (
+	"crypto/mldsa"
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestMLDSA(t *testing.T) {
+	caKey, err := CreateMLDSAKey(mldsa.MLDSA65())
+	if err != nil {
+		t.Fatal("Failed creating ML-DSA key:", err)
+	}
+	key, err := CreateMLDSAKey(mldsa.MLDSA44())
+	if err != nil {
+		t.Fatal("Failed creating ML-DSA key:", err)
+	}
+
+	pemBytes, err := caKey.ExportPrivate()
+	if err != nil {
+		t.Fatal("Failed exporting PEM-format bytes:", err)
+	}
+	if _, err := NewKeyFromPrivateKeyPEM(pemBytes); err != nil {
+		t.Fatal("Failed parsing exported key:", err)
+	}
+	pemBytes, err = caKey.ExportEncryptedPrivate([]byte("password"))
+	if err != nil {
+		t.Fatal("Failed exporting encrypted PEM-format bytes:", err)
+	}
+	if _, err := NewKeyFromEncryptedPrivateKeyPEM(pemBytes, []byte("password")); err != nil {
+		t.Fatal("Failed parsing exported encrypted key:", err)
+	}
+
+	ca, err := CreateCertificateAuthority(caKey, "", time.Now().Add(time.Hour), "", "", "", "", "CA", nil)
+	if err != nil {
+		t.Fatal("Failed creating CA:", err)
+	}
+	csr, err := CreateCertificateSigningRequest(key, "", nil, []string{"host"}, nil, "", "", "", "", "host")
+	if err != nil {
+		t.Fatal("Failed creating certificate request:", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Fatal("Failed checking signature:", err)
+	}
+	crt, err := CreateCertificateHost(ca, caKey, csr, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal("Failed creating certificate:", err)
+	}
+
+	rawCa, err := ca.GetRawCertificate()
+	if err != nil {
+		t.Fatal("Failed getting raw certificate:", err)
+	}
+	rawCrt, err := crt.GetRawCertificate()
+	if err != nil {
+		t.Fatal("Failed getting raw certificate:", err)
+	}
+	if rawCrt.SignatureAlgorithm != x509.MLDSA65 || rawCrt.PublicKeyAlgorithm != x509.MLDSA {
+		t.Fatalf("Expect an ML-DSA certificate signed with ML-DSA-65, got %v, %v", rawCrt.PublicKeyAlgorithm, rawCrt.SignatureAlgorithm)
+	}
+	if err := rawCrt.CheckSignatureFrom(rawCa); err != nil {
+		t.Fatal("Failed verifying certificate:", err)
+	}
+
+	// An ML-DSA key signs with its own parameter set only
+	if err := CheckSignatureAlgorithm(key, x509.SHA256WithRSA); err == nil {
+		t.Fatal("Expect an RSA signature algorithm not to be allowed with an ML-DSA key")
+	}
+	if _, err := CreateCertificateHost(ca, caKey, csr, time.Now().Add(time.Hour), WithSignatureAlgorithmOption(x509.MLDSA87)); err == nil {
+		t.Fatal("Expect ML-DSA-87 not to sign with an ML-DSA-65 key")
+	}
+}
@@ -0,0 +1,64 @@
+package pkix
+
+import (
+	"encoding/pem"
+	"errors"
+
+	"github.com/square/certstrap/pkcs7"
+)
+
+const (
+	pkcs7PEMBlockType = "PKCS7"
+)
+
+// ExportCertificatesPKCS7 returns DER-format PKCS#7 bytes holding the given certificates,
+// as used by .p7b files
+func ExportCertificatesPKCS7(crts []*Certificate) ([]byte, error) {
+	certs := make([][]byte, len(crts))
+	for i, crt := range crts {
+		certs[i] = crt.derBytes
+	}
+	return pkcs7.Degenerate(certs, nil)
+}
+
+// NewCertificatesFromPKCS7 inits the certificates held in PKCS#7 bytes,
+// which may be either DER or PEM formatted
+func NewCertificatesFromPKCS7(data []byte) ([]*Certificate, error) {
+	sd, err := parsePKCS7(data)
+	if err != nil {
+		return nil, err
+	}
+	crts := make([]*Certificate, len(sd.Certificates))
+	for i, der := range sd.Certificates {
+		crts[i] = NewCertificateFromDER(der)
+	}
+	return crts, nil
+}
+
+// ExportPKCS7 returns DER-format PKCS#7 bytes holding the CRL
+func (c *CertificateRevocationList) ExportPKCS7() ([]byte, error) {
+	return pkcs7.Degenerate(nil, [][]byte{c.derBytes})
+}
+
+// NewCertificateRevocationListFromPKCS7 inits CertificateRevocationList from PKCS#7 bytes,
+// which may be either DER or PEM formatted and should contain exactly one CRL
+func NewCertificateRevocationListFromPKCS7(data []byte) (*CertificateRevocationList, error) {
+	sd, err := parsePKCS7(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(sd.CRLs) != 1 {
+		return nil, errors.New("expected exactly one CRL in PKCS#7 data")
+	}
+	return NewCertificateRevocationListFromDER(sd.CRLs[0]), nil
+}
+
+func parsePKCS7(data []byte) (*pkcs7.SignedData, error) {
+	if pemBlock, _ := pem.Decode(data); pemBlock != nil {
+		if pemBlock.Type != pkcs7PEMBlockType {
+			return nil, errors.New("unmatched type or headers")
+		}
+		data = pemBlock.Bytes
+	}
+	return pkcs7.ParseSignedData(data)
+}
@@ -0,0 +1,55 @@
+package pkix
+
+import (
+	"bytes"
+	"encoding/pem"
+	"testing"
+)
+
+func TestCertificatesPKCS7(t *testing.T) {
+	crt, err := NewCertificateFromPEM([]byte(certAuthPEM))
+	if err != nil {
+		t.Fatal("Failed parsing certificate from PEM:", err)
+	}
+	host, err := NewCertificateFromPEM([]byte(certHostPEM))
+	if err != nil {
+		t.Fatal("Failed parsing certificate from PEM:", err)
+	}
+
+	der, err := ExportCertificatesPKCS7([]*Certificate{host, crt})
+	if err != nil {
+		t.Fatal("Failed exporting PKCS#7:", err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: pkcs7PEMBlockType, Bytes: der})
+	for _, data := range [][]byte{der, pemBytes} {
+		crts, err := NewCertificatesFromPKCS7(data)
+		if err != nil {
+			t.Fatal("Failed parsing PKCS#7:", err)
+		}
+		if len(crts) != 2 || !bytes.Equal(crts[0].DERBytes(), host.DERBytes()) || !bytes.Equal(crts[1].DERBytes(), crt.DERBytes()) {
+			t.Fatal("Failed getting the same certificates back from PKCS#7")
+		}
+	}
+
+	if _, err := NewCertificatesFromPKCS7([]byte(certAuthPEM)); err == nil {
+		t.Fatal("Expect error parsing PKCS#7 from certificate PEM")
+	}
+}
+
+func TestCertificateRevocationListPKCS7(t *testing.T) {
+	crl, err := NewCertificateRevocationListFromPEM([]byte(crlPEM))
+	if err != nil {
+		t.Fatal("Failed parsing CRL from PEM:", err)
+	}
+	der, err := crl.ExportPKCS7()
+	if err != nil {
+		t.Fatal("Failed exporting PKCS#7:", err)
+	}
+	crl2, err := NewCertificateRevocationListFromPKCS7(der)
+	if err != nil {
+		t.Fatal("Failed parsing PKCS#7:", err)
+	}
+	if !bytes.Equal(crl.DERBytes(), crl2.DERBytes()) {
+		t.Fatal("Failed getting the same CRL back from PKCS#7")
+	}
+}
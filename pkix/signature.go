@@ -0,0 +1,102 @@
+package pkix
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// signatureAlgorithm describes how a signature algorithm signs and what key it needs
+type signatureAlgorithm struct {
+	algo       x509.SignatureAlgorithm
+	pubKeyAlgo x509.PublicKeyAlgorithm
+	// hash is the digest that is signed, 0 if the message is signed as is
+	hash crypto.Hash
+	pss  bool
+	// verifyOnly algorithms are accepted on requests but never used to sign
+	verifyOnly bool
+}
+
+// signatureAlgorithms are the signature algorithms of crypto/x509, except those with MD5,
+// which no longer verifies, and DSA, which it cannot sign or verify
+var signatureAlgorithms = []signatureAlgorithm{
+	{x509.SHA1WithRSA, x509.RSA, crypto.SHA1, false, true},
+	{x509.SHA256WithRSA, x509.RSA, crypto.SHA256, false, false},
+	{x509.SHA384WithRSA, x509.RSA, crypto.SHA384, false, false},
+	{x509.SHA512WithRSA, x509.RSA, crypto.SHA512, false, false},
+	{x509.SHA256WithRSAPSS, x509.RSA, crypto.SHA256, true, false},
+	{x509.SHA384WithRSAPSS, x509.RSA, crypto.SHA384, true, false},
+	{x509.SHA512WithRSAPSS, x509.RSA, crypto.SHA512, true, false},
+	{x509.ECDSAWithSHA1, x509.ECDSA, crypto.SHA1, false, true},
+	{x509.ECDSAWithSHA256, x509.ECDSA, crypto.SHA256, false, false},
+	{x509.ECDSAWithSHA384, x509.ECDSA, crypto.SHA384, false, false},
+	{x509.ECDSAWithSHA512, x509.ECDSA, crypto.SHA512, false, false},
+	{x509.PureEd25519, x509.Ed25519, 0, false, false},
+}
+
+func lookupSignatureAlgorithm(algo x509.SignatureAlgorithm) (signatureAlgorithm, bool) {
+	for _, details := range signatureAlgorithms {
+		if details.algo == algo {
+			return details, true
+		}
+	}
+	return signatureAlgorithm{}, false
+}
+
+// SignatureAlgorithms returns the names of the algorithms certificates and requests can be signed with
+func SignatureAlgorithms() []string {
+	var names []string
+	for _, details := range signatureAlgorithms {
+		if !details.verifyOnly {
+			names = append(names, details.algo.String())
+		}
+	}
+	return names
+}
+
+// ParseSignatureAlgorithm returns the signature algorithm with the given name, as returned
+// by SignatureAlgorithms and compared case-insensitively
+func ParseSignatureAlgorithm(name string) (x509.SignatureAlgorithm, error) {
+	for _, details := range signatureAlgorithms {
+		if !details.verifyOnly && strings.EqualFold(details.algo.String(), name) {
+			return details.algo, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unknown signature algorithm %q, must be one of %s", name, strings.Join(SignatureAlgorithms(), ", "))
+}
+
+// CheckSignatureAlgorithm checks that key can sign with algo. Any key can sign with
+// x509.UnknownSignatureAlgorithm, which picks the default algorithm of the key.
+func CheckSignatureAlgorithm(key *Key, algo x509.SignatureAlgorithm) error {
+	if algo == x509.UnknownSignatureAlgorithm {
+		return nil
+	}
+	details, ok := lookupSignatureAlgorithm(algo)
+	if !ok || details.verifyOnly {
+		return fmt.Errorf("cannot sign with %v", algo)
+	}
+	if pubKeyAlgo := publicKeyAlgorithm(key.Public); pubKeyAlgo != details.pubKeyAlgo {
+		return fmt.Errorf("signature algorithm %v requires an %v key, not %v", algo, details.pubKeyAlgo, pubKeyAlgo)
+	}
+	return nil
+}
+
+// WithSignatureAlgorithmOption signs a certificate with algo instead of the default
+// algorithm of the signing key
+func WithSignatureAlgorithmOption(algo x509.SignatureAlgorithm) Option {
+	return func(template *x509.Certificate) {
+		template.SignatureAlgorithm = algo
+	}
+}
+
+// CSROption customizes a certificate request before it is signed
+type CSROption func(*x509.CertificateRequest)
+
+// WithCSRSignatureAlgorithmOption signs a certificate request with algo instead of the
+// default algorithm of the key
+func WithCSRSignatureAlgorithmOption(algo x509.SignatureAlgorithm) CSROption {
+	return func(template *x509.CertificateRequest) {
+		template.SignatureAlgorithm = algo
+	}
+}
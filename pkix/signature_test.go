@@ -0,0 +1,88 @@
+package pkix
+
+import (
+	"crypto/elliptic"
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestParseSignatureAlgorithm(t *testing.T) {
+	for name, want := range map[string]x509.SignatureAlgorithm{
+		"SHA256-RSA":    x509.SHA256WithRSA,
+		"sha384-rsapss": x509.SHA384WithRSAPSS,
+		"ECDSA-SHA512":  x509.ECDSAWithSHA512,
+		"ed25519":       x509.PureEd25519,
+	} {
+		if algo, err := ParseSignatureAlgorithm(name); err != nil || algo != want {
+			t.Errorf("ParseSignatureAlgorithm(%q) = %v, %v, want %v", name, algo, err, want)
+		}
+	}
+	for _, name := range []string{"", "SHA1-RSA", "MD5-RSA", "ECDSA-SHA1", "RSA"} {
+		if _, err := ParseSignatureAlgorithm(name); err == nil {
+			t.Errorf("Expect ParseSignatureAlgorithm(%q) to fail", name)
+		}
+	}
+}
+
+func TestCheckSignatureAlgorithm(t *testing.T) {
+	rsaKey, err := CreateRSAKey(1024)
+	if err != nil {
+		t.Fatal("Failed creating RSA key:", err)
+	}
+	ecKey, err := CreateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal("Failed creating ECDSA key:", err)
+	}
+
+	if err := CheckSignatureAlgorithm(rsaKey, x509.UnknownSignatureAlgorithm); err != nil {
+		t.Fatal("Expect the default algorithm to be allowed:", err)
+	}
+	if err := CheckSignatureAlgorithm(rsaKey, x509.SHA512WithRSAPSS); err != nil {
+		t.Fatal("Expect RSA-PSS with an RSA key to be allowed:", err)
+	}
+	if err := CheckSignatureAlgorithm(ecKey, x509.SHA256WithRSAPSS); err == nil {
+		t.Fatal("Expect RSA-PSS with an ECDSA key not to be allowed")
+	}
+	if err := CheckSignatureAlgorithm(rsaKey, x509.SHA1WithRSA); err == nil {
+		t.Fatal("Expect SHA-1 not to be allowed for signing")
+	}
+}
+
+func TestCertificateSignatureAlgorithm(t *testing.T) {
+	key, err := CreateRSAKey(2048)
+	if err != nil {
+		t.Fatal("Failed creating RSA key:", err)
+	}
+	ca, err := CreateCertificateAuthorityWithOptions(key, "", time.Now().Add(time.Hour), "", "", "", "", "CA", nil,
+		WithSignatureAlgorithmOption(x509.SHA384WithRSAPSS))
+	if err != nil {
+		t.Fatal("Failed creating CA:", err)
+	}
+	rawCa, err := ca.GetRawCertificate()
+	if err != nil {
+		t.Fatal("Failed getting raw certificate:", err)
+	}
+	if rawCa.SignatureAlgorithm != x509.SHA384WithRSAPSS {
+		t.Fatalf("Expect CA signed with SHA384-RSAPSS, got %v", rawCa.SignatureAlgorithm)
+	}
+
+	csr, err := CreateCertificateSigningRequest(key, "", nil, []string{"host"}, nil, "", "", "", "", "host")
+	if err != nil {
+		t.Fatal("Failed creating certificate request:", err)
+	}
+	crt, err := CreateCertificateHost(ca, key, csr, time.Now().Add(time.Hour), WithSignatureAlgorithmOption(x509.SHA512WithRSAPSS))
+	if err != nil {
+		t.Fatal("Failed creating certificate:", err)
+	}
+	rawCrt, err := crt.GetRawCertificate()
+	if err != nil {
+		t.Fatal("Failed getting raw certificate:", err)
+	}
+	if rawCrt.SignatureAlgorithm != x509.SHA512WithRSAPSS {
+		t.Fatalf("Expect certificate signed with SHA512-RSAPSS, got %v", rawCrt.SignatureAlgorithm)
+	}
+	if err := rawCrt.CheckSignatureFrom(rawCa); err != nil {
+		t.Fatal("Failed verifying certificate:", err)
+	}
+}
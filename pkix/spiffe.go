@@ -0,0 +1,177 @@
+package pkix
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxSPIFFEIDLength is the maximum length of a SPIFFE ID in bytes
+const maxSPIFFEIDLength = 2048
+
+// ValidateSPIFFETrustDomain checks that td is a valid SPIFFE trust domain name
+func ValidateSPIFFETrustDomain(td string) error {
+	if td == "" {
+		return errors.New("trust domain is empty")
+	}
+	for _, c := range td {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return fmt.Errorf("trust domain %q has a character other than lowercase letters, digits, '.', '-' and '_'", td)
+		}
+	}
+	return nil
+}
+
+// ParseSPIFFEID parses and validates a SPIFFE ID such as spiffe://example.org/ns/web
+func ParseSPIFFEID(id string) (*url.URL, error) {
+	if len(id) > maxSPIFFEIDLength {
+		return nil, fmt.Errorf("SPIFFE ID is longer than %d bytes", maxSPIFFEIDLength)
+	}
+	rest := strings.TrimPrefix(id, "spiffe://")
+	if rest == id {
+		return nil, fmt.Errorf("SPIFFE ID %q does not start with spiffe://", id)
+	}
+	td, path := rest, ""
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		td, path = rest[:i], rest[i:]
+	}
+	if err := ValidateSPIFFETrustDomain(td); err != nil {
+		return nil, fmt.Errorf("invalid SPIFFE ID %q: %v", id, err)
+	}
+	if path != "" {
+		for _, segment := range strings.Split(path[1:], "/") {
+			if segment == "" || segment == "." || segment == ".." {
+				return nil, fmt.Errorf("invalid SPIFFE ID %q: path has an empty, '.' or '..' segment", id)
+			}
+			for _, c := range segment {
+				if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+					return nil, fmt.Errorf("invalid SPIFFE ID %q: path has a character other than letters, digits, '.', '-' and '_'", id)
+				}
+			}
+		}
+	}
+	return &url.URL{Scheme: "spiffe", Host: td, Path: path}, nil
+}
+
+// SPIFFEID returns the SPIFFE ID requested by an X509-SVID certificate request, which must
+// have exactly one URI subject alternative name holding a valid SPIFFE ID
+func (c *CertificateSigningRequest) SPIFFEID() (*url.URL, error) {
+	rawCsr, err := c.GetRawCertificateSigningRequest()
+	if err != nil {
+		return nil, err
+	}
+	if len(rawCsr.URIs) != 1 {
+		return nil, fmt.Errorf("an X509-SVID must have exactly one URI subject alternative name, the request has %d", len(rawCsr.URIs))
+	}
+	return ParseSPIFFEID(rawCsr.URIs[0].String())
+}
+
+// WithSPIFFETrustDomainOption adds a critical name constraint to a CA certificate permitting
+// only URIs in the SPIFFE trust domain td
+func WithSPIFFETrustDomainOption(td string) Option {
+	return func(template *x509.Certificate) {
+		template.PermittedURIDomains = append(template.PermittedURIDomains, td)
+		template.PermittedDNSDomainsCritical = true
+	}
+}
+
+// CreateCertificateSVID creates an X509-SVID leaf certificate as defined by the SPIFFE
+// X509-SVID specification. The request must have a valid SPIFFE ID as its only URI,
+// which is within the URI name constraints of the CA if it has any.
+func CreateCertificateSVID(crtAuth *Certificate, keyAuth *Key, csr *CertificateSigningRequest, proposedExpiry time.Time, opts ...Option) (*Certificate, error) {
+	id, err := csr.SPIFFEID()
+	if err != nil {
+		return nil, err
+	}
+	rawCrtAuth, err := crtAuth.GetRawCertificate()
+	if err != nil {
+		return nil, err
+	}
+	if len(rawCrtAuth.PermittedURIDomains) > 0 && !permitsURIDomain(rawCrtAuth.PermittedURIDomains, id.Host) {
+		return nil, fmt.Errorf("trust domain %q is not permitted by the CA, which is limited to %s", id.Host, strings.Join(rawCrtAuth.PermittedURIDomains, ", "))
+	}
+	rawCsr, err := csr.GetRawCertificateSigningRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		// The subject is copied as requested, SPIFFE does not rely on it
+		RawSubject: rawCsr.RawSubject,
+		// NotBefore is set to be 10min earlier to fix gap on time difference in cluster
+		NotBefore: clock().Add(-10 * time.Minute).UTC(),
+		NotAfter:  proposedExpiry,
+		// An X509-SVID leaf must have digitalSignature and must not have keyCertSign or cRLSign
+		KeyUsage:    svidKeyUsage(rawCsr.PublicKey),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		// and must have the cA field of its basic constraints set to false
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+		URIs:                  []*url.URL{id},
+		DNSNames:              rawCsr.DNSNames,
+		IPAddresses:           rawCsr.IPAddresses,
+	}
+	// ensure cert doesn't expire after issuer
+	if caExpiry := clock().Add(crtAuth.GetExpirationDuration()); caExpiry.Before(proposedExpiry) {
+		template.NotAfter = caExpiry
+	}
+	if template.SubjectKeyId, err = GenerateSubjectKeyID(rawCsr.PublicKey); err != nil {
+		return nil, err
+	}
+	applyOptions(&template, opts)
+
+	crtBytes, err := x509.CreateCertificate(random, &template, rawCrtAuth, rawCsr.PublicKey, keyAuth.Private)
+	if err != nil {
+		return nil, err
+	}
+	return NewCertificateFromDER(crtBytes), nil
+}
+
+// svidKeyUsage returns the key usage of an X509-SVID leaf for pub: digitalSignature, which
+// the specification requires, and keyEncipherment only for RSA keys, which alone can be used
+// for key transport
+func svidKeyUsage(pub crypto.PublicKey) x509.KeyUsage {
+	if _, ok := pub.(*rsa.PublicKey); ok {
+		return x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	}
+	return x509.KeyUsageDigitalSignature
+}
+
+// permitsURIDomain reports whether the URI name constraints in permitted allow host,
+// following the rules of RFC 5280 section 4.2.1.10
+func permitsURIDomain(permitted []string, host string) bool {
+	for _, domain := range permitted {
+		if strings.HasPrefix(domain, ".") && strings.HasSuffix(host, domain) || host == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// ExportSPIFFEBundle returns a SPIFFE trust bundle holding crts as X.509 authorities of
+// the trust domain, in the JWKS format of the SPIFFE Trust Domain and Bundle specification
+func ExportSPIFFEBundle(crts []*Certificate) ([]byte, error) {
+	bundle := &JWKS{Keys: []*JWK{}}
+	for _, crt := range crts {
+		jwk, err := crt.JWK()
+		if err != nil {
+			return nil, err
+		}
+		// x509-svid keys carry exactly one certificate and no key ID
+		jwk.Use = "x509-svid"
+		jwk.Kid = ""
+		bundle.Keys = append(bundle.Keys, jwk)
+	}
+	return json.MarshalIndent(bundle, "", "  ")
+}
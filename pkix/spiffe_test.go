@@ -0,0 +1,143 @@
+package pkix
+
+import (
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseSPIFFEID(t *testing.T) {
+	for _, id := range []string{"spiffe://example.org", "spiffe://example.org/ns/web", "spiffe://a-b_c.example/Web.1"} {
+		if u, err := ParseSPIFFEID(id); err != nil || u.String() != id {
+			t.Errorf("Parsing %s: got %v, %v", id, u, err)
+		}
+	}
+	for _, id := range []string{
+		"https://example.org/web",
+		"spiffe://",
+		"spiffe://Example.org/web",
+		"spiffe://example.org:8080/web",
+		"spiffe://user@example.org/web",
+		"spiffe://example.org/",
+		"spiffe://example.org//web",
+		"spiffe://example.org/ns/../web",
+		"spiffe://example.org/web?query",
+		"spiffe://example.org/web#fragment",
+		"spiffe://example.org/web%20server",
+	} {
+		if _, err := ParseSPIFFEID(id); err == nil {
+			t.Errorf("Expected an error parsing %s", id)
+		}
+	}
+}
+
+func newSVIDRequest(t *testing.T, uris ...string) *CertificateSigningRequest {
+	key, err := CreateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newSVIDRequestForKey(t, key, uris...)
+}
+
+func newSVIDRequestForKey(t *testing.T, key *Key, uris ...string) *CertificateSigningRequest {
+	var parsed []*url.URL
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed = append(parsed, u)
+	}
+	csr, err := CreateCertificateSigningRequest(key, "", nil, nil, parsed, "", "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
+
+func TestCreateCertificateSVID(t *testing.T) {
+	key, err := CreateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := CreateCertificateAuthorityWithOptions(key, "", time.Now().Add(time.Hour), "", "", "", "", "SPIFFE CA", nil,
+		WithSPIFFETrustDomainOption("example.org"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crt, err := CreateCertificateSVID(ca, key, newSVIDRequest(t, "spiffe://example.org/ns/web"), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := crt.GetRawCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw.URIs) != 1 || raw.URIs[0].String() != "spiffe://example.org/ns/web" {
+		t.Fatalf("SVID has URIs %v", raw.URIs)
+	}
+	if !raw.BasicConstraintsValid || raw.IsCA || raw.KeyUsage&x509.KeyUsageDigitalSignature == 0 || raw.KeyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0 {
+		t.Fatalf("SVID has basic constraints %v, CA %v and key usage %v", raw.BasicConstraintsValid, raw.IsCA, raw.KeyUsage)
+	}
+	if raw.KeyUsage != x509.KeyUsageDigitalSignature {
+		t.Fatalf("SVID for an ECDSA key has key usage %v, want only digitalSignature", raw.KeyUsage)
+	}
+	rawCA, err := ca.GetRawCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(rawCA)
+	if _, err := raw.Verify(x509.VerifyOptions{Roots: roots}); err != nil {
+		t.Fatal("SVID does not verify:", err)
+	}
+
+	rsaKey, err := CreateRSAKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err = CreateCertificateSVID(ca, key, newSVIDRequestForKey(t, rsaKey, "spiffe://example.org/ns/db"), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, err = crt.GetRawCertificate(); err != nil {
+		t.Fatal(err)
+	}
+	if raw.KeyUsage != x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment {
+		t.Fatalf("SVID for an RSA key has key usage %v, want digitalSignature and keyEncipherment", raw.KeyUsage)
+	}
+
+	for _, csr := range []*CertificateSigningRequest{
+		newSVIDRequest(t),
+		newSVIDRequest(t, "spiffe://example.org/a", "spiffe://example.org/b"),
+		newSVIDRequest(t, "https://example.org/web"),
+		newSVIDRequest(t, "spiffe://other.org/web"),
+	} {
+		if _, err := CreateCertificateSVID(ca, key, csr, time.Now().Add(time.Hour)); err == nil {
+			raw, _ := csr.GetRawCertificateSigningRequest()
+			t.Errorf("Expected an error signing an SVID for %v", raw.URIs)
+		}
+	}
+}
+
+func TestExportSPIFFEBundle(t *testing.T) {
+	crt, err := NewCertificateFromPEM([]byte(certAuthPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ExportSPIFFEBundle([]*Certificate{crt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bundle JWKS
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle.Keys) != 1 || bundle.Keys[0].Use != "x509-svid" || len(bundle.Keys[0].X5c) != 1 || bundle.Keys[0].Kid != "" {
+		t.Fatalf("Unexpected bundle %s", data)
+	}
+}
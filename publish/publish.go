@@ -0,0 +1,226 @@
+// Package publish serves the certificates and CRLs of the CAs in a depot, so that the CRL
+// distribution point and authority information access URLs of the certificates they issue
+// can be resolved.
+//
+// For a CA named CA, the published files are:
+//
+//	CA.crt      the CA certificate, DER-encoded
+//	CA.crt.pem  the CA certificate, PEM-encoded
+//	CA.crl      the CRL of the CA, DER-encoded
+//	CA.crl.pem  the CRL of the CA, PEM-encoded
+//
+// Files are read from the depot again whenever it changes, so that a CRL rewritten by
+// revoke is published immediately.
+package publish
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/pkix"
+)
+
+// Content types of published files
+const (
+	ContentTypeCertificate = "application/pkix-cert"
+	ContentTypeCRL         = "application/pkix-crl"
+	ContentTypePEM         = "application/x-pem-file"
+)
+
+// DefaultMaxAge is how long clients may cache published files by default
+const DefaultMaxAge = time.Hour
+
+// File is a published file
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+	// ModTime is when the file was last changed in the depot
+	ModTime time.Time
+	// NextUpdate is when a new CRL will be issued, zero for certificates
+	NextUpdate time.Time
+}
+
+// Publisher publishes the files of CAs in a depot. It implements http.Handler, serving
+// every file at the root of the server.
+type Publisher struct {
+	d   *depot.FileDepot
+	cas []string
+
+	// MaxAge is how long clients may cache files. CRLs are not cached past their next update.
+	MaxAge time.Duration
+
+	mu    sync.Mutex
+	cache map[string]*cachedFile
+}
+
+type cachedFile struct {
+	modTime time.Time
+	size    int64
+	file    *File
+}
+
+// kinds maps the suffix of published files to the depot file they are made from
+var kinds = []struct {
+	suffix string
+	tag    func(name string) *depot.Tag
+	crl    bool
+	pem    bool
+}{
+	{".crt", depot.CrtTag, false, false},
+	{".crt.pem", depot.CrtTag, false, true},
+	{".crl", depot.CrlTag, true, false},
+	{".crl.pem", depot.CrlTag, true, true},
+}
+
+// New creates a publisher for the CAs named cas in d, or every CA in d if cas is empty
+func New(d *depot.FileDepot, cas []string) *Publisher {
+	return &Publisher{d: d, cas: cas, MaxAge: DefaultMaxAge, cache: map[string]*cachedFile{}}
+}
+
+// Get returns the published file with the given name. The error satisfies os.IsNotExist
+// if there is no such file.
+func (p *Publisher) Get(name string) (*File, error) {
+	for _, kind := range kinds {
+		ca := strings.TrimSuffix(name, kind.suffix)
+		if ca == name || ca == "" || strings.ContainsAny(ca, `/\`) {
+			continue
+		}
+		if len(p.cas) > 0 && !slices.Contains(p.cas, ca) {
+			return nil, os.ErrNotExist
+		}
+		tag := kind.tag(ca)
+		fi, err := p.d.Stat(tag)
+		if err != nil {
+			return nil, err
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if c, ok := p.cache[name]; ok && c.modTime.Equal(fi.ModTime()) && c.size == fi.Size() {
+			return c.file, nil
+		}
+		data, err := p.d.Get(tag)
+		if err != nil {
+			return nil, err
+		}
+		f := &File{Name: name, ModTime: fi.ModTime()}
+		if kind.crl {
+			err = f.setCRL(data, kind.pem)
+		} else {
+			err = f.setCertificate(data, kind.pem)
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.cache[name] = &cachedFile{modTime: fi.ModTime(), size: fi.Size(), file: f}
+		return f, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func (f *File) setCertificate(data []byte, pem bool) error {
+	crt, err := pkix.NewCertificateFromPEM(data)
+	if err != nil {
+		return err
+	}
+	raw, err := crt.GetRawCertificate()
+	if err != nil {
+		return err
+	}
+	// Only CA certificates are published
+	if !raw.IsCA {
+		return os.ErrNotExist
+	}
+	f.ContentType = ContentTypeCertificate
+	f.Data = raw.Raw
+	if pem {
+		f.ContentType = ContentTypePEM
+		f.Data, err = crt.Export()
+	}
+	return err
+}
+
+func (f *File) setCRL(data []byte, pem bool) error {
+	crl, err := pkix.NewCertificateRevocationListFromPEM(data)
+	if err != nil {
+		return err
+	}
+	list, err := x509.ParseDERCRL(crl.DERBytes())
+	if err != nil {
+		return err
+	}
+	f.NextUpdate = list.TBSCertList.NextUpdate
+	f.ContentType = ContentTypeCRL
+	f.Data = crl.DERBytes()
+	if pem {
+		f.ContentType = ContentTypePEM
+		f.Data, err = crl.Export()
+	}
+	return err
+}
+
+// Files returns every published file, ordered by name
+func (p *Publisher) Files() ([]*File, error) {
+	var files []*File
+	for _, tag := range p.d.List() {
+		ca := depot.GetNameFromCrtTag(tag)
+		if ca == "" || (len(p.cas) > 0 && !slices.Contains(p.cas, ca)) {
+			continue
+		}
+		for _, kind := range kinds {
+			f, err := p.Get(ca + kind.suffix)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// ServeHTTP serves published files with caching headers
+func (p *Publisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	f, err := p.Get(strings.TrimPrefix(r.URL.Path, "/"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, "cannot read file", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	maxAge := p.MaxAge
+	if !f.NextUpdate.IsZero() {
+		w.Header().Set("Expires", f.NextUpdate.UTC().Format(http.TimeFormat))
+		if untilUpdate := time.Until(f.NextUpdate); untilUpdate < maxAge {
+			maxAge = untilUpdate
+		}
+	}
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	w.Header().Set("Content-Type", f.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	http.ServeContent(w, r, f.Name, f.ModTime, bytes.NewReader(f.Data))
+}
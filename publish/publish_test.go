@@ -0,0 +1,171 @@
+package publish
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/certstrap/depot"
+	certpkix "github.com/square/certstrap/pkix"
+)
+
+func newTestDepot(t *testing.T) (*depot.FileDepot, *certpkix.Certificate, *certpkix.Key) {
+	dir, err := os.MkdirTemp("", "certstrap-publish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	d, err := depot.NewFileDepot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := certpkix.CreateRSAKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := certpkix.CreateCertificateAuthority(key, "", time.Now().Add(time.Hour), "", "", "", "", "CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := certpkix.CreateCertificateRevocationList(key, crt, time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := depot.PutCertificate(d, "CA", crt); err != nil {
+		t.Fatal(err)
+	}
+	if err := depot.PutCertificateRevocationList(d, "CA", crl); err != nil {
+		t.Fatal(err)
+	}
+
+	csr, err := certpkix.CreateCertificateSigningRequest(key, "", nil, []string{"host"}, nil, "", "", "", "", "host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, err := certpkix.CreateCertificateHost(crt, key, csr, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := depot.PutCertificate(d, "host", host); err != nil {
+		t.Fatal(err)
+	}
+	return d, crt, key
+}
+
+func TestFiles(t *testing.T) {
+	d, _, _ := newTestDepot(t)
+	files, err := New(d, nil).Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name+" "+f.ContentType)
+	}
+	want := "CA.crl application/pkix-crl,CA.crl.pem application/x-pem-file,CA.crt application/pkix-cert,CA.crt.pem application/x-pem-file"
+	if got := strings.Join(names, ","); got != want {
+		t.Fatalf("Published %s, want %s", got, want)
+	}
+
+	if files, err := New(d, []string{"other"}).Files(); err != nil || len(files) != 0 {
+		t.Fatalf("Published %v, %v for a CA not in the depot", files, err)
+	}
+	if _, err := New(d, nil).Get("host.crt"); !os.IsNotExist(err) {
+		t.Fatalf("Expect not exist error for a host certificate, got %v", err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	d, crt, key := newTestDepot(t)
+	srv := httptest.NewServer(New(d, nil))
+	defer srv.Close()
+
+	get := func(path string, header http.Header) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, body
+	}
+
+	res, body := get("/CA.crt", nil)
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != ContentTypeCertificate {
+		t.Fatalf("Fetching CA.crt: got %s, %s", res.Status, res.Header.Get("Content-Type"))
+	}
+	if res.Header.Get("Cache-Control") != "public, max-age=3600" {
+		t.Fatalf("CA.crt has Cache-Control %q", res.Header.Get("Cache-Control"))
+	}
+	if _, err := x509.ParseCertificate(body); err != nil {
+		t.Fatal("CA.crt is not a DER certificate:", err)
+	}
+
+	res, body = get("/CA.crl", nil)
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != ContentTypeCRL || res.Header.Get("Expires") == "" {
+		t.Fatalf("Fetching CA.crl: got %s, %v", res.Status, res.Header)
+	}
+	list, err := x509.ParseDERCRL(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.TBSCertList.RevokedCertificates) != 0 {
+		t.Fatal("CRL has revoked certificates")
+	}
+	if res, _ := get("/CA.crl", http.Header{"If-Modified-Since": {res.Header.Get("Last-Modified")}}); res.StatusCode != http.StatusNotModified {
+		t.Fatalf("Fetching an unmodified CRL: got %s, want 304", res.Status)
+	}
+
+	// A CRL rewritten in the depot is served at once
+	raw, err := crt.GetRawCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := raw.CreateCRL(rand.Reader, key.Private, []pkix.RevokedCertificate{{SerialNumber: big.NewInt(42), RevocationTime: time.Now()}}, time.Now(), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := depot.ReplaceCertificateRevocationList(d, "CA", certpkix.NewCertificateRevocationListFromDER(der)); err != nil {
+		t.Fatal(err)
+	}
+	res, body = get("/CA.crl", nil)
+	if list, err = x509.ParseDERCRL(body); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.TBSCertList.RevokedCertificates) != 1 {
+		t.Fatal("Rewritten CRL was not reloaded")
+	}
+	// and is not cached past its next update
+	if cc := res.Header.Get("Cache-Control"); cc != "public, max-age=59" && cc != "public, max-age=60" {
+		t.Fatalf("CRL has Cache-Control %q", cc)
+	}
+
+	res, body = get("/CA.crl.pem", nil)
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(string(body), "-----BEGIN X509 CRL-----") {
+		t.Fatalf("Fetching CA.crl.pem: got %s: %s", res.Status, body)
+	}
+	for _, path := range []string{"/host.crt", "/CA.key", "/CA.index", "/../CA.crt", "/other.crl"} {
+		if res, _ := get(path, nil); res.StatusCode != http.StatusNotFound {
+			t.Errorf("Fetching %s: got %s, want 404", path, res.Status)
+		}
+	}
+}
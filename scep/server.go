@@ -0,0 +1,270 @@
+// Package scep implements a SCEP (RFC 8894) server that issues certificates
+// through a caller-provided Issuer.
+//
+// The server answers the GetCACert, GetCACaps and PKIOperation operations.
+// Enrollment requests must carry a valid challenge password, unless they renew
+// a certificate issued by the CA and are signed with it. Requests are decrypted,
+// and replies signed, with the RSA key of the CA.
+package scep
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/square/certstrap/pkcs7"
+	"github.com/square/certstrap/pkix"
+)
+
+// Issuer signs the certificate requests the server has authorized
+type Issuer interface {
+	// Issue returns the certificate for csr followed by the chain of intermediates to serve with it
+	Issue(csr *pkix.CertificateSigningRequest) ([]*pkix.Certificate, error)
+}
+
+var (
+	oidMessageType    = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 2}
+	oidPKIStatus      = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 3}
+	oidFailInfo       = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 4}
+	oidSenderNonce    = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 5}
+	oidRecipientNonce = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 6}
+	oidTransactionID  = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 7}
+)
+
+// Message types
+const (
+	messageTypeCertRep    = "3"
+	messageTypeRenewalReq = "17"
+	messageTypePKCSReq    = "19"
+)
+
+// PKI statuses
+const (
+	statusSuccess = "0"
+	statusFailure = "2"
+)
+
+// Failure reasons
+const (
+	failBadAlg          = "0"
+	failBadMessageCheck = "1"
+	failBadRequest      = "2"
+)
+
+const (
+	caCertContentType   = "application/x-x509-ca-cert"
+	caRACertContentType = "application/x-x509-ca-ra-cert"
+	pkiMessageType      = "application/x-pki-message"
+
+	// capabilities are returned by GetCACaps
+	capabilities = "AES\nDES3\nPOSTPKIOperation\nRenewal\nSCEPStandard\nSHA-1\nSHA-256\nSHA-512\n"
+
+	maxRequestSize = 64 << 10
+)
+
+// Server is a SCEP server. It implements http.Handler and serves every path,
+// selecting the operation with the operation query parameter.
+type Server struct {
+	issuer  Issuer
+	caCerts []*x509.Certificate
+	key     *rsa.PrivateKey
+
+	// Challenge reports whether password is a valid challenge password. Enrollment
+	// requests that do not renew a certificate of the CA are refused if it is nil.
+	Challenge func(password string) bool
+}
+
+// request is a verified PKIOperation request
+type request struct {
+	msg           *pkcs7.SignedMessage
+	transactionID string
+	messageType   string
+	senderNonce   []byte
+}
+
+// NewServer creates a SCEP server issuing certificates with issuer. caCerts is the chain of
+// the issuing CA returned by GetCACert, ordered from the CA up to the root, and key is the
+// private key of the CA, which must be an RSA key.
+func NewServer(issuer Issuer, caCerts []*pkix.Certificate, key *pkix.Key) (*Server, error) {
+	rsaKey, ok := key.Private.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("SCEP requires a CA with an RSA key")
+	}
+	s := &Server{issuer: issuer, key: rsaKey}
+	for _, crt := range caCerts {
+		raw, err := crt.GetRawCertificate()
+		if err != nil {
+			return nil, err
+		}
+		s.caCerts = append(s.caCerts, raw)
+	}
+	if len(s.caCerts) == 0 {
+		return nil, errors.New("no CA certificate")
+	}
+	return s, nil
+}
+
+// ServeHTTP handles SCEP operations
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "SCEP operations must be requested with GET or POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch op := r.URL.Query().Get("operation"); op {
+	case "GetCACert":
+		if len(s.caCerts) == 1 {
+			write(w, caCertContentType, s.caCerts[0].Raw)
+			return
+		}
+		var certs [][]byte
+		for _, crt := range s.caCerts {
+			certs = append(certs, crt.Raw)
+		}
+		data, err := pkcs7.Degenerate(certs, nil)
+		if err != nil {
+			http.Error(w, "cannot encode CA certificates", http.StatusInternalServerError)
+			return
+		}
+		write(w, caRACertContentType, data)
+	case "GetCACaps":
+		write(w, "text/plain", []byte(capabilities))
+	case "PKIOperation":
+		var data []byte
+		var err error
+		if r.Method == http.MethodGet {
+			// GET requests carry the message base64-encoded in the query, where + may have become a space
+			data, err = base64.StdEncoding.DecodeString(strings.ReplaceAll(r.URL.Query().Get("message"), " ", "+"))
+		} else {
+			data, err = io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+		}
+		if err != nil {
+			http.Error(w, "cannot read message", http.StatusBadRequest)
+			return
+		}
+		reply, err := s.pkiOperation(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		write(w, pkiMessageType, reply)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported operation %q", op), http.StatusBadRequest)
+	}
+}
+
+// pkiOperation answers a PKIOperation message. It returns an error if the message cannot be
+// answered with a CertRep message, which is signed by the CA.
+func (s *Server) pkiOperation(data []byte) ([]byte, error) {
+	msg, err := pkcs7.Verify(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message: %v", err)
+	}
+	req := &request{msg: msg}
+	if err := msg.UnmarshalAttribute(oidTransactionID, &req.transactionID); err != nil {
+		return nil, fmt.Errorf("invalid transactionID: %v", err)
+	}
+	if err := msg.UnmarshalAttribute(oidMessageType, &req.messageType); err != nil {
+		return nil, fmt.Errorf("invalid messageType: %v", err)
+	}
+	if err := msg.UnmarshalAttribute(oidSenderNonce, &req.senderNonce); err != nil {
+		return nil, fmt.Errorf("invalid senderNonce: %v", err)
+	}
+
+	switch req.messageType {
+	case messageTypePKCSReq, messageTypeRenewalReq:
+		return s.enroll(req)
+	default:
+		return s.reply(req, statusFailure, failBadRequest, nil)
+	}
+}
+
+// enroll issues a certificate for the PKCS #10 request enveloped in the message, and replies
+// with the certificate enveloped for the signer of the message
+func (s *Server) enroll(req *request) ([]byte, error) {
+	env, err := pkcs7.ParseEnvelopedData(req.msg.Content)
+	if err != nil {
+		return s.reply(req, statusFailure, failBadAlg, nil)
+	}
+	plain, err := env.Decrypt(pkix.Random(), s.caCerts[0], s.key)
+	if err != nil {
+		return s.reply(req, statusFailure, failBadMessageCheck, nil)
+	}
+	csr := pkix.NewCertificateSigningRequestFromDER(plain)
+	raw, err := csr.GetRawCertificateSigningRequest()
+	if err != nil {
+		return s.reply(req, statusFailure, failBadRequest, nil)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return s.reply(req, statusFailure, failBadMessageCheck, nil)
+	}
+	if !s.renewal(req.msg.Signer, raw) {
+		password, err := csr.ChallengePassword()
+		if err != nil || password == "" || s.Challenge == nil || !s.Challenge(password) {
+			return s.reply(req, statusFailure, failBadRequest, nil)
+		}
+	}
+
+	crts, err := s.issuer.Issue(csr)
+	if err != nil {
+		return s.reply(req, statusFailure, failBadRequest, nil)
+	}
+	certs, err := pkix.ExportCertificatesPKCS7(crts)
+	if err != nil {
+		return nil, err
+	}
+	enveloped, err := pkcs7.Encrypt(pkix.Random(), certs, []*x509.Certificate{req.msg.Signer}, env.Algorithm)
+	if err != nil {
+		return s.reply(req, statusFailure, failBadAlg, nil)
+	}
+	return s.reply(req, statusSuccess, "", enveloped)
+}
+
+// renewal reports whether a request is signed with a certificate issued by the CA
+// for the same subject and subject alternative names
+func (s *Server) renewal(signer *x509.Certificate, csr *x509.CertificateRequest) bool {
+	roots := x509.NewCertPool()
+	roots.AddCert(s.caCerts[0])
+	if _, err := signer.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		return false
+	}
+	return string(signer.RawSubject) == string(csr.RawSubject) &&
+		reflect.DeepEqual(csr.DNSNames, signer.DNSNames) &&
+		reflect.DeepEqual(csr.EmailAddresses, signer.EmailAddresses) &&
+		fmt.Sprint(csr.IPAddresses) == fmt.Sprint(signer.IPAddresses) &&
+		fmt.Sprint(csr.URIs) == fmt.Sprint(signer.URIs)
+}
+
+// reply creates a CertRep message answering req
+func (s *Server) reply(req *request, status, failInfo string, content []byte) ([]byte, error) {
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(pkix.Random(), nonce); err != nil {
+		return nil, err
+	}
+	attrs := []pkcs7.Attribute{
+		{Type: oidTransactionID, Value: req.transactionID},
+		{Type: oidMessageType, Value: messageTypeCertRep},
+		{Type: oidPKIStatus, Value: status},
+		{Type: oidSenderNonce, Value: nonce},
+		{Type: oidRecipientNonce, Value: req.senderNonce},
+	}
+	if status == statusFailure {
+		attrs = append(attrs, pkcs7.Attribute{Type: oidFailInfo, Value: failInfo})
+	}
+	return pkcs7.Sign(pkix.Random(), content, s.caCerts[0], s.key, attrs)
+}
+
+func write(w http.ResponseWriter, contentType string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	//nolint:errcheck
+	w.Write(data)
+}
@@ -0,0 +1,351 @@
+package scep
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/square/certstrap/pkcs7"
+	certpkix "github.com/square/certstrap/pkix"
+)
+
+const testChallenge = "enroll-me"
+
+var (
+	oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+	oidSHA256WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+)
+
+type testIssuer struct {
+	crt *certpkix.Certificate
+	key *certpkix.Key
+}
+
+func (i *testIssuer) Issue(csr *certpkix.CertificateSigningRequest) ([]*certpkix.Certificate, error) {
+	crt, err := certpkix.CreateCertificateHost(i.crt, i.key, csr, time.Now().Add(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	return []*certpkix.Certificate{crt}, nil
+}
+
+// client builds SCEP requests the way a device does
+type client struct {
+	t   *testing.T
+	url string
+	ca  *x509.Certificate
+	key *rsa.PrivateKey
+	// crt signs requests, a self-signed certificate until one is issued
+	crt *x509.Certificate
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, *testIssuer) {
+	key, err := certpkix.CreateRSAKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := certpkix.CreateCertificateAuthority(key, "", time.Now().Add(time.Hour), "", "", "", "", "SCEP Test CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{crt: crt, key: key}
+	server, err := NewServer(issuer, []*certpkix.Certificate{crt}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Challenge = func(password string) bool { return password == testChallenge }
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+	return srv, issuer
+}
+
+func newClient(t *testing.T, srv *httptest.Server, cn string) *client {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &client{t: t, url: srv.URL + "/scep", key: key, crt: crt}
+
+	res, err := http.Get(c.url + "?operation=GetCACert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := readBody(t, res, caCertContentType)
+	if c.ca, err = x509.ParseCertificate(body); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func readBody(t *testing.T, res *http.Response, contentType string) []byte {
+	t.Helper()
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %s: %s", res.Status, body)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != contentType {
+		t.Fatalf("got content type %q, want %q", ct, contentType)
+	}
+	return body
+}
+
+// createCSR creates a certificate request with a challengePassword attribute,
+// which x509.CreateCertificateRequest cannot add
+func (c *client) createCSR(challenge string) []byte {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: c.crt.Subject}, c.key)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if challenge == "" {
+		return der
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	value, err := asn1.Marshal(challenge)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	attr, err := asn1.Marshal(struct {
+		Type   asn1.ObjectIdentifier
+		Values []asn1.RawValue `asn1:"set"`
+	}{oidChallengePassword, []asn1.RawValue{{FullBytes: value}}})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	tbs, err := asn1.Marshal(struct {
+		Version    int
+		Subject    asn1.RawValue
+		PublicKey  asn1.RawValue
+		Attributes asn1.RawValue
+	}{
+		Subject:    asn1.RawValue{FullBytes: csr.RawSubject},
+		PublicKey:  asn1.RawValue{FullBytes: csr.RawSubjectPublicKeyInfo},
+		Attributes: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attr},
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	digest := sha256.Sum256(tbs)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, c.key, crypto.SHA256, digest[:])
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	der, err = asn1.Marshal(struct {
+		TBS       asn1.RawValue
+		Algorithm pkix.AlgorithmIdentifier
+		Signature asn1.BitString
+	}{
+		TBS:       asn1.RawValue{FullBytes: tbs},
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256WithRSA, Parameters: asn1.NullRawValue},
+		Signature: asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)},
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return der
+}
+
+// request sends a PKIOperation with csr enveloped for the CA, and returns the verified reply
+func (c *client) request(messageType string, csr []byte, get bool) *pkcs7.SignedMessage {
+	enveloped, err := pkcs7.Encrypt(rand.Reader, csr, []*x509.Certificate{c.ca}, pkcs7.EncryptionAlgorithmAES128CBC)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	nonce := []byte("0123456789abcdef")
+	msg, err := pkcs7.Sign(rand.Reader, enveloped, c.crt, c.key, []pkcs7.Attribute{
+		{Type: oidTransactionID, Value: "transaction-1"},
+		{Type: oidMessageType, Value: messageType},
+		{Type: oidSenderNonce, Value: nonce},
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	var res *http.Response
+	if get {
+		res, err = http.Get(c.url + "?operation=PKIOperation&message=" + url.QueryEscape(base64.StdEncoding.EncodeToString(msg)))
+	} else {
+		res, err = http.Post(c.url+"?operation=PKIOperation", pkiMessageType, bytes.NewReader(msg))
+	}
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	reply, err := pkcs7.Verify(readBody(c.t, res, pkiMessageType))
+	if err != nil {
+		c.t.Fatal("Failed verifying reply:", err)
+	}
+	if !reply.Signer.Equal(c.ca) {
+		c.t.Fatal("Reply is not signed by the CA")
+	}
+	var transactionID, replyType string
+	var recipientNonce []byte
+	if err := reply.UnmarshalAttribute(oidTransactionID, &transactionID); err != nil || transactionID != "transaction-1" {
+		c.t.Fatalf("Reply has transactionID %q, %v", transactionID, err)
+	}
+	if err := reply.UnmarshalAttribute(oidMessageType, &replyType); err != nil || replyType != messageTypeCertRep {
+		c.t.Fatalf("Reply has messageType %q, %v", replyType, err)
+	}
+	if err := reply.UnmarshalAttribute(oidRecipientNonce, &recipientNonce); err != nil || !bytes.Equal(recipientNonce, nonce) {
+		c.t.Fatalf("Reply has recipientNonce %x, %v", recipientNonce, err)
+	}
+	return reply
+}
+
+// certificate returns the certificate issued by a successful reply
+func (c *client) certificate(reply *pkcs7.SignedMessage) *x509.Certificate {
+	var status string
+	if err := reply.UnmarshalAttribute(oidPKIStatus, &status); err != nil || status != statusSuccess {
+		var failInfo string
+		reply.UnmarshalAttribute(oidFailInfo, &failInfo)
+		c.t.Fatalf("Reply has pkiStatus %q and failInfo %q, want success", status, failInfo)
+	}
+	env, err := pkcs7.ParseEnvelopedData(reply.Content)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	certs, err := env.Decrypt(rand.Reader, c.crt, c.key)
+	if err != nil {
+		c.t.Fatal("Failed decrypting reply:", err)
+	}
+	sd, err := pkcs7.ParseSignedData(certs)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	crt, err := x509.ParseCertificate(sd.Certificates[0])
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := crt.CheckSignatureFrom(c.ca); err != nil {
+		c.t.Fatal("Issued certificate is not signed by the CA:", err)
+	}
+	return crt
+}
+
+func checkFailure(t *testing.T, reply *pkcs7.SignedMessage, failInfo string) {
+	t.Helper()
+	var status, info string
+	reply.UnmarshalAttribute(oidPKIStatus, &status)
+	reply.UnmarshalAttribute(oidFailInfo, &info)
+	if status != statusFailure || info != failInfo {
+		t.Fatalf("Reply has pkiStatus %q and failInfo %q, want %q and %q", status, info, statusFailure, failInfo)
+	}
+}
+
+func TestGetCACaps(t *testing.T) {
+	srv, _ := newTestServer(t)
+	res, err := http.Get(srv.URL + "/scep?operation=GetCACaps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps := string(readBody(t, res, "text/plain"))
+	for _, capability := range []string{"POSTPKIOperation", "Renewal", "SHA-256", "AES", "SCEPStandard"} {
+		if !bytes.Contains([]byte(caps), []byte(capability+"\n")) {
+			t.Fatalf("Capabilities %q do not include %s", caps, capability)
+		}
+	}
+}
+
+func TestEnroll(t *testing.T) {
+	srv, _ := newTestServer(t)
+	for _, get := range []bool{false, true} {
+		c := newClient(t, srv, "device-1")
+		crt := c.certificate(c.request(messageTypePKCSReq, c.createCSR(testChallenge), get))
+		if crt.Subject.CommonName != "device-1" {
+			t.Fatalf("Issued certificate is for %q", crt.Subject.CommonName)
+		}
+	}
+}
+
+func TestEnrollChallenge(t *testing.T) {
+	srv, _ := newTestServer(t)
+	c := newClient(t, srv, "device-1")
+	checkFailure(t, c.request(messageTypePKCSReq, c.createCSR("wrong"), false), failBadRequest)
+	checkFailure(t, c.request(messageTypePKCSReq, c.createCSR(""), false), failBadRequest)
+}
+
+func TestRenewal(t *testing.T) {
+	srv, _ := newTestServer(t)
+	c := newClient(t, srv, "device-1")
+	crt := c.certificate(c.request(messageTypePKCSReq, c.createCSR(testChallenge), false))
+
+	// Signed with the issued certificate, a renewal needs no challenge
+	c.crt = crt
+	renewed := c.certificate(c.request(messageTypeRenewalReq, c.createCSR(""), false))
+	if renewed.SerialNumber.Cmp(crt.SerialNumber) == 0 {
+		t.Fatal("Renewal returned the same certificate")
+	}
+
+	// but only for the subject of the certificate
+	other := newClient(t, srv, "device-2")
+	other.crt = crt
+	other.key = c.key
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "device-2"}}, c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFailure(t, other.request(messageTypeRenewalReq, csr, false), failBadRequest)
+
+	// and its subject alternative names
+	csr, err = x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  crt.Subject,
+		DNSNames: []string{"www.example.com"},
+	}, c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFailure(t, c.request(messageTypeRenewalReq, csr, false), failBadRequest)
+}
+
+func TestUnsupportedMessageType(t *testing.T) {
+	srv, _ := newTestServer(t)
+	c := newClient(t, srv, "device-1")
+	checkFailure(t, c.request("20", c.createCSR(testChallenge), false), failBadRequest)
+}
+
+func TestNewServerECDSA(t *testing.T) {
+	key, err := certpkix.CreateECDSAKey(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := certpkix.CreateCertificateAuthority(key, "", time.Now().Add(time.Hour), "", "", "", "", "CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewServer(&testIssuer{crt, key}, []*certpkix.Certificate{crt}, key); err == nil {
+		t.Fatal("Expect error creating a server for a CA with an ECDSA key")
+	}
+}
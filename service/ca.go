@@ -0,0 +1,347 @@
+// Package service implements the operations of a certificate authority kept in a depot:
+// signing certificate requests with a profile, revoking certificates, listing the CA index,
+// and fetching the CRL and certificate chain of the CA. The certstrap commands and servers
+// are built on it.
+//
+// CA does not lock the depot. Callers hold the lock returned by CA.Lock, or
+// depot.FileDepot.Lock, around operations that change it.
+package service
+
+import (
+	"bytes"
+	"crypto/x509"
+	x509pkix "crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/pkix"
+)
+
+// CRL reason codes, see RFC 5280 section 5.3.1
+const (
+	ReasonUnspecified = 0
+	ReasonSuperseded  = 4
+)
+
+// crlLifetime is how long a CRL regenerated on revocation is valid
+const crlLifetime = 2 * 8760 * time.Hour
+
+var oidExtensionReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// CA is a certificate authority in a depot together with its private key
+type CA struct {
+	d    *depot.FileDepot
+	name string
+	crt  *pkix.Certificate
+	key  *pkix.Key
+	// chain holds the CA certificate and the intermediates up to, but excluding, its root
+	chain []*pkix.Certificate
+	// root is the root certificate the CA chains to, nil if it is not in the depot
+	root *pkix.Certificate
+}
+
+// NewCA loads the CA certificate stored under name in d. key is the private key of the CA.
+func NewCA(d *depot.FileDepot, name string, key *pkix.Key) (*CA, error) {
+	crt, err := depot.GetCertificate(d, name)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := crt.GetRawCertificate()
+	if err != nil {
+		return nil, err
+	}
+	if !raw.IsCA {
+		return nil, errors.New("selected CA certificate is not allowed to sign certificates")
+	}
+	chain, err := depot.GetCertificateChain(d, name)
+	if err != nil {
+		return nil, err
+	}
+	ca := &CA{d: d, name: name, crt: crt, key: key, chain: chain}
+	if last := chain[len(chain)-1]; depot.IsRootCertificate(last) {
+		ca.root = last
+		ca.chain = chain[:len(chain)-1]
+	}
+	return ca, nil
+}
+
+// Name returns the depot name of the CA
+func (ca *CA) Name() string {
+	return ca.name
+}
+
+// Certificate returns the CA certificate
+func (ca *CA) Certificate() *pkix.Certificate {
+	return ca.crt
+}
+
+// Key returns the private key of the CA
+func (ca *CA) Key() *pkix.Key {
+	return ca.key
+}
+
+// Chain returns the CA certificate followed by the intermediates up to, but excluding, its root,
+// which is empty for a root CA. It is the chain served along with issued certificates.
+func (ca *CA) Chain() []*pkix.Certificate {
+	return ca.chain
+}
+
+// Root returns the root certificate the CA chains to, or nil if it is not in the depot
+func (ca *CA) Root() *pkix.Certificate {
+	return ca.root
+}
+
+// Lock takes the depot lock, see depot.FileDepot.Lock
+func (ca *CA) Lock() (func() error, error) {
+	return ca.d.Lock()
+}
+
+// SignRequest describes a certificate to sign
+type SignRequest struct {
+	// Name is the depot name the certificate is recorded under in the CA index, its serial
+	// number if empty
+	Name string
+	CSR  *pkix.CertificateSigningRequest
+	// Profile is the name of the profile to issue the certificate with, ProfileHost if empty
+	Profile  string
+	NotAfter time.Time
+	// PathLength is the maximum path length of an intermediate CA certificate
+	PathLength int
+	// Operator is recorded in the CA index as the issuer of the certificate
+	Operator string
+	// SignatureAlgorithm signs the certificate, the default of the CA key if unknown
+	SignatureAlgorithm x509.SignatureAlgorithm
+	// AllowWeak allows signing a request whose key is of a weak type, such as RSA below 2048
+	// bits or P-224
+	AllowWeak bool
+	// Options adjust the certificate after the profile, such as to keep the constraints of a
+	// renewed certificate
+	Options []pkix.Option
+}
+
+// options returns opts followed by the options of the request
+func (req SignRequest) options(opts ...pkix.Option) []pkix.Option {
+	return append(opts, req.Options...)
+}
+
+// ErrWeakKey is returned by Sign for a request whose key is of a weak type, unless allowed
+var ErrWeakKey = errors.New("weak key type")
+
+// Sign issues a certificate for req and records it in the CA index
+func (ca *CA) Sign(req SignRequest) (*pkix.Certificate, error) {
+	profile := req.Profile
+	if profile == "" {
+		profile = ProfileHost
+	}
+	p, ok := profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", profile)
+	}
+	if err := pkix.CheckSignatureAlgorithm(ca.key, req.SignatureAlgorithm); err != nil {
+		return nil, err
+	}
+	if err := checkRequestKey(req); err != nil {
+		return nil, err
+	}
+	crt, err := p(ca, req)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := depot.NewIndexEntry(req.Name, crt, depot.StatusIssued, req.Operator)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Name == "" {
+		entry.Name = entry.Serial
+	}
+	if err := depot.AppendIndexEntry(ca.d, ca.name, entry); err != nil {
+		return nil, err
+	}
+	return crt, nil
+}
+
+// checkRequestKey fails unless the key of the request is of a known type, and not of a weak
+// one unless req allows it
+func checkRequestKey(req SignRequest) error {
+	raw, err := req.CSR.GetRawCertificateSigningRequest()
+	if err != nil {
+		return err
+	}
+	keyType, err := pkix.KeyTypeOf(raw.PublicKey)
+	if err != nil {
+		return err
+	}
+	if keyType.Weak() && !req.AllowWeak {
+		return fmt.Errorf("%w: %s", ErrWeakKey, keyType)
+	}
+	return nil
+}
+
+// Certificates returns the current status of every certificate in the CA index,
+// in the order they were issued
+func (ca *CA) Certificates() ([]*depot.IndexEntry, error) {
+	entries, err := depot.GetIndex(ca.d, ca.name)
+	if err != nil {
+		return nil, err
+	}
+	return depot.LatestIndexEntries(entries), nil
+}
+
+// FindCertificate describes the certificate with the given depot name to revoke. It is built
+// from the certificate in the depot, which must have been issued by the CA, or found in the
+// CA index if that file is gone.
+func (ca *CA) FindCertificate(name string) (*depot.IndexEntry, error) {
+	crt, err := depot.GetCertificate(ca.d, name)
+	if err == nil {
+		if err := ca.CheckIssued(crt); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		return depot.NewIndexEntry(name, crt, depot.StatusIssued, "")
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	entries, indexErr := depot.GetIndex(ca.d, ca.name)
+	if indexErr != nil {
+		return nil, indexErr
+	}
+	entry := depot.FindIssuedIndexEntry(entries, name)
+	if entry == nil {
+		return nil, fmt.Errorf("no certificate file or unrevoked index entry for %s: %v", name, err)
+	}
+	return entry, nil
+}
+
+// CheckIssued fails unless crt was issued by the CA: its authority key ID is the subject
+// key ID of the CA certificate, and its signature verifies with the CA certificate
+func (ca *CA) CheckIssued(crt *pkix.Certificate) error {
+	raw, err := crt.GetRawCertificate()
+	if err != nil {
+		return err
+	}
+	caRaw, err := ca.crt.GetRawCertificate()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(raw.AuthorityKeyId, caRaw.SubjectKeyId) || raw.CheckSignatureFrom(caRaw) != nil {
+		return fmt.Errorf("certificate was not issued by CA %s", ca.name)
+	}
+	return nil
+}
+
+// Revoke adds the certificate described by entry to the CRL of the CA with the given
+// reason code, and records the revocation by operator in the CA index. entry must describe a
+// certificate of the CA, as returned by FindCertificate or checked with CheckIssued.
+func (ca *CA) Revoke(entry *depot.IndexEntry, reason int, operator string) error {
+	serial, ok := new(big.Int).SetString(entry.Serial, 16)
+	if !ok {
+		return fmt.Errorf("invalid serial number %q for %s", entry.Serial, entry.Name)
+	}
+
+	revoked, err := ca.revokedCertificates()
+	if err != nil {
+		return err
+	}
+	revokedCert := x509pkix.RevokedCertificate{
+		SerialNumber:   serial,
+		RevocationTime: pkix.Now(),
+	}
+	if reason != ReasonUnspecified {
+		// RFC 5280 recommends omitting the extension for unspecified reasons
+		value, err := asn1.Marshal(asn1.Enumerated(reason))
+		if err != nil {
+			return err
+		}
+		revokedCert.Extensions = []x509pkix.Extension{{Id: oidExtensionReasonCode, Value: value}}
+	}
+	revoked = append(revoked, revokedCert)
+
+	if err = ca.saveRevokedCertificates(revoked); err != nil {
+		return err
+	}
+
+	entry.Status = depot.StatusRevoked
+	if reason == ReasonSuperseded {
+		entry.Status = depot.StatusSuperseded
+	}
+	entry.Operator = operator
+	entry.Timestamp = pkix.Now().UTC()
+	return depot.AppendIndexEntry(ca.d, ca.name, entry)
+}
+
+// CRL returns the certificate revocation list of the CA
+func (ca *CA) CRL() (*pkix.CertificateRevocationList, error) {
+	return depot.GetCertificateRevocationList(ca.d, ca.name)
+}
+
+func (ca *CA) revokedCertificates() ([]x509pkix.RevokedCertificate, error) {
+	list, err := ca.CRL()
+	if err != nil {
+		return nil, err
+	}
+	certList, err := x509.ParseDERCRL(list.DERBytes())
+	if err != nil {
+		return nil, err
+	}
+	return certList.TBSCertList.RevokedCertificates, nil
+}
+
+func (ca *CA) saveRevokedCertificates(list []x509pkix.RevokedCertificate) error {
+	raw, err := ca.crt.GetRawCertificate()
+	if err != nil {
+		return err
+	}
+	crlBytes, err := raw.CreateCRL(pkix.Random(), ca.key.Private, list, pkix.Now(), pkix.Now().Add(crlLifetime))
+	if err != nil {
+		return fmt.Errorf("could not create CRL: %v", err)
+	}
+	if err = depot.ReplaceCertificateRevocationList(ca.d, ca.name, pkix.NewCertificateRevocationListFromDER(crlBytes)); err != nil {
+		return fmt.Errorf("could not put revokation list: %v", err)
+	}
+	return nil
+}
+
+// profile signs the certificates of one kind
+type profile func(ca *CA, req SignRequest) (*pkix.Certificate, error)
+
+// Names of the built-in profiles
+const (
+	// ProfileHost issues certificates for TLS servers and clients
+	ProfileHost = "host"
+	// ProfileIntermediate issues intermediate CA certificates
+	ProfileIntermediate = "intermediate"
+	// ProfileSVID issues SPIFFE X509-SVIDs for requests with a SPIFFE ID as their only URI
+	ProfileSVID = "svid"
+)
+
+var profiles = map[string]profile{
+	ProfileHost: func(ca *CA, req SignRequest) (*pkix.Certificate, error) {
+		return pkix.CreateCertificateHost(ca.crt, ca.key, req.CSR, req.NotAfter,
+			req.options(pkix.WithSignatureAlgorithmOption(req.SignatureAlgorithm))...)
+	},
+	ProfileIntermediate: func(ca *CA, req SignRequest) (*pkix.Certificate, error) {
+		return pkix.CreateIntermediateCertificateAuthorityWithOptions(ca.crt, ca.key, req.CSR, req.NotAfter,
+			req.options(pkix.WithPathlenOption(req.PathLength, false), pkix.WithSignatureAlgorithmOption(req.SignatureAlgorithm))...)
+	},
+	ProfileSVID: func(ca *CA, req SignRequest) (*pkix.Certificate, error) {
+		return pkix.CreateCertificateSVID(ca.crt, ca.key, req.CSR, req.NotAfter,
+			req.options(pkix.WithSignatureAlgorithmOption(req.SignatureAlgorithm))...)
+	},
+}
+
+// Profiles returns the names of the profiles certificates can be signed with
+func Profiles() []string {
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/square/certstrap/depot"
+	"github.com/square/certstrap/pkix"
+)
+
+func newTestCA(t *testing.T) *CA {
+	dir, err := os.MkdirTemp("", "certstrap-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	d, err := depot.NewFileDepot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := pkix.CreateRSAKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := pkix.CreateCertificateAuthority(key, "", time.Now().Add(time.Hour), "", "", "", "", "Service CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := pkix.CreateCertificateRevocationList(key, crt, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := depot.PutCertificate(d, "ca", crt); err != nil {
+		t.Fatal(err)
+	}
+	if err := depot.PutCertificateRevocationList(d, "ca", crl); err != nil {
+		t.Fatal(err)
+	}
+	ca, err := NewCA(d, "ca", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func newTestCSR(t *testing.T, name string) *pkix.CertificateSigningRequest {
+	key, err := pkix.CreateRSAKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := pkix.CreateCertificateSigningRequest(key, "", nil, []string{name}, nil, "", "", "", "", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
+
+func TestSign(t *testing.T) {
+	ca := newTestCA(t)
+	if len(ca.Chain()) != 0 || ca.Root() == nil {
+		t.Fatalf("Root CA has chain %v and root %v", ca.Chain(), ca.Root())
+	}
+
+	for _, profile := range []string{"", ProfileHost, ProfileIntermediate} {
+		crt, err := ca.Sign(SignRequest{
+			Name:     "host" + profile,
+			CSR:      newTestCSR(t, "host.example.com"),
+			Profile:  profile,
+			NotAfter: time.Now().Add(time.Hour),
+			Operator: "tester",
+		})
+		if err != nil {
+			t.Fatalf("Signing with profile %q failed: %v", profile, err)
+		}
+		raw, err := crt.GetRawCertificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if raw.IsCA != (profile == ProfileIntermediate) {
+			t.Fatalf("Certificate signed with profile %q has IsCA %v", profile, raw.IsCA)
+		}
+	}
+
+	if _, err := ca.Sign(SignRequest{Name: "x", CSR: newTestCSR(t, "x"), Profile: "unknown", NotAfter: time.Now().Add(time.Hour)}); err == nil {
+		t.Fatal("Expect error signing with an unknown profile")
+	}
+	if _, err := ca.Sign(SignRequest{Name: "x", CSR: newTestCSR(t, "x"), Profile: ProfileSVID, NotAfter: time.Now().Add(time.Hour)}); err == nil {
+		t.Fatal("Expect error signing an SVID for a request without a SPIFFE ID")
+	}
+
+	entries, err := ca.Certificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Name != "host" || entries[0].Operator != "tester" || entries[0].Status != depot.StatusIssued {
+		t.Fatalf("Unexpected index entries %+v", entries)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	ca := newTestCA(t)
+	crt, err := ca.Sign(SignRequest{Name: "host", CSR: newTestCSR(t, "host"), NotAfter: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := crt.GetRawCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The certificate is not in the depot, and is found in the index
+	entry, err := ca.FindCertificate("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.Revoke(entry, ReasonSuperseded, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.FindCertificate("host"); err == nil {
+		t.Fatal("Expect error finding a revoked certificate")
+	}
+
+	crl, err := ca.CRL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := x509.ParseDERCRL(crl.DERBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked := list.TBSCertList.RevokedCertificates; len(revoked) != 1 || revoked[0].SerialNumber.Cmp(raw.SerialNumber) != 0 {
+		t.Fatalf("Unexpected revoked certificates %+v", revoked)
+	}
+
+	entries, err := ca.Certificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Status != depot.StatusSuperseded || entries[0].Operator != "tester" {
+		t.Fatalf("Unexpected index entries %+v", entries)
+	}
+}
+
+func TestRevokeOtherCA(t *testing.T) {
+	ca, other := newTestCA(t), newTestCA(t)
+	crt, err := other.Sign(SignRequest{Name: "host", CSR: newTestCSR(t, "host"), NotAfter: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := depot.PutCertificate(ca.d, "host", crt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.FindCertificate("host"); err == nil {
+		t.Fatal("Expect error finding a certificate issued by another CA")
+	}
+
+	crt, err = ca.Sign(SignRequest{Name: "own", CSR: newTestCSR(t, "own"), NotAfter: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := depot.PutCertificate(ca.d, "own", crt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.FindCertificate("own"); err != nil {
+		t.Fatal("Failed finding a certificate of the CA:", err)
+	}
+}
+
+func TestSignWithoutName(t *testing.T) {
+	ca := newTestCA(t)
+	crt, err := ca.Sign(SignRequest{CSR: newTestCSR(t, "host"), NotAfter: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := crt.GetRawCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ca.Certificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial := fmt.Sprintf("%X", raw.SerialNumber); len(entries) != 1 || entries[0].Name != serial {
+		t.Fatalf("Expect the certificate to be recorded under its serial number %s, got %+v", serial, entries)
+	}
+}
+
+func TestSignWeakKey(t *testing.T) {
+	ca := newTestCA(t)
+	key, err := pkix.CreateRSAKey(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := pkix.CreateCertificateSigningRequest(key, "", nil, []string{"weak"}, nil, "", "", "", "", "weak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.Sign(SignRequest{Name: "weak", CSR: csr, NotAfter: time.Now().Add(time.Hour)}); !errors.Is(err, ErrWeakKey) {
+		t.Fatalf("Expect ErrWeakKey signing a request with a weak key, got %v", err)
+	}
+	if _, err := ca.Sign(SignRequest{Name: "weak", CSR: csr, NotAfter: time.Now().Add(time.Hour), AllowWeak: true}); err != nil {
+		t.Fatal("Failed signing a request with a weak key with AllowWeak:", err)
+	}
+}
+
+func TestNewCANotCA(t *testing.T) {
+	ca := newTestCA(t)
+	crt, err := ca.Sign(SignRequest{Name: "host", CSR: newTestCSR(t, "host"), NotAfter: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := depot.PutCertificate(ca.d, "host", crt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCA(ca.d, "host", ca.key); err == nil {
+		t.Fatal("Expect error loading a host certificate as CA")
+	}
+}
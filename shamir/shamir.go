@@ -0,0 +1,119 @@
+// Package shamir implements Shamir's secret sharing over GF(256): a secret is split into
+// shares such that any threshold of them recombine it, while fewer reveal nothing about it.
+//
+// Each share holds one byte per byte of the secret, followed by the x coordinate it was
+// evaluated at. The arithmetic is constant time.
+package shamir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxShares is the largest number of shares a secret can be split into
+const MaxShares = 255
+
+// Split splits secret into the given number of shares, any threshold of which recombine it.
+// The coefficients of the polynomials are read from rand.
+func Split(rand io.Reader, secret []byte, shares, threshold int) ([][]byte, error) {
+	switch {
+	case len(secret) == 0:
+		return nil, errors.New("cannot split an empty secret")
+	case threshold < 2:
+		return nil, errors.New("threshold must be at least 2")
+	case shares < threshold:
+		return nil, errors.New("there must be at least as many shares as the threshold")
+	case shares > MaxShares:
+		return nil, fmt.Errorf("cannot split a secret into more than %d shares", MaxShares)
+	}
+
+	out := make([][]byte, shares)
+	for i := range out {
+		out[i] = make([]byte, len(secret)+1)
+		out[i][len(secret)] = byte(i + 1)
+	}
+	// One random polynomial of degree threshold-1 per byte, whose constant term is the byte
+	coefficients := make([]byte, threshold)
+	for b, s := range secret {
+		if _, err := io.ReadFull(rand, coefficients[1:]); err != nil {
+			return nil, err
+		}
+		coefficients[0] = s
+		for i := range out {
+			out[i][b] = evaluate(coefficients, byte(i+1))
+		}
+	}
+	return out, nil
+}
+
+// Combine recombines the secret from shares made by Split. With fewer shares than the
+// threshold, the result is unrelated to the secret.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least 2 shares are required")
+	}
+	length := len(shares[0])
+	if length < 2 {
+		return nil, errors.New("share is too short")
+	}
+	xs := make([]byte, len(shares))
+	for i, share := range shares {
+		if len(share) != length {
+			return nil, errors.New("shares have different lengths")
+		}
+		xs[i] = share[length-1]
+		if xs[i] == 0 {
+			return nil, errors.New("invalid share")
+		}
+		for _, x := range xs[:i] {
+			if x == xs[i] {
+				return nil, errors.New("duplicate share")
+			}
+		}
+	}
+
+	// Lagrange interpolation at x = 0
+	secret := make([]byte, length-1)
+	for i, share := range shares {
+		basis := byte(1)
+		for j, x := range xs {
+			if j != i {
+				basis = mul(basis, div(x, x^xs[i]))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= mul(share[b], basis)
+		}
+	}
+	return secret, nil
+}
+
+// evaluate returns the polynomial with the given coefficients, lowest degree first, at x
+func evaluate(coefficients []byte, x byte) byte {
+	var y byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ coefficients[i]
+	}
+	return y
+}
+
+// mul multiplies in GF(256) with the AES polynomial x^8 + x^4 + x^3 + x + 1
+func mul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= -(b & 1) & a
+		a = a<<1 ^ -(a>>7)&0x1b
+		b >>= 1
+	}
+	return p
+}
+
+// div divides a by b, which must not be 0, as a times b^254
+func div(a, b byte) byte {
+	inv := b
+	for i := 0; i < 6; i++ {
+		inv = mul(mul(inv, inv), b)
+	}
+	return mul(a, mul(inv, inv))
+}
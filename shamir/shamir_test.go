@@ -0,0 +1,93 @@
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestField(t *testing.T) {
+	// Examples from FIPS 197
+	if p := mul(0x57, 0x83); p != 0xc1 {
+		t.Fatalf("0x57 * 0x83 = %#x, want 0xc1", p)
+	}
+	if p := mul(0x57, 0x13); p != 0xfe {
+		t.Fatalf("0x57 * 0x13 = %#x, want 0xfe", p)
+	}
+	for a := 1; a < 256; a++ {
+		if q := div(byte(a), byte(a)); q != 1 {
+			t.Fatalf("%#x / %#x = %#x, want 1", a, a, q)
+		}
+		if p := mul(div(1, byte(a)), byte(a)); p != 1 {
+			t.Fatalf("inverse of %#x is wrong", a)
+		}
+	}
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("the passphrase of the root key")
+	shares, err := Split(rand.Reader, secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("got %d shares, want 5", len(shares))
+	}
+
+	// Any 3 or more shares recombine the secret
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3}, {0, 1, 2, 3, 4}} {
+		var parts [][]byte
+		for _, i := range subset {
+			parts = append(parts, shares[i])
+		}
+		got, err := Combine(parts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Fatalf("shares %v recombined %q", subset, got)
+		}
+	}
+
+	// Fewer do not
+	got, err := Combine(shares[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(got, secret) {
+		t.Fatal("2 of 3 required shares recombined the secret")
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	for _, tc := range []struct {
+		secret            []byte
+		shares, threshold int
+	}{
+		{nil, 3, 2},
+		{[]byte("secret"), 3, 1},
+		{[]byte("secret"), 2, 3},
+		{[]byte("secret"), 256, 2},
+	} {
+		if _, err := Split(rand.Reader, tc.secret, tc.shares, tc.threshold); err == nil {
+			t.Errorf("Split(%q, %d, %d) did not fail", tc.secret, tc.shares, tc.threshold)
+		}
+	}
+}
+
+func TestCombineErrors(t *testing.T) {
+	shares, err := Split(rand.Reader, []byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, parts := range map[string][][]byte{
+		"one share":        {shares[0]},
+		"duplicate shares": {shares[0], shares[0]},
+		"different length": {shares[0], shares[1][1:]},
+		"zero x":           {shares[0], append(shares[1][:len(shares[1])-1:len(shares[1])-1], 0)},
+	} {
+		if _, err := Combine(parts); err == nil {
+			t.Errorf("%s: Combine did not fail", name)
+		}
+	}
+}
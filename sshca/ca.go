@@ -0,0 +1,107 @@
+// Package sshca implements an OpenSSH certificate authority with keys from a depot: signing
+// user and host certificates, and keeping a key revocation list (KRL) of revoked certificates
+// and keys in the format of ssh-keygen.
+package sshca
+
+import (
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/square/certstrap/pkix"
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultUserExtensions are the extensions of user certificates by default, as set by ssh-keygen
+var DefaultUserExtensions = []string{
+	"permit-X11-forwarding",
+	"permit-agent-forwarding",
+	"permit-port-forwarding",
+	"permit-pty",
+	"permit-user-rc",
+}
+
+// CA signs OpenSSH certificates
+type CA struct {
+	signer ssh.Signer
+}
+
+// NewCA creates a CA signing with key, which may be RSA, ECDSA or Ed25519. RSA signatures
+// use SHA-512.
+func NewCA(key *pkix.Key) (*CA, error) {
+	priv, ok := key.Private.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key cannot sign")
+	}
+	signer, err := ssh.NewSignerFromSigner(priv)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{signer: signer}, nil
+}
+
+// PublicKey returns the public key of the CA, which servers and clients are configured to trust
+func (ca *CA) PublicKey() ssh.PublicKey {
+	return ca.signer.PublicKey()
+}
+
+// CertificateRequest describes a certificate to sign
+type CertificateRequest struct {
+	// PublicKey is the key to certify
+	PublicKey ssh.PublicKey
+	// CertType is ssh.UserCert or ssh.HostCert
+	CertType uint32
+	// KeyID identifies the certificate in the logs of sshd and in the KRL
+	KeyID string
+	// Principals are the user names or host names the certificate is valid for
+	Principals      []string
+	ValidAfter      time.Time
+	ValidBefore     time.Time
+	CriticalOptions map[string]string
+	Extensions      map[string]string
+}
+
+// Sign issues a certificate for req with a random serial number
+func (ca *CA) Sign(req CertificateRequest) (*ssh.Certificate, error) {
+	if req.CertType != ssh.UserCert && req.CertType != ssh.HostCert {
+		return nil, fmt.Errorf("unknown certificate type %d", req.CertType)
+	}
+	if len(req.Principals) == 0 {
+		// A certificate without principals is valid for any user or host
+		return nil, errors.New("at least one principal is required")
+	}
+	if !req.ValidBefore.After(req.ValidAfter) {
+		return nil, errors.New("certificate expires before it becomes valid")
+	}
+	if _, ok := req.PublicKey.(*ssh.Certificate); ok {
+		return nil, errors.New("cannot certify a certificate")
+	}
+	if req.CertType == ssh.HostCert && (len(req.CriticalOptions) > 0 || len(req.Extensions) > 0) {
+		return nil, errors.New("host certificates have no critical options or extensions")
+	}
+
+	var serial [8]byte
+	if _, err := io.ReadFull(pkix.Random(), serial[:]); err != nil {
+		return nil, err
+	}
+	crt := &ssh.Certificate{
+		Key:             req.PublicKey,
+		Serial:          binary.BigEndian.Uint64(serial[:]),
+		CertType:        req.CertType,
+		KeyId:           req.KeyID,
+		ValidPrincipals: req.Principals,
+		ValidAfter:      uint64(req.ValidAfter.Unix()),
+		ValidBefore:     uint64(req.ValidBefore.Unix()),
+		Permissions: ssh.Permissions{
+			CriticalOptions: req.CriticalOptions,
+			Extensions:      req.Extensions,
+		},
+	}
+	if err := crt.SignCert(pkix.Random(), ca.signer); err != nil {
+		return nil, err
+	}
+	return crt, nil
+}
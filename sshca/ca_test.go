@@ -0,0 +1,142 @@
+package sshca
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/square/certstrap/pkix"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestCA(t *testing.T) *CA {
+	key, err := pkix.CreateRSAKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := NewCA(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func newTestKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSign(t *testing.T) {
+	ca := newTestCA(t)
+	req := CertificateRequest{
+		PublicKey:       newTestKey(t),
+		CertType:        ssh.UserCert,
+		KeyID:           "alice",
+		Principals:      []string{"alice", "deploy"},
+		ValidAfter:      time.Now().Add(-time.Minute),
+		ValidBefore:     time.Now().Add(time.Hour),
+		CriticalOptions: map[string]string{"source-address": "10.0.0.0/8"},
+		Extensions:      map[string]string{"permit-pty": ""},
+	}
+	crt, err := ca.Sign(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crt.Signature.Format != ssh.KeyAlgoRSASHA512 {
+		t.Fatalf("Certificate is signed with %s", crt.Signature.Format)
+	}
+
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return string(auth.Marshal()) == string(ca.PublicKey().Marshal())
+		},
+	}
+	if err := checker.CheckCert("deploy", crt); err != nil {
+		t.Fatal("Certificate does not check:", err)
+	}
+	if err := checker.CheckCert("root", crt); err == nil {
+		t.Fatal("Certificate is valid for a principal it was not issued for")
+	}
+
+	for _, bad := range []func(*CertificateRequest){
+		func(r *CertificateRequest) { r.Principals = nil },
+		func(r *CertificateRequest) { r.ValidBefore = r.ValidAfter },
+		func(r *CertificateRequest) { r.CertType = ssh.HostCert },
+		func(r *CertificateRequest) { r.PublicKey = crt },
+	} {
+		r := req
+		bad(&r)
+		if _, err := ca.Sign(r); err == nil {
+			t.Errorf("Expected an error signing %+v", r)
+		}
+	}
+}
+
+func TestKRL(t *testing.T) {
+	ca := newTestCA(t)
+	sign := func(id string) *ssh.Certificate {
+		crt, err := ca.Sign(CertificateRequest{
+			PublicKey:   newTestKey(t),
+			CertType:    ssh.HostCert,
+			KeyID:       id,
+			Principals:  []string{id + ".example.com"},
+			ValidAfter:  time.Now(),
+			ValidBefore: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return crt
+	}
+	bySerial, byID, byKey, valid := sign("a"), sign("b"), sign("c"), sign("d")
+	plainKey := newTestKey(t)
+
+	krl := NewKRL(ca.PublicKey(), "test")
+	krl.RevokeSerial(bySerial.Serial)
+	krl.RevokeKeyID("b")
+	krl.RevokeKey(byKey)
+	krl.RevokeKey(plainKey)
+	krl.RevokeSerial(bySerial.Serial)
+	krl.Version = 3
+	krl.GeneratedDate = time.Unix(1700000000, 0)
+
+	parsed, err := ParseKRL(krl.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Version != 3 || parsed.Comment != "test" || !parsed.GeneratedDate.Equal(krl.GeneratedDate) ||
+		len(parsed.Serials) != 1 || len(parsed.KeyIDs) != 1 || len(parsed.Keys) != 2 {
+		t.Fatalf("Parsed KRL %+v", parsed)
+	}
+	for _, key := range []ssh.PublicKey{bySerial, byID, byKey, byKey.Key, plainKey} {
+		if !parsed.IsRevoked(key) {
+			t.Errorf("Key %s is not revoked", ssh.FingerprintSHA256(key))
+		}
+	}
+	if parsed.IsRevoked(valid) || parsed.IsRevoked(valid.Key) {
+		t.Error("Certificate is revoked")
+	}
+
+	// Certificates of another CA are only revoked by key
+	other := newTestCA(t)
+	crt, err := other.Sign(CertificateRequest{PublicKey: newTestKey(t), CertType: ssh.HostCert, KeyID: "b",
+		Principals: []string{"b"}, ValidAfter: time.Now(), ValidBefore: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.IsRevoked(crt) {
+		t.Error("Certificate of another CA is revoked by key ID")
+	}
+
+	if _, err := ParseKRL(krl.Marshal()[:40]); err == nil {
+		t.Error("Expected an error parsing a truncated KRL")
+	}
+}
@@ -0,0 +1,306 @@
+package sshca
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// KRL format constants, see PROTOCOL.krl in the OpenSSH sources
+const (
+	krlMagic         = 0x5353484b524c0a00
+	krlFormatVersion = 1
+
+	krlSectionCertificates = 1
+	krlSectionExplicitKey  = 2
+
+	krlSectionCertSerialList = 0x20
+	krlSectionCertKeyID      = 0x23
+)
+
+// KRL is an OpenSSH key revocation list, as read by the RevokedKeys option of sshd and
+// by ssh-keygen -Q. It revokes certificates of one CA by serial number or key ID, and
+// keys and certificates of any CA by their public key.
+type KRL struct {
+	// Version is incremented every time the KRL changes
+	Version       uint64
+	GeneratedDate time.Time
+	Comment       string
+
+	// CAKey is the CA whose certificates are revoked by Serials and KeyIDs
+	CAKey   ssh.PublicKey
+	Serials []uint64
+	KeyIDs  []string
+	// Keys are revoked public keys. Certificates for these keys are revoked too.
+	Keys []ssh.PublicKey
+}
+
+// NewKRL creates an empty KRL for the certificates of ca
+func NewKRL(ca ssh.PublicKey, comment string) *KRL {
+	return &KRL{CAKey: ca, Comment: comment}
+}
+
+// RevokeSerial revokes the certificate of the CA with the given serial number
+func (k *KRL) RevokeSerial(serial uint64) {
+	for _, s := range k.Serials {
+		if s == serial {
+			return
+		}
+	}
+	k.Serials = append(k.Serials, serial)
+}
+
+// RevokeKeyID revokes every certificate of the CA with the given key ID
+func (k *KRL) RevokeKeyID(id string) {
+	for _, s := range k.KeyIDs {
+		if s == id {
+			return
+		}
+	}
+	k.KeyIDs = append(k.KeyIDs, id)
+}
+
+// RevokeKey revokes a public key, and every certificate for it
+func (k *KRL) RevokeKey(key ssh.PublicKey) {
+	if crt, ok := key.(*ssh.Certificate); ok {
+		key = crt.Key
+	}
+	for _, revoked := range k.Keys {
+		if bytes.Equal(revoked.Marshal(), key.Marshal()) {
+			return
+		}
+	}
+	k.Keys = append(k.Keys, key)
+}
+
+// IsRevoked reports whether key, a public key or a certificate, is revoked
+func (k *KRL) IsRevoked(key ssh.PublicKey) bool {
+	crt, isCert := key.(*ssh.Certificate)
+	if isCert {
+		key = crt.Key
+	}
+	for _, revoked := range k.Keys {
+		if bytes.Equal(revoked.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	if !isCert || k.CAKey == nil || !bytes.Equal(crt.SignatureKey.Marshal(), k.CAKey.Marshal()) {
+		return false
+	}
+	for _, s := range k.Serials {
+		if s == crt.Serial {
+			return true
+		}
+	}
+	for _, id := range k.KeyIDs {
+		if id == crt.KeyId {
+			return true
+		}
+	}
+	return false
+}
+
+// Marshal encodes the KRL in the binary format of OpenSSH
+func (k *KRL) Marshal() []byte {
+	var b []byte
+	b = appendUint64(b, krlMagic)
+	b = appendUint32(b, krlFormatVersion)
+	b = appendUint64(b, k.Version)
+	b = appendUint64(b, uint64(k.GeneratedDate.Unix()))
+	b = appendUint64(b, 0)   // flags
+	b = appendString(b, nil) // reserved
+	b = appendString(b, []byte(k.Comment))
+
+	if k.CAKey != nil && (len(k.Serials) > 0 || len(k.KeyIDs) > 0) {
+		section := appendString(nil, k.CAKey.Marshal())
+		section = appendString(section, nil) // reserved
+		if len(k.Serials) > 0 {
+			serials := append([]uint64{}, k.Serials...)
+			sort.Slice(serials, func(i, j int) bool { return serials[i] < serials[j] })
+			var list []byte
+			for _, s := range serials {
+				list = appendUint64(list, s)
+			}
+			section = append(section, krlSectionCertSerialList)
+			section = appendString(section, list)
+		}
+		if len(k.KeyIDs) > 0 {
+			ids := append([]string{}, k.KeyIDs...)
+			sort.Strings(ids)
+			var list []byte
+			for _, id := range ids {
+				list = appendString(list, []byte(id))
+			}
+			section = append(section, krlSectionCertKeyID)
+			section = appendString(section, list)
+		}
+		b = append(b, krlSectionCertificates)
+		b = appendString(b, section)
+	}
+
+	if len(k.Keys) > 0 {
+		// ssh-keygen expects keys in ascending order
+		var blobs [][]byte
+		for _, key := range k.Keys {
+			blobs = append(blobs, key.Marshal())
+		}
+		sort.Slice(blobs, func(i, j int) bool { return bytes.Compare(blobs[i], blobs[j]) < 0 })
+		var section []byte
+		for _, blob := range blobs {
+			section = appendString(section, blob)
+		}
+		b = append(b, krlSectionExplicitKey)
+		b = appendString(b, section)
+	}
+	return b
+}
+
+// ParseKRL parses a KRL in the binary format of OpenSSH. Only the sections written by
+// Marshal are supported.
+func ParseKRL(data []byte) (*KRL, error) {
+	r := &reader{b: data}
+	if r.uint64() != krlMagic {
+		return nil, errors.New("not a KRL")
+	}
+	if v := r.uint32(); v != krlFormatVersion {
+		return nil, fmt.Errorf("unsupported KRL format version %d", v)
+	}
+	k := &KRL{Version: r.uint64()}
+	k.GeneratedDate = time.Unix(int64(r.uint64()), 0)
+	r.uint64() // flags
+	r.string() // reserved
+	k.Comment = string(r.string())
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	for len(r.b) > 0 && r.err == nil {
+		sectionType := r.byte()
+		section := &reader{b: r.string()}
+		switch sectionType {
+		case krlSectionCertificates:
+			if k.CAKey != nil {
+				return nil, errors.New("KRLs revoking certificates of several CAs are not supported")
+			}
+			ca, err := ssh.ParsePublicKey(section.string())
+			if err != nil {
+				return nil, fmt.Errorf("invalid CA key in KRL: %v", err)
+			}
+			k.CAKey = ca
+			section.string() // reserved
+			for len(section.b) > 0 && section.err == nil {
+				subsectionType := section.byte()
+				subsection := &reader{b: section.string()}
+				switch subsectionType {
+				case krlSectionCertSerialList:
+					for len(subsection.b) > 0 && subsection.err == nil {
+						k.Serials = append(k.Serials, subsection.uint64())
+					}
+				case krlSectionCertKeyID:
+					for len(subsection.b) > 0 && subsection.err == nil {
+						k.KeyIDs = append(k.KeyIDs, string(subsection.string()))
+					}
+				default:
+					return nil, fmt.Errorf("unsupported KRL certificate section type 0x%x", subsectionType)
+				}
+				if subsection.err != nil {
+					return nil, subsection.err
+				}
+			}
+		case krlSectionExplicitKey:
+			for len(section.b) > 0 && section.err == nil {
+				key, err := ssh.ParsePublicKey(section.string())
+				if err != nil {
+					return nil, fmt.Errorf("invalid key in KRL: %v", err)
+				}
+				k.Keys = append(k.Keys, key)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported KRL section type %d", sectionType)
+		}
+		if section.err != nil {
+			return nil, section.err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return k, nil
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendString(b, s []byte) []byte {
+	b = appendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// reader reads the SSH wire encoding, keeping the first error
+type reader struct {
+	b   []byte
+	err error
+}
+
+var errTruncated = errors.New("truncated KRL")
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.b) < n {
+		r.err = errTruncated
+		r.b = nil
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *reader) string() []byte {
+	n := r.uint32()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(n) > uint64(len(r.b)) {
+		r.err = errTruncated
+		return nil
+	}
+	return r.next(int(n))
+}
@@ -0,0 +1,126 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// freeAddr returns a local address with a port nothing listens on
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// startServer runs certstrap with args in the background until the test ends,
+// and waits until url can be fetched with client
+func startServer(t *testing.T, client *http.Client, url string, args ...string) {
+	server := exec.Command(binPath, append([]string{"--depot-path", depotDir}, args...)...)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		server.Process.Kill()
+		server.Wait()
+	})
+
+	for i := 0; ; i++ {
+		res, err := client.Get(url)
+		if err == nil {
+			res.Body.Close()
+			return
+		}
+		if i == 50 {
+			t.Fatalf("Server did not start: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestACMEServe(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	if _, stderr, err := run(binPath, "init", "--passphrase", passphrase, "--common-name", "ACME CA", "--curve", "P-256"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+
+	addr := freeAddr(t)
+	directory := "http://" + addr + "/directory"
+	startServer(t, http.DefaultClient, directory, "acme", "serve", "--CA", "ACME CA", "--passphrase", passphrase,
+		"--listen", addr, "--mode", "trust-all", "--allow-domain", "example.com", "--expires", "30 days")
+
+	ctx := context.Background()
+	accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &acme.Client{Key: accountKey, DirectoryURL: directory}
+	if _, err := client.Register(ctx, &acme.Account{}, acme.AcceptTOS); err != nil {
+		t.Fatalf("Registering account failed: %v", err)
+	}
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs("www.example.com"))
+	if err != nil {
+		t.Fatalf("Creating order failed: %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "www.example.com"},
+		DNSNames: []string{"www.example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ders, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		t.Fatalf("Finalizing order failed: %v", err)
+	}
+	crt, err := x509.ParseCertificate(ders[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crt.CheckSignatureFrom(readCertificate(t, "ACME_CA.crt")); err != nil {
+		t.Fatalf("Certificate is not signed by the CA: %v", err)
+	}
+	if days := crt.NotAfter.Sub(time.Now()).Hours() / 24; days < 29 || days > 31 {
+		t.Fatalf("Certificate expires in %.1f days, want 30", days)
+	}
+
+	index, err := os.ReadFile(filepath.Join(depotDir, "ACME_CA.index"))
+	if err != nil {
+		t.Fatalf("Reading CA index failed: %v", err)
+	}
+	// Requesters choose the names of their certificates, so they are recorded under their serial number
+	if !strings.Contains(string(index), fmt.Sprintf(`"name":"%X"`, crt.SerialNumber)) {
+		t.Fatalf("Issued certificate is not in the CA index: %s", index)
+	}
+
+	if _, err := client.AuthorizeOrder(ctx, acme.DomainIDs("www.example.org")); err == nil {
+		t.Fatal("Ordering a domain outside --allow-domain succeeded")
+	}
+}
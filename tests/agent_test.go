@@ -0,0 +1,101 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAgent(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	for _, args := range [][]string{
+		{"init", "--passphrase", passphrase, "--common-name", "Agent CA", "--curve", "P-256"},
+		{"request-cert", "--passphrase", "", "--common-name", "web", "--curve", "P-256"},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+		}
+	}
+	hooked, err := filepath.Abs(filepath.Join(depotDir, "hooked"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := func(args ...string) {
+		t.Helper()
+		args = append([]string{"agent", "--once", "--CA", "Agent CA", "--passphrase", passphrase, "--expires", "1 hour",
+			"--hook", "echo $CERTSTRAP_RENEWED >> " + hooked}, args...)
+		if _, stderr, err := run(binPath, append(args, "web")...); err != nil {
+			t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+		}
+	}
+
+	// web has no certificate, it is issued one at once
+	agent()
+	first := readCertificate(t, "web.crt")
+	if err := first.CheckSignatureFrom(readCertificate(t, "Agent_CA.crt")); err != nil {
+		t.Fatalf("Certificate is not signed by the CA: %v", err)
+	}
+	// and it is not due again until most of its lifetime has passed
+	agent()
+	if readCertificate(t, "web.crt").SerialNumber.Cmp(first.SerialNumber) != 0 {
+		t.Fatal("Certificate was renewed before it was due")
+	}
+	agent("--renew-fraction", "0.1")
+	if readCertificate(t, "web.crt").SerialNumber.Cmp(first.SerialNumber) == 0 {
+		t.Fatal("Certificate was not renewed when due")
+	}
+	if data, err := os.ReadFile(hooked); err != nil || string(data) != "web\nweb\n" {
+		t.Fatalf("Hook ran with %q, %v, want twice for web", data, err)
+	}
+}
+
+func TestAgentRemote(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	for _, args := range [][]string{
+		{"init", "--passphrase", passphrase, "--common-name", "API CA", "--curve", "P-256"},
+		{"request-cert", "--passphrase", "", "--common-name", "api-server", "--ip", "127.0.0.1", "--curve", "P-256"},
+		{"sign", "--passphrase", passphrase, "--CA", "API CA", "api-server"},
+		{"request-cert", "--passphrase", "", "--common-name", "app.ci.example.com", "--curve", "P-256"},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+		}
+	}
+	policies := filepath.Join(depotDir, "api-policy.json")
+	if err := os.WriteFile(policies, []byte(`{"clients": [
+		{"name": "agent", "token": "agent-token", "domains": ["ci.example.com"], "max_expires": "1 day"}
+	]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(readCertificate(t, "API_CA.crt"))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	addr := freeAddr(t)
+	startServer(t, client, "https://"+addr+"/v1/chain", "serve", "--CA", "API CA", "--passphrase", passphrase, "--listen", addr,
+		"--tls-cert", filepath.Join(depotDir, "api-server.crt"), "--tls-key", filepath.Join(depotDir, "api-server.key"),
+		"--policy-file", policies)
+
+	args := []string{"agent", "--once", "--server", "https://" + addr, "--server-ca", filepath.Join(depotDir, "API_CA.crt")}
+	if _, stderr, err := run(binPath, append(args, "--token", "wrong", "app.ci.example.com")...); err == nil || !strings.Contains(stderr, "invalid credentials") {
+		t.Fatalf("Expected an authentication error, got %v, %v", stderr, err)
+	}
+	if _, stderr, err := run(binPath, append(args, "--token", "agent-token", "app.ci.example.com")...); err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	crt := readCertificate(t, "app.ci.example.com.crt")
+	if err := crt.CheckSignatureFrom(readCertificate(t, "API_CA.crt")); err != nil {
+		t.Fatalf("Certificate is not signed by the CA: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const applyManifest = `
+certificates:
+  - name: web
+    issuer: Issuing CA
+    subject:
+      common-name: web.example.com
+    sans:
+      dns: [web.example.com]
+      ip: [10.0.0.1]
+    key: P-256
+    lifetime: 90 days
+  - name: Issuing CA
+    kind: intermediate
+    issuer: Root CA
+    key: P-256
+    lifetime: 1 year
+  - name: Root CA
+    kind: ca
+    key: P-384
+    lifetime: 2 years
+    subject:
+      organization: Example
+`
+
+func TestApply(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+	path := filepath.Join(t.TempDir(), "pki.yaml")
+	if err := os.WriteFile(path, []byte(applyManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := run(binPath, "apply", "--dry-run", "-f", path)
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if !strings.HasPrefix(stdout, "Plan: 3 to create, 0 unchanged.\n  + Root_CA (root CA") {
+		t.Fatalf("Unexpected plan:\n%s", stdout)
+	}
+	if _, err := os.Stat(filepath.Join(depotDir, "Root_CA.crt")); !os.IsNotExist(err) {
+		t.Fatal("Dry run created Root_CA.crt")
+	}
+
+	if _, stderr, err := run(binPath, "apply", "--passphrase", passphrase, "-f", path); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	root := readCertificate(t, "Root_CA.crt")
+	intermediate := readCertificate(t, "Issuing_CA.crt")
+	web := readCertificate(t, "web.crt")
+	if root.Subject.Organization[0] != "Example" || root.MaxPathLen != 1 || intermediate.MaxPathLen != 0 || !intermediate.MaxPathLenZero {
+		t.Fatalf("Unexpected CA path lengths %d, %d", root.MaxPathLen, intermediate.MaxPathLen)
+	}
+	if web.Subject.CommonName != "web.example.com" || len(web.IPAddresses) != 1 {
+		t.Fatalf("Unexpected certificate %v, %v", web.Subject, web.IPAddresses)
+	}
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	roots.AddCert(root)
+	intermediates.AddCert(intermediate)
+	if _, err := web.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, DNSName: "web.example.com"}); err != nil {
+		t.Fatal("Certificate does not verify:", err)
+	}
+
+	// Applying again changes nothing, and applying an addition creates only the addition
+	stdout, stderr, err = run(binPath, "apply", "-f", path)
+	if stderr != "" || err != nil || !strings.HasPrefix(stdout, "Plan: 0 to create, 3 unchanged.") {
+		t.Fatalf("Unexpected plan: %v, %v, %v", stdout, stderr, err)
+	}
+	if !readCertificate(t, "web.crt").Equal(web) {
+		t.Fatal("Applying again replaced a certificate")
+	}
+	added := applyManifest + `
+  - name: api
+    issuer: Issuing CA
+    sans:
+      dns: [api.example.com]
+`
+	if err := os.WriteFile(path, []byte(added), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, err = run(binPath, "apply", "--passphrase", passphrase, "-f", path)
+	if stderr != "" || err != nil || !strings.HasPrefix(stdout, "Plan: 1 to create, 3 unchanged.") {
+		t.Fatalf("Unexpected plan: %v, %v, %v", stdout, stderr, err)
+	}
+	if api := readCertificate(t, "api.crt"); api.Issuer.CommonName != "Issuing CA" {
+		t.Fatalf("Certificate is issued by %v", api.Issuer)
+	}
+
+	if err := os.WriteFile(path, []byte(`certificates: [{name: leaf, issuer: Missing CA}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, err := run(binPath, "apply", "--dry-run", "-f", path); err == nil {
+		t.Fatalf("Expected an error applying a manifest with a missing issuer, got %v", stderr)
+	}
+}
@@ -22,8 +22,12 @@ package tests
 
 import (
 	"bytes"
+	"crypto/x509"
+	"encoding/pem"
 	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -57,6 +61,24 @@ func runWithStdin(stdin io.Reader, command string, args ...string) (string, stri
 	return stdoutBytes.String(), stderrBytes.String(), err
 }
 
+// readCertificate parses a PEM certificate file from the test depot
+func readCertificate(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(depotDir, name))
+	if err != nil {
+		t.Fatalf("Reading cert failed: %v", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		t.Fatalf("No PEM block in %s", name)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Parsing cert failed: %v", err)
+	}
+	return cert
+}
+
 func TestVersion(t *testing.T) {
 	stdout, stderr, err := run(binPath, "--version")
 	if stderr != "" || err != nil {
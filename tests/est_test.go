@@ -0,0 +1,158 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	certpkix "github.com/square/certstrap/pkix"
+)
+
+func TestESTServe(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	for _, args := range [][]string{
+		{"init", "--passphrase", passphrase, "--common-name", "EST CA", "--curve", "P-256"},
+		{"init", "--passphrase", passphrase, "--common-name", "Client CA", "--curve", "P-256"},
+		{"request-cert", "--passphrase", "", "--common-name", "est-server", "--ip", "127.0.0.1", "--curve", "P-256"},
+		{"sign", "--passphrase", passphrase, "--CA", "EST CA", "est-server"},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+		}
+	}
+	users := filepath.Join(depotDir, "est-users")
+	if err := os.WriteFile(users, []byte("# lab devices\nsensor:s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	domains := filepath.Join(depotDir, "est-domains")
+	if err := os.WriteFile(domains, []byte("sensor:sensors.example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	serveArgs := []string{"est", "serve", "--CA", "EST CA", "--passphrase", passphrase,
+		"--tls-cert", filepath.Join(depotDir, "est-server.crt"), "--tls-key", filepath.Join(depotDir, "est-server.key"),
+		"--users-file", users, "--domains-file", domains}
+
+	// The issuing CA cannot authenticate clients
+	if _, stderr, err := run(binPath, serveArgs...); err == nil || !strings.Contains(stderr, "--client-ca") {
+		t.Fatalf("Expect est serve without --client-ca to fail, got: %v, %v", stderr, err)
+	}
+	if _, stderr, err := run(binPath, append(serveArgs, "--client-ca", "EST CA")...); err == nil || !strings.Contains(stderr, "cannot be a client CA") {
+		t.Fatalf("Expect est serve with the issuing CA as client CA to fail, got: %v, %v", stderr, err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(readCertificate(t, "EST_CA.crt"))
+	transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}
+	client := &http.Client{Transport: transport}
+
+	addr := freeAddr(t)
+	url := "https://" + addr + "/.well-known/est/"
+	startServer(t, client, url+"cacerts", append(serveArgs, "--client-ca", "Client CA", "--listen", addr)...)
+
+	enroll := func(op string, csr []byte, user, pass string) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodPost, url+op, strings.NewReader(base64.StdEncoding.EncodeToString(csr)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/pkcs10")
+		if user != "" {
+			req.SetBasicAuth(user, pass)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, body
+	}
+	parseResponse := func(body []byte) *x509.Certificate {
+		der, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(body), nil)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		crts, err := certpkix.NewCertificatesFromPKCS7(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := crts[0].GetRawCertificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "sensor-0042.sensors.example.com"}}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "est-server"}}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res, _ := enroll("simpleenroll", csr, "sensor", "wrong"); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Enrolling with a wrong password: got status %s, want 401", res.Status)
+	}
+	if res, _ := enroll("simpleenroll", outside, "sensor", "s3cret"); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("Enrolling outside the user domains: got status %s, want 403", res.Status)
+	}
+	res, body := enroll("simpleenroll", csr, "sensor", "s3cret")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Enrolling failed: %s: %s", res.Status, body)
+	}
+	crt := parseResponse(body)
+	if err := crt.CheckSignatureFrom(readCertificate(t, "EST_CA.crt")); err != nil {
+		t.Fatalf("Enrolled certificate is not signed by the CA: %v", err)
+	}
+
+	// Re-enroll with the enrolled certificate as client certificate
+	transport.TLSClientConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{crt.Raw}, PrivateKey: key}}
+	transport.CloseIdleConnections()
+	res, body = enroll("simplereenroll", csr, "", "")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Re-enrolling failed: %s: %s", res.Status, body)
+	}
+	renewed := parseResponse(body)
+	if renewed.SerialNumber.Cmp(crt.SerialNumber) == 0 {
+		t.Fatal("Re-enrollment returned the same certificate")
+	}
+	// The enrolled certificate does not authenticate enrollment for other names
+	if res, _ := enroll("simpleenroll", outside, "", ""); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Enrolling with a certificate of the issuing CA: got status %s, want 401", res.Status)
+	}
+
+	index, err := os.ReadFile(filepath.Join(depotDir, "EST_CA.index"))
+	if err != nil {
+		t.Fatalf("Reading CA index failed: %v", err)
+	}
+	for _, enrolled := range []*x509.Certificate{crt, renewed} {
+		if !strings.Contains(string(index), fmt.Sprintf(`"name":"%X"`, enrolled.SerialNumber)) {
+			t.Fatalf("CA index does not record the enrolled certificate %X under its serial number: %s", enrolled.SerialNumber, index)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/square/certstrap/pkix"
+)
+
+func parsePEMCertificates(t *testing.T, data []byte) []*x509.Certificate {
+	var crts []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		crt, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatalf("Failed parsing certificate: %v", err)
+		}
+		crts = append(crts, crt)
+	}
+	return crts
+}
+
+func TestExport(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	for _, args := range [][]string{
+		{"init", "--passphrase", passphrase, "--common-name", "Root", "--curve", "P-256", "--path-length", "1"},
+		{"init", "--passphrase", passphrase, "--common-name", "OtherRoot", "--curve", "P-256"},
+		{"request-cert", "--passphrase", "", "--common-name", "Inter", "--curve", "P-256"},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+		}
+	}
+	if _, _, err := run(binPath, "sign", "--passphrase", passphrase, "--CA", "Root", "--intermediate", "Inter"); err != nil {
+		t.Fatalf("Received unexpected error: %v", err)
+	}
+	for _, args := range [][]string{
+		{"request-cert", "--passphrase", "", "--common-name", hostname, "--domain", "host1.example.com", "--curve", "P-256"},
+		{"sign", "--passphrase", "", "--CA", "Inter", hostname},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+		}
+	}
+
+	stdout, stderr, err := run(binPath, "export", hostname)
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if crts := parsePEMCertificates(t, []byte(stdout)); len(crts) != 1 || crts[0].Subject.CommonName != hostname {
+		t.Fatalf("Expect only the leaf certificate, got %d certificates", len(crts))
+	}
+
+	stdout, stderr, err = run(binPath, "export", "--chain", hostname)
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	crts := parsePEMCertificates(t, []byte(stdout))
+	if len(crts) != 2 || crts[0].Subject.CommonName != hostname || crts[1].Subject.CommonName != "Inter" {
+		t.Fatalf("Expect leaf and intermediate, got %d certificates", len(crts))
+	}
+
+	out := filepath.Join(depotDir, "chain.pem")
+	if _, stderr, err = run(binPath, "export", "--chain", "--include-root", "--out", out, hostname); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed reading chain: %v", err)
+	}
+	crts = parsePEMCertificates(t, data)
+	if len(crts) != 3 || crts[2].Subject.CommonName != "Root" {
+		t.Fatalf("Expect chain to end with the root, got %d certificates", len(crts))
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(crts[2])
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(crts[1])
+	if _, err := crts[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, DNSName: "host1.example.com"}); err != nil {
+		t.Fatalf("Exported chain does not verify: %v", err)
+	}
+
+	stdout, stderr, err = run(binPath, "export", "bundle")
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	crts = parsePEMCertificates(t, []byte(stdout))
+	if len(crts) != 2 || crts[0].Subject.CommonName != "OtherRoot" || crts[1].Subject.CommonName != "Root" {
+		t.Fatalf("Expect bundle of both roots, got %d certificates", len(crts))
+	}
+
+	keystore := filepath.Join(depotDir, "host.jks")
+	if _, stderr, err = run(binPath, "export", "--format", "jks", "--store-password", "changeit", "--out", keystore, hostname); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if fi, err := os.Stat(keystore); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Fatalf("Expect keystore only readable by its owner, got %v", fi.Mode())
+	}
+	data, err = os.ReadFile(keystore)
+	if err != nil {
+		t.Fatalf("Failed reading keystore: %v", err)
+	}
+	entries, err := pkix.ParseJKS(data, []byte("changeit"))
+	if err != nil {
+		t.Fatalf("Failed parsing keystore: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Alias != hostname || entries[0].Key == nil || len(entries[0].Certificates) != 3 {
+		t.Fatalf("Unexpected keystore entries: %+v", entries)
+	}
+
+	stdout, stderr, err = run(binPath, "export", "--format", "jks", "--truststore", "--store-password", "changeit", hostname)
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	entries, err = pkix.ParseJKS([]byte(stdout), []byte("changeit"))
+	if err != nil {
+		t.Fatalf("Failed parsing truststore: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Alias != "root" || entries[0].Key != nil {
+		t.Fatalf("Unexpected truststore entries: %+v", entries)
+	}
+
+	// The store password can come from any of the passphrase sources
+	storePassFile := filepath.Join(depotDir, "store-password")
+	if err := os.WriteFile(storePassFile, []byte("changeit\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, err = run(binPath, "export", "bundle", "--format", "jks", "--store-password-file", storePassFile)
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if entries, err = pkix.ParseJKS([]byte(stdout), []byte("changeit")); err != nil || len(entries) != 2 {
+		t.Fatalf("Unexpected truststore bundle: %v", err)
+	}
+
+	stdout, stderr, err = run(binPath, "export", "--format", "k8s-secret", "--namespace", "prod", "--label", "app=web", hostname)
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	secret := parseSecretData(t, stdout)
+	if !strings.Contains(stdout, "type: kubernetes.io/tls\n") || !strings.Contains(stdout, "namespace: \"prod\"\n") || !strings.Contains(stdout, "\"app\": \"web\"\n") {
+		t.Fatalf("Unexpected secret manifest:\n%s", stdout)
+	}
+	if crts := parsePEMCertificates(t, secret["tls.crt"]); len(crts) != 2 || crts[0].Subject.CommonName != hostname {
+		t.Fatalf("Expect leaf and intermediate in tls.crt, got %d certificates", len(crts))
+	}
+	if crts := parsePEMCertificates(t, secret["ca.crt"]); len(crts) != 1 || crts[0].Subject.CommonName != "Root" {
+		t.Fatal("Expect root in ca.crt")
+	}
+	if _, err := tls.X509KeyPair(secret["tls.crt"], secret["tls.key"]); err != nil {
+		t.Fatalf("Secret does not hold a valid key pair: %v", err)
+	}
+
+	secretFile := filepath.Join(depotDir, "host.yaml")
+	if _, stderr, err = run(binPath, "export", "--format", "k8s-secret", "--out", secretFile, hostname); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if fi, err := os.Stat(secretFile); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Fatalf("Expect secret only readable by its owner, got %v", fi.Mode())
+	}
+
+	stdout, stderr, err = run(binPath, "export", "--format", "k8s-ca-secret", "--passphrase", passphrase, "--secret-name", "root-ca", "Root")
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	secret = parseSecretData(t, stdout)
+	if !strings.Contains(stdout, "name: \"root-ca\"\n") {
+		t.Fatalf("Unexpected secret manifest:\n%s", stdout)
+	}
+	if _, err := tls.X509KeyPair(secret["tls.crt"], secret["tls.key"]); err != nil {
+		t.Fatalf("CA secret does not hold a valid key pair: %v", err)
+	}
+
+	if _, _, err = run(binPath, "export", "--format", "k8s-ca-secret", hostname); err == nil {
+		t.Fatal("Expect error exporting a leaf as CA secret")
+	}
+}
+
+// parseSecretData returns the decoded data of a Secret manifest written by export
+func parseSecretData(t *testing.T, manifest string) map[string][]byte {
+	data := map[string][]byte{}
+	inData := false
+	for _, line := range strings.Split(manifest, "\n") {
+		if line == "data:" {
+			inData = true
+			continue
+		}
+		if !inData || line == "" {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimSpace(line), ": ", 2)
+		b, err := base64.StdEncoding.DecodeString(kv[1])
+		if err != nil {
+			t.Fatalf("Failed decoding secret data %s: %v", kv[0], err)
+		}
+		data[kv[0]] = b
+	}
+	return data
+}
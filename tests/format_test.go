@@ -0,0 +1,99 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/square/certstrap/pkcs7"
+)
+
+func TestFormats(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	csrPath := filepath.Join(depotDir, "host.der")
+	for _, args := range [][]string{
+		{"init", "--passphrase", passphrase, "--common-name", "CA", "--curve", "P-256", "--format", "der"},
+		{"request-cert", "--passphrase", "", "--common-name", hostname, "--curve", "P-256", "--format", "jwk"},
+		{"sign", "--passphrase", passphrase, "--CA", "CA", "--format", "pkcs7", hostname},
+		{"request-cert", "--passphrase", "", "--common-name", "host2", "--curve", "P-256", "--format", "der", "--csr", csrPath},
+		{"sign", "--passphrase", passphrase, "--CA", "CA", "--csr", csrPath, "--format", "der", "--cert", filepath.Join(depotDir, "host2.cer"), "host2"},
+		{"request-cert", "--passphrase", "", "--common-name", "host3", "--curve", "P-256", "--format", "jwk"},
+		{"sign", "--passphrase", passphrase, "--CA", "CA", "--format", "jwk", "host3"},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error running %v: %v, %v", args, stderr, err)
+		}
+	}
+
+	// depot files stay PEM
+	ca := readCertificate(t, "CA.crt")
+	readCertificate(t, hostname+".crt")
+
+	der, err := os.ReadFile(filepath.Join(depotDir, "CA.cer"))
+	if err != nil {
+		t.Fatalf("Failed reading DER certificate: %v", err)
+	}
+	if crt, err := x509.ParseCertificate(der); err != nil || !crt.Equal(ca) {
+		t.Fatalf("DER certificate does not match the CA: %v", err)
+	}
+
+	p7b, err := os.ReadFile(filepath.Join(depotDir, hostname+".p7b"))
+	if err != nil {
+		t.Fatalf("Failed reading PKCS#7 certificates: %v", err)
+	}
+	sd, err := pkcs7.ParseSignedData(p7b)
+	if err != nil {
+		t.Fatalf("Failed parsing PKCS#7 certificates: %v", err)
+	}
+	if len(sd.Certificates) != 2 {
+		t.Fatalf("Expect certificate and CA in PKCS#7, got %d certificates", len(sd.Certificates))
+	}
+
+	var jwk map[string]interface{}
+	data, err := os.ReadFile(filepath.Join(depotDir, hostname+".csr.jwk"))
+	if err != nil {
+		t.Fatalf("Failed reading JWK: %v", err)
+	}
+	if err := json.Unmarshal(data, &jwk); err != nil || jwk["kty"] != "EC" || jwk["d"] != nil {
+		t.Fatalf("Unexpected public key JWK: %s", data)
+	}
+
+	// The JWK of a request and of its certificate are different files
+	data, err = os.ReadFile(filepath.Join(depotDir, "host3.jwk"))
+	if err != nil {
+		t.Fatalf("Failed reading certificate JWK: %v", err)
+	}
+	jwk = nil
+	if err := json.Unmarshal(data, &jwk); err != nil || jwk["x5c"] == nil {
+		t.Fatalf("Unexpected certificate JWK: %s", data)
+	}
+	if _, err := os.Stat(filepath.Join(depotDir, "host3.csr.jwk")); err != nil {
+		t.Fatalf("Request JWK was not kept: %v", err)
+	}
+
+	der, err = os.ReadFile(filepath.Join(depotDir, "host2.cer"))
+	if err != nil {
+		t.Fatalf("Failed reading DER certificate: %v", err)
+	}
+	if _, err := x509.ParseCertificate(der); err != nil {
+		t.Fatalf("Failed parsing DER certificate: %v", err)
+	}
+
+	stdout, stderr, err := run(binPath, "export", "bundle", "--format", "jwk")
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	var jwks struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &jwks); err != nil || len(jwks.Keys) != 1 {
+		t.Fatalf("Unexpected JWKS: %s", stdout)
+	}
+}
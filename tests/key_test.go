@@ -0,0 +1,62 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestKeyPasswd(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	for _, args := range [][]string{
+		{"init", "--passphrase", passphrase, "--common-name", "CA", "--curve", "P-256"},
+		{"request-cert", "--passphrase", "", "--common-name", "host", "--curve", "P-256"},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+		}
+	}
+	keyPath := filepath.Join(depotDir, "CA.key")
+	if err := os.Chmod(keyPath, 0400); err != nil {
+		t.Fatal(err)
+	}
+	original, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, stderr, err := run(binPath, "key", "passwd", "--passphrase", "wrong", "--new-passphrase", "new", "CA"); err == nil {
+		t.Fatalf("Expected an error with the wrong passphrase, got %v", stderr)
+	}
+	if data, _ := os.ReadFile(keyPath); string(data) != string(original) {
+		t.Fatal("Key changed after a failed passwd")
+	}
+
+	if _, stderr, err := run(binPath, "key", "passwd", "--passphrase", passphrase, "--new-passphrase", "new", "CA"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if fi, err := os.Stat(keyPath); err != nil || (runtime.GOOS != "windows" && fi.Mode().Perm() != 0400) {
+		t.Fatalf("Key has mode %v, %v", fi.Mode(), err)
+	}
+	if _, stderr, err := run(binPath, "sign", "--passphrase", passphrase, "--CA", "CA", "host"); err == nil {
+		t.Fatalf("Expected an error signing with the old passphrase, got %v", stderr)
+	}
+
+	// An empty new passphrase stores the key unencrypted
+	if _, stderr, err := run(binPath, "key", "passwd", "--passphrase", "new", "--new-passphrase", "", "CA"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if _, stderr, err := run(binPath, "sign", "--CA", "CA", "host"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error signing with the unencrypted key: %v, %v", stderr, err)
+	}
+
+	if _, stderr, err := run(binPath, "key", "passwd", "--new-passphrase", "x", "missing"); err == nil {
+		t.Fatalf("Expected an error changing the passphrase of a missing key, got %v", stderr)
+	}
+}
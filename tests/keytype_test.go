@@ -0,0 +1,60 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyType(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	if _, stderr, err := run(binPath, "init", "--passphrase", "", "--common-name", "CA", "--key-type", "ec:P-384"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	for _, args := range [][]string{
+		{"init", "--passphrase", "", "--common-name", "Other", "--curve", "P-256", "--key-type", "ec:P-384"},
+		{"request-cert", "--passphrase", "", "--common-name", "weak", "--key-type", "rsa:1024"},
+		{"request-cert", "--passphrase", "", "--common-name", "weak", "--curve", "P-224"},
+	} {
+		if _, stderr, err := run(binPath, args...); err == nil || !strings.Contains(stderr, "Invalid key type") {
+			t.Fatalf("Expected an invalid key type error for %v, got %v", args, stderr)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(depotDir, "weak.key")); !os.IsNotExist(err) {
+		t.Fatalf("Expected no weak key to be saved, got %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"request-cert", "--passphrase", "", "--common-name", "host", "--key-type", "rsa:3072"},
+		{"request-cert", "--passphrase", "", "--common-name", "weak", "--key-type", "rsa:1024", "--allow-weak"},
+		{"sign", "--CA", "CA", "host"},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error for %v: %v, %v", args, stderr, err)
+		}
+	}
+
+	ca := readCertificate(t, "CA.crt")
+	if pub, ok := ca.PublicKey.(*ecdsa.PublicKey); !ok || pub.Curve != elliptic.P384() {
+		t.Fatalf("Expected a P-384 CA key, got %T", ca.PublicKey)
+	}
+	if pub, ok := readCertificate(t, "host.crt").PublicKey.(*rsa.PublicKey); !ok || pub.N.BitLen() != 3072 {
+		t.Fatalf("Expected a 3072 bit RSA host key")
+	}
+
+	if _, stderr, err := run(binPath, "sign", "--CA", "CA", "weak"); err == nil || !strings.Contains(stderr, "weak key type: rsa:1024") {
+		t.Fatalf("Expected an error signing a request with a weak key, got %v", stderr)
+	}
+	if _, stderr, err := run(binPath, "sign", "--CA", "CA", "--allow-weak", "weak"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+}
@@ -0,0 +1,35 @@
+//go:build integration && go1.27
+// +build integration,go1.27
+
+package tests
+
+import (
+	"crypto/x509"
+	"os"
+	"testing"
+)
+
+func TestMLDSA(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	for _, args := range [][]string{
+		{"init", "--passphrase", passphrase, "--common-name", "CA", "--key-type", "mldsa:65"},
+		{"request-cert", "--passphrase", "", "--common-name", "host", "--curve", "ML-DSA-44"},
+		{"sign", "--passphrase", passphrase, "--CA", "CA", "host"},
+		{"revoke", "--passphrase", passphrase, "--CA", "CA", "--CN", "host"},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error for %v: %v, %v", args, stderr, err)
+		}
+	}
+
+	ca := readCertificate(t, "CA.crt")
+	host := readCertificate(t, "host.crt")
+	if host.PublicKeyAlgorithm != x509.MLDSA || host.SignatureAlgorithm != x509.MLDSA65 {
+		t.Fatalf("Expected an ML-DSA certificate signed with ML-DSA-65, got %v, %v", host.PublicKeyAlgorithm, host.SignatureAlgorithm)
+	}
+	if err := host.CheckSignatureFrom(ca); err != nil {
+		t.Fatalf("Failed verifying host certificate: %v", err)
+	}
+}
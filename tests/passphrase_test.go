@@ -0,0 +1,48 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPassphraseSources(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+	file := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(file, []byte(passphrase+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(binPath, "--depot-path", depotDir, "init", "--passphrase-env", "CERTSTRAP_TEST_PASSPHRASE", "--common-name", "CA", "--curve", "P-256")
+	cmd.Env = append(os.Environ(), "CERTSTRAP_TEST_PASSPHRASE="+passphrase)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Received unexpected error: %v, %s", err, out)
+	}
+	if _, stderr, err := runWithStdin(strings.NewReader("keypass\n"), binPath, "request-cert", "--passphrase-fd", "0", "--common-name", "host", "--curve", "P-256"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if _, stderr, err := run(binPath, "sign", "--passphrase-file", file, "--CA", "CA", "host"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if _, stderr, err := run(binPath, "revoke", "--passphrase-cmd", "cat "+file, "--CA", "CA", "--CN", "host"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if _, stderr, err := run(binPath, "export", "--format", "k8s-secret", "--passphrase", "keypass", "host"); err != nil {
+		t.Fatalf("Key is not encrypted with the passphrase read from stdin: %v, %v", stderr, err)
+	}
+
+	// Without a terminal, commands fail rather than prompting
+	_, stderr, err := runWithStdin(strings.NewReader(""), binPath, "init", "--common-name", "CA2")
+	if err == nil || !strings.Contains(stderr, "not a terminal") || !strings.Contains(stderr, "--passphrase-file") {
+		t.Fatalf("Expected an error prompting without a terminal, got %v, %v", stderr, err)
+	}
+	if _, stderr, err := run(binPath, "sign", "--passphrase", passphrase, "--passphrase-file", file, "--CA", "CA", "host"); err == nil {
+		t.Fatalf("Expected an error giving two passphrases, got %v", stderr)
+	}
+}
@@ -0,0 +1,74 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"crypto/x509"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPublish(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	for _, args := range [][]string{
+		{"init", "--passphrase", passphrase, "--common-name", "Publish CA"},
+		{"request-cert", "--passphrase", "", "--common-name", "host"},
+		{"sign", "--passphrase", passphrase, "--CA", "Publish CA", "host"},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+		}
+	}
+
+	dir := filepath.Join(depotDir, "public")
+	if _, stderr, err := run(binPath, "publish", "export", "--dir", dir); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	for _, name := range []string{"Publish_CA.crt", "Publish_CA.crt.pem", "Publish_CA.crl", "Publish_CA.crl.pem"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("Export did not write %s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "host.crt")); !os.IsNotExist(err) {
+		t.Fatal("Export wrote a host certificate")
+	}
+
+	addr := freeAddr(t)
+	url := "http://" + addr + "/Publish_CA.crl"
+	startServer(t, http.DefaultClient, url, "publish", "serve", "--listen", addr)
+
+	revoked := func() int {
+		res, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if ct := res.Header.Get("Content-Type"); ct != "application/pkix-crl" {
+			t.Fatalf("CRL served with content type %q", ct)
+		}
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := x509.ParseDERCRL(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(list.TBSCertList.RevokedCertificates)
+	}
+	if n := revoked(); n != 0 {
+		t.Fatalf("CRL has %d revoked certificates, want 0", n)
+	}
+	if _, stderr, err := run(binPath, "revoke", "--passphrase", passphrase, "--CA", "Publish CA", "--CN", "host"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if n := revoked(); n != 1 {
+		t.Fatalf("CRL served after revoke has %d revoked certificates, want 1", n)
+	}
+}
@@ -0,0 +1,162 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenew(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	for _, args := range [][]string{
+		{"init", "--passphrase", passphrase, "--common-name", "CA", "--curve", "P-256"},
+		{"request-cert", "--passphrase", "", "--common-name", hostname, "--domain", "host1.example.com", "--curve", "P-256"},
+		{"sign", "--passphrase", passphrase, "--CA", "CA", hostname},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+		}
+	}
+	old := readCertificate(t, hostname+".crt")
+
+	// Renew reusing the stored CSR
+	stdout, stderr, err := run(binPath, "renew", "--passphrase", passphrase, "--CA", "CA", hostname)
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if !strings.Contains(stdout, "Archived") || !strings.Contains(stdout, "Renewed") {
+		t.Fatalf("Received incorrect output: %v", stdout)
+	}
+
+	renewed := readCertificate(t, hostname+".crt")
+	if renewed.SerialNumber.Cmp(old.SerialNumber) == 0 {
+		t.Fatal("Renewed certificate has the same serial number")
+	}
+	if !bytes.Equal(renewed.RawSubject, old.RawSubject) || len(renewed.DNSNames) != 1 || renewed.DNSNames[0] != "host1.example.com" {
+		t.Fatal("Renewed certificate does not preserve subject and SANs")
+	}
+	archived := readCertificate(t, filepath.Join("archive", fmt.Sprintf("%s.%X.crt", hostname, old.SerialNumber)))
+	if !bytes.Equal(archived.Raw, old.Raw) {
+		t.Fatal("Archived certificate differs from the old certificate")
+	}
+
+	// Renew with a fresh key, superseding the previous certificate
+	stdout, stderr, err = run(binPath, "renew", "--passphrase", passphrase, "--key-passphrase", "", "--CA", "CA", "--rekey", "--supersede", hostname)
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if strings.Count(stdout, "Created") != 2 {
+		t.Fatalf("Received incorrect output: %v", stdout)
+	}
+
+	rekeyed := readCertificate(t, hostname+".crt")
+	if bytes.Equal(rekeyed.RawSubjectPublicKeyInfo, renewed.RawSubjectPublicKeyInfo) {
+		t.Fatal("Rekeyed certificate has the same public key")
+	}
+	if rekeyed.PublicKeyAlgorithm != x509.ECDSA {
+		t.Fatalf("Rekeyed certificate algorithm = %v, want ECDSA", rekeyed.PublicKeyAlgorithm)
+	}
+
+	crlBytes, err := os.ReadFile(filepath.Join(depotDir, "CA.crl"))
+	if err != nil {
+		t.Fatalf("Reading CRL failed: %v", err)
+	}
+	block, _ := pem.Decode(crlBytes)
+	crl, err := x509.ParseCRL(block.Bytes)
+	if err != nil {
+		t.Fatalf("Parsing CRL failed: %v", err)
+	}
+	revoked := crl.TBSCertList.RevokedCertificates
+	if len(revoked) != 1 || revoked[0].SerialNumber.Cmp(renewed.SerialNumber) != 0 {
+		t.Fatalf("Expected superseded certificate in CRL, got %v", revoked)
+	}
+
+	stdout, stderr, err = run(binPath, "log", "--CA", "CA", "--current", "--json")
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if strings.Count(stdout, `"status":"issued"`) != 2 || strings.Count(stdout, `"status":"superseded"`) != 1 {
+		t.Fatalf("Received incorrect log: %v", stdout)
+	}
+}
+
+func TestRenewCA(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	if _, stderr, err := run(binPath, "init", "--passphrase", passphrase, "--common-name", "CA", "--curve", "P-256", "--permit-domain", "example.com",
+		"--spiffe-trust-domain", "example.org"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	old := readCertificate(t, "CA.crt")
+
+	// A renewal that fails, here for want of a passphrase for the new key, leaves the depot as it was
+	_, stderr, err := run(binPath, "renew", "--passphrase", passphrase, "--CA", "CA", "--rekey", "CA")
+	if err == nil || !strings.Contains(stderr, "not a terminal") {
+		t.Fatalf("Expected renewal without a key passphrase to fail, got %v, %v", stderr, err)
+	}
+	if _, err := os.Stat(filepath.Join(depotDir, "archive")); !os.IsNotExist(err) {
+		t.Fatalf("Failed renewal archived the old certificate: %v", err)
+	}
+	if crt := readCertificate(t, "CA.crt"); !bytes.Equal(crt.Raw, old.Raw) {
+		t.Fatal("Failed renewal replaced the certificate")
+	}
+
+	// The passphrase of the renewed key can come from any of the passphrase sources
+	keyPassFile := filepath.Join(depotDir, "key-passphrase")
+	if err := os.WriteFile(keyPassFile, []byte(passphrase+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, err := run(binPath, "renew", "--passphrase", passphrase, "--key-passphrase-file", keyPassFile, "--CA", "CA", "CA"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	renewed := readCertificate(t, "CA.crt")
+	if !renewed.IsCA || len(renewed.PermittedDNSDomains) != 1 || renewed.PermittedDNSDomains[0] != "example.com" || renewed.PermittedDNSDomainsCritical != old.PermittedDNSDomainsCritical {
+		t.Fatalf("Renewed CA does not keep the name constraints: %v", renewed.PermittedDNSDomains)
+	}
+	if len(renewed.PermittedURIDomains) != 1 || renewed.PermittedURIDomains[0] != "example.org" {
+		t.Fatalf("Renewed CA does not keep the SPIFFE trust domain: %v", renewed.PermittedURIDomains)
+	}
+}
+
+func TestRenewSVID(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	for _, args := range [][]string{
+		{"init", "--passphrase", passphrase, "--common-name", "CA", "--curve", "P-256", "--spiffe-trust-domain", "example.org"},
+		{"request-cert", "--passphrase", "", "--common-name", "web", "--spiffe-id", "spiffe://example.org/web", "--curve", "P-256"},
+		{"sign", "--passphrase", passphrase, "--CA", "CA", "--profile", "svid", "web"},
+		{"renew", "--passphrase", passphrase, "--CA", "CA", "--signature-algorithm", "ECDSA-SHA384", "web"},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+		}
+	}
+
+	// The renewed certificate is still an X509-SVID, signed with the requested algorithm
+	renewed := readCertificate(t, "web.crt")
+	if len(renewed.URIs) != 1 || renewed.URIs[0].String() != "spiffe://example.org/web" || renewed.KeyUsage != x509.KeyUsageDigitalSignature {
+		t.Fatalf("Renewed certificate is not an X509-SVID: %v, %v", renewed.URIs, renewed.KeyUsage)
+	}
+	if renewed.SignatureAlgorithm != x509.ECDSAWithSHA384 {
+		t.Fatalf("Renewed certificate is signed with %v, want ECDSA-SHA384", renewed.SignatureAlgorithm)
+	}
+	index, err := os.ReadFile(filepath.Join(depotDir, "CA.index"))
+	if err != nil {
+		t.Fatalf("Reading CA index failed: %v", err)
+	}
+	if !strings.Contains(string(index), fmt.Sprintf("%X", renewed.SerialNumber)) {
+		t.Fatalf("CA index does not record the renewed certificate: %s", index)
+	}
+}
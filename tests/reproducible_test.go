@@ -0,0 +1,81 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReproducible(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	fixed := []string{"--now", "2020-01-02T03:04:05Z", "--seed", "fixture"}
+	create := func() map[string][]byte {
+		os.RemoveAll(depotDir)
+		for _, args := range [][]string{
+			{"init", "--passphrase", passphrase, "--common-name", "CA", "--key-type", "ed25519"},
+			{"request-cert", "--passphrase", "", "--common-name", hostname, "--key-type", "ed25519"},
+			{"sign", "--passphrase", passphrase, "--CA", "CA", hostname},
+			{"revoke", "--passphrase", passphrase, "--CA", "CA", "--CN", hostname},
+		} {
+			if _, stderr, err := run(binPath, append(fixed, args...)...); stderr != "" || err != nil {
+				t.Fatalf("Received unexpected error for %v: %v, %v", args, stderr, err)
+			}
+		}
+		files := map[string][]byte{}
+		entries, err := os.ReadDir(depotDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			b, err := os.ReadFile(filepath.Join(depotDir, entry.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[entry.Name()] = b
+		}
+		return files
+	}
+
+	first, second := create(), create()
+	if len(first) != len(second) {
+		t.Fatalf("Expected the same files, got %d and %d", len(first), len(second))
+	}
+	for name, b := range first {
+		if !bytes.Equal(b, second[name]) {
+			t.Errorf("Expected %s to be the same", name)
+		}
+	}
+
+	host := readCertificate(t, hostname+".crt")
+	if want := time.Date(2020, 1, 2, 2, 54, 5, 0, time.UTC); !host.NotBefore.Equal(want) {
+		t.Fatalf("Expected the certificate valid from %v, got %v", want, host.NotBefore)
+	}
+
+	if _, stderr, err := run(binPath, "--now", "yesterday", "init", "--passphrase", "", "--common-name", "Other"); err == nil || stderr == "" {
+		t.Fatal("Expected an error for an invalid --now")
+	}
+
+	// Servers and the agent would hand out predictable serial numbers and nonces
+	for _, args := range [][]string{
+		{"serve", "--CA", "CA"},
+		{"acme", "serve", "--CA", "CA"},
+		{"est", "serve", "--CA", "CA"},
+		{"scep", "serve", "--CA", "CA"},
+		{"agent", "--CA", "CA", "--once"},
+	} {
+		if _, stderr, err := run(binPath, append([]string{"--seed", "fixture"}, args...)...); err == nil || !strings.Contains(stderr, "--seed") {
+			t.Fatalf("Expected %v to refuse --seed, got %v, %v", args, stderr, err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRotateCA(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	for _, args := range [][]string{
+		{"init", "--passphrase", passphrase, "--common-name", "OldCA", "--organization", "certstrap", "--curve", "P-256", "--path-length", "1"},
+		{"request-cert", "--passphrase", "", "--common-name", hostname, "--domain", "host1.example.com", "--curve", "P-256"},
+		{"sign", "--passphrase", passphrase, "--CA", "OldCA", hostname},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+		}
+	}
+
+	// The old CA passphrase can come from any of the passphrase sources
+	passFile := filepath.Join(depotDir, "old-ca-passphrase")
+	if err := os.WriteFile(passFile, []byte(passphrase+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, err := run(binPath, "rotate-ca", "--CA", "OldCA", "--ca-passphrase-file", passFile, "--passphrase", passphrase, "--common-name", "NewCA", "--curve", "P-256")
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if strings.Count(stdout, "Created") != 6 {
+		t.Fatalf("Received incorrect create: %v", stdout)
+	}
+
+	oldCA := readCertificate(t, "OldCA.crt")
+	newCA := readCertificate(t, "NewCA.crt")
+	if len(newCA.Subject.Organization) != 1 || newCA.Subject.Organization[0] != "certstrap" {
+		t.Fatalf("New CA does not keep the subject of the old CA: %v", newCA.Subject)
+	}
+	newByOld := readCertificate(t, "NewCA-cross-OldCA.crt")
+	oldByNew := readCertificate(t, "OldCA-cross-NewCA.crt")
+	leaf := readCertificate(t, hostname+".crt")
+
+	// A leaf of the old CA validates for clients that only trust the new CA...
+	roots := x509.NewCertPool()
+	roots.AddCert(newCA)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(oldByNew)
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, DNSName: "host1.example.com"}); err != nil {
+		t.Fatalf("Old leaf does not chain to the new CA: %v", err)
+	}
+
+	// ...and the new CA validates for clients that only trust the old CA.
+	roots = x509.NewCertPool()
+	roots.AddCert(oldCA)
+	if _, err := newByOld.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		t.Fatalf("New CA does not chain to the old CA: %v", err)
+	}
+
+	bundle, err := os.ReadFile(filepath.Join(depotDir, "NewCA.bundle.pem"))
+	if err != nil {
+		t.Fatalf("Reading bundle failed: %v", err)
+	}
+	if strings.Count(string(bundle), "BEGIN CERTIFICATE") != 2 {
+		t.Fatalf("Expected both CA certificates in the trust bundle, got: %s", bundle)
+	}
+}
+
+func TestRotateConstrainedCA(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	for _, args := range [][]string{
+		{"init", "--passphrase", passphrase, "--common-name", "OldCA", "--curve", "P-256", "--path-length", "1", "--permit-domain", "example.com", "--spiffe-trust-domain", "example.org"},
+		{"rotate-ca", "--CA", "OldCA", "--ca-passphrase", passphrase, "--passphrase", passphrase, "--common-name", "NewCA", "--curve", "P-256"},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+		}
+	}
+
+	// The new CA and both cross-signed certificates are as constrained as the old CA
+	oldCA := readCertificate(t, "OldCA.crt")
+	for _, name := range []string{"NewCA.crt", "NewCA-cross-OldCA.crt", "OldCA-cross-NewCA.crt"} {
+		crt := readCertificate(t, name)
+		if !reflect.DeepEqual(crt.PermittedDNSDomains, oldCA.PermittedDNSDomains) || !reflect.DeepEqual(crt.PermittedURIDomains, oldCA.PermittedURIDomains) ||
+			crt.PermittedDNSDomainsCritical != oldCA.PermittedDNSDomainsCritical {
+			t.Fatalf("%s does not keep the name constraints of the old CA: %v, %v", name, crt.PermittedDNSDomains, crt.PermittedURIDomains)
+		}
+	}
+}
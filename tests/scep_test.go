@@ -0,0 +1,212 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/certstrap/pkcs7"
+)
+
+var (
+	oidSCEPMessageType   = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 2}
+	oidSCEPPKIStatus     = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 3}
+	oidSCEPSenderNonce   = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 5}
+	oidSCEPTransactionID = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 7}
+)
+
+// challengeCSR creates a certificate request for cn carrying a challengePassword attribute
+func challengeCSR(t *testing.T, key *rsa.PrivateKey, cn, challenge string) []byte {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn}}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := asn1.Marshal(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attr, err := asn1.Marshal(struct {
+		Type   asn1.ObjectIdentifier
+		Values []asn1.RawValue `asn1:"set"`
+	}{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}, []asn1.RawValue{{FullBytes: value}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbs, err := asn1.Marshal(struct {
+		Version    int
+		Subject    asn1.RawValue
+		PublicKey  asn1.RawValue
+		Attributes asn1.RawValue
+	}{
+		Subject:    asn1.RawValue{FullBytes: csr.RawSubject},
+		PublicKey:  asn1.RawValue{FullBytes: csr.RawSubjectPublicKeyInfo},
+		Attributes: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attr},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(tbs)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err = asn1.Marshal(struct {
+		TBS       asn1.RawValue
+		Algorithm pkix.AlgorithmIdentifier
+		Signature asn1.BitString
+	}{
+		TBS:       asn1.RawValue{FullBytes: tbs},
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, Parameters: asn1.NullRawValue},
+		Signature: asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestSCEPServe(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	if _, stderr, err := run(binPath, "init", "--passphrase", passphrase, "--common-name", "SCEP CA", "--key-bits", "2048"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+
+	challengeFile := filepath.Join(depotDir, "challenge")
+	if err := os.WriteFile(challengeFile, []byte("enroll-me\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := freeAddr(t)
+	url := "http://" + addr + "/scep"
+	startServer(t, http.DefaultClient, url+"?operation=GetCACaps", "scep", "serve", "--CA", "SCEP CA", "--passphrase", passphrase,
+		"--listen", addr, "--challenge-password-file", challengeFile)
+
+	res, err := http.Get(url + "?operation=GetCACert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(body)
+	if err != nil {
+		t.Fatalf("Parsing GetCACert response failed: %v", err)
+	}
+	if !ca.Equal(readCertificate(t, "SCEP_CA.crt")) {
+		t.Fatal("GetCACert did not return the CA certificate")
+	}
+
+	// Devices sign their first request with a self-signed certificate
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ipad-0042"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	self, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enroll := func(challenge string) *pkcs7.SignedMessage {
+		enveloped, err := pkcs7.Encrypt(rand.Reader, challengeCSR(t, key, "ipad-0042", challenge), []*x509.Certificate{ca}, pkcs7.EncryptionAlgorithmAES256CBC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := pkcs7.Sign(rand.Reader, enveloped, self, key, []pkcs7.Attribute{
+			{Type: oidSCEPTransactionID, Value: "ipad-0042-enroll"},
+			{Type: oidSCEPMessageType, Value: "19"},
+			{Type: oidSCEPSenderNonce, Value: []byte("0123456789abcdef")},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.Post(url+"?operation=PKIOperation", "application/x-pki-message", bytes.NewReader(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("PKIOperation failed: %s: %s", res.Status, body)
+		}
+		reply, err := pkcs7.Verify(body)
+		if err != nil {
+			t.Fatalf("Verifying reply failed: %v", err)
+		}
+		return reply
+	}
+
+	var status string
+	if err := enroll("wrong").UnmarshalAttribute(oidSCEPPKIStatus, &status); err != nil || status != "2" {
+		t.Fatalf("Enrolling with a wrong challenge: got pkiStatus %q, %v, want failure", status, err)
+	}
+
+	reply := enroll("enroll-me")
+	if err := reply.UnmarshalAttribute(oidSCEPPKIStatus, &status); err != nil || status != "0" {
+		t.Fatalf("Enrolling: got pkiStatus %q, %v, want success", status, err)
+	}
+	env, err := pkcs7.ParseEnvelopedData(reply.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	degenerate, err := env.Decrypt(rand.Reader, self, key)
+	if err != nil {
+		t.Fatalf("Decrypting reply failed: %v", err)
+	}
+	sd, err := pkcs7.ParseSignedData(degenerate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := x509.ParseCertificate(sd.Certificates[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crt.CheckSignatureFrom(ca); err != nil {
+		t.Fatalf("Enrolled certificate is not signed by the CA: %v", err)
+	}
+
+	index, err := os.ReadFile(filepath.Join(depotDir, "SCEP_CA.index"))
+	if err != nil {
+		t.Fatalf("Reading CA index failed: %v", err)
+	}
+	if !strings.Contains(string(index), fmt.Sprintf(`"name":"%X"`, crt.SerialNumber)) {
+		t.Fatalf("CA index does not record the enrolled certificate: %s", index)
+	}
+}
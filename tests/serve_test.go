@@ -0,0 +1,114 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	certpkix "github.com/square/certstrap/pkix"
+)
+
+func TestServe(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	for _, args := range [][]string{
+		{"init", "--passphrase", passphrase, "--common-name", "API CA", "--curve", "P-256"},
+		{"request-cert", "--passphrase", "", "--common-name", "api-server", "--ip", "127.0.0.1", "--curve", "P-256"},
+		{"sign", "--passphrase", passphrase, "--CA", "API CA", "api-server"},
+		{"request-cert", "--passphrase", "", "--common-name", "app.ci.example.com", "--curve", "P-256"},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+		}
+	}
+	policies := filepath.Join(depotDir, "api-policy.json")
+	if err := os.WriteFile(policies, []byte(`{"clients": [
+		{"name": "ci", "token": "ci-token", "domains": ["ci.example.com"], "max_expires": "90 days", "revoke": true}
+	]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(readCertificate(t, "API_CA.crt"))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	addr := freeAddr(t)
+	url := "https://" + addr + "/v1/"
+	startServer(t, client, url+"chain", "serve", "--CA", "API CA", "--passphrase", passphrase, "--listen", addr,
+		"--tls-cert", filepath.Join(depotDir, "api-server.crt"), "--tls-key", filepath.Join(depotDir, "api-server.key"),
+		"--policy-file", policies)
+
+	post := func(op string, body interface{}) (*http.Response, []byte) {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(http.MethodPost, url+op, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer ci-token")
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, err = io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, data
+	}
+
+	csr, err := os.ReadFile(filepath.Join(depotDir, "app.ci.example.com.csr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, body := post("sign", map[string]string{"csr": string(csr), "expires": "1 year"}); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("Signing beyond max_expires: got %s, want 403: %s", res.Status, body)
+	}
+	res, body := post("sign", map[string]string{"csr": string(csr), "expires": "30 days"})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Signing failed: %s: %s", res.Status, body)
+	}
+	var signed struct {
+		Name        string `json:"name"`
+		Certificate string `json:"certificate"`
+	}
+	if err := json.Unmarshal(body, &signed); err != nil {
+		t.Fatal(err)
+	}
+	crt, err := certpkix.NewCertificateFromPEM([]byte(signed.Certificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := crt.GetRawCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := raw.CheckSignatureFrom(readCertificate(t, "API_CA.crt")); err != nil {
+		t.Fatalf("Signed certificate is not signed by the CA: %v", err)
+	}
+
+	if res, body := post("revoke", map[string]string{"name": signed.Name}); res.StatusCode != http.StatusOK {
+		t.Fatalf("Revoking failed: %s: %s", res.Status, body)
+	}
+	stdout, stderr, err := run(binPath, "log", "--CA", "API CA", "--current")
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if !strings.Contains(stdout, "revoked") || !strings.Contains(stdout, "app.ci.example.com") || !strings.Contains(stdout, " ci ") {
+		t.Fatalf("CA index does not record the revocation by the API client: %s", stdout)
+	}
+}
@@ -0,0 +1,76 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignatureAlgorithm(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	if _, stderr, err := run(binPath, "init", "--passphrase", "", "--common-name", "CA", "--key-bits", "2048", "--signature-algorithm", "MD5-RSA"); err == nil || !strings.Contains(stderr, "unknown signature algorithm") {
+		t.Fatalf("Expected an error for an unknown signature algorithm, got %v", stderr)
+	}
+	if _, stderr, err := run(binPath, "init", "--passphrase", "", "--common-name", "CA", "--curve", "P-256", "--signature-algorithm", "SHA256-RSAPSS"); err == nil || !strings.Contains(stderr, "requires an RSA key") {
+		t.Fatalf("Expected an error for a signature algorithm not matching the key, got %v", stderr)
+	}
+	if _, err := os.Stat(filepath.Join(depotDir, "CA.key")); !os.IsNotExist(err) {
+		t.Fatalf("Expected no key to be saved, got %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"init", "--passphrase", "", "--common-name", "CA", "--key-bits", "2048", "--signature-algorithm", "SHA384-RSAPSS"},
+		{"request-cert", "--passphrase", "", "--common-name", "host", "--key-bits", "2048", "--signature-algorithm", "SHA256-RSAPSS"},
+		{"request-cert", "--passphrase", "", "--common-name", "ed", "--curve", "Ed25519", "--signature-algorithm", "Ed25519"},
+		{"sign", "--CA", "CA", "--signature-algorithm", "sha512-rsapss", "host"},
+		{"sign", "--CA", "CA", "ed"},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error for %v: %v, %v", args, stderr, err)
+		}
+	}
+
+	ca := readCertificate(t, "CA.crt")
+	if ca.SignatureAlgorithm != x509.SHA384WithRSAPSS {
+		t.Fatalf("Expected CA signed with SHA384-RSAPSS, got %v", ca.SignatureAlgorithm)
+	}
+	host := readCertificate(t, "host.crt")
+	if host.SignatureAlgorithm != x509.SHA512WithRSAPSS {
+		t.Fatalf("Expected host signed with SHA512-RSAPSS, got %v", host.SignatureAlgorithm)
+	}
+	if err := host.CheckSignatureFrom(ca); err != nil {
+		t.Fatalf("Failed verifying host certificate: %v", err)
+	}
+	// Without the flag, the default of the CA key is used
+	if ed := readCertificate(t, "ed.crt"); ed.SignatureAlgorithm != x509.SHA256WithRSA {
+		t.Fatalf("Expected ed signed with SHA256-RSA, got %v", ed.SignatureAlgorithm)
+	}
+
+	b, err := os.ReadFile(filepath.Join(depotDir, "host.csr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(b)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csr.SignatureAlgorithm != x509.SHA256WithRSAPSS {
+		t.Fatalf("Expected request signed with SHA256-RSAPSS, got %v", csr.SignatureAlgorithm)
+	}
+
+	if _, stderr, err := run(binPath, "request-cert", "--passphrase", "", "--common-name", "other", "--curve", "P-256"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if _, stderr, err := run(binPath, "sign", "--CA", "CA", "--signature-algorithm", "ECDSA-SHA256", "other"); err == nil || !strings.Contains(stderr, "requires an ECDSA key") {
+		t.Fatalf("Expected an error signing with an algorithm not matching the CA key, got %v", stderr)
+	}
+}
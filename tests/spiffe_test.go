@@ -0,0 +1,65 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestSPIFFE(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	for _, args := range [][]string{
+		{"init", "--passphrase", passphrase, "--common-name", "SPIFFE CA", "--spiffe-trust-domain", "example.org", "--curve", "P-256"},
+		{"request-cert", "--passphrase", "", "--spiffe-id", "spiffe://example.org/ns/web", "--curve", "P-256"},
+		{"sign", "--passphrase", passphrase, "--CA", "SPIFFE CA", "--profile", "svid", "spiffe_example.org_ns_web"},
+		{"request-cert", "--passphrase", "", "--spiffe-id", "spiffe://other.org/web", "--curve", "P-256"},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+		}
+	}
+
+	ca := readCertificate(t, "SPIFFE_CA.crt")
+	if len(ca.PermittedURIDomains) != 1 || ca.PermittedURIDomains[0] != "example.org" {
+		t.Fatalf("CA has URI name constraints %v", ca.PermittedURIDomains)
+	}
+	svid := readCertificate(t, "spiffe_example.org_ns_web.crt")
+	if len(svid.URIs) != 1 || svid.URIs[0].String() != "spiffe://example.org/ns/web" || svid.Subject.CommonName != "" {
+		t.Fatalf("SVID has URIs %v and common name %q", svid.URIs, svid.Subject.CommonName)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	if _, err := svid.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Fatal("SVID does not verify:", err)
+	}
+
+	if _, stderr, err := run(binPath, "sign", "--passphrase", passphrase, "--CA", "SPIFFE CA", "--profile", "svid", "spiffe_other.org_web"); err == nil {
+		t.Fatalf("Expected an error signing an SVID outside the trust domain, got %v", stderr)
+	}
+	if _, stderr, err := run(binPath, "request-cert", "--passphrase", "", "--spiffe-id", "spiffe://example.org/a", "--uri", "spiffe://example.org/b"); err == nil {
+		t.Fatalf("Expected an error requesting an SVID with two URIs, got %v", stderr)
+	}
+
+	stdout, stderr, err := run(binPath, "export", "bundle", "--format", "spiffe")
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	var bundle struct {
+		Keys []struct {
+			Use string   `json:"use"`
+			X5c []string `json:"x5c"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &bundle); err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle.Keys) != 1 || bundle.Keys[0].Use != "x509-svid" || len(bundle.Keys[0].X5c) != 1 {
+		t.Fatalf("Unexpected SPIFFE bundle %s", stdout)
+	}
+}
@@ -0,0 +1,100 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestInitSplit(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+
+	stdout, stderr, err := run(binPath, "init", "--split", "2/3", "--common-name", "CA", "--curve", "P-256")
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	shares := regexp.MustCompile(`(?m)^Share \d of 3: ([0-9a-f]+)$`).FindAllStringSubmatch(stdout, -1)
+	if len(shares) != 3 {
+		t.Fatalf("Expected 3 shares, got %v", stdout)
+	}
+	share := func(i int) string { return filepath.Join(depotDir, fmt.Sprintf("share%d", i)) }
+	for i, match := range shares {
+		if err := os.WriteFile(share(i+1), []byte(match[1]+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, stderr, err := run(binPath, "request-cert", "--passphrase", "", "--common-name", "host"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	// One share is not enough, and the CA key cannot be used without shares
+	if _, stderr, err := run(binPath, "sign", "--share-file", share(1), "--CA", "CA", "host"); err == nil || !strings.Contains(stderr, "2 of the 3 shares") {
+		t.Fatalf("Expected an error signing with one share, got %v", stderr)
+	}
+	if _, stderr, err := run(binPath, "sign", "--CA", "CA", "host"); err == nil || !strings.Contains(stderr, "--share-file") {
+		t.Fatalf("Expected an error signing without shares, got %v", stderr)
+	}
+	if _, stderr, err := run(binPath, "sign", "--share-file", share(3), "--share-file", share(1), "--CA", "CA", "host"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if _, stderr, err := run(binPath, "revoke", "--share-file", share(2), "--share-file", share(3), "--CA", "CA", "--CN", "host"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	// Exports holding the key take the shares too
+	if _, stderr, err := run(binPath, "export", "--format", "jks", "--store-password", "changeit", "--out", filepath.Join(depotDir, "ca.jks"),
+		"--share-file", share(1), "--share-file", share(2), "CA"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if stdout, stderr, err := run(binPath, "export", "--format", "k8s-ca-secret", "--share-file", share(1), "--share-file", share(3), "CA"); stderr != "" || err != nil || !strings.Contains(stdout, "tls.key:") {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+
+	// Changing the passphrase of the key undoes the split
+	if _, stderr, err := run(binPath, "key", "passwd", "--share-file", share(1), "--share-file", share(2), "--new-passphrase", passphrase, "CA"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if _, err := os.Stat(filepath.Join(depotDir, "CA.split")); !os.IsNotExist(err) {
+		t.Fatalf("Expected the split record to be deleted, got %v", err)
+	}
+	if _, stderr, err := run(binPath, "revoke", "--passphrase", passphrase, "--CA", "CA", "--CN", "host"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+}
+
+func TestInitSplitShareDir(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+	shareDir := filepath.Join(depotDir, "shares")
+
+	if _, stderr, err := run(binPath, "init", "--split", "2/3", "--passphrase", passphrase, "--common-name", "CA"); err == nil {
+		t.Fatalf("Expected an error splitting a given passphrase, got %v", stderr)
+	}
+	if _, stderr, err := run(binPath, "init", "--split", "1/3", "--common-name", "CA"); err == nil {
+		t.Fatalf("Expected an error splitting with a threshold of 1, got %v", stderr)
+	}
+
+	stdout, stderr, err := run(binPath, "init", "--split", "3/4", "--share-dir", shareDir, "--common-name", "CA", "--curve", "P-256")
+	if stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	if strings.Contains(stdout, "Share 1") {
+		t.Fatalf("Expected the shares not to be printed, got %v", stdout)
+	}
+	if _, stderr, err := run(binPath, "request-cert", "--passphrase", "", "--common-name", "host"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	args := []string{"sign", "--CA", "CA", "host"}
+	for _, i := range []string{"4", "2", "1"} {
+		args = append(args, "--share-file", filepath.Join(shareDir, "CA.share-"+i))
+	}
+	if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+}
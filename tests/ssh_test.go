@@ -0,0 +1,89 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSSH(t *testing.T) {
+	os.RemoveAll(depotDir)
+	defer os.RemoveAll(depotDir)
+	keygen, err := exec.LookPath("ssh-keygen")
+	if err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"alice", "bob", "host"} {
+		if out, err := exec.Command(keygen, "-q", "-t", "ed25519", "-N", "", "-f", filepath.Join(dir, name)).CombinedOutput(); err != nil {
+			t.Fatalf("ssh-keygen error: %v, %s", err, out)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"ssh", "init", "--passphrase", passphrase, "--curve", "P-256", "SSH CA"},
+		{"ssh", "sign-user", "--passphrase", passphrase, "--CA", "SSH CA", "--principals", "alice,deploy",
+			"--critical-option", "source-address=10.0.0.0/8", "--extension", "login@example.com=alice", filepath.Join(dir, "alice.pub")},
+		{"ssh", "sign-user", "--passphrase", passphrase, "--CA", "SSH CA", "--principals", "bob", filepath.Join(dir, "bob.pub")},
+		{"ssh", "sign-host", "--passphrase", passphrase, "--CA", "SSH CA", "--principals", "host.example.com",
+			"--out", filepath.Join(dir, "host-cert"), filepath.Join(dir, "host.pub")},
+	} {
+		if _, stderr, err := run(binPath, args...); stderr != "" || err != nil {
+			t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+		}
+	}
+
+	out, err := exec.Command(keygen, "-L", "-f", filepath.Join(dir, "alice-cert.pub")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("ssh-keygen error: %v, %s", err, out)
+	}
+	for _, want := range []string{"user certificate", `Key ID: "alice"`, "deploy", "source-address 10.0.0.0/8", "permit-pty", "login@example.com"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("User certificate does not have %q:\n%s", want, out)
+		}
+	}
+	out, err = exec.Command(keygen, "-L", "-f", filepath.Join(dir, "host-cert")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("ssh-keygen error: %v, %s", err, out)
+	}
+	if !strings.Contains(string(out), "host certificate") || !strings.Contains(string(out), "host.example.com") {
+		t.Errorf("Unexpected host certificate:\n%s", out)
+	}
+
+	krl := filepath.Join(depotDir, "SSH_CA.krl")
+	checkRevoked := func(name string, revoked bool) {
+		t.Helper()
+		out, err := exec.Command(keygen, "-Q", "-f", krl, filepath.Join(dir, name)).CombinedOutput()
+		if (err != nil) != revoked {
+			t.Errorf("ssh-keygen -Q %s: %v, %s", name, err, out)
+		}
+	}
+	checkRevoked("alice-cert.pub", false)
+
+	if _, stderr, err := run(binPath, "ssh", "revoke", "--CA", "SSH CA", filepath.Join(dir, "alice-cert.pub"), filepath.Join(dir, "host.pub")); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	checkRevoked("alice-cert.pub", true)
+	checkRevoked("bob-cert.pub", false)
+	checkRevoked("host-cert", true)
+	checkRevoked("host.pub", true)
+
+	if _, stderr, err := run(binPath, "ssh", "revoke", "--CA", "SSH CA", "--key-id", "bob"); stderr != "" || err != nil {
+		t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+	}
+	checkRevoked("bob-cert.pub", true)
+	checkRevoked("alice-cert.pub", true)
+
+	if _, stderr, err := run(binPath, "ssh", "sign-host", "--passphrase", passphrase, "--CA", "SSH CA", "--principals", "host.example.com", filepath.Join(dir, "host.pub")); err == nil {
+		t.Fatalf("Expected an error signing a revoked key, got %v", stderr)
+	}
+	if _, stderr, err := run(binPath, "ssh", "sign-user", "--passphrase", passphrase, "--CA", "SSH CA", "--critical-option", "permit-pty=", "--principals", "bob", filepath.Join(dir, "bob.pub")); err == nil {
+		t.Fatalf("Expected an error signing with an unknown critical option, got %v", stderr)
+	}
+}
@@ -119,6 +119,14 @@ func TestWorkflow(t *testing.T) {
 			if strings.Count(stdout, hostname) != 0 {
 				t.Fatalf("Received incorrect create: %v", stdout)
 			}
+
+			stdout, stderr, err = run(binPath, "log", "--CA", "CA", "--json", "--name", hostname)
+			if stderr != "" || err != nil {
+				t.Fatalf("Received unexpected error: %v, %v", stderr, err)
+			}
+			if strings.Count(stdout, `"status":"issued"`) != 1 || strings.Count(stdout, `"status":"revoked"`) != 1 {
+				t.Fatalf("Received incorrect log: %v", stdout)
+			}
 		})
 	}
 }